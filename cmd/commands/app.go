@@ -14,6 +14,12 @@ func AppCommand() *cobra.Command {
 	}
 	command.AddCommand(PreviewAppCommand())
 	command.AddCommand(PreviewAppResourcesCommand())
+	command.AddCommand(DiffAppCommand())
+	command.AddCommand(ValidateAppCommand())
+	command.AddCommand(DriftAppCommand())
+	command.AddCommand(SyncPlanAppCommand())
+	command.AddCommand(PredictAppStatusCommand())
+	command.AddCommand(PreviewAppNotificationsCommand())
 	return command
 }
 
@@ -38,8 +44,7 @@ func PreviewAppCommand() *cobra.Command {
 }
 
 func PreviewAppResourcesCommand() *cobra.Command {
-	var kind string
-	var output string
+	var opts preview.RenderOptions
 	command := &cobra.Command{
 		Use:   "preview-resources APPMANIFEST",
 		Short: "Preview Kubernetes resource(s) generated from an Application",
@@ -49,10 +54,149 @@ func PreviewAppResourcesCommand() *cobra.Command {
 				os.Exit(1)
 			}
 			filename := args[0]
-			preview.PreviewApplicationResources(filename, kind, output)
+			preview.PreviewApplicationResources(filename, opts)
 		},
 	}
-	command.Flags().StringVarP(&kind, "kind", "k", "", "Kind of resources to preview")
-	command.Flags().StringVarP(&output, "output", "o", "name", "Output format. One of: name|json|yaml")
+	addRenderFlags(command, &opts)
+	return command
+}
+
+func DiffAppCommand() *cobra.Command {
+	var opts preview.LiveOptions
+	command := &cobra.Command{
+		Use:   "diff APPMANIFEST",
+		Short: "Diff the resources generated from an Application against their live state in Argo CD",
+		Long: `Diff the resources generated from an Application against their live state in Argo CD.
+
+The live state of the resources is fetched from an Argo CD API server, and compared the same way
+'argocd app diff' does. Exits with status 1 when a difference is found.`,
+		Run: func(c *cobra.Command, args []string) {
+			if len(args) == 0 {
+				c.HelpFunc()(c, args)
+				os.Exit(1)
+			}
+			filename := args[0]
+			preview.DiffApplicationLive(filename, opts)
+		},
+	}
+	command.Flags().StringVarP(&opts.AppName, "name", "n", "", "Name of the Application to diff")
+	addLiveFlags(command, &opts)
+	return command
+}
+
+func ValidateAppCommand() *cobra.Command {
+	var opts preview.ValidateOptions
+	command := &cobra.Command{
+		Use:   "validate APPMANIFEST",
+		Short: "Validate the Kubernetes resource(s) generated from an Application",
+		Run: func(c *cobra.Command, args []string) {
+			if len(args) == 0 {
+				c.HelpFunc()(c, args)
+				os.Exit(1)
+			}
+			filename := args[0]
+			preview.ValidateApplications(filename, opts)
+		},
+	}
+	addValidateFlags(command, &opts)
+	return command
+}
+
+func DriftAppCommand() *cobra.Command {
+	var opts preview.DriftOptions
+	command := &cobra.Command{
+		Use:   "drift APPMANIFEST",
+		Short: "Report the drift between the resources generated from an Application and a cluster export",
+		Run: func(c *cobra.Command, args []string) {
+			if len(args) == 0 {
+				c.HelpFunc()(c, args)
+				os.Exit(1)
+			}
+			filename := args[0]
+			preview.DriftApplications(filename, opts)
+		},
+	}
+	addDriftFlags(command, &opts)
+	return command
+}
+
+func SyncPlanAppCommand() *cobra.Command {
+	var opts preview.SyncPlanOptions
+	command := &cobra.Command{
+		Use:   "sync-plan APPMANIFEST",
+		Short: "Print the order in which the child Applications of an app-of-apps would be synced",
+		Long: `Print the order in which the child Applications of an app-of-apps would be synced.
+
+The Applications generated from an Application are grouped by their argocd.argoproj.io/sync-wave annotation:
+Argo CD syncs the waves by increasing number, each once the Applications of the previous waves are healthy.
+The retry strategy of each Application is printed, and the hooks of the rendered ones with their delete policy.
+
+With --resources, the other resources are planned too, along with the kubectl command each would be synced with,
+given the Replace, Force and ServerSideApply options of their argocd.argoproj.io/sync-options annotation and of the
+sync: the resources deleted and recreated rather than patched are flagged.`,
+		Run: func(c *cobra.Command, args []string) {
+			if len(args) == 0 {
+				c.HelpFunc()(c, args)
+				os.Exit(1)
+			}
+			filename := args[0]
+			preview.PlanApplicationSync(filename, opts)
+		},
+	}
+	command.Flags().StringVarP(&opts.AppName, "name", "n", "", "Name of the Application to plan")
+	command.Flags().BoolVarP(&opts.Recursive, "recursive", "r", false,
+		"Also render the child Applications, to plan the Applications they manage in turn")
+	command.Flags().BoolVar(&opts.Resources, "resources", false,
+		"Also plan the other resources, with the kubectl command each would be synced with")
+	command.Flags().StringArrayVar(&opts.SyncOptions, "sync-option", nil,
+		"Sync option overriding the sync policy of the Applications, e.g. Replace=true (can be repeated)")
+	command.Flags().BoolVar(&opts.Force, "force", false, "Plan a forced sync, as argocd app sync --force")
+	return command
+}
+
+func PredictAppStatusCommand() *cobra.Command {
+	var opts preview.StatusOptions
+	command := &cobra.Command{
+		Use:   "predict-status APPMANIFEST",
+		Short: "Print the status Argo CD would report for an Application once synced, as JSON",
+		Long: `Print the status Argo CD would report for an Application once synced, as JSON.
+
+The status has the format of the Application status field: the sync status, the health, and the group, kind,
+namespace, name, sync wave and predicted health of each resource. The health of the resources is assessed from the
+rendered manifests with the health checks of Argo CD, before their controllers report their state.`,
+		Run: func(c *cobra.Command, args []string) {
+			if len(args) == 0 {
+				c.HelpFunc()(c, args)
+				os.Exit(1)
+			}
+			filename := args[0]
+			preview.PredictApplicationStatus(filename, opts)
+		},
+	}
+	command.Flags().StringVarP(&opts.AppName, "name", "n", "", "Name of the Application to predict the status of")
+	return command
+}
+
+func PreviewAppNotificationsCommand() *cobra.Command {
+	var opts preview.NotificationOptions
+	command := &cobra.Command{
+		Use:   "preview-notifications APPMANIFEST",
+		Short: "Print the notifications Argo CD would send for an Application once synced",
+		Long: `Print the notifications Argo CD would send for an Application once synced.
+
+The triggers of argocd-notifications-cm are evaluated on the Application with the status predicted by
+predict-status, after a sync operation in the given phase, and the templates of the triggered conditions are
+formatted for each destination subscribed to the trigger, by the annotations of the Application or the
+subscriptions of the ConfigMap.`,
+		Run: func(c *cobra.Command, args []string) {
+			if len(args) == 0 {
+				c.HelpFunc()(c, args)
+				os.Exit(1)
+			}
+			filename := args[0]
+			preview.PreviewApplicationNotifications(filename, opts)
+		},
+	}
+	addNotificationFlags(command, &opts)
 	return command
 }
@@ -14,12 +14,18 @@ func AppSetCommand() *cobra.Command {
 	}
 	command.AddCommand(PreviewApplicationsCommand())
 	command.AddCommand(PreviewAppSetResourcesCommand())
+	command.AddCommand(DiffAppSetCommand())
+	command.AddCommand(ValidateAppSetCommand())
+	command.AddCommand(DriftAppSetCommand())
+	command.AddCommand(PredictAppSetStatusCommand())
+	command.AddCommand(PreviewAppSetNotificationsCommand())
 	return command
 }
 
 func PreviewApplicationsCommand() *cobra.Command {
 	var name string
 	var output string
+	var printParams bool
 	command := &cobra.Command{
 		Use:   "preview-apps APPSETMANIFEST",
 		Short: "Preview Application(s) generated from an ApplicationSet",
@@ -29,18 +35,18 @@ func PreviewApplicationsCommand() *cobra.Command {
 				os.Exit(1)
 			}
 			filename := args[0]
-			preview.PreviewApplications(filename, name, output)
+			preview.PreviewApplications(filename, name, output, printParams)
 		},
 	}
 	command.Flags().StringVarP(&name, "name", "n", "", "Name of the Application to preview")
 	command.Flags().StringVarP(&output, "output", "o", "name", "Output format. One of: name|json|yaml")
+	command.Flags().BoolVar(&printParams, "print-params", false,
+		"Print the parameters each generator produced for each Application, before templating, as YAML or JSON")
 	return command
 }
 
 func PreviewAppSetResourcesCommand() *cobra.Command {
-	var kind string
-	var name string
-	var output string
+	var opts preview.RenderOptions
 	command := &cobra.Command{
 		Use:   "preview-resources APPSETMANIFEST",
 		Short: "Preview Kubernetes resource(s) generated from an ApplicationSet/Application",
@@ -50,11 +56,101 @@ func PreviewAppSetResourcesCommand() *cobra.Command {
 				os.Exit(1)
 			}
 			filename := args[0]
-			preview.PreviewResources(filename, name, kind, output)
+			preview.PreviewResources(filename, opts)
 		},
 	}
-	command.Flags().StringVarP(&kind, "kind", "k", "", "Kind of resources to preview")
-	command.Flags().StringVarP(&name, "name", "n", "", "Name of the Application to preview")
-	command.Flags().StringVarP(&output, "output", "o", "name", "Output format. One of: name|json|yaml")
+	command.Flags().StringVarP(&opts.AppName, "name", "n", "", "Name of the Application to preview")
+	addRenderFlags(command, &opts)
+	return command
+}
+
+func DiffAppSetCommand() *cobra.Command {
+	var opts preview.LiveOptions
+	command := &cobra.Command{
+		Use:   "diff APPSETMANIFEST",
+		Short: "Diff the resources generated from an ApplicationSet against their live state in Argo CD",
+		Run: func(c *cobra.Command, args []string) {
+			if len(args) == 0 {
+				c.HelpFunc()(c, args)
+				os.Exit(1)
+			}
+			filename := args[0]
+			preview.DiffResourcesLive(filename, opts)
+		},
+	}
+	command.Flags().StringVarP(&opts.AppName, "name", "n", "", "Name of the Application to diff")
+	addLiveFlags(command, &opts)
+	return command
+}
+
+func ValidateAppSetCommand() *cobra.Command {
+	var opts preview.ValidateOptions
+	command := &cobra.Command{
+		Use:   "validate APPSETMANIFEST",
+		Short: "Validate the Kubernetes resource(s) generated from an ApplicationSet",
+		Run: func(c *cobra.Command, args []string) {
+			if len(args) == 0 {
+				c.HelpFunc()(c, args)
+				os.Exit(1)
+			}
+			filename := args[0]
+			preview.ValidateResources(filename, opts)
+		},
+	}
+	addValidateFlags(command, &opts)
+	return command
+}
+
+func DriftAppSetCommand() *cobra.Command {
+	var opts preview.DriftOptions
+	command := &cobra.Command{
+		Use:   "drift APPSETMANIFEST",
+		Short: "Report the drift between the resources generated from an ApplicationSet and a cluster export",
+		Run: func(c *cobra.Command, args []string) {
+			if len(args) == 0 {
+				c.HelpFunc()(c, args)
+				os.Exit(1)
+			}
+			filename := args[0]
+			preview.DriftResources(filename, opts)
+		},
+	}
+	addDriftFlags(command, &opts)
+	return command
+}
+
+func PredictAppSetStatusCommand() *cobra.Command {
+	var opts preview.StatusOptions
+	command := &cobra.Command{
+		Use:   "predict-status APPSETMANIFEST",
+		Short: "Print the status Argo CD would report for the Applications of an ApplicationSet once synced, as JSON",
+		Run: func(c *cobra.Command, args []string) {
+			if len(args) == 0 {
+				c.HelpFunc()(c, args)
+				os.Exit(1)
+			}
+			filename := args[0]
+			preview.PredictResourcesStatus(filename, opts)
+		},
+	}
+	command.Flags().StringVarP(&opts.AppName, "name", "n", "", "Name of the Application to predict the status of")
+	return command
+}
+
+func PreviewAppSetNotificationsCommand() *cobra.Command {
+	var opts preview.NotificationOptions
+	command := &cobra.Command{
+		Use:   "preview-notifications APPSETMANIFEST",
+		Short: "Print the notifications Argo CD would send for the Applications of an ApplicationSet once synced",
+		Run: func(c *cobra.Command, args []string) {
+			if len(args) == 0 {
+				c.HelpFunc()(c, args)
+				os.Exit(1)
+			}
+			filename := args[0]
+			preview.PreviewResourceNotifications(filename, opts)
+		},
+	}
+	addNotificationFlags(command, &opts)
 	return command
 }
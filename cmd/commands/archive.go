@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/touchardv/argocd-offline-cli/preview"
+)
+
+func ArchiveCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "archive",
+		Short: "Inspect the output archives written with --output-archive",
+	}
+	command.AddCommand(ExtractArchiveCommand())
+	return command
+}
+
+func ExtractArchiveCommand() *cobra.Command {
+	var opts preview.ArchiveExtractOptions
+	command := &cobra.Command{
+		Use:   "extract ARCHIVE",
+		Short: "Extract an output archive to a directory, grouped by destination cluster",
+		Long: `Extract an output archive written with --output-archive ("-" for the standard input).
+
+The resources are written to the directory given with --output-dir as by the preview-resources commands:
+<dir>/<cluster>/<app>/manifest.yaml for each Application, and a <dir>/<cluster>/apply.yaml stream per cluster.
+An encrypted archive is decrypted first, e.g. age -d -i key.txt out.tar.zst.age | argocd-offline-cli archive
+extract - --output-dir out.`,
+		Run: func(c *cobra.Command, args []string) {
+			if len(args) == 0 {
+				c.HelpFunc()(c, args)
+				os.Exit(1)
+			}
+			preview.ExtractArchive(args[0], opts)
+		},
+	}
+	command.Flags().StringVar(&opts.OutputDir, "output-dir", "", "Directory the resources are written to")
+	command.Flags().BoolVar(&opts.SplitCRDs, "split-crds", false,
+		"Write the CustomResourceDefinitions of each cluster to <dir>/<cluster>/crds.yaml instead")
+	return command
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/touchardv/argocd-offline-cli/preview"
+)
+
+func ExportBootstrapCommand() *cobra.Command {
+	var opts preview.BootstrapOptions
+	command := &cobra.Command{
+		Use:   "export-bootstrap APPMANIFEST...",
+		Short: "Export the bundle standing up a new cluster from scratch with Applications, offline",
+		Long: `Export the bundle standing up a new cluster from scratch with Applications, offline.
+
+The bundle is written to a directory, its files being applied in order:
+- 00-projects.yaml holds the AppProjects of the Applications, but the default one created by Argo CD
+- 01-applications.yaml holds the Application CRs, by sync wave then name
+- 02-manifests/<cluster>/apply.yaml holds the pre-rendered resources of the Applications, with --render
+Directories are searched for YAML and JSON manifests.`,
+		Run: func(c *cobra.Command, args []string) {
+			if len(args) == 0 || !c.Flags().Changed("output-dir") {
+				c.HelpFunc()(c, args)
+				os.Exit(1)
+			}
+			preview.ExportBootstrap(args, opts)
+		},
+	}
+	command.Flags().StringVar(&opts.OutputDir, "output-dir", "",
+		"Directory the bundle is written to, which must be empty")
+	command.Flags().StringArrayVar(&opts.Apps, "app", nil,
+		"Name of an Application to export, all the Applications of the manifests by default (can be repeated)")
+	command.Flags().StringArrayVar(&opts.Projects, "projects", nil,
+		"File or directory holding the AppProjects of the Applications (can be repeated)")
+	command.Flags().BoolVar(&opts.Render, "render", false,
+		"Also write the pre-rendered resources of the Applications, grouped by destination cluster")
+	command.Flags().BoolVar(&opts.SplitCRDs, "split-crds", false,
+		"With --render, write the CustomResourceDefinitions of each cluster to crds.yaml, applied before apply.yaml")
+	command.Flags().StringArrayVar(&opts.Strip, "strip", nil,
+		"With --render, strip this profile of metadata: test-hooks|argocd-metadata|null-fields|all (can be repeated)")
+	return command
+}
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/touchardv/argocd-offline-cli/preview"
+)
+
+func CacheCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the cache of git repositories, Helm charts and run states",
+	}
+	command.AddCommand(GarbageCollectCacheCommand())
+	return command
+}
+
+func GarbageCollectCacheCommand() *cobra.Command {
+	var opts preview.CacheGCOptions
+	command := &cobra.Command{
+		Use:   "gc",
+		Short: "Evict the old and least recently used entries of the cache",
+		Long: `Evict the old and least recently used entries of the cache.
+
+The git repositories, Helm charts and run states not modified for longer than --max-age are removed first,
+then the least recently modified ones until the cache fits in --max-size.
+The caches and runs in use by other invocations are skipped. The temporary files left over by crashed
+invocations are removed as well.`,
+		Run: func(c *cobra.Command, args []string) {
+			preview.GarbageCollectCache(opts)
+		},
+	}
+	command.Flags().DurationVar(&opts.MaxAge, "max-age", 7*24*time.Hour,
+		"Evict the entries not modified for longer than this duration (0 to disable)")
+	command.Flags().StringVar(&opts.MaxSize, "max-size", "",
+		"Evict the least recently modified entries until the cache fits in this size, e.g. 10G")
+	return command
+}
@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/touchardv/argocd-offline-cli/preview"
+)
+
+// addRenderFlags registers the flags shared by the commands generating resource manifests
+func addRenderFlags(command *cobra.Command, opts *preview.RenderOptions) {
+	command.Flags().StringVarP(&opts.Kind, "kind", "k", "", "Kind of resources to preview")
+	command.Flags().StringVar(&opts.Shard, "shard", "",
+		"Only render the Applications of this shard of the run, index/count (e.g. 2/5), assigned by a hash of their name")
+	command.Flags().StringVar(&opts.Destination, "destination", "",
+		"Only render the Applications going to this cluster: a name, server or alias of --clusters, or in-cluster")
+	command.Flags().StringVarP(&opts.Output, "output", "o", "name", "Output format. One of: name|json|yaml")
+	command.Flags().StringVar(&opts.RunID, "run-id", "", "Persist the per-app completion state under this run ID")
+	command.Flags().StringVar(&opts.Resume, "resume", "", "Resume the run with this ID, skipping the apps that already succeeded")
+	command.Flags().StringVar(&opts.DebugArtifacts, "debug-artifacts", "",
+		"Directory where the helm/kustomize command lines, values files and plugin env of each app are dumped")
+	command.Flags().StringArrayVar(&opts.Projects, "projects", nil,
+		"File or directory holding the AppProjects the Applications are rendered against (can be repeated)")
+	command.Flags().StringVar(&opts.Overrides, "overrides", "",
+		"File mapping Application names to the targetRevision, helm parameters, kustomize images and plugin env to set")
+	command.Flags().StringArrayVar(&opts.SourceOverrides, "override-source", nil,
+		"Render a source of an app from a local directory or revision: app=index=path:dir|revision:rev (can be repeated)")
+	command.Flags().StringVar(&opts.SkipList, "skip-list", "",
+		"File mapping the names of the Applications not to render to the reason, recorded in the report")
+	command.Flags().StringVar(&opts.OutputDir, "output-dir", "",
+		"Write the resources to <dir>/<cluster>/<app>/manifest.yaml and a <dir>/<cluster>/apply.yaml stream per cluster")
+	command.Flags().BoolVar(&opts.SplitCRDs, "split-crds", false,
+		"With --output-dir, write the CustomResourceDefinitions of each cluster to <dir>/<cluster>/crds.yaml instead")
+	command.Flags().StringVar(&opts.OutputArchive, "output-archive", "",
+		"Write the resources to this zstd-compressed tar archive, storing each distinct resource once")
+	command.Flags().StringVar(&opts.Report, "report", "",
+		"Write a JSON report of the run to this file: status, duration, resource count and images of each app")
+	command.Flags().BoolVar(&opts.OriginAnnotations, "origin-annotations", false,
+		"Annotate each resource with the source repo, path or chart, revision and values files it was generated from")
+	command.Flags().StringArrayVar(&opts.AddLabels, "add-label", nil,
+		"Label, as key=value, added to every resource, its pod templates and selectors like commonLabels (can be repeated)")
+	command.Flags().StringArrayVar(&opts.AddAnnotations, "add-annotation", nil,
+		"Annotation, as key=value, added to every resource and its pod templates like commonAnnotations (can be repeated)")
+	command.Flags().BoolVar(&opts.LabelSelectors, "label-selectors", true,
+		"Also add the --add-label labels to the selectors, which are immutable for the workloads")
+	command.Flags().StringVar(&opts.Hooks.PreLoad, "pre-load-hook", "",
+		"Command run before the Applications are loaded, given the manifest as JSON on its standard input")
+	command.Flags().StringVar(&opts.Hooks.PostRender, "post-render-hook", "",
+		"Command run on the resources of each rendered Application, given as JSON, the resources it prints replacing them")
+	command.Flags().StringVar(&opts.Hooks.PostRun, "post-run-hook", "",
+		"Command run once the run is done, given the status of each Application as JSON on its standard input")
+	command.Flags().DurationVar(&opts.MaxDuration, "max-duration", 0,
+		"Fail the run when it takes longer than this duration, e.g. 10m")
+	command.Flags().DurationVar(&opts.MaxDurationPerApp, "max-duration-per-app", 0,
+		"Fail the run, and mark the Application as failed in the report, when an app takes longer to render, e.g. 90s")
+	command.Flags().BoolVar(&opts.KeepGoing, "keep-going", false,
+		"Render the remaining Applications after one fails to render, failing the run once they are done")
+	command.Flags().StringArrayVar(&opts.Strip, "strip", nil,
+		"Strip this profile of preview-only metadata: test-hooks|argocd-metadata|null-fields|all (can be repeated)")
+	command.Flags().StringVar(&opts.MergePreview, "merge-preview", "",
+		"Render the local repositories at a temporary merge of head into base, given as base..head, instead of HEAD")
+	command.Flags().StringVar(&opts.ChartKeyring, "chart-keyring", "",
+		"Keyring (gpg --export) the provenance of the Helm charts is verified against, recorded in the report")
+	command.Flags().BoolVar(&opts.EnforceProvenance, "enforce-provenance", false,
+		"Fail the Applications whose Helm charts are unsigned or unverifiable instead of warning")
+}
+
+// addLiveFlags registers the flags used to connect to an Argo CD API server
+func addLiveFlags(command *cobra.Command, opts *preview.LiveOptions) {
+	command.Flags().StringVar(&opts.Server, "argocd-server", "", "Address of the Argo CD API server")
+	command.Flags().StringVar(&opts.AuthToken, "auth-token", "", "Authentication token of the Argo CD API server")
+	command.Flags().BoolVar(&opts.PlainText, "plaintext", false, "Disable TLS")
+	command.Flags().BoolVar(&opts.Insecure, "insecure", false, "Skip server certificate and domain verification")
+	command.Flags().BoolVar(&opts.GRPCWeb, "grpc-web", false,
+		"Use the gRPC-Web protocol, for proxies without HTTP/2 support")
+	command.Flags().BoolVar(&opts.Summary, "summary", false,
+		"Print a one-line summary of the changes of each Application instead of the diff")
+	command.Flags().BoolVar(&opts.Porcelain, "porcelain", false,
+		"Print a tab-separated status, name, duration (ms) and changed-resource count line per app as it completes")
+	command.Flags().BoolVar(&opts.OnlyChanged, "only-changed", false,
+		"Leave out the Applications in sync from the output")
+	command.Flags().StringVar(&opts.DiffExec, "diff-exec", "",
+		"External command diffing the old and new YAML files of each changed resource, e.g. \"dyff between\"")
+	command.Flags().BoolVar(&opts.StructuralDiff, "structural-diff", false,
+		"Print the changed YAML paths of each modified resource with their old and new values instead of the lines")
+}
+
+// addValidateFlags registers the flags of the commands validating generated resources
+func addValidateFlags(command *cobra.Command, opts *preview.ValidateOptions) {
+	command.Flags().StringVarP(&opts.AppName, "name", "n", "", "Name of the Application to validate")
+	command.Flags().StringVar(&opts.Suppressions, "suppressions", "", "File listing the known and accepted findings")
+	command.Flags().StringArrayVar(&opts.Policies, "policies", nil,
+		"File or directory holding Kyverno policies or Gatekeeper Constraints to evaluate (can be repeated)")
+	command.Flags().StringArrayVar(&opts.Projects, "projects", nil,
+		"File or directory holding the AppProjects the Applications are validated against (can be repeated)")
+	command.Flags().StringVar(&opts.ChartKeyring, "chart-keyring", "",
+		"Keyring (gpg --export) the provenance of the Helm charts is verified against")
+	command.Flags().BoolVar(&opts.EnforceProvenance, "enforce-provenance", false,
+		"Report the unsigned and unverifiable Helm charts as errors instead of warnings")
+	command.Flags().StringVar(&opts.Config, "validation-config", "",
+		"File setting the severity (off|warn|error) of each check category")
+	command.Flags().BoolVar(&opts.WarnOnly, "warn-only", false, "Report all findings as warnings, never failing")
+	command.Flags().StringVar(&opts.WriteBaseline, "write-baseline", "",
+		"Write a suppression file accepting all the current findings to this file")
+	command.Flags().StringVar(&opts.SkipList, "skip-list", "",
+		"File mapping the names of the Applications not to validate to the reason")
+}
+
+// addDriftFlags registers the flags of the commands reporting the drift against a cluster export
+func addDriftFlags(command *cobra.Command, opts *preview.DriftOptions) {
+	command.Flags().StringVarP(&opts.AppName, "name", "n", "", "Name of the Application to report on")
+	command.Flags().StringVar(&opts.Shard, "shard", "",
+		"Only report on the Applications of this shard of the run, index/count (e.g. 2/5), assigned by name hash")
+	command.Flags().StringVar(&opts.ClusterExport, "cluster-export", "",
+		"Directory holding the resources exported from the cluster (kubectl get -o yaml, Velero backup)")
+	command.Flags().StringVarP(&opts.Output, "output", "o", "text", "Output format. One of: text|json")
+	command.Flags().BoolVar(&opts.OnlyChanged, "only-changed", false,
+		"Leave out the Applications without drift from the output")
+	command.Flags().StringVar(&opts.DiffExec, "diff-exec", "",
+		"External command diffing the old and new YAML files of each changed resource, e.g. \"dyff between\"")
+	command.Flags().BoolVar(&opts.StructuralDiff, "structural-diff", false,
+		"Print the changed YAML paths of each modified resource with their old and new values instead of the lines")
+}
+
+// addNotificationFlags adds the flags of the preview-notifications commands
+func addNotificationFlags(command *cobra.Command, opts *preview.NotificationOptions) {
+	command.Flags().StringVarP(&opts.AppName, "name", "n", "", "Name of the Application to preview the notifications of")
+	command.Flags().StringArrayVar(&opts.Notifications, "notifications", nil,
+		"File or directory holding argocd-notifications-cm, and optionally argocd-notifications-secret (can be repeated)")
+	command.Flags().StringArrayVar(&opts.Triggers, "trigger", nil,
+		"Trigger to evaluate, all the triggers by default (can be repeated)")
+	command.Flags().StringVar(&opts.OperationPhase, "operation-phase", "Succeeded",
+		"Phase of the sync operation the notifications are previewed after. One of: Succeeded|Running|Failed|Error")
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/touchardv/argocd-offline-cli/preview"
+)
+
+func HookCommand() *cobra.Command {
+	var opts preview.HookOptions
+	command := &cobra.Command{
+		Use:   "hook APPMANIFEST...",
+		Short: "Preview the changes made in the working tree to Applications, for use as a pre-commit hook",
+		Long: `Preview the changes made in the working tree to Applications, for use as a pre-commit hook.
+
+Only the Applications whose manifest, or local source paths, changed since HEAD are rendered,
+both at HEAD and from the working tree, and a compact diff of their resources is printed.
+Directories are searched for YAML and JSON manifests.`,
+		Run: func(c *cobra.Command, args []string) {
+			if len(args) == 0 {
+				c.HelpFunc()(c, args)
+				os.Exit(1)
+			}
+			preview.RunHook(args, opts)
+		},
+	}
+	command.Flags().DurationVar(&opts.Timeout, "timeout", 30*time.Second,
+		"Time budget of the hook, the preview is skipped with a warning when exceeded (0 to disable)")
+	command.Flags().BoolVar(&opts.Summary, "summary", false,
+		"Print a one-line summary of the changes of each Application instead of the diff")
+	command.Flags().BoolVar(&opts.Porcelain, "porcelain", false,
+		"Print a tab-separated status, name, duration (ms) and changed-resource count line per app as it completes")
+	command.Flags().BoolVar(&opts.OnlyChanged, "only-changed", false,
+		"Leave out the Applications without changes from the output")
+	command.Flags().StringVar(&opts.DiffExec, "diff-exec", "",
+		"External command diffing the old and new YAML files of each changed resource, e.g. \"dyff between\"")
+	command.Flags().BoolVar(&opts.StructuralDiff, "structural-diff", false,
+		"Print the changed YAML paths of each modified resource with their old and new values instead of the lines")
+	command.Flags().StringVar(&opts.Owners, "owners", "",
+		"CODEOWNERS-style file attributing the changes to teams, by path or label:key=value, summarized per team")
+	return command
+}
@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/touchardv/argocd-offline-cli/preview"
+)
+
+func HydrateCommand() *cobra.Command {
+	var opts preview.HydrateOptions
+	command := &cobra.Command{
+		Use:   "hydrate APPMANIFEST...",
+		Short: "Commit the resources rendered from Applications to a git branch",
+		Long: `Commit the resources rendered from Applications to a git branch, following the rendered-manifests pattern.
+
+Each Application is written to <path>/manifest.yaml, along with a <path>/hydrator.metadata file recording
+the revisions of its sources. The path is spec.sourceHydrator.syncSource.path when set, the Application name otherwise.
+The commit message lists the Applications whose manifests changed, and the revisions of their sources.
+Directories are searched for YAML and JSON manifests.`,
+		Run: func(c *cobra.Command, args []string) {
+			if len(args) == 0 || !c.Flags().Changed("branch") {
+				c.HelpFunc()(c, args)
+				os.Exit(1)
+			}
+			preview.Hydrate(args, opts)
+		},
+	}
+	command.Flags().StringVarP(&opts.Branch, "branch", "b", "", "Branch the rendered manifests are committed to")
+	command.Flags().StringVar(&opts.Repo, "repo", "", "Path of the git repository holding the branch, the current repository by default")
+	return command
+}
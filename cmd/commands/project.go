@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/touchardv/argocd-offline-cli/preview"
+)
+
+func ProjectImpactCommand() *cobra.Command {
+	var opts preview.ProjectImpactOptions
+	command := &cobra.Command{
+		Use:   "project-impact APPMANIFEST...",
+		Short: "Preview which Applications a change of AppProjects would make invalid",
+		Long: `Preview which Applications a change of AppProjects would make invalid.
+
+Each Application is checked against both the current and the changed definition of its AppProject,
+and the source repositories, destinations and namespaces which would no longer be permitted are reported.
+With --render, the generated resources are also checked against the permitted resource kinds.
+Directories are searched for YAML and JSON manifests. Exits with status 1 when an Application would become invalid.`,
+		Run: func(c *cobra.Command, args []string) {
+			if len(args) == 0 || !c.Flags().Changed("old-projects") || !c.Flags().Changed("new-projects") {
+				c.HelpFunc()(c, args)
+				os.Exit(1)
+			}
+			preview.ProjectImpact(args, opts)
+		},
+	}
+	command.Flags().StringArrayVar(&opts.OldProjects, "old-projects", nil,
+		"File or directory holding the current AppProjects (can be repeated)")
+	command.Flags().StringArrayVar(&opts.NewProjects, "new-projects", nil,
+		"File or directory holding the changed AppProjects (can be repeated)")
+	command.Flags().BoolVar(&opts.Render, "render", false,
+		"Render the Applications, to also check their resources against the permitted kinds and namespaces")
+	return command
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/touchardv/argocd-offline-cli/preview"
+)
+
+func RenderPathCommand() *cobra.Command {
+	var pathOpts preview.PathOptions
+	var opts preview.RenderOptions
+	command := &cobra.Command{
+		Use:   "render-path",
+		Short: "Preview the Kubernetes resource(s) generated from a source, without Application manifest",
+		Long: `Preview the Kubernetes resource(s) generated from a source, without Application manifest.
+
+An Application is generated with the source given by the flags, named after its path or chart, and rendered like
+the Applications of the app preview-resources command. The values files are relative to the path of the source,
+as in Argo CD. A local repository is rendered at its committed revision.`,
+		Example: `  argocd-offline-cli render-path --repo . --path charts/myapp --type helm --values env/prod.yaml`,
+		Run: func(c *cobra.Command, args []string) {
+			if pathOpts.Path == "" && pathOpts.Chart == "" {
+				c.HelpFunc()(c, args)
+				os.Exit(1)
+			}
+			preview.RenderPath(pathOpts, opts)
+		},
+	}
+	command.Flags().StringVar(&pathOpts.Repo, "repo", ".", "URL of the repository, or path of a local git repository")
+	command.Flags().StringVar(&pathOpts.Path, "path", "", "Path of the source in the repository")
+	command.Flags().StringVar(&pathOpts.Chart, "helm-chart", "",
+		"Name of the chart of a Helm repository, instead of a path")
+	command.Flags().StringVar(&pathOpts.Revision, "revision", "",
+		"Revision of the repository, or version of the chart (default HEAD)")
+	command.Flags().StringVar(&pathOpts.Type, "type", "",
+		"Type of the source, one of: helm|kustomize|directory|plugin (detected by default)")
+	command.Flags().StringArrayVar(&pathOpts.Values, "values", nil,
+		"Helm values file, relative to the path (can be repeated)")
+	command.Flags().StringArrayVar(&pathOpts.HelmSet, "helm-set", nil, "Helm parameter, as name=value (can be repeated)")
+	command.Flags().StringVar(&pathOpts.Name, "name", "",
+		"Name of the Application, the last element of the path or the chart by default")
+	command.Flags().StringVar(&pathOpts.Project, "project", "", "AppProject of the Application (default \"default\")")
+	command.Flags().StringVar(&pathOpts.DestServer, "dest-server", "",
+		"Server of the destination cluster (default the in-cluster one)")
+	command.Flags().StringVar(&pathOpts.DestName, "dest-name", "", "Name of the destination cluster")
+	command.Flags().StringVar(&pathOpts.DestNamespace, "dest-namespace", "",
+		"Destination namespace (default \"default\")")
+	addRenderFlags(command, &opts)
+	return command
+}
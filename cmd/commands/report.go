@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/touchardv/argocd-offline-cli/preview"
+)
+
+func ReportCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "report",
+		Short: "Inspect the run reports written with --report",
+	}
+	command.AddCommand(CompareReportsCommand())
+	command.AddCommand(MergeReportsCommand())
+	return command
+}
+
+func CompareReportsCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "compare OLDREPORT NEWREPORT",
+		Short: "Compare two run reports",
+		Long: `Compare two run reports written with --report.
+
+The app count, failure count and duration of the runs are printed, followed by the Applications added,
+removed, whose status changed, or whose duration changed by more than 20% and 1s, and by the images
+added and removed.`,
+		Run: func(c *cobra.Command, args []string) {
+			if len(args) != 2 {
+				c.HelpFunc()(c, args)
+				os.Exit(1)
+			}
+			preview.CompareRunReports(args[0], args[1])
+		},
+	}
+	return command
+}
+
+func MergeReportsCommand() *cobra.Command {
+	var output string
+	command := &cobra.Command{
+		Use:   "merge REPORT...",
+		Short: "Merge the reports of the shards of a run",
+		Long: `Merge the reports of the shards of a run, rendered by several CI jobs with --shard, into one report.
+
+The run reports written with --report are merged into a run report: the Applications are sorted by name,
+the run spans from the earliest start to the latest end of the shards, and the cache hits are summed.
+The shards must not overlap, and the missing ones are reported. The JSON drift reports printed by
+drift -o json are merged into a drift report, sorted by Application and resource.`,
+		Run: func(c *cobra.Command, args []string) {
+			if len(args) == 0 {
+				c.HelpFunc()(c, args)
+				os.Exit(1)
+			}
+			preview.MergeReports(args, output)
+		},
+	}
+	command.Flags().StringVar(&output, "output-file", "", "File the merged report is written to, printed by default")
+	return command
+}
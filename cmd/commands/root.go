@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/spf13/cobra"
+	"github.com/touchardv/argocd-offline-cli/preview"
 )
 
 // Version information set via ldflags
@@ -14,6 +15,10 @@ var (
 )
 
 func NewCommand() *cobra.Command {
+	var strict, keepLists, allowUnpinnedTools bool
+	var plugins []string
+	var clusters, argoCDExport string
+	var recipients []string
 	rootCmd := &cobra.Command{
 		Use:   "argocd-offline-cli",
 		Short: "An Argo CD CLI offline utility",
@@ -24,9 +29,55 @@ to preview the Kubernetes resource manifests being created and managed by Argo C
 
 	// Enable -v as shorthand for --version
 	rootCmd.Flags().BoolP("version", "v", false, "version for argocd-offline-cli")
+	rootCmd.PersistentFlags().BoolVar(&strict, "strict", false,
+		"Fail on the Application features and fields which are not supported, instead of rendering without them")
+	rootCmd.PersistentFlags().BoolVar(&keepLists, "keep-lists", false,
+		"Output the Lists nested in the rendered manifests as single resources, instead of unwrapping their items")
+	rootCmd.PersistentFlags().StringArrayVar(&plugins, "plugins", nil,
+		"File or directory holding ConfigManagementPlugin definitions (plugin.yaml) to run locally (can be repeated)")
+	rootCmd.PersistentFlags().StringVar(&clusters, "clusters", "",
+		"File describing the destination clusters, with the Kubernetes version and API versions they serve")
+	rootCmd.PersistentFlags().StringVar(&argoCDExport, "argocd-export", "",
+		"Directory of the resources exported from the Argo CD namespace, to read the clusters, repository credentials "+
+			"and settings from")
+	rootCmd.PersistentFlags().StringArrayVar(&recipients, "encrypt-output", nil,
+		"Encrypt the files of --output-dir, --report and --debug-artifacts to this age recipient (can be repeated)")
+	rootCmd.PersistentFlags().BoolVar(&allowUnpinnedTools, "allow-unpinned-tools", false,
+		"Download the Helm and Kustomize versions without a pinned checksum, verified against their published checksum")
+	rootCmd.PersistentPreRun = func(c *cobra.Command, args []string) {
+		if strict {
+			preview.EnableStrictMode()
+		}
+		if keepLists {
+			preview.KeepLists()
+		}
+		if len(plugins) > 0 {
+			preview.EnablePlugins(plugins)
+		}
+		if clusters != "" {
+			preview.EnableClusters(clusters)
+		}
+		if argoCDExport != "" {
+			preview.LoadArgoCDExport(argoCDExport)
+		}
+		if len(recipients) > 0 {
+			preview.EncryptOutput(recipients)
+		}
+		if allowUnpinnedTools {
+			preview.AllowUnpinnedTools()
+		}
+	}
 
 	rootCmd.AddCommand(AppSetCommand())
 	rootCmd.AddCommand(AppCommand())
+	rootCmd.AddCommand(RenderPathCommand())
+	rootCmd.AddCommand(HookCommand())
+	rootCmd.AddCommand(HydrateCommand())
+	rootCmd.AddCommand(ProjectImpactCommand())
+	rootCmd.AddCommand(CacheCommand())
+	rootCmd.AddCommand(ReportCommand())
+	rootCmd.AddCommand(ArchiveCommand())
+	rootCmd.AddCommand(ExportBootstrapCommand())
 
 	return rootCmd
 }
@@ -0,0 +1,169 @@
+package preview
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/argoproj/argo-cd/v3/pkg/apis/application"
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Rules of the checks on the definitions of the Applications
+const (
+	ruleAppDuplicate     = "application-duplicate"
+	ruleAppNameConflict  = "application-name-conflict"
+	ruleAppName          = "application-name"
+	ruleAppRequiredField = "application-required-field"
+	ruleAppDestination   = "application-destination"
+)
+
+// checkApplications checks the definitions of the Applications themselves, before they are rendered: the
+// Applications defined more than once, the names used in several namespaces, the names Kubernetes rejects, the
+// missing required fields and the conflicting destinations. The destination clusters are checked to be known when
+// clusters are given. The findings are returned by Application, in the order of the Applications, the ones already
+// reported for an earlier definition of the same Application being left out.
+func checkApplications(apps []argoappv1.Application, clusters []destinationCluster) [][]finding {
+	namespaces := map[string][]string{}
+	count := map[resourceKey]int{}
+	for _, app := range apps {
+		key := appResourceKey(app)
+		if count[key]++; count[key] == 1 {
+			namespaces[app.Name] = append(namespaces[app.Name], app.Namespace)
+		}
+	}
+	findings := make([][]finding, len(apps))
+	reported := map[string]bool{}
+	for i, app := range apps {
+		key := appResourceKey(app)
+		add := func(f finding) {
+			if id := key.String() + " " + f.RuleID + " " + f.Message; !reported[id] {
+				reported[id] = true
+				findings[i] = append(findings[i], f)
+			}
+		}
+		newFinding := func(rule string, format string, args ...interface{}) finding {
+			return finding{
+				RuleID:   rule,
+				Category: categoryApplication,
+				App:      app.Name,
+				Resource: key,
+				Message:  fmt.Sprintf(format, args...),
+			}
+		}
+		if count[key] > 1 {
+			add(newFinding(ruleAppDuplicate, "defined %d times", count[key]))
+		}
+		if others := otherNamespaces(namespaces[app.Name], app.Namespace); len(others) > 0 {
+			f := newFinding(ruleAppNameConflict,
+				"name also used in namespace(s) %s, the --app-name filter and the skip list match all",
+				strings.Join(others, ", "))
+			f.Advisory = true
+			add(f)
+		}
+		for _, msg := range appNameErrors(app) {
+			add(newFinding(ruleAppName, "%s", msg))
+		}
+		for _, field := range missingAppFields(app) {
+			add(newFinding(ruleAppRequiredField, "missing required field %s", field))
+		}
+		for _, msg := range appDestinationErrors(app, clusters) {
+			add(newFinding(ruleAppDestination, "%s", msg))
+		}
+	}
+	return findings
+}
+
+// renderable returns whether an Application can be rendered given the findings on its definition
+func renderable(findings []finding) bool {
+	for _, f := range findings {
+		if f.RuleID == ruleAppRequiredField {
+			return false
+		}
+	}
+	return true
+}
+
+// appResourceKey returns the key of an Application, the resource of its findings
+func appResourceKey(app argoappv1.Application) resourceKey {
+	return resourceKey{Group: application.Group, Kind: applicationKind, Namespace: app.Namespace, Name: app.Name}
+}
+
+// otherNamespaces returns the namespaces of an Application name other than the given one, sorted
+func otherNamespaces(namespaces []string, namespace string) []string {
+	var others []string
+	for _, ns := range namespaces {
+		if ns == namespace {
+			continue
+		}
+		if ns == "" {
+			ns = "<none>"
+		}
+		others = append(others, ns)
+	}
+	sort.Strings(others)
+	return others
+}
+
+// appNameErrors returns why the name or namespace of an Application is rejected by Kubernetes
+func appNameErrors(app argoappv1.Application) []string {
+	var errs []string
+	if app.Name != "" {
+		for _, msg := range validation.IsDNS1123Subdomain(app.Name) {
+			errs = append(errs, fmt.Sprintf("invalid name '%s': %s", app.Name, msg))
+		}
+	}
+	if app.Namespace != "" {
+		for _, msg := range validation.IsDNS1123Label(app.Namespace) {
+			errs = append(errs, fmt.Sprintf("invalid namespace '%s': %s", app.Namespace, msg))
+		}
+	}
+	return errs
+}
+
+// missingAppFields returns the required fields an Application is missing, without which Argo CD rejects it
+func missingAppFields(app argoappv1.Application) []string {
+	var missing []string
+	if app.Name == "" {
+		missing = append(missing, "metadata.name")
+	}
+	if app.Spec.Project == "" {
+		missing = append(missing, "spec.project")
+	}
+	switch {
+	case app.Spec.HasMultipleSources():
+		for i, source := range app.Spec.Sources {
+			if source.RepoURL == "" {
+				missing = append(missing, fmt.Sprintf("spec.sources[%d].repoURL", i))
+			}
+		}
+	case app.Spec.Source != nil:
+		if app.Spec.Source.RepoURL == "" {
+			missing = append(missing, "spec.source.repoURL")
+		}
+	default:
+		missing = append(missing, "spec.source or spec.sources")
+	}
+	return missing
+}
+
+// appDestinationErrors returns why the destination of an Application conflicts: set by name and server at once,
+// which Argo CD rejects, or, when the clusters are given, not one of them nor the cluster Argo CD runs in
+func appDestinationErrors(app argoappv1.Application, clusters []destinationCluster) []string {
+	destination := app.Spec.Destination
+	switch {
+	case destination.Name == "" && destination.Server == "":
+		return []string{"destination has neither a name nor a server"}
+	case destination.Name != "" && destination.Server != "":
+		return []string{fmt.Sprintf("destination has both a name (%s) and a server (%s)",
+			destination.Name, destination.Server)}
+	case isInClusterDestination(destination):
+	case clusters != nil && lookupCluster(clusters, destination) == nil:
+		if destination.Name != "" {
+			return []string{fmt.Sprintf("destination cluster '%s' is not a known cluster", destination.Name)}
+		}
+		return []string{fmt.Sprintf("destination server %s is not a known cluster", destination.Server)}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package preview
+
+import (
+	"slices"
+	"testing"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TestCheckApplications verifies that the duplicate Applications, the names used in several namespaces, the invalid
+// names, the missing required fields and the conflicting destinations are all reported
+func TestCheckApplications(t *testing.T) {
+	newApp := func(namespace string, name string, cluster string) argoappv1.Application {
+		return argoappv1.Application{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Spec: argoappv1.ApplicationSpec{
+				Project:     "default",
+				Source:      &argoappv1.ApplicationSource{RepoURL: "https://github.com/example/apps.git"},
+				Destination: argoappv1.ApplicationDestination{Name: cluster, Namespace: "apps"},
+			},
+		}
+	}
+	conflicting := newApp("argocd", "conflicting", "prod")
+	conflicting.Spec.Destination.Server = "https://prod.example.com"
+	incomplete := newApp("argocd", "incomplete", "prod")
+	incomplete.Spec.Project = ""
+	incomplete.Spec.Source = nil
+	incomplete.Spec.Sources = argoappv1.ApplicationSources{{RepoURL: "https://github.com/example/apps.git"}, {}}
+	apps := []argoappv1.Application{
+		newApp("argocd", "web", "prod"),
+		newApp("argocd", "web", "prod"),
+		newApp("team-a", "web", "prod"),
+		newApp("argocd", "Web_App", "prod"),
+		newApp("argocd", "local", "in-cluster"),
+		newApp("argocd", "staging", "staging"),
+		conflicting,
+		incomplete,
+	}
+
+	type result struct {
+		rule     string
+		app      string
+		message  string
+		advisory bool
+	}
+	var results []result
+	findings := checkApplications(apps, []destinationCluster{{Name: "prod"}})
+	require.Len(t, findings, len(apps))
+	// The findings of the first definition of an Application are not repeated
+	require.Empty(t, findings[1])
+	require.False(t, renderable(findings[7]))
+	require.True(t, renderable(findings[6]))
+	for _, f := range slices.Concat(findings...) {
+		require.Equal(t, categoryApplication, f.Category)
+		results = append(results, result{f.RuleID, f.Resource.Namespace + "/" + f.App, f.Message, f.Advisory})
+	}
+	require.Equal(t, []result{
+		{ruleAppDuplicate, "argocd/web", "defined 2 times", false},
+		{ruleAppNameConflict, "argocd/web",
+			"name also used in namespace(s) team-a, the --app-name filter and the skip list match all", true},
+		{ruleAppNameConflict, "team-a/web",
+			"name also used in namespace(s) argocd, the --app-name filter and the skip list match all", true},
+		{ruleAppName, "argocd/Web_App", "invalid name 'Web_App': a lowercase RFC 1123 subdomain must consist of " +
+			"lower case alphanumeric characters, '-' or '.', and must start and end with an alphanumeric character " +
+			"(e.g. 'example.com', regex used for validation is " +
+			"'[a-z0-9]([-a-z0-9]*[a-z0-9])?(\\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*')", false},
+		{ruleAppDestination, "argocd/staging", "destination cluster 'staging' is not a known cluster", false},
+		{ruleAppDestination, "argocd/conflicting",
+			"destination has both a name (prod) and a server (https://prod.example.com)", false},
+		{ruleAppRequiredField, "argocd/incomplete", "missing required field spec.project", false},
+		{ruleAppRequiredField, "argocd/incomplete", "missing required field spec.sources[1].repoURL", false},
+	}, results)
+
+	// The destination clusters are only checked when known
+	require.Equal(t, [][]finding{nil}, checkApplications([]argoappv1.Application{newApp("", "staging", "staging")}, nil))
+	missing := checkApplications([]argoappv1.Application{{}}, nil)[0]
+	require.Len(t, missing, 4)
+	require.Equal(t, "missing required field metadata.name", missing[0].Message)
+	require.Equal(t, "missing required field spec.source or spec.sources", missing[2].Message)
+	require.Equal(t, "destination has neither a name nor a server", missing[3].Message)
+}
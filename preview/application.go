@@ -1,48 +1,160 @@
 package preview
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/url"
+	"os"
 
 	argocmd "github.com/argoproj/argo-cd/v3/cmd/argocd/commands"
-	cmdutil "github.com/argoproj/argo-cd/v3/cmd/util"
+	"github.com/argoproj/argo-cd/v3/pkg/apis/application"
 	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/argoproj/argo-cd/v3/util/config"
+	"github.com/argoproj/gitops-engine/pkg/utils/kube"
 	log "github.com/sirupsen/logrus"
-	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
-// loadApplications loads Applications from a YAML file
-// Uses ArgoCD's ConstructApps utility function with minimal parameters
+// loadApplications loads Applications from a YAML or JSON file, "-" reading from stdin
+// The file can hold several documents, Lists or a JSON array, and resources other than Applications,
+// such as the AppProjects of an app-of-apps, which are skipped
 // Returns a value slice for consistency with ApplicationSet's generateApplications
 func loadApplications(filename string) []argoappv1.Application {
-	// Create empty FlagSet (required by ConstructApps)
-	flags := pflag.NewFlagSet("", pflag.ContinueOnError)
-
-	// Create empty AppOptions (no modifications to loaded YAML)
-	appOpts := cmdutil.AppOptions{}
-
-	// Call ConstructApps with minimal parameters
-	appPointers, err := cmdutil.ConstructApps(
-		filename,   // fileURL - path to YAML file
-		"",         // appName - deprecated, leave empty
-		[]string{}, // labels - no additional labels
-		[]string{}, // annotations - no additional annotations
-		[]string{}, // args - no command arguments
-		appOpts,    // appOpts - empty/default options
-		flags,      // flags - empty flag set
-	)
+	data, err := readManifestFile(filename)
 	if err != nil {
-		log.Fatal("failed to construct Application: ", err)
+		log.Fatal("failed to read Application manifest: ", err)
 	}
-
-	// Convert pointer slice to value slice for consistency with generateApplications pattern
-	apps := make([]argoappv1.Application, len(appPointers))
-	for i, app := range appPointers {
-		apps[i] = *app
+	objs, err := splitManifests(data, filename)
+	if err != nil {
+		log.Fatalf("failed to parse %s: %v", filename, err)
 	}
 
+	var apps []argoappv1.Application
+	for _, obj := range objs {
+		gvk := obj.GroupVersionKind()
+		if gvk.Group != application.Group || gvk.Kind != applicationKind {
+			log.Infof("Skipping %s '%s' of %s, not an Application", gvk.Kind, obj.GetName(), filename)
+			continue
+		}
+		var app argoappv1.Application
+		if err := decodeResource(obj, &app); err != nil {
+			log.Fatalf("failed to construct Application '%s': %v", obj.GetName(), err)
+		}
+		if app.Name == "" {
+			log.Fatalf("failed to construct Application: an Application of %s has no name", filename)
+		}
+		apps = append(apps, app)
+	}
 	return apps
 }
 
+// readManifestFile reads a manifest from a file, an http(s) URL, or stdin when the file name is "-"
+func readManifestFile(filename string) ([]byte, error) {
+	if filename == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	if u, err := url.ParseRequestURI(filename); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		return config.ReadRemoteFile(filename)
+	}
+	return os.ReadFile(filename) // #nosec G304 - user provided manifest
+}
+
+// loadManifestObjects loads the resources defined in the given manifest files, and in the YAML and JSON files
+// of the given directories
+func loadManifestObjects(paths []string) ([]*unstructured.Unstructured, error) {
+	files, err := expandManifestPaths(paths)
+	if err != nil {
+		return nil, err
+	}
+	var objs []*unstructured.Unstructured
+	for _, file := range files {
+		data, err := os.ReadFile(file) // #nosec G304 - user provided manifest
+		if err != nil {
+			return nil, err
+		}
+		fileObjs, err := splitManifests(data, file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+		}
+		objs = append(objs, fileObjs...)
+	}
+	return objs, nil
+}
+
+// splitManifests parses the YAML or JSON documents of a manifest, unwrapping Lists and JSON arrays into their items.
+// The invalid YAML documents fail, all of them being reported; the documents with duplicate keys are reported as
+// warnings naming the origin of the manifest, and fail in strict mode.
+func splitManifests(data []byte, origin string) ([]*unstructured.Unstructured, error) {
+	if err := checkManifestSchemas(data, origin); err != nil {
+		return nil, err
+	}
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var items []map[string]interface{}
+		if err := json.Unmarshal(trimmed, &items); err != nil {
+			return nil, err
+		}
+		objs := make([]*unstructured.Unstructured, 0, len(items))
+		for _, item := range items {
+			objs = append(objs, &unstructured.Unstructured{Object: item})
+		}
+		return objs, nil
+	}
+
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		// JSON objects
+		docs, err := kube.SplitYAML(data)
+		if err != nil {
+			return nil, err
+		}
+		return unwrapLists(docs)
+	}
+
+	docs, errs := splitYAMLDocuments(data)
+	var invalid []*documentError
+	for _, err := range errs {
+		if errors.Is(err, errDuplicateKeys) && !strictMode {
+			log.Warnf("%s of %s: %v", err.resource, origin, err.err)
+			continue
+		}
+		invalid = append(invalid, err)
+	}
+	if len(invalid) > 0 {
+		return nil, &invalidDocumentsError{errs: invalid}
+	}
+	return unwrapLists(docs)
+}
+
+// unwrapLists replaces the Lists (v1/List, or <Kind>List) by their items, including the Lists nested in Lists
+func unwrapLists(objs []*unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+	var unwrapped []*unstructured.Unstructured
+	for _, obj := range objs {
+		if !obj.IsList() {
+			unwrapped = append(unwrapped, obj)
+			continue
+		}
+		var items []*unstructured.Unstructured
+		err := obj.EachListItem(func(item runtime.Object) error {
+			if u, ok := item.(*unstructured.Unstructured); ok {
+				items = append(items, u)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the items of a List: %w", err)
+		}
+		if items, err = unwrapLists(items); err != nil {
+			return nil, err
+		}
+		unwrapped = append(unwrapped, items...)
+	}
+	return unwrapped, nil
+}
+
 // PreviewApplication outputs the Application spec(s)
 func PreviewApplication(filename string, appName string, output string) {
 	apps := loadApplications(filename)
@@ -92,7 +204,8 @@ func printApplicationsFormatted(apps []argoappv1.Application, appName string, ou
 }
 
 // PreviewApplicationResources generates and outputs Kubernetes manifests
-func PreviewApplicationResources(filename string, resKind string, output string) {
+func PreviewApplicationResources(filename string, opts RenderOptions) {
+	opts.Hooks.runPreLoadHook(filename)
 	apps := loadApplications(filename)
-	generateAndOutputManifests(apps, "", resKind, output)
+	generateAndOutputManifests(apps, opts)
 }
@@ -239,3 +239,65 @@ func TestGenerateMultiSourceManifestsAllHelmCharts(t *testing.T) {
 	// network access to Helm repositories. This test verifies the validation logic
 	// correctly allows all-Helm applications with different repositories.
 }
+
+// TestLoadApplicationsMixedManifests verifies that the resources other than Applications are skipped,
+// from multi-document YAML files and JSON Lists
+func TestLoadApplicationsMixedManifests(t *testing.T) {
+	apps := loadApplications("../testdata/test-app-of-apps.yaml")
+	require.Len(t, apps, 2)
+	require.Equal(t, "guestbook", apps[0].Name)
+	require.Equal(t, "guestbook", apps[0].Spec.Project)
+	require.Equal(t, "helm-guestbook", apps[1].Name)
+	require.JSONEq(t, `{"replicaCount":2}`, string(apps[1].Spec.Source.Helm.ValuesObject.Raw))
+
+	apps = loadApplications("../testdata/test-app.json")
+	require.Len(t, apps, 1)
+	require.Equal(t, "guestbook", apps[0].Name)
+	require.Equal(t, "guestbook", apps[0].Spec.Destination.Namespace)
+}
+
+// TestSplitManifests verifies that Lists and JSON arrays are unwrapped into their items
+func TestSplitManifests(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		expected []string
+	}{
+		{
+			name:     "multi-document YAML",
+			manifest: "kind: A\nmetadata: {name: a}\n---\nkind: B\nmetadata: {name: b}\n",
+			expected: []string{"a", "b"},
+		},
+		{
+			name:     "concatenated JSON objects",
+			manifest: `{"kind": "A", "metadata": {"name": "a"}} {"kind": "B", "metadata": {"name": "b"}}`,
+			expected: []string{"a", "b"},
+		},
+		{
+			name:     "JSON array",
+			manifest: `[{"kind": "A", "metadata": {"name": "a"}}, {"kind": "B", "metadata": {"name": "b"}}]`,
+			expected: []string{"a", "b"},
+		},
+		{
+			name:     "List",
+			manifest: "kind: List\nitems:\n- kind: A\n  metadata: {name: a}\n---\nkind: B\nmetadata: {name: b}\n",
+			expected: []string{"a", "b"},
+		},
+		{
+			name:     "nested Lists",
+			manifest: "kind: List\nitems:\n- kind: ApplicationList\n  items:\n  - kind: A\n    metadata: {name: a}\n",
+			expected: []string{"a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objs, err := splitManifests([]byte(tt.manifest), "test.yaml")
+			require.NoError(t, err)
+			var names []string
+			for _, obj := range objs {
+				names = append(names, obj.GetName())
+			}
+			require.Equal(t, tt.expected, names)
+		})
+	}
+}
@@ -1,8 +1,12 @@
 package preview
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"sort"
+	"strings"
 
 	appsettemplate "github.com/argoproj/argo-cd/v3/applicationset/controllers/template"
 	"github.com/argoproj/argo-cd/v3/applicationset/generators"
@@ -13,6 +17,7 @@ import (
 	"github.com/argoproj/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
 )
 
 // Output format constants
@@ -38,7 +43,13 @@ func initConfig() {
 	logger.SetLevel(log.WarnLevel)
 }
 
-func PreviewApplications(filename string, appName string, output string) {
+func PreviewApplications(filename string, appName string, output string, printParams bool) {
+	if printParams {
+		params, err := generateAppSetParams(loadApplicationSet(filename), appName)
+		errors.CheckError(err)
+		errors.CheckError(printAppSetParams(os.Stdout, params, output))
+		return
+	}
 	apps := generateApplications(filename)
 	switch output {
 	case outputFormatName:
@@ -81,20 +92,14 @@ func printAppSetFormatted(apps []argoappv1.Application, appName string, output s
 	}
 }
 
-func PreviewResources(filename string, appName string, resKind string, output string) {
+func PreviewResources(filename string, opts RenderOptions) {
+	opts.Hooks.runPreLoadHook(filename)
 	apps := generateApplications(filename)
-	generateAndOutputManifests(apps, appName, resKind, output)
+	generateAndOutputManifests(apps, opts)
 }
 
 func generateApplications(filename string) []argoappv1.Application {
-	appSets, err := cmdutil.ConstructApplicationSet(filename)
-	if err != nil {
-		log.Fatal("failed to construct ApplicationSet: ", err)
-	}
-	if len(appSets) > 1 {
-		log.Warnf("found %d ApplicationSets, only previewing the first entry", len(appSets))
-	}
-	appSet := appSets[0]
+	appSet := loadApplicationSet(filename)
 	appSetGenerators := getAppSetGenerators()
 	apps, _, err := appsettemplate.GenerateApplications(
 		log.NewEntry(logger),
@@ -109,6 +114,123 @@ func generateApplications(filename string) []argoappv1.Application {
 	return apps
 }
 
+// loadApplicationSet loads the first ApplicationSet of a manifest, checked in strict mode
+func loadApplicationSet(filename string) *argoappv1.ApplicationSet {
+	if data, err := readManifestFile(filename); err == nil {
+		errors.CheckError(checkManifestSchemas(data, filename))
+	}
+	appSets, err := cmdutil.ConstructApplicationSet(filename)
+	if err != nil {
+		log.Fatal("failed to construct ApplicationSet: ", err)
+	}
+	if len(appSets) > 1 {
+		log.Warnf("found %d ApplicationSets, only previewing the first entry", len(appSets))
+	}
+	appSet := appSets[0]
+	if strictMode {
+		errors.CheckError(checkStrictApplicationSet(filename))
+		errors.CheckError(checkSupportedGenerators(appSet))
+	}
+	return appSet
+}
+
+// generatorParams are the parameter sets produced by a generator of an ApplicationSet
+type generatorParams struct {
+	// Generator is the index of the generator in the ApplicationSet
+	Generator int `json:"generator"`
+	// Type is the type of the generator, e.g. list or matrix
+	Type         string      `json:"type"`
+	Applications []appParams `json:"applications"`
+	// Error is why the generator produced no parameters, e.g. a nested generator which is not supported
+	Error string `json:"error,omitempty"`
+}
+
+// appParams is a parameter set produced by a generator, before templating, and the Application it is templated into
+type appParams struct {
+	Name   string         `json:"name,omitempty"`
+	Params map[string]any `json:"params"`
+	// Error is the error of the templating of the Application name with the parameters
+	Error string `json:"error,omitempty"`
+}
+
+// generateAppSetParams returns the parameter sets each generator of an ApplicationSet produces, by generator, only
+// the ones of the Application with the given name when set
+func generateAppSetParams(appSet *argoappv1.ApplicationSet, appName string) ([]generatorParams, error) {
+	appSetGenerators := getAppSetGenerators()
+	renderer := &appsetutils.Render{}
+	result := make([]generatorParams, 0, len(appSet.Spec.Generators))
+	for i, requested := range appSet.Spec.Generators {
+		generated := generatorParams{Generator: i, Type: generatorType(requested), Applications: []appParams{}}
+		single := appSet.DeepCopy()
+		single.Spec.Generators = []argoappv1.ApplicationSetGenerator{requested}
+		if err := checkSupportedGenerators(single); err != nil {
+			generated.Error = err.Error()
+			result = append(result, generated)
+			continue
+		}
+		results, err := generators.Transform(requested, appSetGenerators, appSet.Spec.Template, appSet,
+			map[string]any{}, nil)
+		if err != nil {
+			return nil, fmt.Errorf("generator %d of ApplicationSet '%s' failed: %w", i, appSet.Name, err)
+		}
+		for _, r := range results {
+			tmplApplication := appsettemplate.GetTempApplication(r.Template)
+			for _, params := range r.Params {
+				entry := appParams{Params: params}
+				app, err := renderer.RenderTemplateParams(tmplApplication, appSet.Spec.SyncPolicy, params,
+					appSet.Spec.GoTemplate, appSet.Spec.GoTemplateOptions)
+				if err != nil {
+					entry.Error = err.Error()
+				} else {
+					entry.Name = app.Name
+				}
+				if !shouldMatch(appName) || appName == entry.Name {
+					generated.Applications = append(generated.Applications, entry)
+				}
+			}
+		}
+		result = append(result, generated)
+	}
+	return result, nil
+}
+
+// generatorType returns the type of a generator, which is the name of its field, e.g. list
+func generatorType(generator argoappv1.ApplicationSetGenerator) string {
+	data, err := json.Marshal(generator)
+	if err != nil {
+		return ""
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return ""
+	}
+	var types []string
+	for name := range fields {
+		if name != "selector" {
+			types = append(types, name)
+		}
+	}
+	sort.Strings(types)
+	return strings.Join(types, ",")
+}
+
+// printAppSetParams prints the parameter sets of the generators, as JSON or else YAML
+func printAppSetParams(w io.Writer, params []generatorParams, output string) error {
+	var data []byte
+	var err error
+	if output == outputFormatJSON {
+		data, err = json.MarshalIndent(params, "", "  ")
+		data = append(data, '\n')
+	} else {
+		data, err = yaml.Marshal(params)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
 func getAppSetGenerators() map[string]generators.Generator {
 	terminalGenerators := map[string]generators.Generator{
 		"List": generators.NewListGenerator(),
@@ -0,0 +1,71 @@
+package preview
+
+import (
+	"bytes"
+	"testing"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/yaml"
+)
+
+// TestGenerateAppSetParams verifies that the parameters of each generator are returned with the name of the
+// Application they are templated into, the matrix combining the parameters of its children, and that the
+// generators which are not supported are reported
+func TestGenerateAppSetParams(t *testing.T) {
+	var appSet argoappv1.ApplicationSet
+	require.NoError(t, yaml.Unmarshal([]byte(`metadata:
+  name: apps
+spec:
+  goTemplate: true
+  generators:
+    - list:
+        elements: [{app: web, env: dev}]
+    - matrix:
+        generators:
+          - list:
+              elements: [{app: api}, {app: worker}]
+          - list:
+              elements: [{env: prod}]
+  template:
+    metadata:
+      name: '{{ .app }}-{{ .env }}'
+    spec:
+      project: default
+      source: {repoURL: https://github.com/example/apps.git, path: '{{ .app }}'}
+      destination: {server: https://kubernetes.default.svc, namespace: '{{ .env }}'}
+`), &appSet))
+
+	params, err := generateAppSetParams(&appSet, "")
+	require.NoError(t, err)
+	require.Len(t, params, 2)
+	require.Equal(t, "list", params[0].Type)
+	require.Equal(t, []appParams{{Name: "web-dev", Params: map[string]any{"app": "web", "env": "dev"}}},
+		params[0].Applications)
+	require.Equal(t, 1, params[1].Generator)
+	require.Equal(t, "matrix", params[1].Type)
+	require.Len(t, params[1].Applications, 2)
+	require.Equal(t, "api-prod", params[1].Applications[0].Name)
+	require.Equal(t, "prod", params[1].Applications[0].Params["env"])
+
+	params, err = generateAppSetParams(&appSet, "worker-prod")
+	require.NoError(t, err)
+	require.Empty(t, params[0].Applications)
+	require.Len(t, params[1].Applications, 1)
+
+	var out bytes.Buffer
+	require.NoError(t, printAppSetParams(&out, params[:1], outputFormatYAML))
+	require.Equal(t, "- applications: []\n  generator: 0\n  type: list\n", out.String())
+
+	appSet.Spec.Generators = append(appSet.Spec.Generators, argoappv1.ApplicationSetGenerator{
+		Git: &argoappv1.GitGenerator{RepoURL: "https://github.com/example/apps.git"},
+	})
+	params, err = generateAppSetParams(&appSet, "")
+	require.NoError(t, err)
+	require.Equal(t, generatorParams{
+		Generator:    2,
+		Type:         "git",
+		Applications: []appParams{},
+		Error:        "ApplicationSet 'apps' uses generators which are not supported: git",
+	}, params[2])
+}
@@ -0,0 +1,233 @@
+package preview
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/klauspost/compress/zstd"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// Directories of the entries of the output archives
+const (
+	archiveObjectsDir = "objects"
+	archiveAppsDir    = "apps"
+)
+
+// maxArchiveEntrySize bounds the size of an entry read from an output archive
+const maxArchiveEntrySize = 64 << 20
+
+// ArchiveExtractOptions holds the settings of the archive extract command
+type ArchiveExtractOptions struct {
+	// OutputDir is the directory the resources are written to, grouped by destination cluster as with --output-dir
+	OutputDir string
+	// SplitCRDs writes the CustomResourceDefinitions of each cluster to a crds.yaml stream applied before apply.yaml
+	SplitCRDs bool
+}
+
+// archivedApp is the entry of an Application in an output archive, referencing its resources by hash
+type archivedApp struct {
+	Name        string                           `json:"name"`
+	Namespace   string                           `json:"namespace,omitempty"`
+	Destination argoappv1.ApplicationDestination `json:"destination"`
+	// Resources are the SHA-256 hashes of the resources of the Application, in order
+	Resources []string `json:"resources"`
+}
+
+// resourceArchive writes the rendered resources to a zstd-compressed tar archive, content-addressed so that the
+// resources rendered identically for several Applications, e.g. for each cluster of a fleet, are stored once:
+// - objects/<sha256>.yaml holds each distinct resource
+// - apps/<n>.json holds each Application, its destination and the hashes of its resources, after its objects
+//
+// The entries are written as each Application is rendered, the archive can be extracted as a stream.
+type resourceArchive struct {
+	filename string
+	file     *outputFile
+	zstd     *zstd.Encoder
+	tar      *tar.Writer
+	stored   map[string]bool
+	apps     int
+	// resources is the number of resources archived, len(stored) the number of distinct ones
+	resources int
+}
+
+// newResourceArchive creates an output archive, encrypted when the output is encrypted
+func newResourceArchive(filename string) (*resourceArchive, error) {
+	file, err := createOutputFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output archive: %w", err)
+	}
+	encoder, err := zstd.NewWriter(file)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return &resourceArchive{
+		filename: outputFileName(filename),
+		file:     file,
+		zstd:     encoder,
+		tar:      tar.NewWriter(encoder),
+		stored:   map[string]bool{},
+	}, nil
+}
+
+// add writes the resources of an Application not stored yet, then the entry of the Application
+func (a *resourceArchive) add(app argoappv1.Application, resources []unstructured.Unstructured) error {
+	if app.Spec.Destination.Server == "" && app.Spec.Destination.Name == "" {
+		return fmt.Errorf("application '%s' has no destination cluster", app.Name)
+	}
+	entry := archivedApp{Name: app.Name, Namespace: app.Namespace, Destination: app.Spec.Destination}
+	for i := range resources {
+		data, err := toYAML(&resources[i])
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256([]byte(data))
+		hash := hex.EncodeToString(sum[:])
+		if !a.stored[hash] {
+			if err := a.writeEntry(path.Join(archiveObjectsDir, hash+".yaml"), []byte(data)); err != nil {
+				return err
+			}
+			a.stored[hash] = true
+		}
+		entry.Resources = append(entry.Resources, hash)
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	a.apps++
+	a.resources += len(resources)
+	return a.writeEntry(path.Join(archiveAppsDir, fmt.Sprintf("%06d.json", a.apps)), data)
+}
+
+// writeEntry writes a file entry, without modification time so that the same resources give the same archive
+func (a *resourceArchive) writeEntry(name string, data []byte) error {
+	header := &tar.Header{Name: name, Mode: 0o600, Size: int64(len(data)), ModTime: time.Unix(0, 0)}
+	if err := a.tar.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write %s to the output archive: %w", name, err)
+	}
+	if _, err := a.tar.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s to the output archive: %w", name, err)
+	}
+	return nil
+}
+
+// close flushes the archive and prints how many resources it holds, and how many distinct ones it stores
+func (a *resourceArchive) close() error {
+	err := a.tar.Close()
+	if closeErr := a.zstd.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := a.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write output archive: %w", err)
+	}
+	fmt.Printf("%s: %d Applications, %d resources, %d distinct\n", a.filename, a.apps, a.resources,
+		len(a.stored))
+	return nil
+}
+
+// ExtractArchive writes the resources of an output archive, - for the standard input, to a directory, grouped by
+// destination cluster as with --output-dir
+func ExtractArchive(filename string, opts ArchiveExtractOptions) {
+	if !shouldMatch(opts.OutputDir) {
+		log.Fatal("the directory the archive is extracted to must be given with --output-dir")
+	}
+	var r io.Reader = os.Stdin
+	if filename != "-" {
+		file, err := os.Open(filename) // #nosec G304 - archive given by the user
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		r = file
+	}
+	output, err := newClusterOutput(opts.OutputDir, false, opts.SplitCRDs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := extractArchive(r, output.add); err != nil {
+		log.Fatalf("failed to extract %s: %v", filename, err)
+	}
+	if err := printClusterOutput(output); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// extractArchive reads an output archive, calling add with the resources of each Application. The distinct
+// resources are held in memory until the end of the archive.
+func extractArchive(r io.Reader, add func(argoappv1.Application, []unstructured.Unstructured) error) error {
+	decoder, err := zstd.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer decoder.Close()
+	objects := map[string][]byte{}
+	archive := tar.NewReader(decoder)
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if header.Size > maxArchiveEntrySize {
+			return fmt.Errorf("entry %s exceeds %d bytes", header.Name, maxArchiveEntrySize)
+		}
+		data, err := io.ReadAll(archive)
+		if err != nil {
+			return err
+		}
+		dir, name := path.Split(header.Name)
+		switch path.Clean(dir) {
+		case archiveObjectsDir:
+			objects[strings.TrimSuffix(name, ".yaml")] = data
+		case archiveAppsDir:
+			var entry archivedApp
+			if err := json.Unmarshal(data, &entry); err != nil {
+				return fmt.Errorf("invalid entry %s: %w", header.Name, err)
+			}
+			app := argoappv1.Application{}
+			app.Name, app.Namespace, app.Spec.Destination = entry.Name, entry.Namespace, entry.Destination
+			resources := make([]unstructured.Unstructured, 0, len(entry.Resources))
+			for _, hash := range entry.Resources {
+				object, ok := objects[hash]
+				if !ok {
+					return fmt.Errorf("resource %s of Application '%s' not found", hash, entry.Name)
+				}
+				// Parsed from JSON as the rendered manifests are, the integers staying integers
+				data, err := yaml.YAMLToJSON(object)
+				if err != nil {
+					return fmt.Errorf("invalid resource %s: %w", hash, err)
+				}
+				resource := unstructured.Unstructured{}
+				if err := resource.UnmarshalJSON(data); err != nil {
+					return fmt.Errorf("invalid resource %s: %w", hash, err)
+				}
+				resources = append(resources, resource)
+			}
+			if err := add(app, resources); err != nil {
+				return err
+			}
+		}
+	}
+}
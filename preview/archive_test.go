@@ -0,0 +1,65 @@
+package preview
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// TestResourceArchive verifies that the resources rendered identically for several Applications are stored once,
+// and that the Applications are extracted with their resources, in order
+func TestResourceArchive(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "out.tar.zst")
+	archive, err := newResourceArchive(filename)
+	require.NoError(t, err)
+
+	newApp := func(cluster string) argoappv1.Application {
+		return argoappv1.Application{
+			ObjectMeta: metav1.ObjectMeta{Name: "web-" + cluster, Namespace: "argocd"},
+			Spec:       argoappv1.ApplicationSpec{Destination: argoappv1.ApplicationDestination{Name: cluster}},
+		}
+	}
+	shared := newTestResource("apps/v1", "Deployment", "web", map[string]interface{}{"replicas": int64(2)})
+	resources := map[string][]unstructured.Unstructured{
+		"prod-eu": {shared, newTestResource("v1", "ConfigMap", "web-eu", nil)},
+		"prod-us": {newTestResource("v1", "ConfigMap", "web-us", nil), shared},
+	}
+	for _, cluster := range []string{"prod-eu", "prod-us"} {
+		require.NoError(t, archive.add(newApp(cluster), resources[cluster]))
+	}
+	require.Error(t, archive.add(argoappv1.Application{}, nil))
+	require.NoError(t, archive.close())
+	require.Equal(t, 4, archive.resources)
+	require.Len(t, archive.stored, 3)
+
+	file, err := os.Open(filename)
+	require.NoError(t, err)
+	defer file.Close()
+	var extracted []string
+	require.NoError(t, extractArchive(file, func(app argoappv1.Application, objs []unstructured.Unstructured) error {
+		cluster := app.Spec.Destination.Name
+		require.Equal(t, newApp(cluster).ObjectMeta, app.ObjectMeta)
+		expected, err := manifestStream(resources[cluster])
+		require.NoError(t, err)
+		actual, err := manifestStream(objs)
+		require.NoError(t, err)
+		require.Equal(t, expected, actual)
+		for i := range objs {
+			require.Equal(t, newResourceKey(&resources[cluster][i]), newResourceKey(&objs[i]))
+			if objs[i].GetKind() == "Deployment" {
+				// The integers are parsed as in the rendered manifests
+				replicas, _, err := unstructured.NestedInt64(objs[i].Object, "spec", "replicas")
+				require.NoError(t, err)
+				require.Equal(t, int64(2), replicas)
+			}
+		}
+		extracted = append(extracted, app.Name)
+		return nil
+	}))
+	require.Equal(t, []string{"web-prod-eu", "web-prod-us"}, extracted)
+}
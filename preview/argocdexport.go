@@ -0,0 +1,372 @@
+package preview
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/argoproj/argo-cd/v3/common"
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	repoapiclient "github.com/argoproj/argo-cd/v3/reposerver/apiclient"
+	"github.com/argoproj/argo-cd/v3/reposerver/repository"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// secretTypeLabel is the label of the Secrets holding the clusters, repositories and credential templates
+	secretTypeLabel = "argocd.argoproj.io/secret-type"
+	// argoCDConfigMap and argoCDCmdParamsConfigMap are the ConfigMaps holding the settings of Argo CD
+	argoCDConfigMap          = "argocd-cm"
+	argoCDCmdParamsConfigMap = "argocd-cmd-params-cm"
+)
+
+// currentArgoCDExport is the Argo CD namespace export given with --argocd-export, nil when not set
+var currentArgoCDExport *argoCDExport
+
+// argoCDExport holds what is read from the resources exported from the namespace of an Argo CD installation
+type argoCDExport struct {
+	// clusters are the destination clusters of the cluster Secrets
+	clusters []destinationCluster
+	// repos are the repositories of the repository Secrets, matched by URL
+	repos []argoappv1.Repository
+	// repoCreds are the credential templates of the repo-creds Secrets, matched by URL prefix
+	repoCreds []argoappv1.RepoCreds
+	// settings of argocd-cm
+	appLabelKey       string
+	trackingMethod    string
+	installationID    string
+	kustomizeBuild    string
+	valuesFileSchemes []string
+	// params of argocd-cmd-params-cm read by the repository server
+	params map[string]string
+}
+
+// LoadArgoCDExport reads the clusters, repository credentials and settings of an Argo CD installation from the
+// resources exported from its namespace, e.g. with kubectl get secret,configmap -n argocd -o yaml. The clusters of
+// the export are added to the ones given with --clusters, completed with the name or server of their cluster Secret.
+func LoadArgoCDExport(dir string) {
+	export, err := loadArgoCDExport(dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, c := range export.clusters {
+		known := lookupCluster(currentClusters, argoappv1.ApplicationDestination{Name: c.Name, Server: c.Server})
+		switch {
+		case known == nil:
+			currentClusters = append(currentClusters, c)
+		case known.Name == "":
+			known.Name = c.Name
+		case known.Server == "":
+			known.Server = c.Server
+		}
+	}
+	log.Debugf("Read %d clusters, %d repositories and %d credential templates from the Argo CD export %s",
+		len(export.clusters), len(export.repos), len(export.repoCreds), dir)
+	currentArgoCDExport = export
+}
+
+// loadArgoCDExport reads the cluster, repository and repo-creds Secrets, argocd-cm and argocd-cmd-params-cm among
+// the resources of a directory, skipping the other resources
+func loadArgoCDExport(dir string) (*argoCDExport, error) {
+	objs, err := loadManifestObjects([]string{dir})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the Argo CD export: %w", err)
+	}
+	// The instance label key and the tracking method default to the ones of Argo CD when argocd-cm does not set them
+	export := &argoCDExport{
+		appLabelKey:    common.LabelKeyAppInstance,
+		trackingMethod: string(argoappv1.TrackingMethodAnnotation),
+		params:         map[string]string{},
+	}
+	for _, obj := range objs {
+		if obj.GroupVersionKind().Group != "" {
+			continue
+		}
+		switch {
+		case obj.GetKind() == "Secret":
+			if err := export.addSecret(obj); err != nil {
+				return nil, err
+			}
+		case obj.GetKind() == "ConfigMap" && obj.GetName() == argoCDConfigMap:
+			data, _, _ := unstructured.NestedStringMap(obj.Object, "data")
+			if key := data["application.instanceLabelKey"]; key != "" {
+				export.appLabelKey = key
+			}
+			if method := data["application.resourceTrackingMethod"]; method != "" {
+				export.trackingMethod = method
+			}
+			export.installationID = data["installationID"]
+			export.kustomizeBuild = data["kustomize.buildOptions"]
+			if schemes := data["helm.valuesFileSchemes"]; schemes != "" {
+				for _, scheme := range strings.Split(schemes, ",") {
+					export.valuesFileSchemes = append(export.valuesFileSchemes, strings.TrimSpace(scheme))
+				}
+			}
+		case obj.GetKind() == "ConfigMap" && obj.GetName() == argoCDCmdParamsConfigMap:
+			data, _, _ := unstructured.NestedStringMap(obj.Object, "data")
+			for key, value := range data {
+				export.params[key] = value
+			}
+		}
+	}
+	// The longest prefix wins, as in Argo CD
+	sort.SliceStable(export.repoCreds, func(i, j int) bool {
+		return len(export.repoCreds[i].URL) > len(export.repoCreds[j].URL)
+	})
+	return export, nil
+}
+
+// addSecret adds the cluster, repository or credential template of a Secret labelled with its type
+func (e *argoCDExport) addSecret(obj *unstructured.Unstructured) error {
+	secretType := obj.GetLabels()[secretTypeLabel]
+	if secretType == "" {
+		return nil
+	}
+	data, err := secretData(obj)
+	if err != nil {
+		return err
+	}
+	switch secretType {
+	case "cluster":
+		if data["name"] == "" && data["server"] == "" {
+			return fmt.Errorf("cluster Secret '%s' has neither a name nor a server", obj.GetName())
+		}
+		e.clusters = append(e.clusters, destinationCluster{Name: data["name"], Server: data["server"]})
+	case "repository":
+		repo := argoappv1.Repository{
+			Repo:                       data["url"],
+			Type:                       data["type"],
+			Name:                       data["name"],
+			Username:                   data["username"],
+			Password:                   data["password"],
+			BearerToken:                data["bearerToken"],
+			SSHPrivateKey:              data["sshPrivateKey"],
+			TLSClientCertData:          data["tlsClientCertData"],
+			TLSClientCertKey:           data["tlsClientCertKey"],
+			GithubAppPrivateKey:        data["githubAppPrivateKey"],
+			GitHubAppEnterpriseBaseURL: data["githubAppEnterpriseBaseUrl"],
+			GCPServiceAccountKey:       data["gcpServiceAccountKey"],
+			Proxy:                      data["proxy"],
+			NoProxy:                    data["noProxy"],
+		}
+		flags := map[string]*bool{
+			"insecure":                 &repo.Insecure,
+			"insecureIgnoreHostKey":    &repo.InsecureIgnoreHostKey,
+			"enableLfs":                &repo.EnableLFS,
+			"enableOCI":                &repo.EnableOCI,
+			"insecureOCIForceHttp":     &repo.InsecureOCIForceHttp,
+			"forceHttpBasicAuth":       &repo.ForceHttpBasicAuth,
+			"useAzureWorkloadIdentity": &repo.UseAzureWorkloadIdentity,
+		}
+		ids := map[string]*int64{"githubAppID": &repo.GithubAppId, "githubAppInstallationID": &repo.GithubAppInstallationId}
+		if err := parseSecretFields(obj, data, flags, ids); err != nil {
+			return err
+		}
+		e.repos = append(e.repos, repo)
+	case "repo-creds":
+		creds := argoappv1.RepoCreds{
+			URL:                        data["url"],
+			Type:                       data["type"],
+			Username:                   data["username"],
+			Password:                   data["password"],
+			BearerToken:                data["bearerToken"],
+			SSHPrivateKey:              data["sshPrivateKey"],
+			TLSClientCertData:          data["tlsClientCertData"],
+			TLSClientCertKey:           data["tlsClientCertKey"],
+			GithubAppPrivateKey:        data["githubAppPrivateKey"],
+			GitHubAppEnterpriseBaseURL: data["githubAppEnterpriseBaseUrl"],
+			GCPServiceAccountKey:       data["gcpServiceAccountKey"],
+			Proxy:                      data["proxy"],
+			NoProxy:                    data["noProxy"],
+		}
+		flags := map[string]*bool{
+			"enableOCI":                &creds.EnableOCI,
+			"insecureOCIForceHttp":     &creds.InsecureOCIForceHttp,
+			"forceHttpBasicAuth":       &creds.ForceHttpBasicAuth,
+			"useAzureWorkloadIdentity": &creds.UseAzureWorkloadIdentity,
+		}
+		ids := map[string]*int64{
+			"githubAppID":             &creds.GithubAppId,
+			"githubAppInstallationID": &creds.GithubAppInstallationId,
+		}
+		if err := parseSecretFields(obj, data, flags, ids); err != nil {
+			return err
+		}
+		e.repoCreds = append(e.repoCreds, creds)
+	}
+	return nil
+}
+
+// parseSecretFields parses the boolean and integer fields of a repository or repo-creds Secret, as Argo CD does
+func parseSecretFields(
+	obj *unstructured.Unstructured,
+	data map[string]string,
+	flags map[string]*bool,
+	ids map[string]*int64,
+) error {
+	for key, flag := range flags {
+		if value, ok := data[key]; ok {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s '%s' of Secret '%s': %w", key, value, obj.GetName(), err)
+			}
+			*flag = parsed
+		}
+	}
+	for key, id := range ids {
+		if value, ok := data[key]; ok {
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid %s '%s' of Secret '%s': %w", key, value, obj.GetName(), err)
+			}
+			*id = parsed
+		}
+	}
+	return nil
+}
+
+// secretData returns the decoded data of a Secret, merged with its stringData like the API server does
+func secretData(obj *unstructured.Unstructured) (map[string]string, error) {
+	encoded, _, _ := unstructured.NestedStringMap(obj.Object, "data")
+	data := make(map[string]string, len(encoded))
+	for key, value := range encoded {
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid data '%s' of Secret '%s': %w", key, obj.GetName(), err)
+		}
+		data[key] = string(decoded)
+	}
+	stringData, _, _ := unstructured.NestedStringMap(obj.Object, "stringData")
+	for key, value := range stringData {
+		data[key] = value
+	}
+	return data, nil
+}
+
+// findRepository returns a copy of the repository of a URL: the one of its repository Secret, with the credentials
+// of the credential template with the longest matching URL prefix when it has none, as in Argo CD. Nil when neither
+// matches.
+func (e *argoCDExport) findRepository(repoURL string) *argoappv1.Repository {
+	if e == nil {
+		return nil
+	}
+	var repo *argoappv1.Repository
+	url := strings.TrimSuffix(repoURL, "/")
+	for i := range e.repos {
+		if strings.TrimSuffix(e.repos[i].Repo, "/") == url {
+			repo = e.repos[i].DeepCopy()
+			break
+		}
+	}
+	if repo != nil && repo.HasCredentials() {
+		return repo
+	}
+	for i := range e.repoCreds {
+		if c := &e.repoCreds[i]; c.URL != "" && strings.HasPrefix(repoURL, c.URL) {
+			if repo == nil {
+				repo = &argoappv1.Repository{Repo: repoURL, EnableOCI: c.EnableOCI}
+			}
+			repo.CopyCredentialsFrom(c)
+			break
+		}
+	}
+	return repo
+}
+
+// findRepoCredentials returns the username and password of a repository, false when it has none
+func (e *argoCDExport) findRepoCredentials(repoURL string) (string, string, bool) {
+	repo := e.findRepository(repoURL)
+	if repo == nil || (repo.Username == "" && repo.Password == "") {
+		return "", "", false
+	}
+	return repo.Username, repo.Password, true
+}
+
+// remoteRepository returns the repository of a remote URL passed to the repository service: the repository of the
+// Argo CD export, e.g. with its SSH key, TLS client certificate or proxy, and the username and password found by
+// FindRepoUsername and FindRepoPassword
+func remoteRepository(repoURL string) *argoappv1.Repository {
+	repo := currentArgoCDExport.findRepository(repoURL)
+	if repo == nil {
+		repo = &argoappv1.Repository{}
+	}
+	repo.Repo = repoURL
+	repo.Username = FindRepoUsername(repoURL)
+	repo.Password = FindRepoPassword(repoURL)
+	return repo
+}
+
+// trackingLabelKey returns the label tracking the resources of the Applications, empty when they are not tracked by
+// label
+func (e *argoCDExport) trackingLabelKey() string {
+	if e == nil {
+		return ""
+	}
+	switch argoappv1.TrackingMethod(e.trackingMethod) {
+	case argoappv1.TrackingMethodLabel, argoappv1.TrackingMethodAnnotationAndLabel:
+		return e.appLabelKey
+	}
+	return ""
+}
+
+// applySettings sets the settings of Argo CD on a manifest request, as the application controller does: the
+// instance label key, the tracking method, the installation ID, the Kustomize build options, the Helm values file
+// schemes, and the Helm repositories and credential templates used for the chart dependencies
+func (e *argoCDExport) applySettings(q *repoapiclient.ManifestRequest) {
+	if e == nil {
+		return
+	}
+	q.AppLabelKey = e.appLabelKey
+	q.TrackingMethod = e.trackingMethod
+	q.InstallationID = e.installationID
+	if e.kustomizeBuild != "" {
+		if q.KustomizeOptions == nil {
+			q.KustomizeOptions = &argoappv1.KustomizeOptions{}
+		}
+		q.KustomizeOptions.BuildOptions = e.kustomizeBuild
+	}
+	if e.valuesFileSchemes != nil {
+		q.HelmOptions = &argoappv1.HelmOptions{ValuesFileSchemes: e.valuesFileSchemes}
+	}
+	for i := range e.repos {
+		if e.repos[i].Type == "helm" {
+			q.Repos = append(q.Repos, &e.repos[i])
+		}
+	}
+	for i := range e.repoCreds {
+		if e.repoCreds[i].Type == "helm" {
+			q.HelmRepoCreds = append(q.HelmRepoCreds, &e.repoCreds[i])
+		}
+	}
+}
+
+// applyParams sets the params of argocd-cmd-params-cm read by the repository server on its init constants
+func (e *argoCDExport) applyParams(initConstants *repository.RepoServerInitConstants) {
+	if e == nil {
+		return
+	}
+	flags := map[string]*bool{
+		"reposerver.enable.git.submodule":               &initConstants.SubmoduleEnabled,
+		"reposerver.include.hidden.directories":         &initConstants.IncludeHiddenDirectories,
+		"reposerver.allow.oob.symlinks":                 &initConstants.AllowOutOfBoundsSymlinks,
+		"reposerver.plugin.use.manifest.generate.paths": &initConstants.CMPUseManifestGeneratePaths,
+	}
+	for key, flag := range flags {
+		value, ok := e.params[key]
+		if !ok {
+			continue
+		}
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			log.Warnf("Ignoring the invalid %s '%s' of %s", key, value, argoCDCmdParamsConfigMap)
+			continue
+		}
+		*flag = enabled
+	}
+	if exclusions := e.params["reposerver.plugin.tar.exclusions"]; exclusions != "" {
+		initConstants.CMPTarExcludedGlobs = strings.Split(exclusions, ";")
+	}
+}
@@ -0,0 +1,215 @@
+package preview
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	repoapiclient "github.com/argoproj/argo-cd/v3/reposerver/apiclient"
+	"github.com/argoproj/argo-cd/v3/reposerver/repository"
+	"github.com/stretchr/testify/require"
+)
+
+// argoCDExportManifest is an export of an Argo CD namespace, as printed by kubectl get secret,configmap -o yaml
+const argoCDExportManifest = `apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: Secret
+  metadata:
+    name: cluster-prod
+    labels:
+      argocd.argoproj.io/secret-type: cluster
+  data:
+    name: cHJvZA==
+    server: aHR0cHM6Ly9wcm9kLmV4YW1wbGUuY29t
+- apiVersion: v1
+  kind: Secret
+  metadata:
+    name: repo-charts
+    labels:
+      argocd.argoproj.io/secret-type: repository
+  stringData:
+    type: helm
+    url: https://charts.example.com/stable
+    username: charts
+    password: s3cr3t
+    insecure: "true"
+    proxy: http://proxy.example.com:3128
+- apiVersion: v1
+  kind: Secret
+  metadata:
+    name: repo-infra
+    labels:
+      argocd.argoproj.io/secret-type: repository
+  stringData:
+    url: git@github.com:example/infra.git
+    sshPrivateKey: ssh-key
+- apiVersion: v1
+  kind: Secret
+  metadata:
+    name: creds-github
+    labels:
+      argocd.argoproj.io/secret-type: repo-creds
+  stringData:
+    url: https://github.com/example
+    username: bot
+    password: token
+- apiVersion: v1
+  kind: Secret
+  metadata:
+    name: creds-github-app
+    labels:
+      argocd.argoproj.io/secret-type: repo-creds
+  stringData:
+    url: https://github.com/example-org
+    githubAppID: "1234"
+    githubAppInstallationID: "5678"
+    githubAppPrivateKey: app-key
+    tlsClientCertData: cert
+    tlsClientCertKey: key
+- apiVersion: v1
+  kind: Secret
+  metadata:
+    name: creds-github-team
+    labels:
+      argocd.argoproj.io/secret-type: repo-creds
+  stringData:
+    url: https://github.com/example/team
+    username: team-bot
+    password: team-token
+- apiVersion: v1
+  kind: Secret
+  metadata:
+    name: argocd-secret
+  stringData:
+    admin.password: ignored
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: argocd-cm
+  data:
+    application.instanceLabelKey: argocd.argoproj.io/instance
+    application.resourceTrackingMethod: annotation
+    kustomize.buildOptions: --enable-helm
+    helm.valuesFileSchemes: https, s3
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: argocd-cmd-params-cm
+  data:
+    reposerver.enable.git.submodule: "true"
+    reposerver.plugin.tar.exclusions: .git/*;*.tgz
+`
+
+// TestLoadArgoCDExport verifies that the clusters, repository credentials and settings are read from the Secrets
+// and ConfigMaps of an export, the other resources being skipped
+func TestLoadArgoCDExport(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "argocd.yaml"), []byte(argoCDExportManifest), 0o600))
+
+	export, err := loadArgoCDExport(dir)
+	require.NoError(t, err)
+	require.Equal(t, []destinationCluster{{Name: "prod", Server: "https://prod.example.com"}}, export.clusters)
+
+	username, password, ok := export.findRepoCredentials("https://charts.example.com/stable/")
+	require.True(t, ok)
+	require.Equal(t, "charts", username)
+	require.Equal(t, "s3cr3t", password)
+	// The credential template with the longest prefix is used
+	username, _, ok = export.findRepoCredentials("https://github.com/example/team/infra.git")
+	require.True(t, ok)
+	require.Equal(t, "team-bot", username)
+	username, _, ok = export.findRepoCredentials("https://github.com/example/apps.git")
+	require.True(t, ok)
+	require.Equal(t, "bot", username)
+	_, _, ok = export.findRepoCredentials("https://gitlab.com/example/apps.git")
+	require.False(t, ok)
+
+	// The other fields of the repository and repo-creds Secrets are passed to the repository service
+	charts := remoteRepositoryOf(t, export, "https://charts.example.com/stable")
+	require.True(t, charts.Insecure)
+	require.Equal(t, "http://proxy.example.com:3128", charts.Proxy)
+	require.Equal(t, "ssh-key", remoteRepositoryOf(t, export, "git@github.com:example/infra.git").SSHPrivateKey)
+	app := remoteRepositoryOf(t, export, "https://github.com/example-org/apps.git")
+	require.Equal(t, "https://github.com/example-org/apps.git", app.Repo)
+	require.Equal(t, int64(1234), app.GithubAppId)
+	require.Equal(t, int64(5678), app.GithubAppInstallationId)
+	require.Equal(t, "app-key", app.GithubAppPrivateKey)
+	require.Equal(t, "cert", app.TLSClientCertData)
+	require.Equal(t, "key", app.TLSClientCertKey)
+
+	q := &repoapiclient.ManifestRequest{}
+	export.applySettings(q)
+	require.Equal(t, "argocd.argoproj.io/instance", q.AppLabelKey)
+	require.Equal(t, "annotation", q.TrackingMethod)
+	require.Equal(t, "--enable-helm", q.KustomizeOptions.BuildOptions)
+	require.Equal(t, []string{"https", "s3"}, q.HelmOptions.ValuesFileSchemes)
+	require.Len(t, q.Repos, 1)
+	require.Equal(t, "https://charts.example.com/stable", q.Repos[0].Repo)
+
+	initConstants := repository.RepoServerInitConstants{}
+	export.applyParams(&initConstants)
+	require.True(t, initConstants.SubmoduleEnabled)
+	require.Equal(t, []string{".git/*", "*.tgz"}, initConstants.CMPTarExcludedGlobs)
+
+	var nilExport *argoCDExport
+	_, _, ok = nilExport.findRepoCredentials("https://charts.example.com/stable")
+	require.False(t, ok)
+	nilExport.applySettings(q)
+
+	// The tracking settings default to the ones of Argo CD
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "argocd.yaml"), []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: argocd-cm
+data:
+  installationID: prod
+`), 0o600))
+	export, err = loadArgoCDExport(dir)
+	require.NoError(t, err)
+	q = &repoapiclient.ManifestRequest{}
+	export.applySettings(q)
+	require.Equal(t, "app.kubernetes.io/instance", q.AppLabelKey)
+	require.Equal(t, "annotation", q.TrackingMethod)
+
+	// The invalid fields fail
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "argocd.yaml"), []byte(`apiVersion: v1
+kind: Secret
+metadata:
+  name: repo
+  labels:
+    argocd.argoproj.io/secret-type: repository
+stringData:
+  url: https://github.com/example/apps.git
+  githubAppID: app
+`), 0o600))
+	_, err = loadArgoCDExport(dir)
+	require.ErrorContains(t, err, "invalid githubAppID 'app' of Secret 'repo'")
+}
+
+// remoteRepositoryOf returns the repository passed to the repository service for a URL with an Argo CD export
+func remoteRepositoryOf(t *testing.T, export *argoCDExport, repoURL string) *argoappv1.Repository {
+	currentArgoCDExport = export
+	t.Cleanup(func() { currentArgoCDExport = nil })
+	return remoteRepository(repoURL)
+}
+
+// TestLoadArgoCDExportAddsClusters verifies that the clusters of the export are added to the ones of --clusters,
+// which take precedence and are completed with the name or server of their cluster Secret
+func TestLoadArgoCDExportAddsClusters(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "argocd.yaml"), []byte(argoCDExportManifest), 0o600))
+	defer func(clusters []destinationCluster, export *argoCDExport) {
+		currentClusters, currentArgoCDExport = clusters, export
+	}(currentClusters, currentArgoCDExport)
+
+	currentClusters = []destinationCluster{{Server: "https://prod.example.com", KubeVersion: "1.29"}}
+	LoadArgoCDExport(dir)
+	require.Len(t, currentClusters, 1)
+	// The cluster of --clusters is named after the cluster Secret
+	prod := lookupCluster(currentClusters, argoappv1.ApplicationDestination{Name: "prod"})
+	require.NotNil(t, prod)
+	require.Equal(t, "1.29", prod.KubeVersion)
+}
@@ -0,0 +1,245 @@
+package preview
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/argoproj/argo-cd/v3/pkg/apis/application"
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/argoproj/gitops-engine/pkg/sync/syncwaves"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Files of a bootstrap bundle, in apply order
+const (
+	bootstrapProjectsFile = "00-projects.yaml"
+	bootstrapAppsFile     = "01-applications.yaml"
+	bootstrapManifestsDir = "02-manifests"
+)
+
+// BootstrapOptions holds the settings of the export-bootstrap command
+type BootstrapOptions struct {
+	// OutputDir is the directory the bootstrap bundle is written to, which must be empty
+	OutputDir string
+	// Apps are the names of the Applications exported, all the Applications of the manifests when empty
+	Apps []string
+	// Projects are the files and directories holding the AppProjects of the exported Applications
+	Projects []string
+	// Render also writes the resources of the Applications, pre-rendered, grouped by destination cluster
+	Render bool
+	// SplitCRDs writes the CustomResourceDefinitions of each cluster to a crds.yaml stream applied before apply.yaml,
+	// with Render
+	SplitCRDs bool
+	// Strip are the profiles of the preview-only metadata stripped from the rendered resources, with Render
+	Strip []string
+}
+
+// ExportBootstrap writes the bundle standing up a new cluster from scratch offline with the Applications defined
+// in the given manifests (files or directories), applied in order:
+// - 00-projects.yaml holds the AppProjects of the Applications, but the default one created by Argo CD
+// - 01-applications.yaml holds the Application CRs, by sync wave then name, without their status
+// - 02-manifests/<cluster>/... holds the pre-rendered resources of the Applications, as with --output-dir, when
+// rendered, so that the cluster can run before Argo CD can reach the repositories
+func ExportBootstrap(paths []string, opts BootstrapOptions) {
+	if !shouldMatch(opts.OutputDir) {
+		log.Fatal("the directory the bundle is written to must be given with --output-dir")
+	}
+	if opts.SplitCRDs && !opts.Render {
+		log.Fatal("--split-crds requires --render")
+	}
+	if len(opts.Strip) > 0 && !opts.Render {
+		log.Fatal("--strip requires --render")
+	}
+	strip, err := newStripProfiles(opts.Strip)
+	if err != nil {
+		log.Fatal(err)
+	}
+	manifestFiles, err := expandManifestPaths(paths)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var apps []argoappv1.Application
+	for _, file := range manifestFiles {
+		apps = append(apps, loadApplications(file)...)
+	}
+	apps, err = selectBootstrapApps(apps, opts.Apps)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(opts.Projects) > 0 {
+		if err := enableProjects(opts.Projects); err != nil {
+			log.Fatal(err)
+		}
+	}
+	bundleProjects, err := bootstrapProjects(apps, currentProjects)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, app := range apps {
+		if err := currentProjects.checkPermitted(app); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	dir := outputDirPath(opts.OutputDir)
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+		log.Fatalf("output directory %s is not empty", opts.OutputDir)
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		log.Fatalf("failed to create output directory: %v", err)
+	}
+	if len(bundleProjects) > 0 {
+		if err := writeBootstrapStream(filepath.Join(dir, bootstrapProjectsFile), bundleProjects); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("projects: %s\n", outputFileName(filepath.Join(dir, bootstrapProjectsFile)))
+	}
+	appObjs, err := bootstrapApplications(apps)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := writeBootstrapStream(filepath.Join(dir, bootstrapAppsFile), appObjs); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("applications: %s\n", outputFileName(filepath.Join(dir, bootstrapAppsFile)))
+	if !opts.Render {
+		return
+	}
+
+	output, err := newClusterOutput(filepath.Join(dir, bootstrapManifestsDir), false, opts.SplitCRDs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	repoService, err := newRepoService()
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, app := range apps {
+		rendered, err := generateAppManifests(repoService, app)
+		if err != nil {
+			log.Fatal(err)
+		}
+		manifests, err := strip.apply(app, allManifests(rendered))
+		if err != nil {
+			log.Fatal(err)
+		}
+		resources, err := parseManifests(manifests)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := output.add(app, resources); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := printClusterOutput(output); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// selectBootstrapApps returns the Applications with the given names, all of them when no name is given
+func selectBootstrapApps(apps []argoappv1.Application, names []string) ([]argoappv1.Application, error) {
+	if len(names) == 0 {
+		return apps, nil
+	}
+	var selected []argoappv1.Application
+	for _, name := range names {
+		i := slices.IndexFunc(apps, func(app argoappv1.Application) bool { return app.Name == name })
+		if i < 0 {
+			return nil, fmt.Errorf("application '%s' not found", name)
+		}
+		selected = append(selected, apps[i])
+	}
+	return selected, nil
+}
+
+// bootstrapProjects returns the AppProjects of the Applications, by name. The default AppProject is created by
+// Argo CD on startup, and only exported when supplied.
+func bootstrapProjects(apps []argoappv1.Application, projects projectSet) ([]unstructured.Unstructured, error) {
+	var names []string
+	for _, app := range apps {
+		name := app.Spec.GetProject()
+		if slices.Contains(names, name) {
+			continue
+		}
+		if _, ok := projects[name]; !ok {
+			if name == argoappv1.DefaultAppProjectName {
+				continue
+			}
+			return nil, fmt.Errorf("application '%s' belongs to AppProject '%s', which was not supplied with "+
+				"--projects", app.Name, name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	objs := make([]unstructured.Unstructured, 0, len(names))
+	for _, name := range names {
+		obj, err := bootstrapObject(projects[name], application.AppProjectKind)
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, obj)
+	}
+	return objs, nil
+}
+
+// bootstrapApplications returns the Application CRs, in the order Argo CD syncs them in an app-of-apps: by sync
+// wave, then by name
+func bootstrapApplications(apps []argoappv1.Application) ([]unstructured.Unstructured, error) {
+	objs := make([]unstructured.Unstructured, 0, len(apps))
+	for i := range apps {
+		obj, err := bootstrapObject(&apps[i], applicationKind)
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, obj)
+	}
+	sort.SliceStable(objs, func(i, j int) bool {
+		if wi, wj := syncwaves.Wave(&objs[i]), syncwaves.Wave(&objs[j]); wi != wj {
+			return wi < wj
+		}
+		return objs[i].GetName() < objs[j].GetName()
+	})
+	return objs, nil
+}
+
+// bootstrapObject returns an Application or AppProject as applied to a new cluster: without status, operation or
+// creation timestamp, in the namespace of Argo CD when unset
+func bootstrapObject(obj runtime.Object, kind string) (unstructured.Unstructured, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return unstructured.Unstructured{}, err
+	}
+	u := unstructured.Unstructured{Object: content}
+	u.SetAPIVersion(applicationAPIVersion)
+	u.SetKind(kind)
+	if u.GetNamespace() == "" {
+		u.SetNamespace(defaultControlPlaneNamespace)
+	}
+	delete(u.Object, "status")
+	delete(u.Object, "operation")
+	unstructured.RemoveNestedField(u.Object, "metadata", "creationTimestamp")
+	return u, nil
+}
+
+// writeBootstrapStream writes the YAML stream of the objects, in order
+func writeBootstrapStream(filename string, objs []unstructured.Unstructured) error {
+	var stream strings.Builder
+	for i := range objs {
+		data, err := toYAML(&objs[i])
+		if err != nil {
+			return err
+		}
+		stream.WriteString("---\n")
+		stream.WriteString(data)
+	}
+	if err := writeOutputFile(filename, []byte(stream.String())); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(filename), err)
+	}
+	return nil
+}
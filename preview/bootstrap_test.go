@@ -0,0 +1,60 @@
+package preview
+
+import (
+	"testing"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TestBootstrapBundle verifies that the AppProjects of the selected Applications are exported, but the default
+// one when not supplied, and that the Application CRs are ordered by sync wave without their status
+func TestBootstrapBundle(t *testing.T) {
+	newApp := func(name string, project string, wave string) argoappv1.Application {
+		app := argoappv1.Application{ObjectMeta: metav1.ObjectMeta{Name: name}, Spec: argoappv1.ApplicationSpec{
+			Project: project,
+		}}
+		if wave != "" {
+			app.Annotations = map[string]string{"argocd.argoproj.io/sync-wave": wave}
+		}
+		app.Status.Sync.Status = argoappv1.SyncStatusCodeSynced
+		return app
+	}
+	apps := []argoappv1.Application{
+		newApp("web", "team", ""),
+		newApp("cert-manager", "infra", "-1"),
+		newApp("api", "team", ""),
+		newApp("monitoring", "", ""),
+	}
+	selected, err := selectBootstrapApps(apps, []string{"web", "cert-manager", "monitoring"})
+	require.NoError(t, err)
+	require.Len(t, selected, 3)
+	_, err = selectBootstrapApps(apps, []string{"missing"})
+	require.EqualError(t, err, "application 'missing' not found")
+
+	projects := projectSet{
+		"team":  &argoappv1.AppProject{ObjectMeta: metav1.ObjectMeta{Name: "team"}},
+		"infra": &argoappv1.AppProject{ObjectMeta: metav1.ObjectMeta{Name: "infra", Namespace: "gitops"}},
+	}
+	objs, err := bootstrapProjects(selected, projects)
+	require.NoError(t, err)
+	require.Len(t, objs, 2)
+	require.Equal(t, "infra", objs[0].GetName())
+	require.Equal(t, "gitops", objs[0].GetNamespace())
+	require.Equal(t, "AppProject", objs[1].GetKind())
+	require.Equal(t, "argocd", objs[1].GetNamespace())
+	_, err = bootstrapProjects(selected, nil)
+	require.ErrorContains(t, err, "AppProject 'team', which was not supplied")
+
+	objs, err = bootstrapApplications(selected)
+	require.NoError(t, err)
+	var names []string
+	for _, obj := range objs {
+		require.NotContains(t, obj.Object, "status")
+		require.NotContains(t, obj.Object["metadata"], "creationTimestamp")
+		names = append(names, obj.GetName())
+	}
+	require.Equal(t, []string{"cert-manager", "monitoring", "web"}, names)
+	require.Equal(t, "argoproj.io/v1alpha1", objs[0].GetAPIVersion())
+}
@@ -0,0 +1,66 @@
+package preview
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+)
+
+// durationBudget fails the run when it, or the rendering of an Application, takes longer than allowed, so that the
+// render time regressions surface as failures in CI. A zero duration is no budget.
+type durationBudget struct {
+	max    time.Duration
+	perApp time.Duration
+	start  time.Time
+	// exceeded are the names of the Applications which exceeded the per-app budget
+	exceeded []string
+}
+
+// newDurationBudget starts the duration budget of a run
+func newDurationBudget(max time.Duration, perApp time.Duration) (*durationBudget, error) {
+	if max < 0 || perApp < 0 {
+		return nil, fmt.Errorf("invalid duration budget: %s, %s per app", max, perApp)
+	}
+	return &durationBudget{max: max, perApp: perApp, start: time.Now()}, nil
+}
+
+// checkApp returns the error of an Application whose rendering exceeded the per-app budget
+func (b *durationBudget) checkApp(app argoappv1.Application, elapsed time.Duration) error {
+	if b.perApp == 0 || elapsed <= b.perApp {
+		return nil
+	}
+	b.exceeded = append(b.exceeded, app.Name)
+	return &appBudgetError{app: app.Name, elapsed: elapsed, budget: b.perApp}
+}
+
+// appBudgetError is returned when the rendering of an Application exceeded the per-app budget
+type appBudgetError struct {
+	app     string
+	elapsed time.Duration
+	budget  time.Duration
+}
+
+func (e *appBudgetError) Error() string {
+	return fmt.Sprintf("application '%s' rendered in %s, exceeding the %s budget", e.app,
+		e.elapsed.Round(time.Millisecond), e.budget)
+}
+
+// check returns the error of a run which exceeded its budget, or one of whose Applications exceeded theirs
+func (b *durationBudget) check() error {
+	var violations []string
+	if len(b.exceeded) > 0 {
+		violations = append(violations, fmt.Sprintf("%d Applications exceeded the %s per-app duration budget: %s",
+			len(b.exceeded), b.perApp, strings.Join(b.exceeded, ", ")))
+	}
+	if elapsed := time.Since(b.start); b.max > 0 && elapsed > b.max {
+		violations = append(violations, fmt.Sprintf("the run took %s, exceeding the %s duration budget",
+			elapsed.Round(time.Millisecond), b.max))
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(violations, "; "))
+}
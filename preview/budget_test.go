@@ -0,0 +1,34 @@
+package preview
+
+import (
+	"testing"
+	"time"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TestDurationBudget verifies that the Applications exceeding the per-app budget, and the run exceeding its budget,
+// fail the run, and that a zero duration is no budget
+func TestDurationBudget(t *testing.T) {
+	_, err := newDurationBudget(-time.Second, 0)
+	require.Error(t, err)
+
+	budget, err := newDurationBudget(0, 0)
+	require.NoError(t, err)
+	require.NoError(t, budget.checkApp(argoappv1.Application{}, time.Hour))
+	require.NoError(t, budget.check())
+
+	budget, err = newDurationBudget(time.Minute, 90*time.Second)
+	require.NoError(t, err)
+	web := argoappv1.Application{ObjectMeta: metav1.ObjectMeta{Name: "web"}}
+	require.NoError(t, budget.checkApp(web, 90*time.Second))
+	require.EqualError(t, budget.checkApp(web, 100*time.Second),
+		"application 'web' rendered in 1m40s, exceeding the 1m30s budget")
+	require.EqualError(t, budget.check(), "1 Applications exceeded the 1m30s per-app duration budget: web")
+
+	budget.exceeded = nil
+	budget.start = time.Now().Add(-2 * time.Minute)
+	require.ErrorContains(t, budget.check(), "exceeding the 1m0s duration budget")
+}
@@ -25,8 +25,10 @@ func (c *NoopCacheClient) Rename(oldKey string, newKey string, expiration time.D
 	return nil
 }
 
+// Get always misses, so that the repository service computes what it reads from the cache, e.g. the revision
+// metadata, rather than returning an empty item
 func (c *NoopCacheClient) Get(key string, obj interface{}) error {
-	return nil
+	return cacheutil.ErrCacheMiss
 }
 
 func (c *NoopCacheClient) Delete(key string) error {
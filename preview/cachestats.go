@@ -0,0 +1,122 @@
+package preview
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	repoapiclient "github.com/argoproj/argo-cd/v3/reposerver/apiclient"
+	"github.com/argoproj/argo-cd/v3/util/git"
+)
+
+// currentCacheStats counts the reuse of the caches by the ongoing run, reset with each repository service
+var currentCacheStats = newCacheStats(nil)
+
+// cacheCounter counts the hits and misses of a cache
+type cacheCounter struct {
+	Hits   int `json:"hits"`
+	Misses int `json:"misses"`
+}
+
+// record counts a hit or a miss
+func (c *cacheCounter) record(hit bool) {
+	if hit {
+		c.Hits++
+	} else {
+		c.Misses++
+	}
+}
+
+// add adds the hits and misses of another counter
+func (c *cacheCounter) add(other cacheCounter) {
+	c.Hits += other.Hits
+	c.Misses += other.Misses
+}
+
+// String formats the counter, e.g. 3/4 hits
+func (c cacheCounter) String() string {
+	return fmt.Sprintf("%d/%d hits", c.Hits, c.Hits+c.Misses)
+}
+
+// cacheStats counts the reuse of the caches during a run:
+// - Repositories, by manifest request and repository: a hit reuses a clone of the cache, cloned by an earlier
+// invocation or request, a miss clones the repository
+// - Charts, by manifest request of a chart: a hit reuses the chart pulled by an earlier request of the invocation,
+// the repository service keeping the charts for the time of the invocation only
+// - Manifests, by Application: a hit reuses the manifests of the run resumed with --resume, the manifest cache of
+// the repository service being disabled so that the manifests are otherwise always generated
+type cacheStats struct {
+	Repositories cacheCounter `json:"repositories"`
+	Charts       cacheCounter `json:"charts"`
+	Manifests    cacheCounter `json:"manifests"`
+	repos        map[string]bool
+	charts       map[string]bool
+}
+
+// newCacheStats starts counting the reuse of the caches, the given repositories being already cloned
+func newCacheStats(cloned []string) *cacheStats {
+	s := &cacheStats{repos: map[string]bool{}, charts: map[string]bool{}}
+	for _, repoURL := range cloned {
+		s.repos[git.NormalizeGitURL(repoURL)] = true
+	}
+	return s
+}
+
+// recordRequest counts the repositories and chart a manifest request reads
+func (s *cacheStats) recordRequest(q *repoapiclient.ManifestRequest) {
+	if q.ApplicationSource.Chart != "" {
+		key := q.Repo.Repo + "\x00" + q.ApplicationSource.Chart + "\x00" + q.ApplicationSource.TargetRevision
+		s.Charts.record(s.charts[key])
+		s.charts[key] = true
+	} else {
+		s.recordRepository(q.Repo.Repo)
+	}
+	// Each request fetches the git repositories its values files refer to
+	for _, ref := range q.RefSources {
+		if ref != nil && ref.Chart == "" && git.NormalizeGitURL(ref.Repo.Repo) != git.NormalizeGitURL(q.Repo.Repo) {
+			s.recordRepository(ref.Repo.Repo)
+		}
+	}
+}
+
+// recordRepository counts the read of a git repository
+func (s *cacheStats) recordRepository(repoURL string) {
+	key := git.NormalizeGitURL(repoURL)
+	s.Repositories.record(s.repos[key])
+	s.repos[key] = true
+}
+
+// recordManifests counts the manifests of an Application, reused from the resumed run or generated
+func (s *cacheStats) recordManifests(reused bool) {
+	s.Manifests.record(reused)
+}
+
+// print prints the counters on one line, e.g. cache: repositories 3/4 hits, charts 1/2 hits, manifests 0/6 hits
+func (s *cacheStats) print(w io.Writer) {
+	fmt.Fprintf(w, "cache: repositories %s, charts %s, manifests %s\n", s.Repositories, s.Charts, s.Manifests)
+}
+
+// clonedRepositories returns the remote URLs of the repositories cloned in the cache directory of the repository
+// service, as restored by its initialization
+func clonedRepositories(cacheDir string) []string {
+	// The repository service removes the read permission of the directory once initialized
+	if err := os.Chmod(cacheDir, 0o700); err != nil {
+		return nil
+	}
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		return nil
+	}
+	var repoURLs []string
+	for _, entry := range entries {
+		dir := filepath.Join(cacheDir, entry.Name())
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+			continue
+		}
+		if repoURL, err := runGit(dir, nil, "remote", "get-url", "origin"); err == nil {
+			repoURLs = append(repoURLs, repoURL)
+		}
+	}
+	return repoURLs
+}
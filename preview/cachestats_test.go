@@ -0,0 +1,56 @@
+package preview
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	repoapiclient "github.com/argoproj/argo-cd/v3/reposerver/apiclient"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCacheStats verifies that the repositories cloned by earlier invocations or requests are counted as hits,
+// the charts pulled by earlier requests as well, and that the repository of the ref sources is counted
+func TestCacheStats(t *testing.T) {
+	cacheDir := t.TempDir()
+	clone := filepath.Join(cacheDir, "3f1c")
+	require.NoError(t, os.Mkdir(clone, 0o700))
+	_, err := runGit(clone, nil, "init", "-q")
+	require.NoError(t, err)
+	_, err = runGit(clone, nil, "remote", "add", "origin", "https://github.com/example/apps.git")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(cacheDir, "chart.tgz"), nil, 0o600))
+	cloned := clonedRepositories(cacheDir)
+	require.Equal(t, []string{"https://github.com/example/apps.git"}, cloned)
+
+	stats := newCacheStats(cloned)
+	gitRequest := func(repoURL string) *repoapiclient.ManifestRequest {
+		return &repoapiclient.ManifestRequest{
+			Repo:              &argoappv1.Repository{Repo: repoURL},
+			ApplicationSource: &argoappv1.ApplicationSource{RepoURL: repoURL, Path: "web"},
+		}
+	}
+	chartRequest := &repoapiclient.ManifestRequest{
+		Repo:              &argoappv1.Repository{Repo: "https://charts.example.com"},
+		ApplicationSource: &argoappv1.ApplicationSource{Chart: "web", TargetRevision: "1.0.0"},
+		RefSources: map[string]*argoappv1.RefTarget{
+			"$values": {Repo: argoappv1.Repository{Repo: "https://github.com/example/values"}},
+		},
+	}
+	stats.recordRequest(gitRequest("https://github.com/example/apps"))
+	stats.recordRequest(gitRequest("https://github.com/example/infra.git"))
+	stats.recordRequest(gitRequest("https://github.com/example/infra.git"))
+	stats.recordRequest(chartRequest)
+	stats.recordRequest(chartRequest)
+	stats.recordManifests(true)
+	stats.recordManifests(false)
+
+	require.Equal(t, cacheCounter{Hits: 3, Misses: 2}, stats.Repositories)
+	require.Equal(t, cacheCounter{Hits: 1, Misses: 1}, stats.Charts)
+	require.Equal(t, cacheCounter{Hits: 1, Misses: 1}, stats.Manifests)
+	var out bytes.Buffer
+	stats.print(&out)
+	require.Equal(t, "cache: repositories 3/5 hits, charts 1/2 hits, manifests 1/2 hits\n", out.String())
+}
@@ -0,0 +1,234 @@
+package preview
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// currentClusters are the destination clusters given with --clusters, nil when not set
+var currentClusters []destinationCluster
+
+// clustersFile describes the destination clusters of the Applications
+type clustersFile struct {
+	Clusters []destinationCluster `json:"clusters"`
+}
+
+// destinationCluster is a destination cluster of Applications, matched by name or server like the cluster secrets
+// of Argo CD, along with the Kubernetes version and API versions it serves
+type destinationCluster struct {
+	Name   string `json:"name,omitempty"`
+	Server string `json:"server,omitempty"`
+	// KubeVersion is the Kubernetes version of the cluster, e.g. 1.29
+	KubeVersion string `json:"kubeVersion,omitempty"`
+	// APIVersions are the API versions served by the cluster, as printed by kubectl api-versions.
+	// Like the API versions passed by Argo CD to Helm, they can be qualified with a kind, e.g. apps/v1/Deployment.
+	APIVersions []string `json:"apiVersions,omitempty"`
+	// Aliases are the other names and servers the cluster is known by in the Applications, e.g. the URL of its
+	// load balancer and of its API server
+	Aliases []string `json:"aliases,omitempty"`
+}
+
+// String returns the name of the cluster, or its server when not named
+func (c *destinationCluster) String() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return c.Server
+}
+
+// EnableClusters reads the destination clusters of the Applications from a file, their Kubernetes version and API
+// versions being passed to Helm and checked by the validate commands
+func EnableClusters(filename string) {
+	clusters, err := loadClusters(filename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	currentClusters = clusters
+}
+
+// loadClusters reads a clusters file
+func loadClusters(filename string) ([]destinationCluster, error) {
+	data, err := os.ReadFile(filename) // #nosec G304 - user provided clusters file
+	if err != nil {
+		return nil, fmt.Errorf("failed to read clusters file: %w", err)
+	}
+	var file clustersFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse clusters file %s: %w", filename, err)
+	}
+	for i, c := range file.Clusters {
+		if c.Name == "" && c.Server == "" {
+			return nil, fmt.Errorf("cluster %d of %s has neither a name nor a server", i, filename)
+		}
+	}
+	return file.Clusters, nil
+}
+
+// lookupCluster returns the destination cluster of an Application, nil when not known. The clusters are matched by
+// name, server or alias, the in-cluster name and the https://kubernetes.default.svc server being the same cluster.
+func lookupCluster(clusters []destinationCluster, destination argoappv1.ApplicationDestination) *destinationCluster {
+	for i := range clusters {
+		c := &clusters[i]
+		if destination.Name != "" && (c.Name == destination.Name || slices.Contains(c.Aliases, destination.Name)) {
+			return c
+		}
+		if destination.Server != "" && (sameServer(c.Server, destination.Server) ||
+			slices.ContainsFunc(c.Aliases, func(alias string) bool { return sameServer(alias, destination.Server) })) {
+			return c
+		}
+	}
+	if isInClusterDestination(destination) {
+		for i := range clusters {
+			if isInClusterDestination(argoappv1.ApplicationDestination{Name: clusters[i].Name,
+				Server: clusters[i].Server}) {
+				return &clusters[i]
+			}
+		}
+	}
+	return nil
+}
+
+// isInClusterDestination returns whether a destination is the cluster Argo CD runs in, by name or server
+func isInClusterDestination(destination argoappv1.ApplicationDestination) bool {
+	return destination.Name == inClusterName || sameServer(destination.Server, inClusterServer)
+}
+
+// sameServer returns whether two server URLs are the same, ignoring the case of the host, the default port and
+// the trailing slash
+func sameServer(a string, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	return normalizeServer(a) == normalizeServer(b)
+}
+
+// normalizeServer returns the comparable form of a server URL
+func normalizeServer(server string) string {
+	u, err := url.Parse(strings.TrimSuffix(server, "/"))
+	if err != nil || u.Host == "" {
+		return strings.TrimSuffix(server, "/")
+	}
+	u.Scheme, u.Host = strings.ToLower(u.Scheme), strings.ToLower(u.Host)
+	if (u.Scheme == "https" && u.Port() == "443") || (u.Scheme == "http" && u.Port() == "80") {
+		u.Host = u.Hostname()
+	}
+	return u.String()
+}
+
+// sameDestination returns whether two destinations are the same cluster: the same known cluster, the cluster Argo
+// CD runs in, or else the same name or server
+func sameDestination(
+	clusters []destinationCluster,
+	a argoappv1.ApplicationDestination,
+	b argoappv1.ApplicationDestination,
+) bool {
+	if ca, cb := lookupCluster(clusters, a), lookupCluster(clusters, b); ca != nil || cb != nil {
+		return ca == cb
+	}
+	if isInClusterDestination(a) || isInClusterDestination(b) {
+		return isInClusterDestination(a) && isInClusterDestination(b)
+	}
+	return (a.Name != "" && a.Name == b.Name) || sameServer(a.Server, b.Server)
+}
+
+// parseDestination returns the destination given on the command line: a server when it is a URL, a name otherwise
+func parseDestination(destination string) argoappv1.ApplicationDestination {
+	if strings.Contains(destination, "://") {
+		return argoappv1.ApplicationDestination{Server: destination}
+	}
+	return argoappv1.ApplicationDestination{Name: destination}
+}
+
+// destinationCapabilities returns the Kubernetes version and API versions of the destination cluster of an
+// Application, passed to the repository service like Argo CD does, empty when the cluster is not known
+func destinationCapabilities(app argoappv1.Application) (string, []string) {
+	c := lookupCluster(currentClusters, app.Spec.Destination)
+	if c == nil {
+		return "", nil
+	}
+	return c.KubeVersion, c.APIVersions
+}
+
+// newAPIAvailabilityCheck returns a check reporting the resources whose API version, or kind when the API versions
+// of the cluster are qualified with kinds, is not served by their destination cluster. The API versions defined by
+// the CustomResourceDefinitions of the Application are served.
+func newAPIAvailabilityCheck(clusters []destinationCluster) check {
+	return func(app argoappv1.Application, resources []unstructured.Unstructured) []finding {
+		c := lookupCluster(clusters, app.Spec.Destination)
+		if c == nil || len(c.APIVersions) == 0 {
+			return nil
+		}
+		served := map[string]bool{}
+		// withKinds are the API versions of the cluster whose kinds are listed
+		withKinds := map[string]bool{}
+		for _, apiVersion := range c.APIVersions {
+			served[apiVersion] = true
+			// Only the API versions of the groups have a slash without kind, e.g. v1/Pod but apps/v1
+			if parts := strings.Split(apiVersion, "/"); len(parts) == 3 || (len(parts) == 2 && parts[0] == "v1") {
+				groupVersion := strings.Join(parts[:len(parts)-1], "/")
+				served[groupVersion] = true
+				withKinds[groupVersion] = true
+			}
+		}
+		for i := range resources {
+			for _, apiVersion := range crdAPIVersions(&resources[i]) {
+				served[apiVersion] = true
+				served[apiVersion[:strings.LastIndex(apiVersion, "/")]] = true
+			}
+		}
+
+		var findings []finding
+		for i := range resources {
+			resource := &resources[i]
+			apiVersion := resource.GetAPIVersion()
+			var message string
+			switch {
+			case !served[apiVersion]:
+				message = fmt.Sprintf("%s is not served by cluster %s", apiVersion, c)
+			case withKinds[apiVersion] && !served[apiVersion+"/"+resource.GetKind()]:
+				message = fmt.Sprintf("%s %s is not served by cluster %s", apiVersion, resource.GetKind(), c)
+			default:
+				continue
+			}
+			findings = append(findings, finding{
+				RuleID:   "api-unavailable",
+				Category: categoryAPIAvailability,
+				App:      app.Name,
+				Resource: newResourceKey(resource),
+				Message:  message,
+			})
+		}
+		return findings
+	}
+}
+
+// crdAPIVersions returns the API versions, qualified with the kind, served by a CustomResourceDefinition
+func crdAPIVersions(resource *unstructured.Unstructured) []string {
+	if resource.GetKind() != "CustomResourceDefinition" {
+		return nil
+	}
+	group, _, _ := unstructured.NestedString(resource.Object, "spec", "group")
+	kind, _, _ := unstructured.NestedString(resource.Object, "spec", "names", "kind")
+	versions, _, _ := unstructured.NestedSlice(resource.Object, "spec", "versions")
+	var apiVersions []string
+	for _, v := range versions {
+		version, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _, _ := unstructured.NestedString(version, "name")
+		if isServed, found, _ := unstructured.NestedBool(version, "served"); found && !isServed {
+			continue
+		}
+		apiVersions = append(apiVersions, group+"/"+name+"/"+kind)
+	}
+	return apiVersions
+}
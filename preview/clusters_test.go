@@ -0,0 +1,122 @@
+package preview
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// TestLoadClusters verifies that the clusters are read from a file, and matched by name or server
+func TestLoadClusters(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "clusters.yaml")
+	require.NoError(t, os.WriteFile(filename, []byte(`clusters:
+- name: prod
+  server: https://prod.example.com
+  kubeVersion: "1.29"
+  apiVersions: [v1, apps/v1]
+- server: https://kubernetes.default.svc
+`), 0o600))
+	clusters, err := loadClusters(filename)
+	require.NoError(t, err)
+	require.Len(t, clusters, 2)
+
+	prod := lookupCluster(clusters, argoappv1.ApplicationDestination{Name: "prod"})
+	require.NotNil(t, prod)
+	require.Equal(t, "1.29", prod.KubeVersion)
+	byServer := lookupCluster(clusters, argoappv1.ApplicationDestination{Server: "https://prod.example.com/"})
+	require.Equal(t, prod, byServer)
+	inCluster := lookupCluster(clusters, argoappv1.ApplicationDestination{Server: "https://kubernetes.default.svc"})
+	require.NotNil(t, inCluster)
+	require.Equal(t, "https://kubernetes.default.svc", inCluster.String())
+	require.Nil(t, lookupCluster(clusters, argoappv1.ApplicationDestination{Name: "staging"}))
+
+	require.NoError(t, os.WriteFile(filename, []byte("clusters:\n- kubeVersion: \"1.29\"\n"), 0o600))
+	_, err = loadClusters(filename)
+	require.ErrorContains(t, err, "has neither a name nor a server")
+	require.NoError(t, os.WriteFile(filename, []byte("clusters:\n- name: prod\n  apiVersion: [v1]\n"), 0o600))
+	_, err = loadClusters(filename)
+	require.ErrorContains(t, err, "unknown field")
+}
+
+// TestDestinationAliases verifies that the clusters are matched by alias, and that the in-cluster name and the
+// https://kubernetes.default.svc server designate the same cluster
+func TestDestinationAliases(t *testing.T) {
+	clusters := []destinationCluster{
+		{Name: "prod", Server: "https://prod.example.com", Aliases: []string{"prod-eu", "https://10.0.0.1:6443"}},
+		{Server: "https://kubernetes.default.svc", KubeVersion: "1.30"},
+	}
+	prod := &clusters[0]
+	require.Equal(t, prod, lookupCluster(clusters, argoappv1.ApplicationDestination{Name: "prod-eu"}))
+	require.Equal(t, prod, lookupCluster(clusters, argoappv1.ApplicationDestination{Server: "https://10.0.0.1:6443/"}))
+	require.Equal(t, prod, lookupCluster(clusters,
+		argoappv1.ApplicationDestination{Server: "https://PROD.example.com:443"}))
+	require.Equal(t, &clusters[1], lookupCluster(clusters, argoappv1.ApplicationDestination{Name: "in-cluster"}))
+
+	inCluster := parseDestination("in-cluster")
+	require.Equal(t, argoappv1.ApplicationDestination{Name: "in-cluster"}, inCluster)
+	require.True(t, sameDestination(nil, inCluster,
+		argoappv1.ApplicationDestination{Server: "https://kubernetes.default.svc:443"}))
+	require.False(t, sameDestination(nil, inCluster, argoappv1.ApplicationDestination{Name: "prod"}))
+	require.True(t, sameDestination(clusters, parseDestination("https://prod.example.com"),
+		argoappv1.ApplicationDestination{Name: "prod-eu"}))
+	require.False(t, sameDestination(clusters, parseDestination("prod"), inCluster))
+	require.True(t, sameDestination(nil, parseDestination("https://staging.example.com/"),
+		argoappv1.ApplicationDestination{Server: "https://staging.example.com"}))
+}
+
+// TestAPIAvailabilityCheck verifies that the resources whose API version or kind is not served by their destination
+// cluster are reported, unless defined by a CustomResourceDefinition of the Application
+func TestAPIAvailabilityCheck(t *testing.T) {
+	clusters := []destinationCluster{
+		{Name: "prod", APIVersions: []string{"v1", "apps/v1", "networking.k8s.io/v1"}},
+		{Name: "edge", APIVersions: []string{"v1", "v1/ConfigMap", "apps/v1", "apps/v1/Deployment"}},
+		{Name: "unknown"},
+	}
+	newApp := func(cluster string) argoappv1.Application {
+		return argoappv1.Application{
+			ObjectMeta: metav1.ObjectMeta{Name: "web"},
+			Spec:       argoappv1.ApplicationSpec{Destination: argoappv1.ApplicationDestination{Name: cluster}},
+		}
+	}
+	resources := []unstructured.Unstructured{
+		newTestResource("apps/v1", "Deployment", "web", nil),
+		newTestResource("v1", "Service", "web", nil),
+		newTestResource("gateway.networking.k8s.io/v1", "HTTPRoute", "web", nil),
+	}
+	c := newAPIAvailabilityCheck(clusters)
+
+	findings := c(newApp("prod"), resources)
+	require.Len(t, findings, 1)
+	require.Equal(t, "api-unavailable", findings[0].RuleID)
+	require.Equal(t, categoryAPIAvailability, findings[0].Category)
+	require.Equal(t, "gateway.networking.k8s.io/v1 is not served by cluster prod", findings[0].Message)
+
+	// The kinds are checked when listed
+	findings = c(newApp("edge"), resources)
+	require.Len(t, findings, 2)
+	require.Equal(t, "v1 Service is not served by cluster edge", findings[0].Message)
+
+	// Nothing is checked without the API versions of the cluster
+	require.Empty(t, c(newApp("unknown"), resources))
+	require.Empty(t, c(newApp("staging"), resources))
+
+	// The API versions defined by the Application are served
+	crd := newTestResource("apiextensions.k8s.io/v1", "CustomResourceDefinition", "httproutes.gateway.networking.k8s.io",
+		map[string]interface{}{
+			"group": "gateway.networking.k8s.io",
+			"names": map[string]interface{}{"kind": "HTTPRoute"},
+			"versions": []interface{}{
+				map[string]interface{}{"name": "v1", "served": true},
+				map[string]interface{}{"name": "v1alpha1", "served": false},
+			},
+		})
+	require.Equal(t, []string{"gateway.networking.k8s.io/v1/HTTPRoute"}, crdAPIVersions(&crd))
+	findings = c(newApp("prod"), append(resources, crd))
+	require.Len(t, findings, 1)
+	require.Equal(t, "apiextensions.k8s.io/v1 is not served by cluster prod", findings[0].Message)
+}
@@ -0,0 +1,192 @@
+package preview
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// metadataFieldSpec is a field the common labels or annotations are set on, like the field specs of the
+// commonLabels and commonAnnotations of Kustomize
+type metadataFieldSpec struct {
+	// kind restricts the field to the resources of a kind, all the resources when empty
+	kind string
+	// path is the path of the field, the lists on the path being traversed item by item
+	path []string
+	// create creates the field when missing, otherwise only existing fields are updated
+	create bool
+	// selector is set for the label selectors, which can be left out
+	selector bool
+}
+
+// commonLabelsFieldSpecs are the fields of the commonLabels of Kustomize: the labels of the resources, of their
+// pod templates, and the selectors matching them
+var commonLabelsFieldSpecs = []metadataFieldSpec{
+	{path: []string{"metadata", "labels"}, create: true},
+	{kind: "Service", path: []string{"spec", "selector"}, create: true, selector: true},
+	{kind: "ReplicationController", path: []string{"spec", "selector"}, create: true, selector: true},
+	{kind: "ReplicationController", path: []string{"spec", "template", "metadata", "labels"}, create: true},
+	{kind: "Deployment", path: []string{"spec", "selector", "matchLabels"}, create: true, selector: true},
+	{kind: "Deployment", path: []string{"spec", "template", "metadata", "labels"}, create: true},
+	{kind: "ReplicaSet", path: []string{"spec", "selector", "matchLabels"}, create: true, selector: true},
+	{kind: "ReplicaSet", path: []string{"spec", "template", "metadata", "labels"}, create: true},
+	{kind: "DaemonSet", path: []string{"spec", "selector", "matchLabels"}, create: true, selector: true},
+	{kind: "DaemonSet", path: []string{"spec", "template", "metadata", "labels"}, create: true},
+	{kind: "StatefulSet", path: []string{"spec", "selector", "matchLabels"}, create: true, selector: true},
+	{kind: "StatefulSet", path: []string{"spec", "template", "metadata", "labels"}, create: true},
+	{kind: "StatefulSet", path: []string{"spec", "volumeClaimTemplates", "metadata", "labels"}, create: true},
+	{kind: "Job", path: []string{"spec", "selector", "matchLabels"}, selector: true},
+	{kind: "Job", path: []string{"spec", "template", "metadata", "labels"}, create: true},
+	{kind: "CronJob", path: []string{"spec", "jobTemplate", "spec", "selector", "matchLabels"}, selector: true},
+	{kind: "CronJob", path: []string{"spec", "jobTemplate", "metadata", "labels"}, create: true},
+	{kind: "CronJob", path: []string{"spec", "jobTemplate", "spec", "template", "metadata", "labels"}, create: true},
+	{kind: "PodDisruptionBudget", path: []string{"spec", "selector", "matchLabels"}, selector: true},
+	{kind: "NetworkPolicy", path: []string{"spec", "podSelector", "matchLabels"}, selector: true},
+	{kind: "NetworkPolicy", path: []string{"spec", "ingress", "from", "podSelector", "matchLabels"}, selector: true},
+	{kind: "NetworkPolicy", path: []string{"spec", "egress", "to", "podSelector", "matchLabels"}, selector: true},
+}
+
+// commonAnnotationsFieldSpecs are the fields of the commonAnnotations of Kustomize: the annotations of the
+// resources and of their pod templates
+var commonAnnotationsFieldSpecs = []metadataFieldSpec{
+	{path: []string{"metadata", "annotations"}, create: true},
+	{kind: "ReplicationController", path: []string{"spec", "template", "metadata", "annotations"}, create: true},
+	{kind: "Deployment", path: []string{"spec", "template", "metadata", "annotations"}, create: true},
+	{kind: "ReplicaSet", path: []string{"spec", "template", "metadata", "annotations"}, create: true},
+	{kind: "DaemonSet", path: []string{"spec", "template", "metadata", "annotations"}, create: true},
+	{kind: "StatefulSet", path: []string{"spec", "template", "metadata", "annotations"}, create: true},
+	{kind: "Job", path: []string{"spec", "template", "metadata", "annotations"}, create: true},
+	{kind: "CronJob", path: []string{"spec", "jobTemplate", "metadata", "annotations"}, create: true},
+	{
+		kind:   "CronJob",
+		path:   []string{"spec", "jobTemplate", "spec", "template", "metadata", "annotations"},
+		create: true,
+	},
+}
+
+// commonMetadata holds the labels and annotations added to every rendered resource.
+// A nil commonMetadata adds nothing.
+type commonMetadata struct {
+	labels      map[string]string
+	annotations map[string]string
+	// selectors also adds the labels to the selectors, as commonLabels does
+	selectors bool
+}
+
+// newCommonMetadata parses the key=value labels and annotations added to the rendered resources, nil when none
+func newCommonMetadata(labels []string, annotations []string, selectors bool) (*commonMetadata, error) {
+	if len(labels) == 0 && len(annotations) == 0 {
+		return nil, nil
+	}
+	m := &commonMetadata{selectors: selectors}
+	var err error
+	if m.labels, err = parseMetadataPairs(labels, "label", true); err != nil {
+		return nil, err
+	}
+	if m.annotations, err = parseMetadataPairs(annotations, "annotation", false); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// parseMetadataPairs parses key=value pairs, validating the keys, and the values of the labels
+func parseMetadataPairs(pairs []string, what string, isLabel bool) (map[string]string, error) {
+	parsed := map[string]string{}
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid %s '%s', expected key=value", what, pair)
+		}
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid %s key '%s': %s", what, key, strings.Join(errs, ", "))
+		}
+		if isLabel {
+			if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+				return nil, fmt.Errorf("invalid %s value '%s': %s", what, value, strings.Join(errs, ", "))
+			}
+		}
+		parsed[key] = value
+	}
+	return parsed, nil
+}
+
+// apply adds the labels and annotations to the rendered resources
+func (m *commonMetadata) apply(rendered []renderedSource) ([]renderedSource, error) {
+	if m == nil {
+		return rendered, nil
+	}
+	stamped := make([]renderedSource, len(rendered))
+	for i, r := range rendered {
+		stamped[i] = r
+		stamped[i].Manifests = make([]string, len(r.Manifests))
+		for j, manifest := range r.Manifests {
+			obj := unstructured.Unstructured{}
+			if err := json.Unmarshal([]byte(manifest), &obj); err != nil {
+				return nil, fmt.Errorf("failed to parse manifest: %w", err)
+			}
+			m.applyResource(&obj)
+			data, err := json.Marshal(obj.Object)
+			if err != nil {
+				return nil, err
+			}
+			stamped[i].Manifests[j] = string(data)
+		}
+	}
+	return stamped, nil
+}
+
+// applyResource adds the labels and annotations to the fields of a resource
+func (m *commonMetadata) applyResource(obj *unstructured.Unstructured) {
+	if len(m.labels) > 0 {
+		for _, spec := range commonLabelsFieldSpecs {
+			if (spec.kind == "" || spec.kind == obj.GetKind()) && (m.selectors || !spec.selector) {
+				setMetadataField(obj.Object, spec.path, m.labels, spec.create)
+			}
+		}
+	}
+	if len(m.annotations) > 0 {
+		for _, spec := range commonAnnotationsFieldSpecs {
+			if spec.kind == "" || spec.kind == obj.GetKind() {
+				setMetadataField(obj.Object, spec.path, m.annotations, spec.create)
+			}
+		}
+	}
+}
+
+// setMetadataField sets the values on the map at the given path, traversing the lists item by item. The missing
+// maps are created when create is set, otherwise the field is left as is.
+func setMetadataField(obj map[string]interface{}, path []string, values map[string]string, create bool) {
+	key := path[0]
+	switch field := obj[key].(type) {
+	case map[string]interface{}:
+		if len(path) > 1 {
+			setMetadataField(field, path[1:], values, create)
+			return
+		}
+		for k, v := range values {
+			field[k] = v
+		}
+	case []interface{}:
+		for _, item := range field {
+			if itemMap, ok := item.(map[string]interface{}); ok && len(path) > 1 {
+				setMetadataField(itemMap, path[1:], values, create)
+			}
+		}
+	case nil:
+		if !create {
+			return
+		}
+		created := map[string]interface{}{}
+		obj[key] = created
+		if len(path) > 1 {
+			setMetadataField(created, path[1:], values, create)
+			return
+		}
+		for k, v := range values {
+			created[k] = v
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package preview
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// TestCommonMetadataApply verifies that the labels are added to the resources, their pod templates and selectors,
+// and the annotations to the resources and their pod templates, like the commonLabels and commonAnnotations of
+// Kustomize
+func TestCommonMetadataApply(t *testing.T) {
+	m, err := newCommonMetadata([]string{"run=dr-42"}, []string{"example.com/restored-by=argocd-offline-cli"}, true)
+	require.NoError(t, err)
+	rendered, err := m.apply([]renderedSource{{Manifests: []string{
+		`{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"web","labels":{"app":"web"}},` +
+			`"spec":{"selector":{"matchLabels":{"app":"web"}},"template":{"metadata":{"labels":{"app":"web"}}}}}`,
+		`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"web"}}`,
+		`{"apiVersion":"networking.k8s.io/v1","kind":"NetworkPolicy","metadata":{"name":"web"},"spec":{` +
+			`"podSelector":{"matchLabels":{"app":"web"}},"ingress":[{"from":[{"podSelector":{"matchLabels":` +
+			`{"app":"api"}}},{"namespaceSelector":{}}]}]}}`,
+		`{"apiVersion":"batch/v1","kind":"Job","metadata":{"name":"migrate"},"spec":{"template":{"spec":{}}}}`,
+	}}})
+	require.NoError(t, err)
+	resources, err := parseManifests(allManifests(rendered))
+	require.NoError(t, err)
+
+	deployment := resources[0].Object
+	requireNestedString(t, deployment, "dr-42", "metadata", "labels", "run")
+	requireNestedString(t, deployment, "web", "metadata", "labels", "app")
+	requireNestedString(t, deployment, "dr-42", "spec", "selector", "matchLabels", "run")
+	requireNestedString(t, deployment, "dr-42", "spec", "template", "metadata", "labels", "run")
+	requireNestedString(t, deployment, "argocd-offline-cli",
+		"spec", "template", "metadata", "annotations", "example.com/restored-by")
+
+	configMap := resources[1].Object
+	requireNestedString(t, configMap, "dr-42", "metadata", "labels", "run")
+	requireNestedString(t, configMap, "argocd-offline-cli", "metadata", "annotations", "example.com/restored-by")
+	_, found, _ := unstructured.NestedFieldNoCopy(configMap, "spec")
+	require.False(t, found)
+
+	networkPolicy := resources[2].Object
+	requireNestedString(t, networkPolicy, "dr-42", "spec", "podSelector", "matchLabels", "run")
+	ingress, _, _ := unstructured.NestedSlice(networkPolicy, "spec", "ingress")
+	from := ingress[0].(map[string]interface{})["from"].([]interface{})
+	requireNestedString(t, from[0].(map[string]interface{}), "dr-42", "podSelector", "matchLabels", "run")
+	require.Equal(t, map[string]interface{}{"namespaceSelector": map[string]interface{}{}}, from[1])
+
+	// The selector of a Job is generated unless set
+	job := resources[3].Object
+	requireNestedString(t, job, "dr-42", "spec", "template", "metadata", "labels", "run")
+	_, found, _ = unstructured.NestedFieldNoCopy(job, "spec", "selector")
+	require.False(t, found)
+}
+
+// TestCommonMetadataWithoutSelectors verifies that the selectors are left as is without --label-selectors
+func TestCommonMetadataWithoutSelectors(t *testing.T) {
+	m, err := newCommonMetadata([]string{"run=dr-42"}, nil, false)
+	require.NoError(t, err)
+	obj := unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1", "kind": "Service", "metadata": map[string]interface{}{"name": "web"},
+		"spec": map[string]interface{}{"selector": map[string]interface{}{"app": "web"}},
+	}}
+	m.applyResource(&obj)
+	requireNestedString(t, obj.Object, "dr-42", "metadata", "labels", "run")
+	require.Equal(t, map[string]interface{}{"app": "web"}, obj.Object["spec"].(map[string]interface{})["selector"])
+
+	var none *commonMetadata
+	rendered := []renderedSource{{Manifests: []string{`{"kind":"ConfigMap"}`}}}
+	unchanged, err := none.apply(rendered)
+	require.NoError(t, err)
+	require.Equal(t, rendered, unchanged)
+}
+
+// TestNewCommonMetadataValidates verifies that the keys and the label values are validated
+func TestNewCommonMetadataValidates(t *testing.T) {
+	m, err := newCommonMetadata(nil, nil, true)
+	require.NoError(t, err)
+	require.Nil(t, m)
+
+	_, err = newCommonMetadata([]string{"run"}, nil, true)
+	require.ErrorContains(t, err, "expected key=value")
+	_, err = newCommonMetadata([]string{"run=not a label value"}, nil, true)
+	require.ErrorContains(t, err, "invalid label value")
+	_, err = newCommonMetadata(nil, []string{"bad key=x"}, true)
+	require.ErrorContains(t, err, "invalid annotation key")
+	_, err = newCommonMetadata(nil, []string{"note=free text, allowed"}, true)
+	require.NoError(t, err)
+}
+
+// requireNestedString requires the string field at the given path to have the expected value
+func requireNestedString(t *testing.T, obj map[string]interface{}, expected string, fields ...string) {
+	value, found, err := unstructured.NestedString(obj, fields...)
+	require.NoError(t, err)
+	require.True(t, found, "field %v not found", fields)
+	require.Equal(t, expected, value)
+}
@@ -0,0 +1,199 @@
+package preview
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	repoapiclient "github.com/argoproj/argo-cd/v3/reposerver/apiclient"
+	log "github.com/sirupsen/logrus"
+)
+
+// currentDebugArtifacts is the collector of the ongoing run, nil when --debug-artifacts is not set
+var currentDebugArtifacts *debugArtifacts
+
+// debugArtifacts dumps, for each rendered Application, what is needed to reproduce its rendering by hand:
+// the helm/kustomize command lines, the values files they use, and the environment passed to plugins.
+//
+// Commands are captured through a logrus hook, since the Argo CD exec utilities log each command line
+// (with credentials redacted) right before running it, at a time the temporary values files still exist.
+type debugArtifacts struct {
+	dir    string
+	mu     sync.Mutex
+	appDir string
+	count  int
+	// commands are the command lines of the Application, its commands file being written again at each step so
+	// that it can be encrypted
+	commands strings.Builder
+}
+
+// enableDebugArtifacts starts collecting the debug artifacts of the run into dir
+func enableDebugArtifacts(dir string) error {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return fmt.Errorf("failed to create debug artifacts directory: %w", err)
+	}
+	d := &debugArtifacts{dir: outputDirPath(dir)}
+	captureCommandLines(d)
+	currentDebugArtifacts = d
+	return nil
+}
+
+// captureCommandLines adds a hook receiving the command lines logged at info level by the Argo CD exec utilities,
+// or their output logged at debug level, while still only printing the entries of the configured level
+func captureCommandLines(hook log.Hook) {
+	std := log.StandardLogger()
+	if _, ok := std.Formatter.(*levelFilterFormatter); !ok {
+		std.SetFormatter(&levelFilterFormatter{Formatter: std.Formatter, level: std.GetLevel()})
+	}
+	for _, level := range hook.Levels() {
+		if !std.IsLevelEnabled(level) {
+			std.SetLevel(level)
+		}
+	}
+	std.AddHook(hook)
+}
+
+// startApp directs the artifacts collected from now on to the directory of the given Application
+func (d *debugArtifacts) startApp(app argoappv1.Application) error {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.appDir = filepath.Join(d.dir, appFileName(app))
+	d.count = 0
+	d.commands.Reset()
+	if err := os.RemoveAll(d.appDir); err != nil {
+		return err
+	}
+	return os.MkdirAll(d.appDir, 0o750)
+}
+
+// recordRequest dumps the plugin environment of a manifest request for a plugin source
+func (d *debugArtifacts) recordRequest(q *repoapiclient.ManifestRequest) {
+	if d == nil || q.ApplicationSource.Plugin == nil {
+		return
+	}
+	env, err := pluginEnv(q)
+	if err != nil {
+		log.Warnf("Failed to compute plugin env of '%s': %v", q.AppName, err)
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.count++
+	filename := filepath.Join(d.appDir, fmt.Sprintf("%02d-plugin.env", d.count))
+	if err := writeOutputFile(filename, []byte(strings.Join(env, "\n")+"\n")); err != nil {
+		log.Warnf("Failed to write plugin env of '%s': %v", q.AppName, err)
+	}
+}
+
+// Levels implements log.Hook
+func (d *debugArtifacts) Levels() []log.Level {
+	return []log.Level{log.InfoLevel}
+}
+
+// Fire implements log.Hook, it records the helm and kustomize command lines logged by the Argo CD exec utilities
+func (d *debugArtifacts) Fire(entry *log.Entry) error {
+	if _, ok := entry.Data["execID"]; !ok {
+		return nil
+	}
+	args := strings.Fields(entry.Message)
+	if len(args) == 0 {
+		return nil
+	}
+	switch filepath.Base(args[0]) {
+	case "helm", "kustomize":
+	default:
+		return nil
+	}
+	dir, _ := entry.Data["dir"].(string)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.appDir == "" {
+		return nil
+	}
+	d.count++
+	args = d.copyValuesFiles(dir, args)
+
+	fmt.Fprintf(&d.commands, "# step %d\n(cd %s && %s)\n\n", d.count, dir, strings.Join(args, " "))
+	return writeOutputFile(filepath.Join(d.appDir, "commands.sh"), []byte(d.commands.String()))
+}
+
+// copyValuesFiles copies the values files referenced by a helm command into the app directory,
+// returning the command arguments pointing to the copies
+func (d *debugArtifacts) copyValuesFiles(dir string, args []string) []string {
+	result := make([]string, len(args))
+	copy(result, args)
+	for i := 1; i < len(result); i++ {
+		if result[i-1] != "--values" && result[i-1] != "-f" {
+			continue
+		}
+		source := result[i]
+		if strings.Contains(source, "://") {
+			continue
+		}
+		if !filepath.IsAbs(source) {
+			source = filepath.Join(dir, source)
+		}
+		target := filepath.Join(d.appDir, "values", fmt.Sprintf("%02d-%s", d.count, filepath.Base(source)))
+		if err := copyOutputFile(source, target); err != nil {
+			log.Warnf("Failed to copy values file %s: %v", source, err)
+			continue
+		}
+		result[i] = outputFileName(target)
+	}
+	return result
+}
+
+// copyOutputFile copies a file to an output file, encrypted when the output is encrypted
+func copyOutputFile(source string, target string) error {
+	data, err := os.ReadFile(source) // #nosec G304 - path comes from the command being run
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o750); err != nil {
+		return err
+	}
+	return writeOutputFile(target, data)
+}
+
+// copyFile copies a regular file, creating the parent directories of the target
+func copyFile(source string, target string) error {
+	in, err := os.Open(source) // #nosec G304 - path comes from the command being run
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if err := os.MkdirAll(filepath.Dir(target), 0o750); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// levelFilterFormatter drops the log entries more verbose than the given level
+type levelFilterFormatter struct {
+	log.Formatter
+	level log.Level
+}
+
+// Format implements log.Formatter
+func (f *levelFilterFormatter) Format(entry *log.Entry) ([]byte, error) {
+	if entry.Level > f.level {
+		return nil, nil
+	}
+	return f.Formatter.Format(entry)
+}
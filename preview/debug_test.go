@@ -0,0 +1,54 @@
+package preview
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TestDebugArtifactsRecordsCommands verifies that helm commands and their values files are captured
+func TestDebugArtifactsRecordsCommands(t *testing.T) {
+	chartDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(chartDir, "values-prod.yaml"), []byte("replicas: 2\n"), 0o600))
+
+	d := &debugArtifacts{dir: t.TempDir()}
+	require.NoError(t, d.startApp(argoappv1.Application{ObjectMeta: metav1.ObjectMeta{Name: "app"}}))
+
+	entry := log.NewEntry(log.StandardLogger()).WithFields(log.Fields{"execID": "abc", "dir": chartDir})
+	entry.Message = "helm template . --name-template app --values values-prod.yaml --values https://example.com/v.yaml"
+	require.NoError(t, d.Fire(entry))
+
+	// Commands not run by the Argo CD exec utilities, or by other binaries, are ignored
+	other := log.NewEntry(log.StandardLogger()).WithFields(log.Fields{"execID": "def", "dir": chartDir})
+	other.Message = "git fetch origin"
+	require.NoError(t, d.Fire(other))
+
+	commands, err := os.ReadFile(filepath.Join(d.dir, "app", "commands.sh"))
+	require.NoError(t, err)
+	copied := filepath.Join(d.dir, "app", "values", "01-values-prod.yaml")
+	require.Contains(t, string(commands), "(cd "+chartDir+" && helm template . --name-template app --values "+copied)
+	require.Contains(t, string(commands), "--values https://example.com/v.yaml")
+	require.NotContains(t, string(commands), "git fetch")
+
+	values, err := os.ReadFile(copied)
+	require.NoError(t, err)
+	require.Equal(t, "replicas: 2\n", string(values))
+}
+
+// TestLevelFilterFormatter verifies that entries more verbose than the configured level are dropped
+func TestLevelFilterFormatter(t *testing.T) {
+	f := &levelFilterFormatter{Formatter: &log.TextFormatter{}, level: log.WarnLevel}
+
+	out, err := f.Format(&log.Entry{Level: log.InfoLevel, Message: "hidden"})
+	require.NoError(t, err)
+	require.Empty(t, out)
+
+	out, err = f.Format(&log.Entry{Level: log.WarnLevel, Message: "shown"})
+	require.NoError(t, err)
+	require.Contains(t, string(out), "shown")
+}
@@ -0,0 +1,215 @@
+package preview
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// Diff actions
+const (
+	diffActionAdded    = "added"
+	diffActionRemoved  = "removed"
+	diffActionModified = "modified"
+)
+
+// resourceKey identifies a resource across two renderings
+type resourceKey struct {
+	Group     string
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+// newResourceKey returns the key identifying the given resource
+func newResourceKey(obj *unstructured.Unstructured) resourceKey {
+	return resourceKey{
+		Group:     obj.GroupVersionKind().Group,
+		Kind:      obj.GetKind(),
+		Namespace: obj.GetNamespace(),
+		Name:      obj.GetName(),
+	}
+}
+
+// String returns the key as "[group/]Kind [namespace/]name"
+func (k resourceKey) String() string {
+	kind := k.Kind
+	if k.Group != "" {
+		kind = k.Group + "/" + k.Kind
+	}
+	name := k.Name
+	if k.Namespace != "" {
+		name = k.Namespace + "/" + k.Name
+	}
+	return kind + " " + name
+}
+
+// resourceDiff is a resource which differs between two renderings
+// Old is nil for an added resource, New is nil for a removed one.
+type resourceDiff struct {
+	Key resourceKey
+	Old *unstructured.Unstructured
+	New *unstructured.Unstructured
+}
+
+// action returns whether the resource was added, removed or modified
+func (d resourceDiff) action() string {
+	switch {
+	case d.Old == nil:
+		return diffActionAdded
+	case d.New == nil:
+		return diffActionRemoved
+	default:
+		return diffActionModified
+	}
+}
+
+// parseManifests parses the JSON manifests returned by the repository service
+func parseManifests(manifests []string) ([]unstructured.Unstructured, error) {
+	resources := make([]unstructured.Unstructured, 0, len(manifests))
+	for _, manifest := range manifests {
+		resource := unstructured.Unstructured{}
+		if err := json.Unmarshal([]byte(manifest), &resource); err != nil {
+			return nil, fmt.Errorf("failed to parse manifest: %w", err)
+		}
+		resources = append(resources, resource)
+	}
+	return resources, nil
+}
+
+// diffResources returns the resources which differ between the old and new renderings, sorted by key
+func diffResources(oldResources []unstructured.Unstructured, newResources []unstructured.Unstructured) []resourceDiff {
+	byKey := map[resourceKey]*resourceDiff{}
+	for i := range oldResources {
+		key := newResourceKey(&oldResources[i])
+		byKey[key] = &resourceDiff{Key: key, Old: &oldResources[i]}
+	}
+	for i := range newResources {
+		key := newResourceKey(&newResources[i])
+		if d, ok := byKey[key]; ok {
+			d.New = &newResources[i]
+		} else {
+			byKey[key] = &resourceDiff{Key: key, New: &newResources[i]}
+		}
+	}
+
+	diffs := make([]resourceDiff, 0, len(byKey))
+	for _, d := range byKey {
+		if d.Old != nil && d.New != nil && reflect.DeepEqual(d.Old.Object, d.New.Object) {
+			continue
+		}
+		diffs = append(diffs, *d)
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Key.String() < diffs[j].Key.String()
+	})
+	return diffs
+}
+
+// toYAML returns the YAML representation of a resource, empty for a nil one
+func toYAML(obj *unstructured.Unstructured) (string, error) {
+	if obj == nil {
+		return "", nil
+	}
+	data, err := yaml.Marshal(obj.Object)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// manifestStream returns the YAML stream of the resources, sorted by key
+func manifestStream(resources []unstructured.Unstructured) (string, error) {
+	sorted := slices.Clone(resources)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return newResourceKey(&sorted[i]).String() < newResourceKey(&sorted[j]).String()
+	})
+	var stream strings.Builder
+	for i := range sorted {
+		data, err := toYAML(&sorted[i])
+		if err != nil {
+			return "", err
+		}
+		stream.WriteString("---\n")
+		stream.WriteString(data)
+	}
+	return stream.String(), nil
+}
+
+// unifiedDiff returns the unified diff between the old and new YAML of a resource
+func unifiedDiff(d resourceDiff, context int) (string, error) {
+	oldYAML, err := toYAML(d.Old)
+	if err != nil {
+		return "", err
+	}
+	newYAML, err := toYAML(d.New)
+	if err != nil {
+		return "", err
+	}
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(oldYAML),
+		B:        difflib.SplitLines(newYAML),
+		FromFile: "old/" + d.Key.String(),
+		ToFile:   "new/" + d.Key.String(),
+		Context:  context,
+	})
+}
+
+// printCompactDiff prints the changed lines of each modified resource, and the added and removed resource keys
+func printCompactDiff(w io.Writer, diffs []resourceDiff) error {
+	for _, d := range diffs {
+		switch d.action() {
+		case diffActionAdded:
+			fmt.Fprintf(w, "  + %s\n", d.Key)
+		case diffActionRemoved:
+			fmt.Fprintf(w, "  - %s\n", d.Key)
+		default:
+			fmt.Fprintf(w, "  ~ %s\n", d.Key)
+			diff, err := unifiedDiff(d, 0)
+			if err != nil {
+				return err
+			}
+			for _, line := range strings.Split(diff, "\n") {
+				if strings.HasPrefix(line, "---") || strings.HasPrefix(line, "+++") || strings.HasPrefix(line, "@@") {
+					continue
+				}
+				if line != "" {
+					fmt.Fprintf(w, "      %s\n", line)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// printAppDiffs prints the diffs of an Application, as a compact diff, through the diffExec command when set, as a
+// structural diff, or as a one-line summary
+func printAppDiffs(
+	w io.Writer,
+	appName string,
+	diffs []resourceDiff,
+	summary bool,
+	diffExec string,
+	structural bool,
+) error {
+	if summary {
+		_, err := fmt.Fprintf(w, "application/%s: %s\n", appName, summarizeDiffs(diffs))
+		return err
+	}
+	fmt.Fprintf(w, "application/%s\n", appName)
+	if shouldMatch(diffExec) {
+		return printExecDiff(w, diffs, diffExec)
+	}
+	if structural {
+		return printStructuralDiff(w, diffs)
+	}
+	return printCompactDiff(w, diffs)
+}
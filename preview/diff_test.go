@@ -0,0 +1,62 @@
+package preview
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newTestResource(apiVersion string, kind string, name string, spec map[string]interface{}) unstructured.Unstructured {
+	obj := unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	obj.SetAPIVersion(apiVersion)
+	obj.SetKind(kind)
+	obj.SetName(name)
+	obj.SetNamespace("default")
+	return obj
+}
+
+// TestDiffResources verifies that only the added, removed and modified resources are returned, sorted by key
+func TestDiffResources(t *testing.T) {
+	oldResources := []unstructured.Unstructured{
+		newTestResource("apps/v1", "Deployment", "web", map[string]interface{}{"replicas": int64(2)}),
+		newTestResource("v1", "Service", "web", map[string]interface{}{"port": int64(80)}),
+		newTestResource("v1", "ConfigMap", "old", nil),
+	}
+	newResources := []unstructured.Unstructured{
+		newTestResource("apps/v1", "Deployment", "web", map[string]interface{}{"replicas": int64(3)}),
+		newTestResource("v1", "Service", "web", map[string]interface{}{"port": int64(80)}),
+		newTestResource("v1", "ConfigMap", "new", nil),
+	}
+
+	diffs := diffResources(oldResources, newResources)
+	require.Len(t, diffs, 3)
+	require.Equal(t, "ConfigMap default/new", diffs[0].Key.String())
+	require.Equal(t, diffActionAdded, diffs[0].action())
+	require.Equal(t, "ConfigMap default/old", diffs[1].Key.String())
+	require.Equal(t, diffActionRemoved, diffs[1].action())
+	require.Equal(t, "apps/Deployment default/web", diffs[2].Key.String())
+	require.Equal(t, diffActionModified, diffs[2].action())
+}
+
+// TestPrintCompactDiff verifies that only the changed lines of modified resources are printed
+func TestPrintCompactDiff(t *testing.T) {
+	diffs := diffResources(
+		[]unstructured.Unstructured{
+			newTestResource("apps/v1", "Deployment", "web", map[string]interface{}{"replicas": int64(2)}),
+		},
+		[]unstructured.Unstructured{
+			newTestResource("apps/v1", "Deployment", "web", map[string]interface{}{"replicas": int64(3)}),
+			newTestResource("v1", "ConfigMap", "new", nil),
+		},
+	)
+
+	var out bytes.Buffer
+	require.NoError(t, printCompactDiff(&out, diffs))
+	require.Equal(t, `  + ConfigMap default/new
+  ~ apps/Deployment default/web
+      -  replicas: 2
+      +  replicas: 3
+`, out.String())
+}
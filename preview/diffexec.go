@@ -0,0 +1,65 @@
+package preview
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// printExecDiff pipes the old and new YAML of each changed resource through an external diff command, split on
+// spaces like KUBECTL_EXTERNAL_DIFF, e.g. "dyff between". The command is given the old and new files, an empty file
+// standing for the missing side of an added or removed resource. Like diff, it may exit with status 1 when the
+// files differ.
+func printExecDiff(w io.Writer, diffs []resourceDiff, command string) error {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return errors.New("the diff command is empty")
+	}
+	dir, err := os.MkdirTemp("", strings.TrimSuffix(tempFilePattern, "*")+"diff-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	for _, side := range []string{"old", "new"} {
+		if err := os.Mkdir(filepath.Join(dir, side), 0o700); err != nil {
+			return err
+		}
+	}
+
+	names := newFileNames()
+	for _, d := range diffs {
+		symbol := map[string]string{diffActionAdded: "+", diffActionRemoved: "-", diffActionModified: "~"}[d.action()]
+		fmt.Fprintf(w, "  %s %s\n", symbol, d.Key)
+		name := names.unique(safeFileName(d.Key.String())) + ".yaml"
+		oldFile, newFile := filepath.Join(dir, "old", name), filepath.Join(dir, "new", name)
+		if err := writeDiffSide(oldFile, d.Old); err != nil {
+			return err
+		}
+		if err := writeDiffSide(newFile, d.New); err != nil {
+			return err
+		}
+		cmd := exec.Command(args[0], append(args[1:], oldFile, newFile)...) // #nosec G204 - user provided command
+		cmd.Stdout = w
+		cmd.Stderr = os.Stderr
+		var exitErr *exec.ExitError
+		if err := cmd.Run(); err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 1) {
+			return fmt.Errorf("diff command '%s' failed on %s: %w", command, d.Key, err)
+		}
+	}
+	return nil
+}
+
+// writeDiffSide writes the YAML of a side of a resource diff, an empty file for a nil resource
+func writeDiffSide(file string, obj *unstructured.Unstructured) error {
+	data, err := toYAML(obj)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, []byte(data), 0o600)
+}
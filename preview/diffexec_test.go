@@ -0,0 +1,27 @@
+package preview
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// TestPrintExecDiff verifies that the resources are diffed by the external command, exit status 1 included
+func TestPrintExecDiff(t *testing.T) {
+	oldWeb := newTestResource("apps/v1", "Deployment", "web", map[string]interface{}{"replicas": int64(2)})
+	newWeb := newTestResource("apps/v1", "Deployment", "web", map[string]interface{}{"replicas": int64(3)})
+	added := newTestResource("v1", "ConfigMap", "cfg", nil)
+	diffs := diffResources([]unstructured.Unstructured{oldWeb}, []unstructured.Unstructured{newWeb, added})
+
+	var out bytes.Buffer
+	require.NoError(t, printExecDiff(&out, diffs, "diff --label old --label new -u"))
+	require.Contains(t, out.String(), "  + ConfigMap default/cfg\n")
+	require.Contains(t, out.String(), "  ~ apps/Deployment default/web\n")
+	require.Contains(t, out.String(), "-  replicas: 2\n+  replicas: 3\n")
+
+	err := printExecDiff(&out, diffs, "no-such-differ between")
+	require.ErrorContains(t, err, "diff command 'no-such-differ between' failed")
+	require.ErrorContains(t, printExecDiff(&out, diffs, " "), "the diff command is empty")
+}
@@ -0,0 +1,187 @@
+package preview
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// duplicateKeyPattern matches the duplicate keys reported by the strict YAML parser
+var duplicateKeyPattern = regexp.MustCompile(`line (\d+): (key .* already set in map)`)
+
+// yamlSeparator separates the documents of a YAML stream
+const yamlSeparator = "---"
+
+// errDuplicateKeys is returned for a document defining a key several times
+var errDuplicateKeys = errors.New("duplicate keys, the last value is used")
+
+// documentError is an error of a document of a YAML stream
+type documentError struct {
+	// index is the index of the document in the stream, from 1
+	index int
+	// line is the line of the stream the document starts at, from 1
+	line int
+	// resource is the kind and name of the resource defined by the document, when parsed
+	resource string
+	err      error
+}
+
+func (e *documentError) Error() string {
+	if e.resource != "" {
+		return fmt.Sprintf("document %d (line %d, %s): %v", e.index, e.line, e.resource, e.err)
+	}
+	return fmt.Sprintf("document %d (line %d): %v", e.index, e.line, e.err)
+}
+
+func (e *documentError) Unwrap() error {
+	return e.err
+}
+
+// invalidDocumentsError lists the invalid documents of a YAML stream
+type invalidDocumentsError struct {
+	errs []*documentError
+}
+
+// Error implements error, listing all the invalid documents of the stream
+func (e *invalidDocumentsError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("invalid documents:")
+	for _, err := range e.errs {
+		sb.WriteString("\n- " + err.Error())
+	}
+	return sb.String()
+}
+
+// Unwrap returns the errors of the documents
+func (e *invalidDocumentsError) Unwrap() []error {
+	errs := make([]error, 0, len(e.errs))
+	for _, err := range e.errs {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// yamlDocument is a document of a YAML stream
+type yamlDocument struct {
+	line int
+	data []byte
+}
+
+// splitYAMLDocuments parses the documents of a YAML stream one by one, so that an invalid document is reported
+// without preventing the others from being read. Anchors, aliases and merge keys are resolved; duplicate keys are
+// resolved like Argo CD does, the last value winning, and reported along with the resource.
+func splitYAMLDocuments(data []byte) ([]*unstructured.Unstructured, []*documentError) {
+	var objs []*unstructured.Unstructured
+	var errs []*documentError
+	index := 0
+	for _, doc := range readYAMLDocuments(data) {
+		obj, err := parseYAMLDocument(doc)
+		if obj == nil && err == nil {
+			continue
+		}
+		index++
+		if err != nil {
+			docErr := &documentError{index: index, line: doc.line, err: err}
+			if obj != nil {
+				docErr.resource = fmt.Sprintf("%s/%s", obj.GetKind(), obj.GetName())
+			}
+			errs = append(errs, docErr)
+		}
+		if obj != nil {
+			objs = append(objs, obj)
+		}
+	}
+	return objs, errs
+}
+
+// readYAMLDocuments splits a YAML stream into documents, like the YAML reader of Kubernetes, without limit on the
+// length of the lines
+func readYAMLDocuments(data []byte) []yamlDocument {
+	var docs []yamlDocument
+	current := yamlDocument{line: 1}
+	reader := bufio.NewReader(bytes.NewReader(data))
+	for line := 1; ; line++ {
+		text, err := reader.ReadBytes('\n')
+		if isYAMLSeparator(text) {
+			docs = append(docs, current)
+			current = yamlDocument{line: line + 1}
+		} else {
+			current.data = append(current.data, text...)
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	return append(docs, current)
+}
+
+// isYAMLSeparator returns whether a line separates two documents: --- optionally followed by a comment
+func isYAMLSeparator(line []byte) bool {
+	if !bytes.HasPrefix(line, []byte(yamlSeparator)) {
+		return false
+	}
+	rest := bytes.TrimSpace(line[len(yamlSeparator):])
+	return len(rest) == 0 || rest[0] == '#'
+}
+
+// parseYAMLDocument parses a document, nil when it holds no resource. The resource is returned along with
+// errDuplicateKeys when keys are defined several times.
+func parseYAMLDocument(doc yamlDocument) (*unstructured.Unstructured, error) {
+	if len(bytes.TrimSpace(doc.data)) == 0 {
+		return nil, nil
+	}
+	if !utf8.Valid(doc.data) {
+		offset := 0
+		for offset < len(doc.data) {
+			r, size := utf8.DecodeRune(doc.data[offset:])
+			if r == utf8.RuneError && size == 1 {
+				break
+			}
+			offset += size
+		}
+		return nil, fmt.Errorf("invalid UTF-8 content at line %d", doc.line+bytes.Count(doc.data[:offset], []byte("\n")))
+	}
+
+	var duplicates error
+	data, err := yaml.YAMLToJSONStrict(doc.data)
+	if err != nil {
+		lenient, lenientErr := yaml.YAMLToJSON(doc.data)
+		if lenientErr != nil {
+			return nil, lenientErr
+		}
+		data, duplicates = lenient, duplicateKeysError(doc, err)
+	}
+	if bytes.Equal(data, []byte("null")) {
+		// Only comments
+		return nil, nil
+	}
+	obj := map[string]interface{}{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, fmt.Errorf("not a resource: %w", err)
+	}
+	return &unstructured.Unstructured{Object: obj}, duplicates
+}
+
+// duplicateKeysError returns the errDuplicateKeys error listing the keys defined several times, at their line
+// in the stream
+func duplicateKeysError(doc yamlDocument, err error) error {
+	var keys []string
+	for _, match := range duplicateKeyPattern.FindAllStringSubmatch(err.Error(), -1) {
+		line, _ := strconv.Atoi(match[1])
+		keys = append(keys, fmt.Sprintf("%s at line %d", match[2], doc.line+line-1))
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("%w: %v", errDuplicateKeys, err)
+	}
+	return fmt.Errorf("%w: %s", errDuplicateKeys, strings.Join(keys, ", "))
+}
@@ -0,0 +1,98 @@
+package preview
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestSplitYAMLDocuments verifies that the invalid documents are reported without preventing the others from
+// being read
+func TestSplitYAMLDocuments(t *testing.T) {
+	configMap := func(name string) string {
+		return "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: " + name + "\n"
+	}
+	tests := []struct {
+		name     string
+		manifest string
+		expected []string
+		errors   []string
+	}{
+		{
+			name:     "anchors, aliases and merge keys",
+			manifest: configMap("a") + "  labels: &labels {app: a}\n  annotations:\n    <<: *labels\n    team: b\n",
+			expected: []string{"a"},
+		},
+		{
+			name:     "empty and comment documents",
+			manifest: "---\n# comment\n---\n" + configMap("a") + "--- # end\n",
+			expected: []string{"a"},
+		},
+		{
+			name:     "duplicate keys",
+			manifest: configMap("a") + "---\n" + configMap("b") + "data:\n  x: '1'\n  x: '2'\n",
+			expected: []string{"a", "b"},
+			errors: []string{
+				`document 2 (line 6, ConfigMap/b): duplicate keys, the last value is used: ` +
+					`key "x" already set in map at line 12`,
+			},
+		},
+		{
+			name:     "invalid YAML",
+			manifest: configMap("a") + "---\nkind: [\n---\n" + configMap("c"),
+			expected: []string{"a", "c"},
+			errors:   []string{"document 2 (line 6): yaml: line 1: did not find expected node content"},
+		},
+		{
+			name:     "not a resource",
+			manifest: "- a\n---\n" + configMap("b"),
+			expected: []string{"b"},
+			errors:   []string{"document 1 (line 1): not a resource"},
+		},
+		{
+			name:     "invalid UTF-8",
+			manifest: configMap("a") + "data:\n  x: \"\xff\"\n---\n" + configMap("b"),
+			expected: []string{"b"},
+			errors:   []string{"document 1 (line 1): invalid UTF-8 content at line 6"},
+		},
+		{
+			name:     "long line",
+			manifest: configMap("a") + "data:\n  x: " + strings.Repeat("x", 1<<20) + "\n",
+			expected: []string{"a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objs, errs := splitYAMLDocuments([]byte(tt.manifest))
+			var names []string
+			for _, obj := range objs {
+				names = append(names, obj.GetName())
+			}
+			require.Equal(t, tt.expected, names)
+			require.Len(t, errs, len(tt.errors))
+			for i, err := range errs {
+				require.Contains(t, err.Error(), tt.errors[i])
+			}
+		})
+	}
+}
+
+// TestSplitManifestsInvalid verifies that the invalid documents fail, all of them being reported, and that the
+// duplicate keys fail in strict mode only
+func TestSplitManifestsInvalid(t *testing.T) {
+	_, err := splitManifests([]byte("kind: [\n---\n- a\n---\napiVersion: v1\nkind: ConfigMap\n"), "test.yaml")
+	require.EqualError(t, err, "invalid documents:\n"+
+		"- document 1 (line 1): yaml: line 1: did not find expected node content\n"+
+		"- document 2 (line 3): not a resource: json: cannot unmarshal array into Go value of type map[string]interface {}")
+
+	manifest := []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n  name: b\n")
+	objs, err := splitManifests(manifest, "test.yaml")
+	require.NoError(t, err)
+	require.Equal(t, "b", objs[0].GetName())
+
+	strictMode = true
+	defer func() { strictMode = false }()
+	_, err = splitManifests(manifest, "test.yaml")
+	require.ErrorIs(t, err, errDuplicateKeys)
+}
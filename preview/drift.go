@@ -0,0 +1,200 @@
+package preview
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/argoproj/argo-cd/v3/common"
+	settingspkg "github.com/argoproj/argo-cd/v3/pkg/apiclient/settings"
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// DriftOptions holds the settings of the drift commands
+type DriftOptions struct {
+	// AppName restricts the report to the Application with this name
+	AppName string
+	// Shard restricts the report to the Applications of a shard of the run, given as index/count
+	Shard string
+	// ClusterExport is the directory holding the exported cluster resources
+	ClusterExport string
+	// Output is the format of the report, text or json
+	Output string
+	// OnlyChanged leaves out the Applications without drift from the output
+	OnlyChanged bool
+	// DiffExec is the external command the old and new YAML of each changed resource are diffed with
+	DiffExec string
+	// StructuralDiff prints the changed YAML paths of each modified resource with their old and new values,
+	// instead of the changed lines
+	StructuralDiff bool
+}
+
+// driftEntry is a resource whose state differs between the rendered output and the cluster export
+type driftEntry struct {
+	Application string `json:"application"`
+	Resource    string `json:"resource"`
+	// Status is added when the resource is missing from the cluster, removed when it is only in the cluster,
+	// modified when its state drifted
+	Status string `json:"status"`
+	Diff   string `json:"diff,omitempty"`
+	// Immutable lists the changes the API server would reject, failing the sync unless the resource is recreated
+	Immutable []string `json:"immutable,omitempty"`
+}
+
+// DriftApplications reports the drift of the Applications defined in a manifest against a cluster export
+func DriftApplications(filename string, opts DriftOptions) {
+	drift(loadApplications(filename), opts)
+}
+
+// DriftResources reports the drift of the Applications generated from an ApplicationSet against a cluster export
+func DriftResources(filename string, opts DriftOptions) {
+	drift(generateApplications(filename), opts)
+}
+
+// drift renders the Applications and compares them to the exported cluster resources,
+// exiting with status 1 when a drift is found
+func drift(apps []argoappv1.Application, opts DriftOptions) {
+	if opts.Output != "text" && opts.Output != "json" {
+		log.Fatalf("Unknown output format: %s", opts.Output)
+	}
+	shard, err := parseShard(opts.Shard)
+	if err != nil {
+		log.Fatal(err)
+	}
+	exported, err := loadClusterExport(opts.ClusterExport)
+	if err != nil {
+		log.Fatal(err)
+	}
+	repoService, err := newRepoService()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	entries := []driftEntry{}
+	for _, app := range apps {
+		if shouldMatch(opts.AppName) && opts.AppName != app.Name || !shard.includes(app) {
+			continue
+		}
+		rendered, err := generateAppManifests(repoService, app)
+		if err != nil {
+			log.Fatal(err)
+		}
+		targets, err := parseManifests(allManifests(rendered))
+		if err != nil {
+			log.Fatal(err)
+		}
+		diffs, err := diffClusterExport(app, exported, targets)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if opts.Output == "text" {
+			if len(diffs) == 0 {
+				if !opts.OnlyChanged {
+					fmt.Printf("application/%s: no drift\n", app.Name)
+				}
+				continue
+			}
+			if err := printAppDiffs(os.Stdout, app.Name, diffs, false, opts.DiffExec,
+				opts.StructuralDiff); err != nil {
+				log.Fatal(err)
+			}
+			warnImmutableChanges(app, diffs)
+		}
+		for _, d := range diffs {
+			entry := driftEntry{
+				Application: app.Name,
+				Resource:    d.Key.String(),
+				Status:      d.action(),
+				Immutable:   immutableChanges(app, d),
+			}
+			if entry.Status == diffActionModified {
+				if entry.Diff, err = unifiedDiff(d, 3); err != nil {
+					log.Fatal(err)
+				}
+			}
+			entries = append(entries, entry)
+		}
+	}
+
+	if opts.Output == "json" {
+		data, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(string(data))
+	}
+	if len(entries) > 0 {
+		os.Exit(1)
+	}
+}
+
+// loadClusterExport loads the resources exported from a cluster, e.g. by `kubectl get -o yaml` or a Velero
+// backup, from the YAML and JSON files of a directory. List resources are unwrapped into their items.
+func loadClusterExport(dir string) ([]*unstructured.Unstructured, error) {
+	if !shouldMatch(dir) {
+		return nil, fmt.Errorf("the directory of the cluster export must be given with --cluster-export")
+	}
+	return loadManifestObjects([]string{dir})
+}
+
+// diffClusterExport diffs the rendered resources of an Application against the exported cluster resources.
+// The exported resources considered are the ones rendered by the Application, and the ones tracked by the
+// Application in the cluster, which would be pruned when no longer rendered. Secrets are skipped.
+func diffClusterExport(
+	app argoappv1.Application,
+	exported []*unstructured.Unstructured,
+	targets []unstructured.Unstructured,
+) ([]resourceDiff, error) {
+	// Without a cluster to discover the namespaced kinds from, they are guessed from the kind
+	rendered := map[resourceKey]bool{}
+	for i := range targets {
+		if targets[i].GetNamespace() == "" && isNamespacedResource(&targets[i]) {
+			targets[i].SetNamespace(app.Spec.Destination.Namespace)
+		}
+		rendered[newResourceKey(&targets[i])] = true
+	}
+
+	var live []*argoappv1.ResourceDiff
+	for _, obj := range exported {
+		key := newResourceKey(obj)
+		if !rendered[key] && !isTrackedBy(obj, app) {
+			continue
+		}
+		data, err := json.Marshal(obj.Object)
+		if err != nil {
+			return nil, err
+		}
+		live = append(live, &argoappv1.ResourceDiff{
+			Group:               key.Group,
+			Kind:                key.Kind,
+			Namespace:           key.Namespace,
+			Name:                key.Name,
+			NormalizedLiveState: string(data),
+		})
+	}
+
+	items, err := pairLiveResources(app, live, targets)
+	if err != nil {
+		return nil, err
+	}
+	return diffLiveItems(app, &settingspkg.Settings{}, items)
+}
+
+// isTrackedBy returns true when the resource carries the tracking metadata of the Application,
+// either the tracking annotation or the default instance label.
+// The instance name depends on the namespace of the controller, so both of its forms are accepted.
+func isTrackedBy(obj *unstructured.Unstructured, app argoappv1.Application) bool {
+	instanceNames := []string{app.Name, app.InstanceName("")}
+	trackingID, annotated := obj.GetAnnotations()[common.AnnotationKeyAppInstance]
+	for _, instanceName := range instanceNames {
+		if annotated && strings.HasPrefix(trackingID, instanceName+":") ||
+			!annotated && obj.GetLabels()[common.LabelKeyAppInstance] == instanceName {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package preview
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const testClusterExport = `apiVersion: v1
+kind: List
+items:
+  - apiVersion: apps/v1
+    kind: Deployment
+    metadata:
+      name: web
+      namespace: default
+      uid: 0b7e2c4e
+      resourceVersion: "1234"
+      annotations:
+        argocd.argoproj.io/tracking-id: web:apps/Deployment:default/web
+    spec:
+      replicas: 5
+      progressDeadlineSeconds: 600
+    status:
+      readyReplicas: 5
+  - apiVersion: v1
+    kind: Service
+    metadata:
+      name: web
+      namespace: default
+      annotations:
+        argocd.argoproj.io/tracking-id: web:/Service:default/web
+    spec:
+      port: 80
+      clusterIP: 10.0.0.1
+  - apiVersion: v1
+    kind: ConfigMap
+    metadata:
+      name: stale
+      namespace: default
+      labels:
+        app.kubernetes.io/instance: web
+  - apiVersion: v1
+    kind: ConfigMap
+    metadata:
+      name: unrelated
+      namespace: default
+`
+
+// TestDiffClusterExport verifies that rendered resources are compared to the exported ones
+func TestDiffClusterExport(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "export.yaml"), []byte(testClusterExport), 0o600))
+	exported, err := loadClusterExport(dir)
+	require.NoError(t, err)
+	require.Len(t, exported, 4)
+
+	app := argoappv1.Application{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "argocd"},
+		Spec:       argoappv1.ApplicationSpec{Destination: argoappv1.ApplicationDestination{Namespace: "default"}},
+	}
+	service := newTestResource("v1", "Service", "web", map[string]interface{}{"port": int64(80)})
+	service.SetNamespace("")
+	targets := []unstructured.Unstructured{
+		newTestResource("apps/v1", "Deployment", "web", map[string]interface{}{"replicas": int64(3)}),
+		service,
+		newTestResource("v1", "ConfigMap", "new", nil),
+	}
+
+	diffs, err := diffClusterExport(app, exported, targets)
+	require.NoError(t, err)
+	require.Len(t, diffs, 3)
+	require.Equal(t, "ConfigMap default/new", diffs[0].Key.String())
+	require.Equal(t, diffActionAdded, diffs[0].action())
+	require.Equal(t, "ConfigMap default/stale", diffs[1].Key.String())
+	require.Equal(t, diffActionRemoved, diffs[1].action())
+	require.Equal(t, "apps/Deployment default/web", diffs[2].Key.String())
+	require.Equal(t, diffActionModified, diffs[2].action())
+
+	diff, err := unifiedDiff(diffs[2], 0)
+	require.NoError(t, err)
+	require.Contains(t, diff, "-  replicas: 5\n+  replicas: 3\n")
+}
@@ -0,0 +1,202 @@
+package preview
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	log "github.com/sirupsen/logrus"
+)
+
+// encryptedSuffix is appended to the names of the encrypted output files
+const encryptedSuffix = ".age"
+
+// outputRecipients are the age recipients the output files are encrypted to, nil when they are written in plain text
+var outputRecipients []age.Recipient
+
+// EncryptOutput encrypts the files written with --output-dir, --report and --debug-artifacts to age recipients,
+// since they may hold the content of Secrets
+func EncryptOutput(recipients []string) {
+	parsed, err := parseRecipients(recipients)
+	if err != nil {
+		log.Fatal(err)
+	}
+	outputRecipients = parsed
+}
+
+// parseRecipients parses age public keys (age1...)
+func parseRecipients(recipients []string) ([]age.Recipient, error) {
+	parsed := make([]age.Recipient, 0, len(recipients))
+	for _, recipient := range recipients {
+		r, err := age.ParseX25519Recipient(strings.TrimSpace(recipient))
+		if err != nil {
+			return nil, fmt.Errorf("invalid age recipient '%s': %w", recipient, err)
+		}
+		parsed = append(parsed, r)
+	}
+	return parsed, nil
+}
+
+// outputFileName returns the name an output file is written to, with the suffix of the encrypted files when the
+// output is encrypted
+func outputFileName(filename string) string {
+	if outputRecipients == nil {
+		return filename
+	}
+	return filename + encryptedSuffix
+}
+
+// writeOutputFile writes an output file to outputFileName(filename), encrypted when the output is encrypted
+func writeOutputFile(filename string, data []byte) error {
+	if outputRecipients != nil {
+		var encrypted bytes.Buffer
+		w, err := age.Encrypt(&encrypted, outputRecipients...)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt %s: %w", filename, err)
+		}
+		if _, err := w.Write(data); err != nil {
+			return fmt.Errorf("failed to encrypt %s: %w", filename, err)
+		}
+		if err := w.Close(); err != nil {
+			return fmt.Errorf("failed to encrypt %s: %w", filename, err)
+		}
+		data = encrypted.Bytes()
+	}
+	return os.WriteFile(outputFileName(filename), data, 0o600)
+}
+
+// outputFile is an output file written as a stream, encrypted when the output is encrypted
+type outputFile struct {
+	file *os.File
+	// w encrypts to the file, the file itself when the output is written in plain text
+	w io.WriteCloser
+}
+
+// createOutputFile creates the output file outputFileName(filename), written as the data comes
+func createOutputFile(filename string) (*outputFile, error) {
+	return createEncryptedFile(outputFileName(filename), outputRecipients)
+}
+
+// createEncryptedFile creates a file encrypted to the recipients, in plain text when there are none
+func createEncryptedFile(filename string, recipients []age.Recipient) (*outputFile, error) {
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0o600) // #nosec G304 - output file
+	if err != nil {
+		return nil, err
+	}
+	f := &outputFile{file: file, w: file}
+	if recipients != nil {
+		if f.w, err = age.Encrypt(file, recipients...); err != nil {
+			_ = file.Close()
+			return nil, fmt.Errorf("failed to encrypt %s: %w", filename, err)
+		}
+	}
+	return f, nil
+}
+
+// Write implements io.Writer
+func (f *outputFile) Write(p []byte) (int, error) {
+	return f.w.Write(p)
+}
+
+// Close flushes the encryption and closes the file
+func (f *outputFile) Close() error {
+	if f.w != io.WriteCloser(f.file) {
+		if err := f.w.Close(); err != nil {
+			_ = f.file.Close()
+			return fmt.Errorf("failed to encrypt %s: %w", f.file.Name(), err)
+		}
+	}
+	return f.file.Close()
+}
+
+// spoolFile is a temporary file holding a part of an output file until it is complete. The file is opened for each
+// write and closed again, so that the spool files of the clusters do not stay open until the end of the run, whatever
+// their number. When the output is encrypted, each write is encrypted to a key only known to the run, so that the
+// content of Secrets is not written in plain text, and prefixed with its length.
+type spoolFile struct {
+	name     string
+	identity *age.X25519Identity
+}
+
+// createSpoolFile creates a spool file, replacing the one of an earlier run
+func createSpoolFile(filename string) (*spoolFile, error) {
+	s := &spoolFile{name: filename}
+	if outputRecipients != nil {
+		identity, err := age.GenerateX25519Identity()
+		if err != nil {
+			return nil, err
+		}
+		s.identity = identity
+	}
+	if err := os.WriteFile(filename, nil, 0o600); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Write implements io.Writer, appending to the spool file
+func (s *spoolFile) Write(p []byte) (int, error) {
+	data := p
+	if s.identity != nil {
+		var encrypted bytes.Buffer
+		encrypted.Write(make([]byte, 8))
+		w, err := age.Encrypt(&encrypted, s.identity.Recipient())
+		if err == nil {
+			_, err = w.Write(p)
+		}
+		if err == nil {
+			err = w.Close()
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to encrypt %s: %w", s.name, err)
+		}
+		data = encrypted.Bytes()
+		binary.BigEndian.PutUint64(data, uint64(len(data)-8))
+	}
+	file, err := os.OpenFile(s.name, os.O_APPEND|os.O_WRONLY, 0o600) // #nosec G304 - spool file created by the run
+	if err != nil {
+		return 0, err
+	}
+	if _, err := file.Write(data); err != nil {
+		_ = file.Close()
+		return 0, err
+	}
+	return len(p), file.Close()
+}
+
+// copyTo writes the content of the spool file to w, then removes the spool file
+func (s *spoolFile) copyTo(w io.Writer) error {
+	defer os.Remove(s.name)
+	file, err := os.Open(s.name) // #nosec G304 - spool file created by the run
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if s.identity == nil {
+		_, err = io.Copy(w, file)
+		return err
+	}
+	for {
+		var size uint64
+		if err := binary.Read(file, binary.BigEndian, &size); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to read %s: %w", s.name, err)
+		}
+		chunk := make([]byte, size)
+		if _, err := io.ReadFull(file, chunk); err != nil {
+			return fmt.Errorf("failed to read %s: %w", s.name, err)
+		}
+		decrypted, err := age.Decrypt(bytes.NewReader(chunk), s.identity)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt %s: %w", s.name, err)
+		}
+		if _, err := io.Copy(w, decrypted); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package preview
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/stretchr/testify/require"
+)
+
+// TestWriteOutputFile verifies that the output files are encrypted to the recipients when set
+func TestWriteOutputFile(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, writeOutputFile(filepath.Join(dir, "report.json"), []byte("{}\n")))
+	data, err := os.ReadFile(filepath.Join(dir, "report.json"))
+	require.NoError(t, err)
+	require.Equal(t, "{}\n", string(data))
+
+	identity, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	other, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	recipients, err := parseRecipients([]string{identity.Recipient().String(), other.Recipient().String()})
+	require.NoError(t, err)
+	outputRecipients = recipients
+	t.Cleanup(func() { outputRecipients = nil })
+
+	filename := filepath.Join(dir, "apply.yaml")
+	require.Equal(t, filename+".age", outputFileName(filename))
+	require.NoError(t, writeOutputFile(filename, []byte("kind: Secret\n")))
+	require.NoFileExists(t, filename)
+	data, err = os.ReadFile(filename + ".age")
+	require.NoError(t, err)
+	require.NotContains(t, string(data), "Secret")
+
+	// Each recipient can decrypt the file
+	for _, id := range []age.Identity{identity, other} {
+		r, err := age.Decrypt(bytes.NewReader(data), id)
+		require.NoError(t, err)
+		plain, err := io.ReadAll(r)
+		require.NoError(t, err)
+		require.Equal(t, "kind: Secret\n", string(plain))
+	}
+}
+
+// TestParseRecipients verifies that the recipients must be age public keys
+func TestParseRecipients(t *testing.T) {
+	_, err := parseRecipients([]string{"ssh-ed25519 AAAA"})
+	require.ErrorContains(t, err, "invalid age recipient 'ssh-ed25519 AAAA'")
+}
@@ -0,0 +1,163 @@
+package preview
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	log "github.com/sirupsen/logrus"
+)
+
+// Events of the exec hooks, given in the event field of their input
+const (
+	execHookPreLoad    = "pre-load"
+	execHookPostRender = "post-render"
+	execHookPostRun    = "post-run"
+)
+
+// ExecHooks are the commands run around the rendering pipeline, split on spaces like --diff-exec. Each is given
+// a JSON document on its standard input, its standard error being passed through, and fails the run when it exits
+// with a non-zero status.
+type ExecHooks struct {
+	// PreLoad is run before the Applications are loaded from the manifest, e.g. to fetch or generate it
+	PreLoad string
+	// PostRender is run once each Application is rendered, with its resources. The resources it prints, a YAML or
+	// JSON stream, replace the rendered ones, nothing keeping them as rendered.
+	PostRender string
+	// PostRun is run once the run is done, with the status of each Application, e.g. to upload or notify
+	PostRun string
+}
+
+// preLoadInput is the input of the pre-load hook
+type preLoadInput struct {
+	Event    string `json:"event"`
+	Manifest string `json:"manifest"`
+}
+
+// postRenderInput is the input of the post-render hook
+type postRenderInput struct {
+	Event       string                   `json:"event"`
+	Application argoappv1.Application    `json:"application"`
+	Resources   []map[string]interface{} `json:"resources"`
+}
+
+// postRunInput is the input of the post-run hook
+type postRunInput struct {
+	Event         string        `json:"event"`
+	Applications  []execHookApp `json:"applications"`
+	OutputDir     string        `json:"outputDir,omitempty"`
+	OutputArchive string        `json:"outputArchive,omitempty"`
+	Report        string        `json:"report,omitempty"`
+	// Error is the error the run failed with
+	Error string `json:"error,omitempty"`
+}
+
+// execHookApp is an Application of the run, as given to the post-run hook
+type execHookApp struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	// Status is one of succeeded|failed|skipped|resumed, as in the report
+	Status string `json:"status"`
+}
+
+// runPreLoadHook runs the pre-load hook, when set, before the Applications of a manifest are loaded
+func (h ExecHooks) runPreLoadHook(filename string) {
+	if !shouldMatch(h.PreLoad) {
+		return
+	}
+	input := preLoadInput{Event: execHookPreLoad, Manifest: filename}
+	if _, err := runExecHook(h.PreLoad, execHookPreLoad, input); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// runPostRenderHook runs the post-render hook, when set, on the rendered manifests of an Application, returning
+// the manifests it prints, or the rendered ones when it prints nothing
+func (h ExecHooks) runPostRenderHook(app argoappv1.Application, manifests []string) ([]string, error) {
+	if !shouldMatch(h.PostRender) {
+		return manifests, nil
+	}
+	input := postRenderInput{Event: execHookPostRender, Application: app, Resources: []map[string]interface{}{}}
+	input.Application.APIVersion, input.Application.Kind = applicationAPIVersion, applicationKind
+	resources, err := parseManifests(manifests)
+	if err != nil {
+		return nil, err
+	}
+	for _, resource := range resources {
+		input.Resources = append(input.Resources, resource.Object)
+	}
+	output, err := runExecHook(h.PostRender, execHookPostRender, input)
+	if err != nil {
+		return nil, fmt.Errorf("application '%s': %w", app.Name, err)
+	}
+	if len(bytes.TrimSpace(output)) == 0 {
+		return manifests, nil
+	}
+	objs, err := splitManifests(output, "the output of the "+execHookPostRender+" hook")
+	if err != nil {
+		return nil, fmt.Errorf("invalid output of the %s hook of Application '%s': %w", execHookPostRender, app.Name,
+			err)
+	}
+	mutated := make([]string, 0, len(objs))
+	for _, obj := range objs {
+		data, err := json.Marshal(obj.Object)
+		if err != nil {
+			return nil, err
+		}
+		mutated = append(mutated, string(data))
+	}
+	return mutated, nil
+}
+
+// runPostRunHook runs the post-run hook, when set, once the run is done or failed with runErr
+func (h ExecHooks) runPostRunHook(apps []execHookApp, opts RenderOptions, runErr error) error {
+	if !shouldMatch(h.PostRun) {
+		return nil
+	}
+	input := postRunInput{
+		Event:         execHookPostRun,
+		Applications:  apps,
+		OutputDir:     opts.OutputDir,
+		OutputArchive: opts.OutputArchive,
+		Report:        opts.Report,
+	}
+	if input.Applications == nil {
+		input.Applications = []execHookApp{}
+	}
+	if runErr != nil {
+		input.Error = runErr.Error()
+	}
+	_, err := runExecHook(h.PostRun, execHookPostRun, input)
+	return err
+}
+
+// runExecHook runs the hook command of an event with the JSON of the input on its standard input, returning its
+// standard output
+func runExecHook(command string, event string, input interface{}) ([]byte, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("the %s hook command is empty", event)
+	}
+	data, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+	var stdout bytes.Buffer
+	cmd := exec.Command(args[0], args[1:]...) // #nosec G204 - user provided command
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("%s hook '%s' exited with status %d", event, command, exitErr.ExitCode())
+		}
+		return nil, fmt.Errorf("failed to run %s hook '%s': %w", event, command, err)
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,76 @@
+package preview
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestHook writes an executable shell script run as a hook
+func writeTestHook(t *testing.T, script string) string {
+	file := filepath.Join(t.TempDir(), "hook.sh")
+	require.NoError(t, os.WriteFile(file, []byte("#!/bin/sh\n"+script), 0o700))
+	return file
+}
+
+// TestPostRenderHook verifies that the post-render hook is given the Application and its resources, and that the
+// resources it prints replace the rendered ones
+func TestPostRenderHook(t *testing.T) {
+	app := argoappv1.Application{}
+	app.Name = "web"
+	manifests := []string{`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"web"}}`}
+	input := filepath.Join(t.TempDir(), "input.json")
+
+	// Printing nothing keeps the rendered resources
+	hooks := ExecHooks{PostRender: writeTestHook(t, "cat > "+input+"\n")}
+	kept, err := hooks.runPostRenderHook(app, manifests)
+	require.NoError(t, err)
+	require.Equal(t, manifests, kept)
+	data, err := os.ReadFile(input)
+	require.NoError(t, err)
+	var received postRenderInput
+	require.NoError(t, json.Unmarshal(data, &received))
+	require.Equal(t, execHookPostRender, received.Event)
+	require.Equal(t, "web", received.Application.Name)
+	require.Equal(t, applicationKind, received.Application.Kind)
+	require.Equal(t, "ConfigMap", received.Resources[0]["kind"])
+
+	hooks.PostRender = writeTestHook(t, "cat > /dev/null\necho 'apiVersion: v1'\necho 'kind: Secret'\n"+
+		"echo 'metadata: {name: mutated}'\n")
+	mutated, err := hooks.runPostRenderHook(app, manifests)
+	require.NoError(t, err)
+	require.Equal(t, []string{`{"apiVersion":"v1","kind":"Secret","metadata":{"name":"mutated"}}`}, mutated)
+
+	// An empty JSON array removes all the resources
+	hooks.PostRender = writeTestHook(t, "echo '[]'\n")
+	removed, err := hooks.runPostRenderHook(app, manifests)
+	require.NoError(t, err)
+	require.Empty(t, removed)
+
+	hooks.PostRender = writeTestHook(t, "exit 3\n")
+	_, err = hooks.runPostRenderHook(app, manifests)
+	require.ErrorContains(t, err, "application 'web': post-render hook '"+hooks.PostRender+"' exited with status 3")
+	_, err = runExecHook(" ", execHookPostRun, nil)
+	require.ErrorContains(t, err, "the post-run hook command is empty")
+}
+
+// TestPostRunHook verifies that the post-run hook is given the status of the Applications and the error of the run
+func TestPostRunHook(t *testing.T) {
+	input := filepath.Join(t.TempDir(), "input.json")
+	hooks := ExecHooks{PostRun: writeTestHook(t, "cat > "+input+"\n")}
+	apps := []execHookApp{{Name: "web", Status: appStatusSucceeded}, {Name: "api", Status: appStatusFailed}}
+	require.NoError(t, hooks.runPostRunHook(apps, RenderOptions{OutputDir: "out"}, os.ErrNotExist))
+	data, err := os.ReadFile(input)
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"event": "post-run",
+		"applications": [{"name": "web", "status": "succeeded"}, {"name": "api", "status": "failed"}],
+		"outputDir": "out",
+		"error": "file does not exist"
+	}`, string(data))
+	require.NoError(t, ExecHooks{}.runPostRunHook(apps, RenderOptions{}, nil))
+}
@@ -0,0 +1,253 @@
+package preview
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/yaml"
+)
+
+// Categories of checks
+const (
+	categorySchema          = "schema"
+	categoryPolicy          = "policy"
+	categoryDeprecatedAPI   = "deprecated-api"
+	categoryImage           = "image"
+	categoryProject         = "project"
+	categoryProvenance      = "provenance"
+	categoryAPIAvailability = "api-availability"
+	categoryApplication     = "application"
+)
+
+// Severities of findings, set per category
+const (
+	severityOff   = "off"
+	severityWarn  = "warn"
+	severityError = "error"
+)
+
+// checkCategories are the categories whose severity can be configured
+var checkCategories = []string{categorySchema, categoryPolicy, categoryDeprecatedAPI, categoryImage, categoryProject,
+	categoryProvenance, categoryAPIAvailability, categoryApplication}
+
+// finding is an issue reported by a check on a rendered resource
+type finding struct {
+	RuleID   string
+	Category string
+	App      string
+	Resource resourceKey
+	Message  string
+	// Advisory findings are reported as warnings at most, like the Kyverno policies in Audit mode
+	Advisory bool
+	// Severity is the severity of the category of the finding
+	Severity string
+	// Suppression is the entry of the suppression file accepting the finding, if any
+	Suppression *suppression
+}
+
+// suppressionFile lists the findings which are known and accepted
+type suppressionFile struct {
+	Suppressions []suppression `json:"suppressions"`
+}
+
+// suppression accepts the findings of a rule, on the matching Applications and resources.
+// App and Resource are glob patterns (see path.Match), matching everything when empty.
+// Resource matches the "[group/]Kind [namespace/]name" identity of the resource.
+type suppression struct {
+	Rule     string `json:"rule"`
+	App      string `json:"app,omitempty"`
+	Resource string `json:"resource,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+	// Expires is the date (YYYY-MM-DD) after which the suppression no longer applies
+	Expires string `json:"expires,omitempty"`
+
+	used bool
+}
+
+// loadSuppressions reads a suppression file, an empty path returns no suppressions
+func loadSuppressions(filename string) ([]*suppression, error) {
+	if !shouldMatch(filename) {
+		return nil, nil
+	}
+	data, err := os.ReadFile(filename) // #nosec G304 - user provided suppression file
+	if err != nil {
+		return nil, fmt.Errorf("failed to read suppression file: %w", err)
+	}
+	var file suppressionFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse suppression file %s: %w", filename, err)
+	}
+
+	suppressions := make([]*suppression, 0, len(file.Suppressions))
+	for i := range file.Suppressions {
+		s := &file.Suppressions[i]
+		if s.Rule == "" {
+			return nil, fmt.Errorf("suppression #%d of %s has no rule", i+1, filename)
+		}
+		for _, pattern := range []string{s.App, s.Resource} {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("suppression #%d of %s has an invalid pattern '%s'", i+1, filename, pattern)
+			}
+		}
+		if s.Expires != "" {
+			if _, err := time.Parse(time.DateOnly, s.Expires); err != nil {
+				return nil, fmt.Errorf("suppression #%d of %s has an invalid expiry date '%s'", i+1, filename, s.Expires)
+			}
+		}
+		suppressions = append(suppressions, s)
+	}
+	return suppressions, nil
+}
+
+// expired returns true when the suppression no longer applies at the given time
+func (s *suppression) expired(now time.Time) bool {
+	if s.Expires == "" {
+		return false
+	}
+	expires, _ := time.Parse(time.DateOnly, s.Expires)
+	return !now.Before(expires.AddDate(0, 0, 1))
+}
+
+// matches returns true when the suppression accepts the finding
+func (s *suppression) matches(f finding) bool {
+	return s.Rule == f.RuleID && globMatch(s.App, f.App) && globMatch(s.Resource, f.Resource.String())
+}
+
+// globMatch matches a value against a glob pattern, an empty pattern matching everything
+func globMatch(pattern string, value string) bool {
+	if pattern == "" {
+		return true
+	}
+	matched, _ := path.Match(pattern, value)
+	return matched
+}
+
+// applySuppressions marks the findings accepted by a suppression which has not expired
+func applySuppressions(findings []finding, suppressions []*suppression, now time.Time) {
+	for i := range findings {
+		for _, s := range suppressions {
+			if s.expired(now) || !s.matches(findings[i]) {
+				continue
+			}
+			s.used = true
+			findings[i].Suppression = s
+			break
+		}
+	}
+	for _, s := range suppressions {
+		if s.expired(now) {
+			log.Warnf("Suppression of rule '%s' expired on %s, its findings are reported again", s.Rule, s.Expires)
+		}
+	}
+}
+
+// unusedSuppressions returns the suppressions which matched no finding, they can be removed from the file
+func unusedSuppressions(suppressions []*suppression) []*suppression {
+	var unused []*suppression
+	for _, s := range suppressions {
+		if !s.used {
+			unused = append(unused, s)
+		}
+	}
+	return unused
+}
+
+// writeBaseline writes a suppression file accepting all the given findings
+func writeBaseline(w io.Writer, findings []finding) error {
+	file := suppressionFile{Suppressions: []suppression{}}
+	seen := map[suppression]bool{}
+	for _, f := range findings {
+		s := suppression{Rule: f.RuleID, App: f.App, Resource: f.Resource.String(), Reason: "baseline"}
+		if !seen[s] {
+			seen[s] = true
+			file.Suppressions = append(file.Suppressions, s)
+		}
+	}
+	sort.Slice(file.Suppressions, func(i, j int) bool {
+		a, b := file.Suppressions[i], file.Suppressions[j]
+		if a.App != b.App {
+			return a.App < b.App
+		}
+		if a.Resource != b.Resource {
+			return a.Resource < b.Resource
+		}
+		return a.Rule < b.Rule
+	})
+	data, err := yaml.Marshal(file)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// validationConfig is the configuration of the validation
+type validationConfig struct {
+	// Severities is the severity of each check category, error by default
+	Severities map[string]string `json:"severities,omitempty"`
+}
+
+// loadValidationConfig reads a validation config file, an empty path returns the default config
+func loadValidationConfig(filename string) (validationConfig, error) {
+	var config validationConfig
+	if !shouldMatch(filename) {
+		return config, nil
+	}
+	data, err := os.ReadFile(filename) // #nosec G304 - user provided config file
+	if err != nil {
+		return config, fmt.Errorf("failed to read validation config: %w", err)
+	}
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return config, fmt.Errorf("failed to parse validation config %s: %w", filename, err)
+	}
+	for category, severity := range config.Severities {
+		// An unquoted off is a YAML 1.1 boolean
+		if severity == "false" {
+			severity = severityOff
+			config.Severities[category] = severity
+		}
+		if !slices.Contains(checkCategories, category) {
+			return config, fmt.Errorf("unknown check category '%s', must be one of: %s",
+				category, strings.Join(checkCategories, "|"))
+		}
+		switch severity {
+		case severityOff, severityWarn, severityError:
+		default:
+			return config, fmt.Errorf("invalid severity '%s' of category '%s', must be one of: off|warn|error",
+				severity, category)
+		}
+	}
+	return config, nil
+}
+
+// severity returns the severity of a check category
+func (c validationConfig) severity(category string) string {
+	if severity, ok := c.Severities[category]; ok {
+		return severity
+	}
+	return severityError
+}
+
+// applySeverities sets the severity of the findings from their category, dropping the ones turned off.
+// With warnOnly, errors are downgraded to warnings, as are the errors of advisory findings.
+func applySeverities(findings []finding, config validationConfig, warnOnly bool) []finding {
+	result := findings[:0]
+	for _, f := range findings {
+		f.Severity = config.severity(f.Category)
+		if f.Severity == severityOff {
+			continue
+		}
+		if warnOnly || f.Advisory {
+			f.Severity = severityWarn
+		}
+		result = append(result, f)
+	}
+	return result
+}
@@ -0,0 +1,133 @@
+package preview
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestFinding(rule string, app string, kind string, name string) finding {
+	return finding{RuleID: rule, App: app, Resource: resourceKey{Kind: kind, Namespace: "default", Name: name}}
+}
+
+// TestApplySuppressions verifies that findings are matched by rule, app and resource patterns
+func TestApplySuppressions(t *testing.T) {
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		suppression suppression
+		suppressed  bool
+	}{
+		{"rule only", suppression{Rule: "removed-api"}, true},
+		{"other rule", suppression{Rule: "other"}, false},
+		{"app pattern", suppression{Rule: "removed-api", App: "legacy-*"}, true},
+		{"other app", suppression{Rule: "removed-api", App: "web"}, false},
+		{"resource", suppression{Rule: "removed-api", Resource: "Ingress default/web"}, true},
+		{"resource pattern", suppression{Rule: "removed-api", Resource: "Ingress default/*"}, true},
+		{"other resource", suppression{Rule: "removed-api", Resource: "Ingress default/api"}, false},
+		{"expires today", suppression{Rule: "removed-api", Expires: "2026-06-01"}, true},
+		{"expired", suppression{Rule: "removed-api", Expires: "2026-05-31"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings := []finding{newTestFinding("removed-api", "legacy-web", "Ingress", "web")}
+			s := tt.suppression
+			applySuppressions(findings, []*suppression{&s}, now)
+			require.Equal(t, tt.suppressed, findings[0].Suppression != nil)
+			require.Equal(t, !tt.suppressed, len(unusedSuppressions([]*suppression{&s})) == 1)
+		})
+	}
+}
+
+// TestBaseline verifies that a written baseline suppresses all the findings it was generated from
+func TestBaseline(t *testing.T) {
+	findings := []finding{
+		newTestFinding("removed-api", "web", "Ingress", "web"),
+		newTestFinding("removed-api", "api", "Ingress", "api"),
+		newTestFinding("removed-api", "web", "Ingress", "web"),
+	}
+	var baseline bytes.Buffer
+	require.NoError(t, writeBaseline(&baseline, findings))
+	require.Equal(t, `suppressions:
+- app: api
+  reason: baseline
+  resource: Ingress default/api
+  rule: removed-api
+- app: web
+  reason: baseline
+  resource: Ingress default/web
+  rule: removed-api
+`, baseline.String())
+
+	filename := filepath.Join(t.TempDir(), "suppressions.yaml")
+	require.NoError(t, os.WriteFile(filename, baseline.Bytes(), 0o600))
+	suppressions, err := loadSuppressions(filename)
+	require.NoError(t, err)
+	applySuppressions(findings, suppressions, time.Now())
+	for _, f := range findings {
+		require.NotNil(t, f.Suppression)
+	}
+}
+
+// TestLoadSuppressionsErrors verifies the validation of suppression files
+func TestLoadSuppressionsErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{"missing rule", "suppressions:\n- app: web\n", "has no rule"},
+		{"invalid pattern", "suppressions:\n- rule: r\n  app: '['\n", "invalid pattern"},
+		{"invalid date", "suppressions:\n- rule: r\n  expires: tomorrow\n", "invalid expiry date"},
+		{"unknown field", "suppressions:\n- rule: r\n  kind: Ingress\n", "unknown field"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "suppressions.yaml")
+			require.NoError(t, os.WriteFile(filename, []byte(tt.content), 0o600))
+			_, err := loadSuppressions(filename)
+			require.ErrorContains(t, err, tt.err)
+		})
+	}
+}
+
+// TestApplySeverities verifies that the findings get the severity of their category
+func TestApplySeverities(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "validation.yaml")
+	require.NoError(t, os.WriteFile(filename, []byte("severities:\n  image: warn\n  schema: off\n"), 0o600))
+	config, err := loadValidationConfig(filename)
+	require.NoError(t, err)
+
+	newFindings := func() []finding {
+		schemaErr := &valuesSchemaError{app: "web", violations: []valuesViolation{{Chart: "web", Path: "replicas"}}}
+		return append([]finding{
+			{RuleID: "removed-api", Category: categoryDeprecatedAPI},
+			{RuleID: "image-unpinned", Category: categoryImage},
+		}, schemaErr.findings()...)
+	}
+	findings := applySeverities(newFindings(), config, false)
+	require.Len(t, findings, 2)
+	require.Equal(t, severityError, findings[0].Severity)
+	require.Equal(t, severityWarn, findings[1].Severity)
+
+	findings = applySeverities(newFindings(), config, true)
+	require.Len(t, findings, 2)
+	require.Equal(t, severityWarn, findings[0].Severity)
+	require.Equal(t, severityWarn, findings[1].Severity)
+}
+
+// TestLoadValidationConfigErrors verifies the validation of the severities
+func TestLoadValidationConfigErrors(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "validation.yaml")
+	require.NoError(t, os.WriteFile(filename, []byte("severities:\n  images: warn\n"), 0o600))
+	_, err := loadValidationConfig(filename)
+	require.ErrorContains(t, err, "unknown check category 'images'")
+
+	require.NoError(t, os.WriteFile(filename, []byte("severities:\n  image: fatal\n"), 0o600))
+	_, err = loadValidationConfig(filename)
+	require.ErrorContains(t, err, "invalid severity 'fatal'")
+}
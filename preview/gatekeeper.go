@@ -0,0 +1,329 @@
+package preview
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/open-policy-agent/opa/v1/ast"
+	"github.com/open-policy-agent/opa/v1/rego"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// gatekeeperTarget is the only target of ConstraintTemplates evaluated
+const gatekeeperTarget = "admission.k8s.gatekeeper.sh"
+
+// gatekeeperTemplate is a compiled ConstraintTemplate
+type gatekeeperTemplate struct {
+	kind  string
+	query rego.PreparedEvalQuery
+}
+
+// gatekeeperConstraint is a Constraint, only the fields used for the evaluation are decoded
+type gatekeeperConstraint struct {
+	Kind     string            `json:"kind"`
+	Metadata metav1.ObjectMeta `json:"metadata"`
+	Spec     struct {
+		EnforcementAction string          `json:"enforcementAction,omitempty"`
+		Match             gatekeeperMatch `json:"match,omitempty"`
+		Parameters        interface{}     `json:"parameters,omitempty"`
+	} `json:"spec"`
+}
+
+type gatekeeperMatch struct {
+	Kinds              []gatekeeperKinds     `json:"kinds,omitempty"`
+	Scope              string                `json:"scope,omitempty"`
+	Namespaces         []string              `json:"namespaces,omitempty"`
+	ExcludedNamespaces []string              `json:"excludedNamespaces,omitempty"`
+	LabelSelector      *metav1.LabelSelector `json:"labelSelector,omitempty"`
+	NamespaceSelector  *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	Name               string                `json:"name,omitempty"`
+}
+
+type gatekeeperKinds struct {
+	APIGroups []string `json:"apiGroups,omitempty"`
+	Kinds     []string `json:"kinds,omitempty"`
+}
+
+// gatekeeperTemplateSpec is the spec of a ConstraintTemplate, only the fields used for the evaluation are decoded
+type gatekeeperTemplateSpec struct {
+	CRD struct {
+		Spec struct {
+			Names struct {
+				Kind string `json:"kind"`
+			} `json:"names"`
+		} `json:"spec"`
+	} `json:"crd"`
+	Targets []struct {
+		Target string   `json:"target"`
+		Rego   string   `json:"rego,omitempty"`
+		Libs   []string `json:"libs,omitempty"`
+		Code   []struct {
+			Engine string `json:"engine"`
+			Source struct {
+				Rego    string   `json:"rego,omitempty"`
+				Libs    []string `json:"libs,omitempty"`
+				Version string   `json:"version,omitempty"`
+			} `json:"source"`
+		} `json:"code,omitempty"`
+	} `json:"targets"`
+}
+
+// loadGatekeeperPolicies compiles the ConstraintTemplates, and returns them along with the Constraints,
+// among the given policy resources
+func loadGatekeeperPolicies(
+	objs []*unstructured.Unstructured,
+) (map[string]*gatekeeperTemplate, []gatekeeperConstraint, error) {
+	templates := map[string]*gatekeeperTemplate{}
+	var constraints []gatekeeperConstraint
+	for _, obj := range objs {
+		gvk := obj.GroupVersionKind()
+		data, err := json.Marshal(obj.Object)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch {
+		case gvk.Group == "templates.gatekeeper.sh" && gvk.Kind == "ConstraintTemplate":
+			var spec struct {
+				Spec gatekeeperTemplateSpec `json:"spec"`
+			}
+			if err := json.Unmarshal(data, &spec); err != nil {
+				return nil, nil, fmt.Errorf("invalid ConstraintTemplate '%s': %w", obj.GetName(), err)
+			}
+			template, err := compileGatekeeperTemplate(obj.GetName(), spec.Spec)
+			if err != nil {
+				return nil, nil, err
+			}
+			if template != nil {
+				templates[template.kind] = template
+			}
+		case gvk.Group == "constraints.gatekeeper.sh":
+			var constraint gatekeeperConstraint
+			if err := json.Unmarshal(data, &constraint); err != nil {
+				return nil, nil, fmt.Errorf("invalid %s Constraint '%s': %w", gvk.Kind, obj.GetName(), err)
+			}
+			constraints = append(constraints, constraint)
+		}
+	}
+
+	var supported []gatekeeperConstraint
+	for _, constraint := range constraints {
+		if _, ok := templates[constraint.Kind]; !ok {
+			log.Warnf("No ConstraintTemplate found for %s Constraint '%s', skipping it",
+				constraint.Kind, constraint.Metadata.Name)
+			continue
+		}
+		if constraint.Spec.Match.NamespaceSelector != nil {
+			log.Warnf("%s Constraint '%s' uses a namespaceSelector, which is not supported, skipping it",
+				constraint.Kind, constraint.Metadata.Name)
+			continue
+		}
+		supported = append(supported, constraint)
+	}
+	return templates, supported, nil
+}
+
+// compileGatekeeperTemplate compiles the Rego of the admission target of a ConstraintTemplate,
+// returns nil for a template without Rego code
+func compileGatekeeperTemplate(name string, spec gatekeeperTemplateSpec) (*gatekeeperTemplate, error) {
+	kind := spec.CRD.Spec.Names.Kind
+	for _, target := range spec.Targets {
+		if target.Target != gatekeeperTarget {
+			continue
+		}
+		source, libs, version := target.Rego, target.Libs, ast.RegoV0
+		for _, code := range target.Code {
+			if code.Engine == "Rego" {
+				source, libs = code.Source.Rego, code.Source.Libs
+				if code.Source.Version == "v1" {
+					version = ast.RegoV1
+				}
+			}
+		}
+		if source == "" {
+			break
+		}
+
+		module, err := ast.ParseModuleWithOpts(name, source, ast.ParserOptions{RegoVersion: version})
+		if err != nil {
+			return nil, fmt.Errorf("invalid Rego in ConstraintTemplate '%s': %w", name, err)
+		}
+		options := []func(*rego.Rego){
+			rego.Query(module.Package.Path.String() + ".violation"),
+			rego.Module(name+".rego", source),
+			rego.SetRegoVersion(version),
+		}
+		for i, lib := range libs {
+			options = append(options, rego.Module(fmt.Sprintf("%s-lib-%d.rego", name, i), lib))
+		}
+		query, err := rego.New(options...).PrepareForEval(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile ConstraintTemplate '%s': %w", name, err)
+		}
+		return &gatekeeperTemplate{kind: kind, query: query}, nil
+	}
+	log.Warnf("ConstraintTemplate '%s' has no Rego code for the %s target, skipping it", name, gatekeeperTarget)
+	return nil, nil
+}
+
+// newGatekeeperCheck returns a check evaluating the Gatekeeper Constraints, as the admission webhook would
+func newGatekeeperCheck(templates map[string]*gatekeeperTemplate, constraints []gatekeeperConstraint) check {
+	return func(app argoappv1.Application, resources []unstructured.Unstructured) []finding {
+		var findings []finding
+		for i := range resources {
+			resource := &resources[i]
+			namespace := resource.GetNamespace()
+			if namespace == "" && isNamespacedResource(resource) {
+				namespace = app.Spec.Destination.Namespace
+			}
+			for _, constraint := range constraints {
+				if !gatekeeperMatches(constraint.Spec.Match, resource, namespace) {
+					continue
+				}
+				messages, err := evaluateGatekeeperConstraint(templates[constraint.Kind], constraint, resource, namespace)
+				if err != nil {
+					log.Warnf("Failed to evaluate %s Constraint '%s' on %s: %v",
+						constraint.Kind, constraint.Metadata.Name, newResourceKey(resource), err)
+					continue
+				}
+				action := constraint.Spec.EnforcementAction
+				for _, message := range messages {
+					findings = append(findings, finding{
+						RuleID:   constraint.Kind + "/" + constraint.Metadata.Name,
+						Category: categoryPolicy,
+						App:      app.Name,
+						Resource: newResourceKey(resource),
+						Message:  message,
+						Advisory: action != "" && action != "deny",
+					})
+				}
+			}
+		}
+		return findings
+	}
+}
+
+// evaluateGatekeeperConstraint evaluates a Constraint on a resource, returning the violation messages
+func evaluateGatekeeperConstraint(
+	template *gatekeeperTemplate,
+	constraint gatekeeperConstraint,
+	resource *unstructured.Unstructured,
+	namespace string,
+) ([]string, error) {
+	object := resource.DeepCopy()
+	if object.GetNamespace() == "" && namespace != "" {
+		object.SetNamespace(namespace)
+	}
+	gvk := object.GroupVersionKind()
+	parameters := constraint.Spec.Parameters
+	if parameters == nil {
+		parameters = map[string]interface{}{}
+	}
+	input := map[string]interface{}{
+		"review": map[string]interface{}{
+			"kind":      map[string]interface{}{"group": gvk.Group, "version": gvk.Version, "kind": gvk.Kind},
+			"name":      object.GetName(),
+			"namespace": object.GetNamespace(),
+			"operation": "CREATE",
+			"object":    object.Object,
+		},
+		"parameters": parameters,
+	}
+
+	results, err := template.query.Eval(context.Background(), rego.EvalInput(input))
+	if err != nil {
+		return nil, err
+	}
+	var messages []string
+	for _, result := range results {
+		for _, expression := range result.Expressions {
+			violations, _ := expression.Value.([]interface{})
+			for _, v := range violations {
+				violation, _ := v.(map[string]interface{})
+				message, _ := violation["msg"].(string)
+				messages = append(messages, message)
+			}
+		}
+	}
+	return messages, nil
+}
+
+// gatekeeperMatches returns true when the match criteria of a Constraint select the resource
+func gatekeeperMatches(match gatekeeperMatch, resource *unstructured.Unstructured, namespace string) bool {
+	gvk := resource.GroupVersionKind()
+	if len(match.Kinds) > 0 {
+		matched := false
+		for _, k := range match.Kinds {
+			if gatekeeperListMatches(k.APIGroups, gvk.Group) && gatekeeperListMatches(k.Kinds, gvk.Kind) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	namespaced := isNamespacedResource(resource)
+	switch match.Scope {
+	case "Cluster":
+		if namespaced {
+			return false
+		}
+	case "Namespaced":
+		if !namespaced {
+			return false
+		}
+	}
+	// Namespaces are matched by name
+	if gvk.Group == "" && gvk.Kind == "Namespace" {
+		namespace = resource.GetName()
+	}
+	if len(match.Namespaces) > 0 && (namespace == "" || !gatekeeperNamespaceMatches(match.Namespaces, namespace)) {
+		return false
+	}
+	if namespace != "" && gatekeeperNamespaceMatches(match.ExcludedNamespaces, namespace) {
+		return false
+	}
+	if match.Name != "" && !globMatch(match.Name, resource.GetName()) {
+		return false
+	}
+	if match.LabelSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(match.LabelSelector)
+		if err != nil || !selector.Matches(labels.Set(resource.GetLabels())) {
+			return false
+		}
+	}
+	return true
+}
+
+// gatekeeperListMatches returns true when the value is in the list, or the list is empty or contains "*"
+func gatekeeperListMatches(list []string, value string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, v := range list {
+		if v == "*" || v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// gatekeeperNamespaceMatches matches a namespace against namespace names, supporting a prefix or suffix wildcard
+func gatekeeperNamespaceMatches(patterns []string, namespace string) bool {
+	for _, pattern := range patterns {
+		switch {
+		case strings.HasSuffix(pattern, "*") && strings.HasPrefix(namespace, strings.TrimSuffix(pattern, "*")),
+			strings.HasPrefix(pattern, "*") && strings.HasSuffix(namespace, strings.TrimPrefix(pattern, "*")),
+			pattern == namespace:
+			return true
+		}
+	}
+	return false
+}
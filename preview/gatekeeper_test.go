@@ -0,0 +1,93 @@
+package preview
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const testGatekeeperPolicies = `apiVersion: templates.gatekeeper.sh/v1
+kind: ConstraintTemplate
+metadata:
+  name: k8srequiredlabels
+spec:
+  crd:
+    spec:
+      names:
+        kind: K8sRequiredLabels
+  targets:
+    - target: admission.k8s.gatekeeper.sh
+      rego: |
+        package k8srequiredlabels
+
+        violation[{"msg": msg}] {
+          provided := {label | input.review.object.metadata.labels[label]}
+          required := {label | label := input.parameters.labels[_]}
+          missing := required - provided
+          count(missing) > 0
+          msg := sprintf("missing required labels: %v", [missing])
+        }
+---
+apiVersion: constraints.gatekeeper.sh/v1beta1
+kind: K8sRequiredLabels
+metadata:
+  name: must-have-team
+spec:
+  match:
+    kinds:
+      - apiGroups: ["apps"]
+        kinds: ["Deployment"]
+    excludedNamespaces: ["kube-*"]
+  parameters:
+    labels: ["team"]
+---
+apiVersion: constraints.gatekeeper.sh/v1beta1
+kind: K8sRequiredLabels
+metadata:
+  name: should-have-owner
+spec:
+  enforcementAction: warn
+  match:
+    kinds:
+      - apiGroups: [""]
+        kinds: ["Service"]
+  parameters:
+    labels: ["owner"]
+---
+apiVersion: constraints.gatekeeper.sh/v1beta1
+kind: K8sUnknown
+metadata:
+  name: no-template
+`
+
+// TestGatekeeperCheck verifies the evaluation of Gatekeeper Constraints
+func TestGatekeeperCheck(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "policies.yaml"), []byte(testGatekeeperPolicies), 0o600))
+	policyChecks, err := newPolicyChecks([]string{dir})
+	require.NoError(t, err)
+	require.Len(t, policyChecks, 1)
+
+	labeled := newTestResource("apps/v1", "Deployment", "labeled", nil)
+	labeled.SetLabels(map[string]string{"team": "web"})
+	unlabeled := newTestResource("apps/v1", "Deployment", "unlabeled", nil)
+	system := newTestResource("apps/v1", "Deployment", "system", nil)
+	system.SetNamespace("kube-system")
+	service := newTestResource("v1", "Service", "web", nil)
+
+	app := argoappv1.Application{ObjectMeta: metav1.ObjectMeta{Name: "web"}}
+	findings := runChecks(app, []unstructured.Unstructured{labeled, unlabeled, system, service}, policyChecks)
+	require.Len(t, findings, 2)
+	require.Equal(t, "Service default/web", findings[0].Resource.String())
+	require.Equal(t, "K8sRequiredLabels/should-have-owner", findings[0].RuleID)
+	require.Equal(t, `missing required labels: {"owner"}`, findings[0].Message)
+	require.True(t, findings[0].Advisory)
+	require.Equal(t, "apps/Deployment default/unlabeled", findings[1].Resource.String())
+	require.Equal(t, "K8sRequiredLabels/must-have-team", findings[1].RuleID)
+	require.False(t, findings[1].Advisory)
+}
@@ -0,0 +1,210 @@
+package preview
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// tempFilePattern matches the temporary files and directories created by the CLI outside of the cache directory
+const tempFilePattern = "argocd-offline-cli-*"
+
+// staleTempAge is the age after which a temporary file is considered left over by a crashed invocation
+const staleTempAge = 24 * time.Hour
+
+// CacheGCOptions holds the eviction settings of the cache garbage collection
+type CacheGCOptions struct {
+	// MaxAge evicts the entries not modified for longer than this duration, 0 to disable
+	MaxAge time.Duration
+	// MaxSize evicts the least recently modified entries until the cache fits in this size (e.g. 10G), empty to disable
+	MaxSize string
+}
+
+// cacheEntry is a unit of eviction of the cache: a git repository, a Helm chart or the state of a run
+type cacheEntry struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// GarbageCollectCache evicts the cache entries exceeding the maximum age, then the least recently modified ones
+// until the cache fits in the maximum size. The caches and runs in use by other invocations are left untouched.
+func GarbageCollectCache(opts CacheGCOptions) {
+	var maxSize int64 = -1
+	if shouldMatch(opts.MaxSize) {
+		quantity, err := resource.ParseQuantity(opts.MaxSize)
+		if err != nil {
+			log.Fatalf("Invalid maximum size '%s': %v", opts.MaxSize, err)
+		}
+		maxSize = quantity.Value()
+	}
+
+	entries, locks, err := collectCacheEntries(getCacheDir())
+	defer func() {
+		for _, lock := range locks {
+			_ = lock.unlock()
+		}
+	}()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var freed int64
+	for _, entry := range selectEvictions(entries, opts.MaxAge, maxSize, time.Now()) {
+		if err := os.RemoveAll(entry.path); err != nil {
+			log.Fatalf("Failed to remove %s: %v", entry.path, err)
+		}
+		fmt.Printf("Removed %s (%s)\n", entry.path, formatSize(entry.size))
+		freed += entry.size
+	}
+	removed := removeStaleTempFiles(os.TempDir(), staleTempAge)
+	fmt.Printf("Freed %s, removed %d stale temporary file(s)\n", formatSize(freed), removed)
+}
+
+// collectCacheEntries lists the entries of the cache which are not in use, along with the locks held on them
+// until they are evicted: the content of the repository caches, the run states, and anything else left in the
+// cache directory (e.g. the repositories cloned by former versions)
+func collectCacheEntries(cacheDir string) ([]cacheEntry, []*fileLock, error) {
+	var entries []cacheEntry
+	var locks []*fileLock
+	children, err := readCacheDir(cacheDir)
+	if err != nil || children == nil {
+		return nil, nil, err
+	}
+	for _, child := range children {
+		path := filepath.Join(cacheDir, child.Name())
+		switch child.Name() {
+		case "repos", "runs":
+			dirs, err := readCacheDir(path)
+			if err != nil {
+				return entries, locks, err
+			}
+			for _, dir := range dirs {
+				if !dir.IsDir() {
+					continue
+				}
+				dirPath := filepath.Join(path, dir.Name())
+				lock, acquired, err := tryLock(dirPath + ".lock")
+				if err != nil {
+					return entries, locks, err
+				}
+				if !acquired {
+					log.Infof("Skipping %s, in use by another invocation", dirPath)
+					continue
+				}
+				locks = append(locks, lock)
+				if child.Name() == "runs" {
+					entries = append(entries, newCacheEntry(dirPath))
+					continue
+				}
+				repos, err := readCacheDir(dirPath)
+				if err != nil {
+					return entries, locks, err
+				}
+				for _, repo := range repos {
+					entries = append(entries, newCacheEntry(filepath.Join(dirPath, repo.Name())))
+				}
+			}
+		default:
+			entries = append(entries, newCacheEntry(path))
+		}
+	}
+	return entries, locks, nil
+}
+
+// readCacheDir lists a directory of the cache, nil when it does not exist.
+// The repository service makes its root directory write-only, so it is made readable again first.
+func readCacheDir(dir string) ([]os.DirEntry, error) {
+	if err := os.Chmod(dir, 0o700); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to access cache directory: %w", err)
+	}
+	return os.ReadDir(dir)
+}
+
+// newCacheEntry computes the size of a cache entry, and the latest modification time of its files
+func newCacheEntry(path string) cacheEntry {
+	entry := cacheEntry{path: path}
+	_ = filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if !d.IsDir() {
+			entry.size += info.Size()
+		}
+		if info.ModTime().After(entry.modTime) {
+			entry.modTime = info.ModTime()
+		}
+		return nil
+	})
+	return entry
+}
+
+// selectEvictions returns the entries older than maxAge, then the least recently modified ones until the
+// remaining ones fit in maxSize. A maxAge of 0 and a negative maxSize disable the respective eviction.
+func selectEvictions(entries []cacheEntry, maxAge time.Duration, maxSize int64, now time.Time) []cacheEntry {
+	sorted := append([]cacheEntry{}, entries...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].modTime.Before(sorted[j].modTime)
+	})
+	var total int64
+	for _, entry := range sorted {
+		total += entry.size
+	}
+	var evicted []cacheEntry
+	for _, entry := range sorted {
+		expired := maxAge > 0 && now.Sub(entry.modTime) > maxAge
+		if !expired && (maxSize < 0 || total <= maxSize) {
+			continue
+		}
+		evicted = append(evicted, entry)
+		total -= entry.size
+	}
+	return evicted
+}
+
+// removeStaleTempFiles removes the temporary files and directories left over by crashed invocations,
+// returning how many were removed
+func removeStaleTempFiles(tempDir string, olderThan time.Duration) int {
+	matches, _ := filepath.Glob(filepath.Join(tempDir, tempFilePattern))
+	removed := 0
+	for _, match := range matches {
+		info, err := os.Lstat(match)
+		if err != nil || time.Since(info.ModTime()) < olderThan {
+			continue
+		}
+		if err := os.RemoveAll(match); err != nil {
+			log.Warnf("Failed to remove stale temporary file %s: %v", match, err)
+			continue
+		}
+		log.Debugf("Removed stale temporary file %s", match)
+		removed++
+	}
+	return removed
+}
+
+// formatSize formats a size in bytes with a binary unit, e.g. 1.5MiB
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+	value, exp := float64(size)/unit, 0
+	for value >= unit && exp < 4 {
+		value /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", value, "KMGTP"[exp])
+}
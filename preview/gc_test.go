@@ -0,0 +1,106 @@
+package preview
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestSelectEvictions verifies the eviction by age, then by size of the least recently modified entries
+func TestSelectEvictions(t *testing.T) {
+	now := time.Now()
+	entries := []cacheEntry{
+		{path: "recent", size: 10, modTime: now.Add(-time.Hour)},
+		{path: "old", size: 10, modTime: now.Add(-30 * 24 * time.Hour)},
+		{path: "older", size: 10, modTime: now.Add(-2 * time.Hour)},
+	}
+	paths := func(evicted []cacheEntry) []string {
+		var result []string
+		for _, entry := range evicted {
+			result = append(result, entry.path)
+		}
+		return result
+	}
+
+	tests := []struct {
+		name     string
+		maxAge   time.Duration
+		maxSize  int64
+		expected []string
+	}{
+		{name: "disabled", maxAge: 0, maxSize: -1, expected: nil},
+		{name: "by age", maxAge: 7 * 24 * time.Hour, maxSize: -1, expected: []string{"old"}},
+		{name: "by size", maxAge: 0, maxSize: 15, expected: []string{"old", "older"}},
+		{name: "by age then size", maxAge: 7 * 24 * time.Hour, maxSize: 20, expected: []string{"old"}},
+		{name: "fits", maxAge: 0, maxSize: 30, expected: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, paths(selectEvictions(entries, tt.maxAge, tt.maxSize, now)))
+		})
+	}
+}
+
+// TestCollectCacheEntries verifies that the caches and runs in use by other invocations are skipped
+func TestCollectCacheEntries(t *testing.T) {
+	cacheDir := t.TempDir()
+	for _, dir := range []string{"repos/0/repo-a", "repos/0/chart-b", "repos/1/repo-c", "runs/nightly", "legacy"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(cacheDir, dir), 0o700))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(cacheDir, "repos/0/repo-a/file"), []byte("12345"), 0o600))
+	// The repository service makes its root directory write-only
+	require.NoError(t, os.Chmod(filepath.Join(cacheDir, "repos/0"), 0o300))
+
+	inUse, acquired, err := tryLock(filepath.Join(cacheDir, "repos/1.lock"))
+	require.NoError(t, err)
+	require.True(t, acquired)
+	defer func() { _ = inUse.unlock() }()
+
+	entries, locks, err := collectCacheEntries(cacheDir)
+	require.NoError(t, err)
+	require.Len(t, locks, 2)
+	sizes := map[string]int64{}
+	for _, entry := range entries {
+		rel, err := filepath.Rel(cacheDir, entry.path)
+		require.NoError(t, err)
+		sizes[rel] = entry.size
+	}
+	require.Equal(t, map[string]int64{"legacy": 0, "repos/0/chart-b": 0, "repos/0/repo-a": 5, "runs/nightly": 0}, sizes)
+
+	// A cache being collected is not used by other invocations
+	_, acquired, err = tryLock(filepath.Join(cacheDir, "repos/0.lock"))
+	require.NoError(t, err)
+	require.False(t, acquired)
+	for _, lock := range locks {
+		require.NoError(t, lock.unlock())
+	}
+}
+
+// TestRemoveStaleTempFiles verifies that only the temporary files of the CLI older than the threshold are removed
+func TestRemoveStaleTempFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	stale := filepath.Join(tempDir, "argocd-offline-cli-index-123")
+	recent := filepath.Join(tempDir, "argocd-offline-cli-head-456.yaml")
+	other := filepath.Join(tempDir, "other-file")
+	for _, file := range []string{stale, recent, other} {
+		require.NoError(t, os.WriteFile(file, nil, 0o600))
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	require.NoError(t, os.Chtimes(stale, old, old))
+	require.NoError(t, os.Chtimes(other, old, old))
+
+	require.Equal(t, 1, removeStaleTempFiles(tempDir, staleTempAge))
+	require.NoFileExists(t, stale)
+	require.FileExists(t, recent)
+	require.FileExists(t, other)
+}
+
+// TestFormatSize verifies the formatting of sizes
+func TestFormatSize(t *testing.T) {
+	require.Equal(t, "512B", formatSize(512))
+	require.Equal(t, "1.5KiB", formatSize(1536))
+	require.Equal(t, "2.0GiB", formatSize(2<<30))
+}
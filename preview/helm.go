@@ -28,6 +28,9 @@ func FindRepoPassword(repoURL string) string {
 	if present && strings.TrimSpace(v) != "" {
 		return v
 	}
+	if _, password, ok := currentArgoCDExport.findRepoCredentials(repoURL); ok {
+		return password
+	}
 	return findHelmRepo(repoURL).Password
 }
 
@@ -36,6 +39,9 @@ func FindRepoUsername(repoURL string) string {
 	if present && strings.TrimSpace(v) != "" {
 		return v
 	}
+	if username, _, ok := currentArgoCDExport.findRepoCredentials(repoURL); ok {
+		return username
+	}
 	return findHelmRepo(repoURL).Username
 }
 
@@ -0,0 +1,391 @@
+package preview
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/argoproj/argo-cd/v3/reposerver/repository"
+	log "github.com/sirupsen/logrus"
+)
+
+// HookOptions holds the settings of the pre-commit hook
+type HookOptions struct {
+	// Timeout is the time budget of the hook, the preview is skipped when exceeded
+	Timeout time.Duration
+	// Summary prints a one-line summary of the changes of each Application instead of the diff
+	Summary bool
+	// Owners is the CODEOWNERS-style file attributing the changes to teams, by path or by label
+	Owners string
+	// Porcelain prints a line per Application as it completes, for tools wrapping the hook, instead of the diff
+	Porcelain bool
+	// OnlyChanged leaves out the Applications without changes from the output
+	OnlyChanged bool
+	// DiffExec is the external command the old and new YAML of each changed resource are diffed with
+	DiffExec string
+	// StructuralDiff prints the changed YAML paths of each modified resource with their old and new values,
+	// instead of the changed lines
+	StructuralDiff bool
+}
+
+// errBudgetExceeded is returned when the preview of the hook exceeds its time budget
+var errBudgetExceeded = errors.New("time budget exceeded")
+
+// hookApp is an Application affected by the working tree changes, as defined at HEAD and in the working tree
+type hookApp struct {
+	name string
+	// file is the manifest defining the Application
+	file string
+	old  *argoappv1.Application
+	new  *argoappv1.Application
+}
+
+// RunHook previews how the working tree changes affect the Applications defined in the given manifests
+// (files or directories), rendering only the Applications whose manifest or local sources changed since HEAD.
+func RunHook(paths []string, opts HookOptions) {
+	ctx := context.Background()
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	output, err := exec.CommandContext(ctx, "git", "rev-parse", "--show-toplevel").Output()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		log.Warnf("Time budget of %s exceeded, skipping the preview", opts.Timeout)
+		return
+	}
+	if err != nil {
+		log.Fatal("the hook must run from within a git repository")
+	}
+	repoRoot := strings.TrimSpace(string(output))
+
+	changed, err := changedFiles(repoRoot)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(changed) == 0 {
+		return
+	}
+
+	ownerRules, err := loadOwners(opts.Owners)
+	if err != nil {
+		log.Fatal(err)
+	}
+	manifestFiles, err := expandManifestPaths(paths)
+	if err != nil {
+		log.Fatal(err)
+	}
+	apps, err := findHookApps(repoRoot, manifestFiles, changed)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(apps) == 0 {
+		if !opts.Porcelain {
+			fmt.Println("No Application affected by the changes")
+		}
+		return
+	}
+
+	commit, cleanup, err := createWorktreeCommit(repoRoot)
+	if err != nil {
+		log.Fatal("failed to snapshot the working tree: ", err)
+	}
+	defer cleanup()
+
+	repoService, err := newRepoService()
+	if err != nil {
+		log.Fatal(err)
+	}
+	owners := ownership{}
+	summary := startRunSummary(len(apps))
+	for _, app := range apps {
+		start := time.Now()
+		diffs, err := withinBudget(ctx, func() ([]resourceDiff, error) {
+			return diffHookApp(repoService, app, commit)
+		})
+		if errors.Is(err, errBudgetExceeded) {
+			log.Warnf("Time budget of %s exceeded, skipping the preview", opts.Timeout)
+			summary.finish()
+			return
+		}
+		if opts.Porcelain {
+			printPorcelainLine(os.Stdout, app.name, start, diffs, err, opts.OnlyChanged)
+		}
+		if err != nil {
+			summary.record(appStatusFailed, err)
+			log.Fatal(err)
+		}
+		summary.record(appStatusSucceeded, nil)
+		if opts.Porcelain {
+			continue
+		}
+		if len(diffs) == 0 {
+			if !opts.OnlyChanged {
+				fmt.Printf("application/%s: no changes\n", app.name)
+			}
+			continue
+		}
+		if err := printAppDiffs(os.Stdout, app.name, diffs, opts.Summary, opts.DiffExec,
+			opts.StructuralDiff); err != nil {
+			log.Fatal(err)
+		}
+		if app.new != nil {
+			warnImmutableChanges(*app.new, diffs)
+		}
+		if ownerRules != nil {
+			owners.attribute(ownerRules, app.name, hookAppPaths(repoRoot, app), diffs)
+		}
+	}
+	if !opts.Porcelain {
+		owners.print(os.Stdout)
+	}
+	summary.finish()
+}
+
+// withinBudget returns the result of fn, or errBudgetExceeded once the context is done. As the repository service
+// does not stop the commands it runs when cancelled, fn is left running until the process exits.
+func withinBudget[T any](ctx context.Context, fn func() (T, error)) (T, error) {
+	type result struct {
+		value T
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		value, err := fn()
+		done <- result{value: value, err: err}
+	}()
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-ctx.Done():
+		var zero T
+		return zero, fmt.Errorf("%w: %w", errBudgetExceeded, ctx.Err())
+	}
+}
+
+// hookAppPaths returns the paths of the manifest and local sources of an Application, relative to the repository root
+func hookAppPaths(repoRoot string, app hookApp) []string {
+	var paths []string
+	files := []string{app.file}
+	for _, a := range []*argoappv1.Application{app.old, app.new} {
+		if a != nil {
+			files = append(files, localSourcePaths(*a, repoRoot)...)
+		}
+	}
+	for _, file := range files {
+		if rel, err := filepath.Rel(repoRoot, file); err == nil {
+			paths = append(paths, filepath.ToSlash(rel))
+		}
+	}
+	return paths
+}
+
+// diffHookApp renders an Application at HEAD and from the working tree commit, and diffs the results
+func diffHookApp(repoService *repository.Service, app hookApp, commit string) ([]resourceDiff, error) {
+	render := func(a *argoappv1.Application, revision string) ([]string, error) {
+		if a == nil {
+			return nil, nil
+		}
+		localRevisionOverride = revision
+		defer func() { localRevisionOverride = "" }()
+		rendered, err := generateAppManifests(repoService, *a)
+		return allManifests(rendered), err
+	}
+
+	oldManifests, err := render(app.old, "")
+	if err != nil {
+		return nil, fmt.Errorf("at HEAD: %w", err)
+	}
+	newManifests, err := render(app.new, commit)
+	if err != nil {
+		return nil, fmt.Errorf("in the working tree: %w", err)
+	}
+	oldParsed, err := parseManifests(oldManifests)
+	if err != nil {
+		return nil, err
+	}
+	newParsed, err := parseManifests(newManifests)
+	if err != nil {
+		return nil, err
+	}
+	return diffResources(oldParsed, newParsed), nil
+}
+
+// expandManifestPaths returns the given manifest files, along with the YAML and JSON files found in the given directories
+func expandManifestPaths(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if d.Name() == ".git" {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if p == path || isManifestFile(p) {
+				abs, err := filepath.Abs(p)
+				if err != nil {
+					return err
+				}
+				files = append(files, abs)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// isManifestFile returns true for the files which may contain Kubernetes manifests
+func isManifestFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+// findHookApps returns the Applications affected by the changed files:
+// the ones defined in a changed manifest, or rendered from a changed path of the local repository
+func findHookApps(repoRoot string, manifestFiles []string, changed []string) ([]hookApp, error) {
+	changedSet := map[string]bool{}
+	for _, file := range changed {
+		changedSet[file] = true
+	}
+
+	var apps []hookApp
+	for _, file := range manifestFiles {
+		var newApps []argoappv1.Application
+		if _, err := os.Stat(file); err == nil {
+			newApps = loadApplications(file)
+		}
+		oldApps, err := loadApplicationsAtHead(repoRoot, file)
+		if err != nil {
+			return nil, err
+		}
+
+		byName := map[string]*hookApp{}
+		var names []string
+		add := func(app argoappv1.Application, isNew bool) {
+			name := app.QualifiedName()
+			entry, ok := byName[name]
+			if !ok {
+				entry = &hookApp{name: name, file: file}
+				byName[name] = entry
+				names = append(names, name)
+			}
+			if isNew {
+				entry.new = &app
+			} else {
+				entry.old = &app
+			}
+		}
+		for _, app := range oldApps {
+			add(app, false)
+		}
+		for _, app := range newApps {
+			add(app, true)
+		}
+
+		for _, name := range names {
+			app := byName[name]
+			if changedSet[file] || touchesLocalSources(app, repoRoot, changed) {
+				apps = append(apps, *app)
+			}
+		}
+	}
+	return apps, nil
+}
+
+// loadApplicationsAtHead loads the Applications of a manifest file as committed at HEAD, if it exists there
+func loadApplicationsAtHead(repoRoot string, file string) ([]argoappv1.Application, error) {
+	rel, err := filepath.Rel(repoRoot, file)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return nil, nil
+	}
+	content, err := runGit(repoRoot, nil, "show", "HEAD:"+filepath.ToSlash(rel))
+	if err != nil {
+		// Not committed yet
+		return nil, nil
+	}
+
+	tmp, err := os.CreateTemp("", "argocd-offline-cli-head-*"+filepath.Ext(file))
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(content); err != nil {
+		_ = tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	return loadApplications(tmp.Name()), nil
+}
+
+// touchesLocalSources returns true when a changed file is part of the local sources of the Application
+func touchesLocalSources(app *hookApp, repoRoot string, changed []string) bool {
+	var paths []string
+	for _, a := range []*argoappv1.Application{app.old, app.new} {
+		if a != nil {
+			paths = append(paths, localSourcePaths(*a, repoRoot)...)
+		}
+	}
+	for _, file := range changed {
+		for _, path := range paths {
+			if file == path || strings.HasPrefix(file, path+string(filepath.Separator)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// localSourcePaths returns the paths of the local repository an Application is rendered from:
+// the path of each Git source, and the Helm value files referenced from other sources
+func localSourcePaths(app argoappv1.Application, repoRoot string) []string {
+	sources := app.Spec.GetSources()
+	localRefs := map[string]bool{}
+	var paths []string
+	for _, source := range sources {
+		if source.Chart != "" {
+			continue
+		}
+		isLocal, localPath, _ := isLocalRepository(source.RepoURL)
+		if !isLocal || localPath != repoRoot {
+			continue
+		}
+		if source.Ref != "" {
+			localRefs["$"+source.Ref] = true
+		}
+		if source.Ref == "" || source.Path != "" {
+			paths = append(paths, filepath.Join(repoRoot, source.Path))
+		}
+	}
+
+	for _, source := range sources {
+		if source.Helm == nil {
+			continue
+		}
+		for _, valueFile := range source.Helm.ValueFiles {
+			ref, rest, found := strings.Cut(valueFile, "/")
+			if found && localRefs[ref] {
+				paths = append(paths, filepath.Join(repoRoot, rest))
+			}
+		}
+	}
+	return paths
+}
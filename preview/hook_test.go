@@ -0,0 +1,31 @@
+package preview
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestWithinBudget verifies that the result is returned within the budget, and errBudgetExceeded once exceeded
+func TestWithinBudget(t *testing.T) {
+	value, err := withinBudget(context.Background(), func() (string, error) { return "done", nil })
+	require.NoError(t, err)
+	require.Equal(t, "done", value)
+
+	_, err = withinBudget(context.Background(), func() (string, error) { return "", errors.New("failed") })
+	require.EqualError(t, err, "failed")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	release := make(chan struct{})
+	defer close(release)
+	_, err = withinBudget(ctx, func() (string, error) {
+		<-release
+		return "late", nil
+	})
+	require.ErrorIs(t, err, errBudgetExceeded)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -0,0 +1,355 @@
+package preview
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	log "github.com/sirupsen/logrus"
+)
+
+// Files written for each hydrated Application
+const (
+	hydratedManifestFile = "manifest.yaml"
+	hydratedMetadataFile = "hydrator.metadata"
+)
+
+// HydrateOptions holds the settings of the hydrate command
+type HydrateOptions struct {
+	// Branch is the branch the rendered manifests are committed to
+	Branch string
+	// Repo is the path of the local git repository holding the branch, the current repository by default
+	Repo string
+}
+
+// hydratedApp is the rendered output of an Application, as written to the target branch
+type hydratedApp struct {
+	name     string
+	path     string
+	manifest []byte
+	metadata []byte
+	sources  []hydratedSource
+}
+
+// hydratedSource records the source, and resolved revision, an Application was rendered from
+type hydratedSource struct {
+	RepoURL        string `json:"repoURL"`
+	Path           string `json:"path,omitempty"`
+	Chart          string `json:"chart,omitempty"`
+	TargetRevision string `json:"targetRevision,omitempty"`
+	Revision       string `json:"revision"`
+}
+
+// hydratedMetadata is the content of the metadata file written next to the manifests of an Application
+type hydratedMetadata struct {
+	Application string           `json:"application"`
+	Sources     []hydratedSource `json:"sources"`
+}
+
+// Hydrate renders the Applications defined in the given manifests (files or directories), and commits
+// their manifests to a branch, following the rendered-manifests pattern:
+// - each Application is written to <path>/manifest.yaml, along with a <path>/hydrator.metadata file recording
+// the source revisions, where path is spec.sourceHydrator.syncSource.path when set, or the Application name
+// - the commit message lists the Applications whose manifests changed, and the revisions of their sources
+// - the directories of the Applications hydrated earlier and not anymore are removed
+// - no commit is created when no manifest changed
+// The branch is updated directly in the repository, without touching its working tree.
+func Hydrate(paths []string, opts HydrateOptions) {
+	repoPath := opts.Repo
+	if !shouldMatch(repoPath) {
+		root, err := runGit(".", nil, "rev-parse", "--show-toplevel")
+		if err != nil {
+			log.Fatal("the target repository must be given with --repo when not run from a git repository")
+		}
+		repoPath = root
+	}
+	if err := checkBranchNotCheckedOut(repoPath, opts.Branch); err != nil {
+		log.Fatal(err)
+	}
+
+	manifestFiles, err := expandManifestPaths(paths)
+	if err != nil {
+		log.Fatal(err)
+	}
+	repoService, err := newRepoService()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var hydrated []hydratedApp
+	for _, file := range manifestFiles {
+		for _, app := range loadApplications(file) {
+			rendered, err := generateAppManifests(repoService, drySourceApplication(app))
+			if err != nil {
+				log.Fatal(err)
+			}
+			h, err := newHydratedApp(app, rendered)
+			if err != nil {
+				log.Fatal(err)
+			}
+			hydrated = append(hydrated, h)
+		}
+	}
+
+	commit, err := commitHydratedApps(repoPath, opts.Branch, hydrated)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if commit == "" {
+		fmt.Printf("No manifest changed, branch '%s' left untouched\n", opts.Branch)
+		return
+	}
+	fmt.Printf("Committed %s to branch '%s'\n", commit, opts.Branch)
+}
+
+// drySourceApplication returns the Application to render: for an Application using the source hydrator,
+// the dry source is rendered instead of the sync source
+func drySourceApplication(app argoappv1.Application) argoappv1.Application {
+	if app.Spec.SourceHydrator == nil {
+		return app
+	}
+	dry := app.Spec.SourceHydrator.DrySource
+	result := *app.DeepCopy()
+	result.Spec.SourceHydrator = nil
+	result.Spec.Sources = nil
+	result.Spec.Source = &argoappv1.ApplicationSource{
+		RepoURL:        dry.RepoURL,
+		Path:           dry.Path,
+		TargetRevision: dry.TargetRevision,
+		Helm:           dry.Helm,
+		Kustomize:      dry.Kustomize,
+		Directory:      dry.Directory,
+		Plugin:         dry.Plugin,
+	}
+	return result
+}
+
+// newHydratedApp builds the files written for a rendered Application
+func newHydratedApp(app argoappv1.Application, rendered []renderedSource) (hydratedApp, error) {
+	dir := app.Name
+	if app.Spec.SourceHydrator != nil && app.Spec.SourceHydrator.SyncSource.Path != "" {
+		dir = path.Clean(strings.Trim(app.Spec.SourceHydrator.SyncSource.Path, "/"))
+	}
+	if dir == "." || strings.HasPrefix(dir, "..") {
+		return hydratedApp{}, fmt.Errorf("invalid hydration path '%s' for Application '%s'", dir, app.Name)
+	}
+
+	resources, err := parseManifests(allManifests(rendered))
+	if err != nil {
+		return hydratedApp{}, err
+	}
+	manifest, err := manifestStream(resources)
+	if err != nil {
+		return hydratedApp{}, err
+	}
+
+	sources := make([]hydratedSource, 0, len(rendered))
+	for _, r := range rendered {
+		sources = append(sources, hydratedSource{
+			RepoURL:        r.Source.RepoURL,
+			Path:           r.Source.Path,
+			Chart:          r.Source.Chart,
+			TargetRevision: r.Source.TargetRevision,
+			Revision:       r.Revision,
+		})
+	}
+	metadata, err := json.MarshalIndent(hydratedMetadata{Application: app.Name, Sources: sources}, "", "  ")
+	if err != nil {
+		return hydratedApp{}, err
+	}
+
+	return hydratedApp{
+		name:     app.Name,
+		path:     dir,
+		manifest: []byte(manifest),
+		metadata: append(metadata, '\n'),
+		sources:  sources,
+	}, nil
+}
+
+// checkBranchNotCheckedOut fails when the branch is checked out in a worktree of the repository,
+// since updating it would leave that worktree out of sync
+func checkBranchNotCheckedOut(repoPath string, branch string) error {
+	worktrees, err := runGit(repoPath, nil, "worktree", "list", "--porcelain")
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(worktrees, "\n") {
+		if line == "branch refs/heads/"+branch {
+			return fmt.Errorf("branch '%s' is checked out, hydrate into a branch which is not checked out", branch)
+		}
+	}
+	return nil
+}
+
+// commitHydratedApps commits the files of the hydrated Applications on top of the branch, creating the branch when
+// it does not exist yet, and removing the directories of the Applications which are not hydrated anymore.
+// Returns an empty commit when no manifest changed and no Application was removed.
+func commitHydratedApps(repoPath string, branch string, apps []hydratedApp) (string, error) {
+	ref := "refs/heads/" + branch
+	parent, _ := runGit(repoPath, nil, "rev-parse", "--verify", "-q", ref)
+
+	index, err := os.CreateTemp("", "argocd-offline-cli-index-")
+	if err != nil {
+		return "", err
+	}
+	indexPath := index.Name()
+	_ = index.Close()
+	defer os.Remove(indexPath)
+	env := []string{"GIT_INDEX_FILE=" + indexPath}
+
+	if parent != "" {
+		_, err = runGit(repoPath, env, "read-tree", parent)
+	} else {
+		_, err = runGit(repoPath, env, "read-tree", "--empty")
+	}
+	if err != nil {
+		return "", err
+	}
+
+	removed, err := pruneHydratedApps(repoPath, env, parent, apps)
+	if err != nil {
+		return "", err
+	}
+	var changed []hydratedApp
+	for _, app := range apps {
+		manifestPath := path.Join(app.path, hydratedManifestFile)
+		if _, err := runGit(repoPath, env, "rm", "-r", "--cached", "-q", "--ignore-unmatch", "--", app.path); err != nil {
+			return "", err
+		}
+		manifestBlob, err := addIndexFile(repoPath, env, manifestPath, app.manifest)
+		if err != nil {
+			return "", err
+		}
+		if _, err := addIndexFile(repoPath, env, path.Join(app.path, hydratedMetadataFile), app.metadata); err != nil {
+			return "", err
+		}
+
+		previous := ""
+		if parent != "" {
+			previous, _ = runGit(repoPath, nil, "rev-parse", "-q", "--verify", parent+":"+manifestPath)
+		}
+		if previous != manifestBlob {
+			changed = append(changed, app)
+		}
+	}
+	if len(changed) == 0 && len(removed) == 0 {
+		return "", nil
+	}
+
+	tree, err := runGit(repoPath, env, "write-tree")
+	if err != nil {
+		return "", err
+	}
+	args := []string{"commit-tree", tree, "-m", hydrateCommitMessage(changed, removed)}
+	if parent != "" {
+		args = append(args, "-p", parent)
+	}
+	commit, err := runGit(repoPath, commitEnv, args...)
+	if err != nil {
+		return "", err
+	}
+
+	// Only move the branch if nobody else did in the meantime
+	oldValue := parent
+	if oldValue == "" {
+		oldValue = strings.Repeat("0", len(commit))
+	}
+	if _, err := runGit(repoPath, nil, "update-ref", ref, commit, oldValue); err != nil {
+		return "", err
+	}
+	return commit, nil
+}
+
+// pruneHydratedApps removes from the index the directories of the Applications hydrated in the parent commit, found
+// by their metadata file, which are not among the hydrated Applications anymore. Returns the removed Applications.
+func pruneHydratedApps(repoPath string, env []string, parent string, apps []hydratedApp) ([]hydratedApp, error) {
+	if parent == "" {
+		return nil, nil
+	}
+	files, err := runGit(repoPath, env, "ls-files")
+	if err != nil {
+		return nil, err
+	}
+	current := map[string]bool{}
+	for _, app := range apps {
+		current[app.path] = true
+	}
+	var removed []hydratedApp
+	for _, file := range strings.Split(files, "\n") {
+		dir := path.Dir(file)
+		if path.Base(file) != hydratedMetadataFile || dir == "." || current[dir] {
+			continue
+		}
+		app := hydratedApp{name: dir, path: dir}
+		var metadata hydratedMetadata
+		if content, err := runGit(repoPath, nil, "cat-file", "blob", parent+":"+file); err == nil &&
+			json.Unmarshal([]byte(content), &metadata) == nil && metadata.Application != "" {
+			app.name = metadata.Application
+		}
+		if _, err := runGit(repoPath, env, "rm", "-r", "--cached", "-q", "--", dir); err != nil {
+			return nil, err
+		}
+		removed = append(removed, app)
+	}
+	return removed, nil
+}
+
+// addIndexFile stores the content as a blob and adds it to the index at the given path, returning the blob
+func addIndexFile(repoPath string, env []string, filePath string, content []byte) (string, error) {
+	blob, err := runGitWithInput(repoPath, nil, content, "hash-object", "-w", "--stdin")
+	if err != nil {
+		return "", err
+	}
+	if _, err := runGit(repoPath, env, "update-index", "--add", "--cacheinfo", "100644,"+blob+","+filePath); err != nil {
+		return "", err
+	}
+	return blob, nil
+}
+
+// hydrateCommitMessage generates the message of a hydration commit
+func hydrateCommitMessage(changed []hydratedApp, removed []hydratedApp) string {
+	var b strings.Builder
+	switch {
+	case len(changed) == 1 && len(removed) == 0:
+		fmt.Fprintf(&b, "Hydrate %s\n\n", changed[0].name)
+	case len(changed) == 0 && len(removed) == 1:
+		fmt.Fprintf(&b, "Remove %s\n\n", removed[0].name)
+	default:
+		fmt.Fprintf(&b, "Hydrate %d Applications\n\n", len(changed)+len(removed))
+	}
+
+	if len(changed) > 0 {
+		b.WriteString("Applications changed:\n")
+		for _, app := range changed {
+			fmt.Fprintf(&b, "- %s (%s)\n", app.name, app.path)
+		}
+	}
+	if len(removed) > 0 {
+		if len(changed) > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString("Applications removed:\n")
+		for _, app := range removed {
+			fmt.Fprintf(&b, "- %s (%s)\n", app.name, app.path)
+		}
+	}
+	if len(changed) == 0 {
+		return b.String()
+	}
+
+	b.WriteString("\nSources:\n")
+	for _, app := range changed {
+		for _, source := range app.sources {
+			location := source.Path
+			if source.Chart != "" {
+				location = source.Chart
+			}
+			fmt.Fprintf(&b, "- %s: %s %s@%s\n", app.name, source.RepoURL, location, source.Revision)
+		}
+	}
+	return b.String()
+}
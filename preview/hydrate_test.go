@@ -0,0 +1,125 @@
+package preview
+
+import (
+	"testing"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TestNewHydratedApp verifies the layout and content of the files written for an Application
+func TestNewHydratedApp(t *testing.T) {
+	app := argoappv1.Application{
+		ObjectMeta: metav1.ObjectMeta{Name: "web"},
+		Spec: argoappv1.ApplicationSpec{
+			SourceHydrator: &argoappv1.SourceHydrator{
+				DrySource:  argoappv1.DrySource{RepoURL: "https://github.com/example/repo.git", Path: "apps/web"},
+				SyncSource: argoappv1.SyncSource{TargetBranch: "env/prod", Path: "/prod/web/"},
+			},
+		},
+	}
+	rendered := []renderedSource{{
+		Source:   argoappv1.ApplicationSource{RepoURL: "https://github.com/example/repo.git", Path: "apps/web"},
+		Revision: "0123456789abcdef",
+		Manifests: []string{
+			`{"apiVersion":"v1","kind":"Service","metadata":{"name":"web"}}`,
+			`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"web"}}`,
+		},
+	}}
+
+	h, err := newHydratedApp(app, rendered)
+	require.NoError(t, err)
+	require.Equal(t, "prod/web", h.path)
+	require.Equal(t, `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+`, string(h.manifest))
+	require.Contains(t, string(h.metadata), `"revision": "0123456789abcdef"`)
+
+	// The dry source is the one rendered
+	dry := drySourceApplication(app)
+	require.Nil(t, dry.Spec.SourceHydrator)
+	require.Equal(t, "apps/web", dry.Spec.GetSource().Path)
+}
+
+// TestCommitHydratedApps verifies that the branch is created, then only updated when a manifest changes
+func TestCommitHydratedApps(t *testing.T) {
+	dir := initTestRepo(t)
+	app := hydratedApp{
+		name:     "web",
+		path:     "web",
+		manifest: []byte("kind: ConfigMap\n"),
+		metadata: []byte("{}\n"),
+		sources:  []hydratedSource{{RepoURL: "https://github.com/example/repo.git", Path: "apps/web", Revision: "abc"}},
+	}
+
+	commit, err := commitHydratedApps(dir, "rendered", []hydratedApp{app})
+	require.NoError(t, err)
+	require.NotEmpty(t, commit)
+	content, err := runGit(dir, nil, "show", "rendered:web/manifest.yaml")
+	require.NoError(t, err)
+	require.Equal(t, "kind: ConfigMap", content)
+	message, err := runGit(dir, nil, "log", "-1", "--format=%B", "rendered")
+	require.NoError(t, err)
+	require.Contains(t, message, "Hydrate web")
+	require.Contains(t, message, "- web: https://github.com/example/repo.git apps/web@abc")
+	author, err := runGit(dir, nil, "log", "-1", "--format=%an <%ae>", "rendered")
+	require.NoError(t, err)
+	require.Equal(t, "argocd-offline-cli <argocd-offline-cli@localhost>", author)
+
+	// Only the metadata changed: nothing is committed
+	app.metadata = []byte(`{"revision":"def"}` + "\n")
+	commit, err = commitHydratedApps(dir, "rendered", []hydratedApp{app})
+	require.NoError(t, err)
+	require.Empty(t, commit)
+
+	app.manifest = []byte("kind: Secret\n")
+	commit, err = commitHydratedApps(dir, "rendered", []hydratedApp{app})
+	require.NoError(t, err)
+	parent, err := runGit(dir, nil, "rev-parse", commit+"^")
+	require.NoError(t, err)
+	require.NotEmpty(t, parent)
+
+	// The working tree of the repository is left untouched
+	status, err := runGit(dir, nil, "status", "--porcelain")
+	require.NoError(t, err)
+	require.Empty(t, status)
+}
+
+// TestCommitHydratedAppsPrunesRemovedApps verifies that the directories of the Applications not hydrated anymore are
+// removed, the other files of the branch being kept
+func TestCommitHydratedAppsPrunesRemovedApps(t *testing.T) {
+	dir := initTestRepo(t)
+	web := hydratedApp{name: "web", path: "web", manifest: []byte("kind: ConfigMap\n"), metadata: []byte("{}\n")}
+	api := hydratedApp{
+		name:     "api",
+		path:     "prod/api",
+		manifest: []byte("kind: Service\n"),
+		metadata: []byte(`{"application": "api"}` + "\n"),
+	}
+	_, err := commitHydratedApps(dir, "rendered", []hydratedApp{web, api})
+	require.NoError(t, err)
+
+	commit, err := commitHydratedApps(dir, "rendered", []hydratedApp{web})
+	require.NoError(t, err)
+	require.NotEmpty(t, commit)
+	files, err := runGit(dir, nil, "ls-tree", "-r", "--name-only", "rendered")
+	require.NoError(t, err)
+	require.Equal(t, "web/hydrator.metadata\nweb/manifest.yaml", files)
+	message, err := runGit(dir, nil, "log", "-1", "--format=%B", "rendered")
+	require.NoError(t, err)
+	require.Equal(t, "Remove api\n\nApplications removed:\n- api (prod/api)", message)
+
+	// Nothing left to remove
+	commit, err = commitHydratedApps(dir, "rendered", []hydratedApp{web})
+	require.NoError(t, err)
+	require.Empty(t, commit)
+}
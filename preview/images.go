@@ -0,0 +1,93 @@
+package preview
+
+import (
+	"fmt"
+	"strings"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// podSpecPaths are the paths of the pod spec in the workload resources, by kind
+var podSpecPaths = map[string][]string{
+	"Pod":                   {"spec"},
+	"Deployment":            {"spec", "template", "spec"},
+	"StatefulSet":           {"spec", "template", "spec"},
+	"DaemonSet":             {"spec", "template", "spec"},
+	"ReplicaSet":            {"spec", "template", "spec"},
+	"ReplicationController": {"spec", "template", "spec"},
+	"Job":                   {"spec", "template", "spec"},
+	"CronJob":               {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// containerImage is the image of a container of a workload resource
+type containerImage struct {
+	Container string
+	Image     string
+}
+
+// containerImages returns the images of the containers, init containers and ephemeral containers of a resource
+func containerImages(obj *unstructured.Unstructured) []containerImage {
+	path, ok := podSpecPaths[obj.GetKind()]
+	if !ok {
+		return nil
+	}
+	var images []containerImage
+	for _, field := range []string{"initContainers", "containers", "ephemeralContainers"} {
+		containers, _, _ := unstructured.NestedSlice(obj.Object, append(path, field)...)
+		for _, c := range containers {
+			container, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			name, _ := container["name"].(string)
+			image, _ := container["image"].(string)
+			images = append(images, containerImage{Container: name, Image: image})
+		}
+	}
+	return images
+}
+
+// imageTag returns the tag of an image reference, empty when the image is only referenced by digest or has no tag
+func imageTag(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	// The tag follows the last colon, unless it belongs to the registry host port
+	i := strings.LastIndex(image, ":")
+	if i < 0 || strings.Contains(image[i:], "/") {
+		return ""
+	}
+	return image[i+1:]
+}
+
+// checkImageTags reports the containers whose image is not pinned: without a tag or digest, or using the latest tag
+func checkImageTags(app argoappv1.Application, resources []unstructured.Unstructured) []finding {
+	var findings []finding
+	for i := range resources {
+		resource := &resources[i]
+		for _, c := range containerImages(resource) {
+			pinned := strings.Contains(c.Image, "@")
+			tag := imageTag(c.Image)
+			var message string
+			switch {
+			case pinned:
+				continue
+			case tag == "":
+				message = fmt.Sprintf("image '%s' of container '%s' has no tag", c.Image, c.Container)
+			case tag == "latest":
+				message = fmt.Sprintf("image '%s' of container '%s' uses the latest tag", c.Image, c.Container)
+			default:
+				continue
+			}
+			findings = append(findings, finding{
+				RuleID:   "image-unpinned",
+				Category: categoryImage,
+				App:      app.Name,
+				Resource: newResourceKey(resource),
+				Message:  message,
+			})
+		}
+	}
+	return findings
+}
@@ -0,0 +1,138 @@
+package preview
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	k8sresource "k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// immutableField is a field the API server rejects the changes of, failing the sync
+type immutableField struct {
+	// group and kind are the resources the field belongs to
+	group string
+	kind  string
+	path  []string
+	// allocated is set for the fields the API server sets when left out, e.g. the clusterIP of a Service: the
+	// field is only compared when set on both sides
+	allocated bool
+}
+
+// immutableFields are the fields the API server rejects the changes of
+var immutableFields = []immutableField{
+	{kind: "Service", path: []string{"spec", "clusterIP"}, allocated: true},
+	{kind: "PersistentVolumeClaim", path: []string{"spec", "storageClassName"}, allocated: true},
+	{kind: "PersistentVolumeClaim", path: []string{"spec", "volumeName"}, allocated: true},
+	{kind: "PersistentVolumeClaim", path: []string{"spec", "volumeMode"}, allocated: true},
+	{kind: "PersistentVolumeClaim", path: []string{"spec", "accessModes"}},
+	{group: "apps", kind: "Deployment", path: []string{"spec", "selector"}},
+	{group: "apps", kind: "ReplicaSet", path: []string{"spec", "selector"}},
+	{group: "apps", kind: "DaemonSet", path: []string{"spec", "selector"}},
+	{group: "apps", kind: "StatefulSet", path: []string{"spec", "selector"}},
+	{group: "apps", kind: "StatefulSet", path: []string{"spec", "serviceName"}},
+	{group: "apps", kind: "StatefulSet", path: []string{"spec", "podManagementPolicy"}, allocated: true},
+	{group: "batch", kind: "Job", path: []string{"spec", "selector"}, allocated: true},
+	{group: "batch", kind: "Job", path: []string{"spec", "template"}},
+	{group: "batch", kind: "Job", path: []string{"spec", "completionMode"}, allocated: true},
+}
+
+// immutableChanges returns the changes of a modified resource the API server would reject, failing the sync unless
+// the resource is recreated: the changes of its immutable fields, the shrinking of its volume claims, and the
+// changes of the ConfigMaps and Secrets marked immutable. The sync options of the Application and the resource
+// tell whether Argo CD would recreate it instead.
+func immutableChanges(app argoappv1.Application, d resourceDiff) []string {
+	if d.action() != diffActionModified {
+		return nil
+	}
+	var changes []string
+	for _, field := range immutableFields {
+		if field.group != d.Key.Group || field.kind != d.Key.Kind {
+			continue
+		}
+		oldValue, oldFound, _ := unstructured.NestedFieldNoCopy(d.Old.Object, field.path...)
+		newValue, newFound, _ := unstructured.NestedFieldNoCopy(d.New.Object, field.path...)
+		if field.allocated && (!oldFound || !newFound || oldValue == "" || newValue == "") {
+			continue
+		}
+		if !reflect.DeepEqual(oldValue, newValue) {
+			changes = append(changes, strings.Join(field.path, ".")+" is immutable")
+		}
+	}
+	switch d.Key.Kind {
+	case "PersistentVolumeClaim":
+		changes = append(changes, storageShrinks(d.Old, d.New, "spec")...)
+	case "StatefulSet":
+		changes = append(changes, volumeClaimTemplateChanges(d.Old, d.New)...)
+	case "ConfigMap", "Secret":
+		if immutable, _, _ := unstructured.NestedBool(d.Old.Object, "immutable"); immutable {
+			for _, field := range []string{"immutable", "data", "binaryData", "stringData"} {
+				if !reflect.DeepEqual(d.Old.Object[field], d.New.Object[field]) {
+					changes = append(changes, field+" of an immutable "+d.Key.Kind+" can not change")
+				}
+			}
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	sync := newAppSync(app)
+	consequence := "the sync would fail unless the resource is recreated, e.g. with the Replace=true,Force=true " +
+		"sync options"
+	if method := sync.method(d.New); method.recreates {
+		consequence = "the resource would be deleted and recreated (" + method.command + ")"
+	}
+	for i := range changes {
+		changes[i] += ": " + consequence
+	}
+	return changes
+}
+
+// storageShrinks returns the shrinking of the storage requested by a volume claim spec, found at the given path
+func storageShrinks(oldObj *unstructured.Unstructured, newObj *unstructured.Unstructured, path ...string) []string {
+	path = append(path, "resources", "requests", "storage")
+	oldSize, _, _ := unstructured.NestedString(oldObj.Object, path...)
+	newSize, _, _ := unstructured.NestedString(newObj.Object, path...)
+	oldQuantity, oldErr := k8sresource.ParseQuantity(oldSize)
+	newQuantity, newErr := k8sresource.ParseQuantity(newSize)
+	if oldErr != nil || newErr != nil || newQuantity.Cmp(oldQuantity) >= 0 {
+		return nil
+	}
+	return []string{fmt.Sprintf("%s shrinks from %s to %s, volumes can not be shrunk", strings.Join(path, "."),
+		oldSize, newSize)}
+}
+
+// volumeClaimTemplateChanges returns the changes of the volume claim templates of a StatefulSet, which are
+// immutable. The templates are compared by name, size, storage class and access modes, the API server defaulting
+// their other fields.
+func volumeClaimTemplateChanges(oldObj *unstructured.Unstructured, newObj *unstructured.Unstructured) []string {
+	summarize := func(obj *unstructured.Unstructured) []interface{} {
+		templates, _, _ := unstructured.NestedSlice(obj.Object, "spec", "volumeClaimTemplates")
+		var summaries []interface{}
+		for _, template := range templates {
+			templateMap, _ := template.(map[string]interface{})
+			name, _, _ := unstructured.NestedString(templateMap, "metadata", "name")
+			size, _, _ := unstructured.NestedString(templateMap, "spec", "resources", "requests", "storage")
+			storageClass, _, _ := unstructured.NestedString(templateMap, "spec", "storageClassName")
+			accessModes, _, _ := unstructured.NestedStringSlice(templateMap, "spec", "accessModes")
+			summaries = append(summaries, []interface{}{name, size, storageClass, accessModes})
+		}
+		return summaries
+	}
+	if reflect.DeepEqual(summarize(oldObj), summarize(newObj)) {
+		return nil
+	}
+	return []string{"spec.volumeClaimTemplates is immutable"}
+}
+
+// warnImmutableChanges warns about the changes of the resources of an Application the API server would reject
+func warnImmutableChanges(app argoappv1.Application, diffs []resourceDiff) {
+	for _, d := range diffs {
+		for _, change := range immutableChanges(app, d) {
+			log.Warnf("Application '%s': %s: %s", app.Name, d.Key, change)
+		}
+	}
+}
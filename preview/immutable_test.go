@@ -0,0 +1,85 @@
+package preview
+
+import (
+	"testing"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// newTestDiff returns the diff of a resource modified by the given function
+func newTestDiff(old unstructured.Unstructured, modify func(obj *unstructured.Unstructured)) resourceDiff {
+	modified := old.DeepCopy()
+	modify(modified)
+	return resourceDiff{Key: newResourceKey(&old), Old: &old, New: modified}
+}
+
+// TestImmutableChanges verifies that the changes of the immutable fields and the shrinking of the volumes are
+// flagged, the allocated fields only when set on both sides, and that the recreation is reported when forced
+func TestImmutableChanges(t *testing.T) {
+	app := argoappv1.Application{}
+	service := newTestResource("v1", "Service", "web", map[string]interface{}{"clusterIP": "10.0.0.1"})
+	require.Equal(t, []string{"spec.clusterIP is immutable: the sync would fail unless the resource is recreated, " +
+		"e.g. with the Replace=true,Force=true sync options"},
+		immutableChanges(app, newTestDiff(service, func(obj *unstructured.Unstructured) {
+			require.NoError(t, unstructured.SetNestedField(obj.Object, "10.0.0.2", "spec", "clusterIP"))
+		})))
+	require.Empty(t, immutableChanges(app, newTestDiff(service, func(obj *unstructured.Unstructured) {
+		unstructured.RemoveNestedField(obj.Object, "spec", "clusterIP")
+	})))
+
+	claim := newTestResource("v1", "PersistentVolumeClaim", "data", map[string]interface{}{
+		"storageClassName": "ssd",
+		"resources":        map[string]interface{}{"requests": map[string]interface{}{"storage": "10Gi"}},
+	})
+	require.Equal(t, []string{
+		"spec.storageClassName is immutable: the sync would fail unless the resource is recreated, " +
+			"e.g. with the Replace=true,Force=true sync options",
+		"spec.resources.requests.storage shrinks from 10Gi to 5Gi, volumes can not be shrunk: the sync would fail " +
+			"unless the resource is recreated, e.g. with the Replace=true,Force=true sync options",
+	}, immutableChanges(app, newTestDiff(claim, func(obj *unstructured.Unstructured) {
+		require.NoError(t, unstructured.SetNestedField(obj.Object, "hdd", "spec", "storageClassName"))
+		require.NoError(t, unstructured.SetNestedField(obj.Object, "5Gi", "spec", "resources", "requests", "storage"))
+	})))
+	require.Empty(t, immutableChanges(app, newTestDiff(claim, func(obj *unstructured.Unstructured) {
+		require.NoError(t, unstructured.SetNestedField(obj.Object, "20Gi", "spec", "resources", "requests", "storage"))
+	})))
+
+	deployment := newTestResource("apps/v1", "Deployment", "web", map[string]interface{}{
+		"selector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": "web"}},
+		"replicas": int64(1),
+	})
+	changeSelector := func(obj *unstructured.Unstructured) {
+		require.NoError(t, unstructured.SetNestedField(obj.Object, "api", "spec", "selector", "matchLabels", "app"))
+	}
+	require.Len(t, immutableChanges(app, newTestDiff(deployment, changeSelector)), 1)
+	require.Empty(t, immutableChanges(app, newTestDiff(deployment, func(obj *unstructured.Unstructured) {
+		require.NoError(t, unstructured.SetNestedField(obj.Object, int64(2), "spec", "replicas"))
+	})))
+	deployment.SetAnnotations(map[string]string{"argocd.argoproj.io/sync-options": "Force=true,Replace=true"})
+	require.Equal(t, []string{"spec.selector is immutable: the resource would be deleted and recreated " +
+		"(replace --force)"}, immutableChanges(app, newTestDiff(deployment, changeSelector)))
+
+	config := newTestResource("v1", "ConfigMap", "settings", nil)
+	config.Object["immutable"] = true
+	config.Object["data"] = map[string]interface{}{"key": "old"}
+	require.Len(t, immutableChanges(app, newTestDiff(config, func(obj *unstructured.Unstructured) {
+		obj.Object["data"] = map[string]interface{}{"key": "new"}
+	})), 1)
+
+	statefulSet := newTestResource("apps/v1", "StatefulSet", "db", map[string]interface{}{
+		"volumeClaimTemplates": []interface{}{map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "data"},
+			"spec": map[string]interface{}{
+				"resources": map[string]interface{}{"requests": map[string]interface{}{"storage": "10Gi"}},
+			},
+		}},
+	})
+	require.Len(t, immutableChanges(app, newTestDiff(statefulSet, func(obj *unstructured.Unstructured) {
+		templates, _, _ := unstructured.NestedSlice(obj.Object, "spec", "volumeClaimTemplates")
+		require.NoError(t, unstructured.SetNestedField(templates[0].(map[string]interface{}), "20Gi",
+			"spec", "resources", "requests", "storage"))
+		require.NoError(t, unstructured.SetNestedSlice(obj.Object, templates, "spec", "volumeClaimTemplates"))
+	})), 1)
+}
@@ -0,0 +1,700 @@
+package preview
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	k8sresource "k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// kyvernoAutogenAnnotation disables, or restricts, the generation of pod controller rules from Pod rules
+const kyvernoAutogenAnnotation = "pod-policies.kyverno.io/autogen-controllers"
+
+// kyvernoPolicy is a Kyverno ClusterPolicy or Policy, only the fields used by validate rules are decoded
+type kyvernoPolicy struct {
+	Kind     string            `json:"kind"`
+	Metadata metav1.ObjectMeta `json:"metadata"`
+	Spec     struct {
+		ValidationFailureAction string        `json:"validationFailureAction,omitempty"`
+		Rules                   []kyvernoRule `json:"rules"`
+	} `json:"spec"`
+}
+
+type kyvernoRule struct {
+	Name          string           `json:"name"`
+	Match         kyvernoMatch     `json:"match"`
+	Exclude       *kyvernoMatch    `json:"exclude,omitempty"`
+	Preconditions json.RawMessage  `json:"preconditions,omitempty"`
+	Context       json.RawMessage  `json:"context,omitempty"`
+	Validate      *kyvernoValidate `json:"validate,omitempty"`
+}
+
+type kyvernoMatch struct {
+	Any       []kyvernoFilter   `json:"any,omitempty"`
+	All       []kyvernoFilter   `json:"all,omitempty"`
+	Resources *kyvernoResources `json:"resources,omitempty"`
+	kyvernoUserInfo
+}
+
+type kyvernoFilter struct {
+	Resources kyvernoResources `json:"resources"`
+	kyvernoUserInfo
+}
+
+// kyvernoUserInfo selects the requests by the user making them, which is not known offline
+type kyvernoUserInfo struct {
+	Subjects     json.RawMessage `json:"subjects,omitempty"`
+	Roles        json.RawMessage `json:"roles,omitempty"`
+	ClusterRoles json.RawMessage `json:"clusterRoles,omitempty"`
+}
+
+type kyvernoResources struct {
+	Kinds      []string              `json:"kinds,omitempty"`
+	Name       string                `json:"name,omitempty"`
+	Names      []string              `json:"names,omitempty"`
+	Namespaces []string              `json:"namespaces,omitempty"`
+	Selector   *metav1.LabelSelector `json:"selector,omitempty"`
+	// Not evaluated offline: the Namespaces are not known, annotations and operations are not matched
+	NamespaceSelector json.RawMessage `json:"namespaceSelector,omitempty"`
+	Annotations       json.RawMessage `json:"annotations,omitempty"`
+	Operations        json.RawMessage `json:"operations,omitempty"`
+}
+
+type kyvernoValidate struct {
+	Message       string          `json:"message,omitempty"`
+	FailureAction string          `json:"failureAction,omitempty"`
+	Pattern       interface{}     `json:"pattern,omitempty"`
+	AnyPattern    []interface{}   `json:"anyPattern,omitempty"`
+	Deny          json.RawMessage `json:"deny,omitempty"`
+	Foreach       json.RawMessage `json:"foreach,omitempty"`
+	CEL           json.RawMessage `json:"cel,omitempty"`
+	PodSecurity   json.RawMessage `json:"podSecurity,omitempty"`
+	Manifests     json.RawMessage `json:"manifests,omitempty"`
+	Assert        json.RawMessage `json:"assert,omitempty"`
+}
+
+// loadKyvernoPolicies returns the Kyverno policies among the given policy resources
+func loadKyvernoPolicies(objs []*unstructured.Unstructured) ([]kyvernoPolicy, error) {
+	var policies []kyvernoPolicy
+	for _, obj := range objs {
+		gvk := obj.GroupVersionKind()
+		if gvk.Group != "kyverno.io" || (gvk.Kind != "ClusterPolicy" && gvk.Kind != "Policy") {
+			continue
+		}
+		data, err := json.Marshal(obj.Object)
+		if err != nil {
+			return nil, err
+		}
+		var policy kyvernoPolicy
+		if err := json.Unmarshal(data, &policy); err != nil {
+			return nil, fmt.Errorf("invalid Kyverno policy '%s': %w", obj.GetName(), err)
+		}
+		warnUnsupportedKyvernoRules(policy)
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+// warnUnsupportedKyvernoRules warns about the validate rules which use features not evaluated offline
+func warnUnsupportedKyvernoRules(policy kyvernoPolicy) {
+	for _, rule := range policy.Spec.Rules {
+		if feature := unsupportedKyvernoFeature(rule); feature != "" {
+			log.Warnf("Kyverno rule '%s/%s' uses %s, which is not supported, skipping it",
+				policy.Metadata.Name, rule.Name, feature)
+		}
+	}
+}
+
+// unsupportedKyvernoFeature returns the unsupported feature used by a validate rule, if any.
+// Only pattern and anyPattern rules are evaluated, anything relying on JMESPath or external data is not.
+func unsupportedKyvernoFeature(rule kyvernoRule) string {
+	v := rule.Validate
+	if v == nil {
+		return ""
+	}
+	unsupported := []struct {
+		name  string
+		value json.RawMessage
+	}{
+		{"preconditions", rule.Preconditions},
+		{"context", rule.Context},
+		{"deny", v.Deny},
+		{"foreach", v.Foreach},
+		{"cel", v.CEL},
+		{"podSecurity", v.PodSecurity},
+		{"manifests", v.Manifests},
+		{"assert", v.Assert},
+	}
+	for _, u := range unsupported {
+		if len(u.value) > 0 {
+			return u.name
+		}
+	}
+	if v.Pattern == nil && len(v.AnyPattern) == 0 {
+		return "a validation without pattern"
+	}
+	if feature := unsupportedKyvernoMatch("match", &rule.Match); feature != "" {
+		return feature
+	}
+	return unsupportedKyvernoMatch("exclude", rule.Exclude)
+}
+
+// unsupportedKyvernoMatch returns the unsupported field of a match or exclude block, if any, so that the rule is
+// skipped rather than matching more resources than it would in the cluster
+func unsupportedKyvernoMatch(name string, match *kyvernoMatch) string {
+	if match == nil {
+		return ""
+	}
+	if field := unsupportedKyvernoUserInfo(match.kyvernoUserInfo); field != "" {
+		return name + "." + field
+	}
+	if match.Resources != nil {
+		if field := unsupportedKyvernoResources(*match.Resources); field != "" {
+			return name + ".resources." + field
+		}
+	}
+	blocks := []struct {
+		name    string
+		filters []kyvernoFilter
+	}{{"any", match.Any}, {"all", match.All}}
+	for _, block := range blocks {
+		for i, filter := range block.filters {
+			field := unsupportedKyvernoUserInfo(filter.kyvernoUserInfo)
+			if field == "" {
+				if field = unsupportedKyvernoResources(filter.Resources); field != "" {
+					field = "resources." + field
+				}
+			}
+			if field != "" {
+				return fmt.Sprintf("%s.%s[%d].%s", name, block.name, i, field)
+			}
+		}
+	}
+	return ""
+}
+
+// unsupportedKyvernoUserInfo returns the field selecting the user making the request, if any
+func unsupportedKyvernoUserInfo(info kyvernoUserInfo) string {
+	switch {
+	case len(info.Subjects) > 0:
+		return "subjects"
+	case len(info.Roles) > 0:
+		return "roles"
+	case len(info.ClusterRoles) > 0:
+		return "clusterRoles"
+	}
+	return ""
+}
+
+// unsupportedKyvernoResources returns the field of a resource description which is not evaluated, if any
+func unsupportedKyvernoResources(r kyvernoResources) string {
+	switch {
+	case len(r.NamespaceSelector) > 0:
+		return "namespaceSelector"
+	case len(r.Annotations) > 0:
+		return "annotations"
+	case len(r.Operations) > 0:
+		return "operations"
+	}
+	return ""
+}
+
+// newKyvernoCheck returns a check evaluating the validate rules of the Kyverno policies
+func newKyvernoCheck(policies []kyvernoPolicy) check {
+	return func(app argoappv1.Application, resources []unstructured.Unstructured) []finding {
+		var findings []finding
+		for i := range resources {
+			resource := &resources[i]
+			for _, policy := range policies {
+				for _, rule := range policy.Spec.Rules {
+					if rule.Validate == nil || unsupportedKyvernoFeature(rule) != "" {
+						continue
+					}
+					message, failed := evaluateKyvernoRule(policy, rule, app, resource)
+					if !failed {
+						continue
+					}
+					action := rule.Validate.FailureAction
+					if action == "" {
+						action = policy.Spec.ValidationFailureAction
+					}
+					findings = append(findings, finding{
+						RuleID:   policy.Metadata.Name + "/" + rule.Name,
+						Category: categoryPolicy,
+						App:      app.Name,
+						Resource: newResourceKey(resource),
+						Message:  message,
+						Advisory: !strings.EqualFold(action, "enforce"),
+					})
+				}
+			}
+		}
+		return findings
+	}
+}
+
+// evaluateKyvernoRule evaluates a validate rule on a resource, returning the failure message if it failed.
+// Pod rules are also evaluated on the pod template of pod controllers, as Kyverno auto-generates them.
+func evaluateKyvernoRule(
+	policy kyvernoPolicy,
+	rule kyvernoRule,
+	app argoappv1.Application,
+	resource *unstructured.Unstructured,
+) (string, bool) {
+	namespace := resource.GetNamespace()
+	if namespace == "" && isNamespacedResource(resource) {
+		namespace = app.Spec.Destination.Namespace
+	}
+	if policy.Kind == "Policy" && namespace != policy.Metadata.Namespace {
+		return "", false
+	}
+
+	target := resource.Object
+	if !kyvernoMatches(rule.Match, resource, resource.GetKind(), namespace) {
+		template, ok := podTemplate(resource)
+		if !ok || !kyvernoAutogen(policy, resource.GetKind()) ||
+			!kyvernoMatches(rule.Match, resource, "Pod", namespace) {
+			return "", false
+		}
+		target = template
+	}
+	if rule.Exclude != nil && kyvernoMatches(*rule.Exclude, resource, resource.GetKind(), namespace) {
+		return "", false
+	}
+
+	patterns := rule.Validate.AnyPattern
+	if rule.Validate.Pattern != nil {
+		patterns = []interface{}{rule.Validate.Pattern}
+	}
+	var failures []string
+	for _, pattern := range patterns {
+		result, failedPath := matchKyvernoPattern(pattern, target, "")
+		if result != patternFail {
+			return "", false
+		}
+		failures = append(failures, failedPath+"/")
+	}
+
+	message := rule.Validate.Message
+	if message == "" {
+		message = "validation error"
+	}
+	return fmt.Sprintf("%s (rule %s failed at path %s)", message, rule.Name, strings.Join(failures, ", ")), true
+}
+
+// isNamespacedResource guesses whether a resource is namespaced, without discovery
+func isNamespacedResource(resource *unstructured.Unstructured) bool {
+	switch resource.GetKind() {
+	case "Namespace", "Node", "PersistentVolume", "ClusterRole", "ClusterRoleBinding", "CustomResourceDefinition",
+		"StorageClass", "PriorityClass", "IngressClass", "MutatingWebhookConfiguration",
+		"ValidatingWebhookConfiguration", "APIService", "RuntimeClass", "CSIDriver":
+		return false
+	}
+	return true
+}
+
+// podTemplate returns the pod template of a pod controller, as a Pod
+func podTemplate(resource *unstructured.Unstructured) (map[string]interface{}, bool) {
+	specPath, ok := podSpecPaths[resource.GetKind()]
+	if !ok || resource.GetKind() == "Pod" {
+		return nil, false
+	}
+	template, found, _ := unstructured.NestedMap(resource.Object, specPath[:len(specPath)-1]...)
+	if !found {
+		return nil, false
+	}
+	template["apiVersion"] = "v1"
+	template["kind"] = "Pod"
+	return template, true
+}
+
+// kyvernoAutogen returns true when rules matching Pods are also applied to the given pod controller kind
+func kyvernoAutogen(policy kyvernoPolicy, kind string) bool {
+	controllers, ok := policy.Metadata.Annotations[kyvernoAutogenAnnotation]
+	if !ok || controllers == "all" {
+		return true
+	}
+	for _, c := range strings.Split(controllers, ",") {
+		if strings.TrimSpace(c) == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// kyvernoMatches returns true when a match (or exclude) block selects the resource, taken as the given kind
+func kyvernoMatches(match kyvernoMatch, resource *unstructured.Unstructured, kind string, namespace string) bool {
+	if match.Resources != nil && !kyvernoResourcesMatch(*match.Resources, resource, kind, namespace) {
+		return false
+	}
+	for _, filter := range match.All {
+		if !kyvernoResourcesMatch(filter.Resources, resource, kind, namespace) {
+			return false
+		}
+	}
+	if len(match.Any) > 0 {
+		matched := false
+		for _, filter := range match.Any {
+			if kyvernoResourcesMatch(filter.Resources, resource, kind, namespace) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return match.Resources != nil || len(match.All) > 0 || len(match.Any) > 0
+}
+
+// kyvernoResourcesMatch returns true when the resource description selects the resource
+func kyvernoResourcesMatch(
+	r kyvernoResources,
+	resource *unstructured.Unstructured,
+	kind string,
+	namespace string,
+) bool {
+	if len(r.Kinds) > 0 && !kyvernoKindMatches(r.Kinds, resource, kind) {
+		return false
+	}
+	names := r.Names
+	if r.Name != "" {
+		names = append(names, r.Name)
+	}
+	if len(names) > 0 && !matchesAnyGlob(names, resource.GetName()) {
+		return false
+	}
+	if len(r.Namespaces) > 0 && !matchesAnyGlob(r.Namespaces, namespace) {
+		return false
+	}
+	if r.Selector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(r.Selector)
+		if err != nil || !selector.Matches(labels.Set(resource.GetLabels())) {
+			return false
+		}
+	}
+	return true
+}
+
+// kyvernoKindMatches matches the kinds of a resource description, given as Kind, Version/Kind or Group/Version/Kind
+func kyvernoKindMatches(kinds []string, resource *unstructured.Unstructured, kind string) bool {
+	gvk := resource.GroupVersionKind()
+	if kind == "Pod" && gvk.Kind != "Pod" {
+		gvk.Group, gvk.Version = "", "v1"
+	}
+	for _, k := range kinds {
+		parts := strings.Split(k, "/")
+		matched := globMatch(parts[len(parts)-1], kind)
+		switch len(parts) {
+		case 2:
+			matched = matched && globMatch(parts[0], gvk.Version)
+		case 3:
+			matched = matched && globMatch(parts[0], gvk.Group) && globMatch(parts[1], gvk.Version)
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAnyGlob returns true when the value matches one of the glob patterns
+func matchesAnyGlob(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, value); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Results of the evaluation of a Kyverno pattern
+const (
+	patternPass = iota
+	patternFail
+	// patternSkip is returned when a conditional anchor does not match, the enclosing list element is skipped
+	patternSkip
+	// patternSkipRule is returned when a global anchor does not match, the rule does not apply to the resource
+	patternSkipRule
+)
+
+// matchKyvernoPattern matches a value against a Kyverno validation pattern, supporting the
+// conditional "(key)", equality "=(key)", negation "X(key)", existence "^(key)" and global "<(key)" anchors.
+// Returns the result and, on failure, the path of the failing field.
+func matchKyvernoPattern(pattern interface{}, value interface{}, fieldPath string) (int, string) {
+	switch p := pattern.(type) {
+	case map[string]interface{}:
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return patternFail, fieldPath
+		}
+		return matchKyvernoMap(p, m, fieldPath)
+	case []interface{}:
+		l, ok := value.([]interface{})
+		if !ok {
+			return patternFail, fieldPath
+		}
+		return matchKyvernoList(p, l, fieldPath)
+	default:
+		if matchKyvernoScalar(pattern, value) {
+			return patternPass, ""
+		}
+		return patternFail, fieldPath
+	}
+}
+
+// matchKyvernoMap matches a map, evaluating the conditional and global anchors first
+func matchKyvernoMap(pattern map[string]interface{}, value map[string]interface{}, fieldPath string) (int, string) {
+	keys := make([]string, 0, len(pattern))
+	for key := range pattern {
+		keys = append(keys, key)
+	}
+	// Conditions first, then the other keys in a stable order
+	sort.SliceStable(keys, func(i, j int) bool {
+		ci, cj := isKyvernoCondition(keys[i]), isKyvernoCondition(keys[j])
+		if ci != cj {
+			return ci
+		}
+		return keys[i] < keys[j]
+	})
+
+	for _, key := range keys {
+		sub := pattern[key]
+		anchor, name := parseKyvernoAnchor(key)
+		childPath := fieldPath + "/" + name
+		v, exists := value[name]
+		switch anchor {
+		case "(", "<(":
+			skip := patternSkip
+			if anchor == "<(" {
+				skip = patternSkipRule
+			}
+			if !exists {
+				return skip, ""
+			}
+			if result, _ := matchKyvernoPattern(sub, v, childPath); result != patternPass {
+				return skip, ""
+			}
+		case "=(":
+			if !exists {
+				continue
+			}
+			if result, failedPath := matchKyvernoPattern(sub, v, childPath); result != patternPass {
+				return result, failedPath
+			}
+		case "X(":
+			if exists {
+				return patternFail, childPath
+			}
+		case "^(":
+			l, ok := v.([]interface{})
+			elements, _ := sub.([]interface{})
+			if !exists || !ok || len(elements) == 0 {
+				return patternFail, childPath
+			}
+			found := false
+			for i, e := range l {
+				if result, _ := matchKyvernoPattern(elements[0], e, childPath+"/"+strconv.Itoa(i)); result == patternPass {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return patternFail, childPath
+			}
+		default:
+			if !exists {
+				if sub == nil {
+					continue
+				}
+				return patternFail, childPath
+			}
+			if result, failedPath := matchKyvernoPattern(sub, v, childPath); result != patternPass {
+				return result, failedPath
+			}
+		}
+	}
+	return patternPass, ""
+}
+
+// matchKyvernoList matches a list: a single element pattern applies to every element, conditional anchors
+// skipping the elements they do not match, otherwise elements are matched by position
+func matchKyvernoList(pattern []interface{}, value []interface{}, fieldPath string) (int, string) {
+	if len(pattern) == 1 {
+		for i, e := range value {
+			result, failedPath := matchKyvernoPattern(pattern[0], e, fieldPath+"/"+strconv.Itoa(i))
+			if result == patternFail || result == patternSkipRule {
+				return result, failedPath
+			}
+		}
+		return patternPass, ""
+	}
+	if len(pattern) != len(value) {
+		return patternFail, fieldPath
+	}
+	for i := range pattern {
+		result, failedPath := matchKyvernoPattern(pattern[i], value[i], fieldPath+"/"+strconv.Itoa(i))
+		if result == patternFail || result == patternSkipRule {
+			return result, failedPath
+		}
+	}
+	return patternPass, ""
+}
+
+// isKyvernoCondition returns true for the keys holding a conditional or global anchor
+func isKyvernoCondition(key string) bool {
+	anchor, _ := parseKyvernoAnchor(key)
+	return anchor == "(" || anchor == "<("
+}
+
+// parseKyvernoAnchor splits a pattern key into its anchor, if any, and field name
+func parseKyvernoAnchor(key string) (string, string) {
+	if !strings.HasSuffix(key, ")") {
+		return "", key
+	}
+	for _, anchor := range []string{"=(", "X(", "^(", "<(", "+(", "("} {
+		if strings.HasPrefix(key, anchor) {
+			return anchor, key[len(anchor) : len(key)-1]
+		}
+	}
+	return "", key
+}
+
+// matchKyvernoScalar matches a scalar value against a pattern, supporting the wildcards, the | and & logical
+// operators, and the !, >, >=, < and <= comparison operators of Kyverno
+func matchKyvernoScalar(pattern interface{}, value interface{}) bool {
+	switch p := pattern.(type) {
+	case nil:
+		return value == nil
+	case bool:
+		return value == p
+	case string:
+		for _, alternative := range strings.Split(p, "|") {
+			matched := true
+			for _, condition := range strings.Split(alternative, "&") {
+				if !matchKyvernoCondition(strings.TrimSpace(condition), value) {
+					matched = false
+					break
+				}
+			}
+			if matched {
+				return true
+			}
+		}
+		return false
+	default:
+		pf, ok := toFloat(pattern)
+		vf, vok := toFloat(value)
+		return ok && vok && pf == vf || reflect.DeepEqual(pattern, value)
+	}
+}
+
+// matchKyvernoCondition matches a value against a single comparison of a scalar pattern
+func matchKyvernoCondition(condition string, value interface{}) bool {
+	for _, operator := range []string{">=", "<=", ">", "<", "!"} {
+		if !strings.HasPrefix(condition, operator) {
+			continue
+		}
+		operand := strings.TrimSpace(condition[len(operator):])
+		if operator == "!" {
+			return !matchKyvernoCondition(operand, value)
+		}
+		cmp, ok := compareQuantities(value, operand)
+		if !ok {
+			return false
+		}
+		switch operator {
+		case ">=":
+			return cmp >= 0
+		case "<=":
+			return cmp <= 0
+		case ">":
+			return cmp > 0
+		default:
+			return cmp < 0
+		}
+	}
+
+	if value == nil {
+		return false
+	}
+	if cmp, ok := compareQuantities(value, condition); ok && !strings.ContainsAny(condition, "*?") {
+		return cmp == 0
+	}
+	return wildcardMatch(condition, scalarString(value))
+}
+
+// compareQuantities compares a value to an operand, both parsed as numbers or Kubernetes quantities
+func compareQuantities(value interface{}, operand string) (int, bool) {
+	other, err := k8sresource.ParseQuantity(operand)
+	if err != nil {
+		return 0, false
+	}
+	q, err := k8sresource.ParseQuantity(scalarString(value))
+	if err != nil {
+		return 0, false
+	}
+	return q.Cmp(other), true
+}
+
+// scalarString returns the string representation of a scalar value
+func scalarString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// toFloat converts a numeric value to a float
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// wildcardMatch matches a string against a pattern where * matches any sequence and ? any single character
+func wildcardMatch(pattern string, value string) bool {
+	p, v := []rune(pattern), []rune(value)
+	star, match := -1, 0
+	i, j := 0, 0
+	for j < len(v) {
+		switch {
+		case i < len(p) && (p[i] == '?' || p[i] == v[j]):
+			i++
+			j++
+		case i < len(p) && p[i] == '*':
+			star, match = i, j
+			i++
+		case star >= 0:
+			i = star + 1
+			match++
+			j = match
+		default:
+			return false
+		}
+	}
+	for i < len(p) && p[i] == '*' {
+		i++
+	}
+	return i == len(p)
+}
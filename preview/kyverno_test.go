@@ -0,0 +1,233 @@
+package preview
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const testKyvernoPolicies = `apiVersion: kyverno.io/v1
+kind: ClusterPolicy
+metadata:
+  name: require-team-label
+spec:
+  validationFailureAction: Enforce
+  rules:
+    - name: check-team
+      match:
+        any:
+          - resources:
+              kinds: [Deployment, Service]
+      exclude:
+        any:
+          - resources:
+              names: ["legacy-*"]
+      validate:
+        message: "label team is required"
+        pattern:
+          metadata:
+            labels:
+              team: "?*"
+    - name: check-owner
+      match:
+        any:
+          - resources:
+              kinds: [Service]
+              namespaceSelector:
+                matchLabels:
+                  env: prod
+      validate:
+        message: "label owner is required in production"
+        pattern:
+          metadata:
+            labels:
+              owner: "?*"
+---
+apiVersion: kyverno.io/v1
+kind: ClusterPolicy
+metadata:
+  name: pod-security
+spec:
+  rules:
+    - name: no-latest
+      match:
+        any:
+          - resources:
+              kinds: [Pod]
+      validate:
+        message: "images must not use the latest tag"
+        pattern:
+          spec:
+            containers:
+              - image: "!*:latest"
+    - name: non-root
+      match:
+        any:
+          - resources:
+              kinds: [Pod]
+      validate:
+        message: "containers must run as non root"
+        anyPattern:
+          - spec:
+              securityContext:
+                runAsNonRoot: true
+          - spec:
+              containers:
+                - securityContext:
+                    runAsNonRoot: true
+    - name: limits
+      match:
+        any:
+          - resources:
+              kinds: [Pod]
+      validate:
+        message: "privileged containers need a memory limit below 1Gi"
+        pattern:
+          spec:
+            containers:
+              - (securityContext):
+                  privileged: true
+                resources:
+                  limits:
+                    memory: "<1Gi"
+    - name: deny-rule
+      match:
+        any:
+          - resources:
+              kinds: [Pod]
+      validate:
+        deny: {}
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: ignored
+`
+
+func newTestPodController(name string, containers ...map[string]interface{}) unstructured.Unstructured {
+	list := make([]interface{}, 0, len(containers))
+	for _, c := range containers {
+		list = append(list, c)
+	}
+	deployment := newTestResource("apps/v1", "Deployment", name, map[string]interface{}{
+		"template": map[string]interface{}{"spec": map[string]interface{}{"containers": list}},
+	})
+	deployment.SetLabels(map[string]string{"team": "web"})
+	return deployment
+}
+
+// TestKyvernoCheck verifies the evaluation of Kyverno validate rules, including on pod controllers
+func TestKyvernoCheck(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "policies.yaml"), []byte(testKyvernoPolicies), 0o600))
+	policyChecks, err := newPolicyChecks([]string{dir})
+	require.NoError(t, err)
+	require.Len(t, policyChecks, 1)
+
+	nonRoot := map[string]interface{}{"runAsNonRoot": true}
+	unlabeled := newTestResource("v1", "Service", "api", nil)
+	legacy := newTestResource("v1", "Service", "legacy-api", nil)
+	compliant := newTestPodController("compliant",
+		map[string]interface{}{"name": "web", "image": "nginx:1.25", "securityContext": nonRoot},
+		map[string]interface{}{
+			"name": "privileged", "image": "envoy:1.30",
+			"securityContext": map[string]interface{}{"privileged": true, "runAsNonRoot": true},
+			"resources":       map[string]interface{}{"limits": map[string]interface{}{"memory": "512Mi"}},
+		},
+	)
+	violating := newTestPodController("violating",
+		map[string]interface{}{"name": "web", "image": "nginx:latest"},
+		map[string]interface{}{
+			"name": "privileged", "image": "envoy:1.30",
+			"securityContext": map[string]interface{}{"privileged": true},
+			"resources":       map[string]interface{}{"limits": map[string]interface{}{"memory": "2Gi"}},
+		},
+	)
+
+	app := argoappv1.Application{ObjectMeta: metav1.ObjectMeta{Name: "web"}}
+	findings := runChecks(app, []unstructured.Unstructured{unlabeled, legacy, compliant, violating},
+		policyChecks)
+
+	type result struct {
+		resource string
+		rule     string
+		advisory bool
+	}
+	var results []result
+	for _, f := range findings {
+		results = append(results, result{f.Resource.String(), f.RuleID, f.Advisory})
+	}
+	require.Equal(t, []result{
+		{"Service default/api", "require-team-label/check-team", false},
+		{"apps/Deployment default/violating", "pod-security/no-latest", true},
+		{"apps/Deployment default/violating", "pod-security/non-root", true},
+		{"apps/Deployment default/violating", "pod-security/limits", true},
+	}, results)
+	require.Equal(t, "label team is required (rule check-team failed at path /metadata/labels/)", findings[0].Message)
+	require.Equal(t, "images must not use the latest tag (rule no-latest failed at path /spec/containers/0/image/)",
+		findings[1].Message)
+}
+
+// TestUnsupportedKyvernoMatch verifies that the rules matching on what is not known offline are reported, to be
+// skipped rather than matching more resources than in the cluster
+func TestUnsupportedKyvernoMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     string
+		expected string
+	}{
+		{name: "supported", rule: `{"match": {"any": [{"resources": {"kinds": ["Pod"], "namespaces": ["prod"]}}]}}`},
+		{name: "namespace selector", rule: `{"match": {"any": [{"resources": {"namespaceSelector": {}}}]}}`,
+			expected: "match.any[0].resources.namespaceSelector"},
+		{name: "annotations", rule: `{"match": {"all": [{"resources": {"kinds": ["Pod"]}},
+			{"resources": {"annotations": {"a": "b"}}}]}}`, expected: "match.all[1].resources.annotations"},
+		{name: "operations", rule: `{"match": {"resources": {"operations": ["CREATE"]}}}`,
+			expected: "match.resources.operations"},
+		{name: "subjects", rule: `{"match": {"any": [{"subjects": [{"kind": "User", "name": "ci"}]}]}}`,
+			expected: "match.any[0].subjects"},
+		{name: "roles", rule: `{"match": {"roles": ["admin"]}}`, expected: "match.roles"},
+		{name: "cluster roles", rule: `{"match": {"resources": {"kinds": ["Pod"]}},
+			"exclude": {"any": [{"clusterRoles": ["cluster-admin"]}]}}`, expected: "exclude.any[0].clusterRoles"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rule kyvernoRule
+			require.NoError(t, json.Unmarshal([]byte(tt.rule), &rule))
+			rule.Validate = &kyvernoValidate{Pattern: map[string]interface{}{}}
+			require.Equal(t, tt.expected, unsupportedKyvernoFeature(rule))
+		})
+	}
+}
+
+// TestMatchKyvernoScalar verifies the operators of Kyverno scalar patterns
+func TestMatchKyvernoScalar(t *testing.T) {
+	tests := []struct {
+		pattern interface{}
+		value   interface{}
+		matched bool
+	}{
+		{"?*", "value", true},
+		{"?*", "", false},
+		{"*", nil, false},
+		{"nginx:*", "nginx:1.25", true},
+		{"!*:latest", "nginx:latest", false},
+		{"Always | IfNotPresent", "IfNotPresent", true},
+		{">1 & <=3", int64(3), true},
+		{">1 & <=3", int64(4), false},
+		{"<1Gi", "512Mi", true},
+		{"1024Mi", "1Gi", true},
+		{true, true, true},
+		{true, false, false},
+		{float64(2), int64(2), true},
+		{nil, nil, true},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.matched, matchKyvernoScalar(tt.pattern, tt.value), "%v against %v", tt.value, tt.pattern)
+	}
+}
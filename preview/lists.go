@@ -0,0 +1,43 @@
+package preview
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// keepLists keeps the Lists nested in the rendered manifests as is, instead of unwrapping them into their items
+var keepLists bool
+
+// KeepLists makes the Lists nested in the rendered manifests output as single resources. The repository service
+// always unwraps the top-level Lists.
+func KeepLists() {
+	keepLists = true
+}
+
+// unwrapListManifests replaces the rendered Lists (v1/List, or <Kind>List) by their items, so that the items are
+// printed, diffed and written as individual resources. The other manifests are kept unchanged.
+func unwrapListManifests(manifests []string) ([]string, error) {
+	unwrapped := make([]string, 0, len(manifests))
+	for _, manifest := range manifests {
+		obj := &unstructured.Unstructured{}
+		if err := json.Unmarshal([]byte(manifest), obj); err != nil || !obj.IsList() {
+			// Not a List, or reported when parsing the manifests
+			unwrapped = append(unwrapped, manifest)
+			continue
+		}
+		items, err := unwrapLists([]*unstructured.Unstructured{obj})
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			data, err := json.Marshal(item.Object)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal item of List: %w", err)
+			}
+			unwrapped = append(unwrapped, string(data))
+		}
+	}
+	return unwrapped, nil
+}
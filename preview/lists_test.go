@@ -0,0 +1,50 @@
+package preview
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestUnwrapListManifests verifies that the rendered Lists are replaced by their items, nested Lists included
+func TestUnwrapListManifests(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		expected []string
+	}{
+		{
+			name:     "resource",
+			manifest: `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"a"}}`,
+			expected: []string{`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"a"}}`},
+		},
+		{
+			name: "List",
+			manifest: `{"apiVersion":"v1","kind":"List","items":[` +
+				`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"a"}},` +
+				`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"b"}}]}`,
+			expected: []string{
+				`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"a"}}`,
+				`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"b"}}`,
+			},
+		},
+		{
+			name: "nested List",
+			manifest: `{"apiVersion":"v1","kind":"List","items":[{"apiVersion":"v1","kind":"ConfigMapList","items":[` +
+				`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"a"}}]}]}`,
+			expected: []string{`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"a"}}`},
+		},
+		{
+			name:     "empty List",
+			manifest: `{"apiVersion":"v1","kind":"List","items":[]}`,
+			expected: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifests, err := unwrapListManifests([]string{tt.manifest})
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, manifests)
+		})
+	}
+}
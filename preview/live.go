@@ -0,0 +1,317 @@
+package preview
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/argoproj/argo-cd/v3/pkg/apiclient"
+	applicationpkg "github.com/argoproj/argo-cd/v3/pkg/apiclient/application"
+	settingspkg "github.com/argoproj/argo-cd/v3/pkg/apiclient/settings"
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/argoproj/argo-cd/v3/reposerver/repository"
+	"github.com/argoproj/argo-cd/v3/util/argo"
+	argodiff "github.com/argoproj/argo-cd/v3/util/argo/diff"
+	"github.com/argoproj/argo-cd/v3/util/argo/normalizers"
+	logutils "github.com/argoproj/argo-cd/v3/util/log"
+	"github.com/argoproj/gitops-engine/pkg/sync/hook"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// LiveOptions holds the settings of the commands diffing the offline render against an Argo CD API server
+type LiveOptions struct {
+	// AppName restricts the diff to the Application with this name
+	AppName string
+	// Server is the address of the Argo CD API server
+	Server string
+	// AuthToken is the token used to authenticate against the Argo CD API server
+	AuthToken string
+	// PlainText disables TLS
+	PlainText bool
+	// Insecure skips the verification of the server certificate
+	Insecure bool
+	// GRPCWeb uses the gRPC-Web protocol, for servers behind proxies without HTTP/2 support
+	GRPCWeb bool
+	// Summary prints a one-line summary of the changes of each Application instead of the diff
+	Summary bool
+	// Porcelain prints a line per Application as it completes, for tools wrapping the CLI, instead of the diff
+	Porcelain bool
+	// OnlyChanged leaves out the Applications in sync from the output
+	OnlyChanged bool
+	// DiffExec is the external command the old and new YAML of each changed resource are diffed with
+	DiffExec string
+	// StructuralDiff prints the changed YAML paths of each modified resource with their old and new values,
+	// instead of the changed lines
+	StructuralDiff bool
+}
+
+// liveItem pairs the live state of a resource, as reported by Argo CD, with its offline rendered target state
+// live is nil for a resource which is not deployed yet, target is nil for a resource which would be pruned.
+type liveItem struct {
+	key    resourceKey
+	live   *unstructured.Unstructured
+	target *unstructured.Unstructured
+}
+
+// DiffApplicationLive diffs the Applications defined in a manifest against their live state
+func DiffApplicationLive(filename string, opts LiveOptions) {
+	diffLive(loadApplications(filename), opts)
+}
+
+// DiffResourcesLive diffs the Applications generated from an ApplicationSet against their live state
+func DiffResourcesLive(filename string, opts LiveOptions) {
+	diffLive(generateApplications(filename), opts)
+}
+
+// diffLive renders the Applications offline, fetches their managed resources from the Argo CD API server,
+// and prints the differences, the same way `argocd app diff` does.
+// Exits with status 1 when a difference is found.
+func diffLive(apps []argoappv1.Application, opts LiveOptions) {
+	if !shouldMatch(opts.Server) {
+		log.Fatal("the address of the Argo CD API server must be given with --argocd-server")
+	}
+	client, err := apiclient.NewClient(&apiclient.ClientOptions{
+		ServerAddr: opts.Server,
+		AuthToken:  opts.AuthToken,
+		PlainText:  opts.PlainText,
+		Insecure:   opts.Insecure,
+		GRPCWeb:    opts.GRPCWeb,
+	})
+	if err != nil {
+		log.Fatal("failed to create Argo CD API client: ", err)
+	}
+	settingsCloser, settingsClient, err := client.NewSettingsClient()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer settingsCloser.Close()
+	appCloser, appClient, err := client.NewApplicationClient()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer appCloser.Close()
+
+	ctx := context.Background()
+	argoSettings, err := settingsClient.Get(ctx, &settingspkg.SettingsQuery{})
+	if err != nil {
+		log.Fatal("failed to get Argo CD settings: ", err)
+	}
+	repoService, err := newRepoService()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	selected := func(app argoappv1.Application) bool {
+		return !shouldMatch(opts.AppName) || opts.AppName == app.Name
+	}
+	summary := startRunSummary(countSelected(apps, selected))
+	foundDiffs := false
+	for _, app := range apps {
+		if !selected(app) {
+			continue
+		}
+		start := time.Now()
+		diffs, err := diffLiveApp(ctx, repoService, appClient, argoSettings, app)
+		if opts.Porcelain {
+			printPorcelainLine(os.Stdout, app.Name, start, diffs, err, opts.OnlyChanged)
+		}
+		if err != nil {
+			summary.record(appStatusFailed, err)
+			log.Fatal(err)
+		}
+		summary.record(appStatusSucceeded, nil)
+		foundDiffs = foundDiffs || len(diffs) > 0
+		if opts.Porcelain {
+			continue
+		}
+		if len(diffs) == 0 {
+			if !opts.OnlyChanged {
+				fmt.Printf("application/%s: in sync\n", app.Name)
+			}
+			continue
+		}
+		if err := printAppDiffs(os.Stdout, app.Name, diffs, opts.Summary, opts.DiffExec,
+			opts.StructuralDiff); err != nil {
+			log.Fatal(err)
+		}
+		warnImmutableChanges(app, diffs)
+	}
+	summary.finish()
+	if foundDiffs {
+		os.Exit(1)
+	}
+}
+
+// diffLiveApp renders an Application and diffs its resources against their live state in Argo CD
+func diffLiveApp(
+	ctx context.Context,
+	repoService *repository.Service,
+	appClient applicationpkg.ApplicationServiceClient,
+	argoSettings *settingspkg.Settings,
+	app argoappv1.Application,
+) ([]resourceDiff, error) {
+	rendered, err := generateAppManifests(repoService, app)
+	if err != nil {
+		return nil, err
+	}
+	targets, err := parseManifests(allManifests(rendered))
+	if err != nil {
+		return nil, err
+	}
+
+	appName, appNamespace := app.Name, app.Namespace
+	resources, err := appClient.ManagedResources(ctx, &applicationpkg.ResourcesQuery{
+		ApplicationName: &appName,
+		AppNamespace:    &appNamespace,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the live resources of Application '%s': %w", app.Name, err)
+	}
+
+	items, err := pairLiveResources(app, resources.Items, targets)
+	if err != nil {
+		return nil, err
+	}
+	// After pairing, which sets the namespace of the rendered resources
+	if err := setTrackingMetadata(app, argoSettings, targets); err != nil {
+		return nil, err
+	}
+	return diffLiveItems(app, argoSettings, items)
+}
+
+// setTrackingMetadata sets the tracking metadata Argo CD adds on sync on the rendered resources of an Application
+func setTrackingMetadata(
+	app argoappv1.Application,
+	argoSettings *settingspkg.Settings,
+	targets []unstructured.Unstructured,
+) error {
+	tracking := argo.NewResourceTracking()
+	instanceName := app.InstanceName(argoSettings.ControllerNamespace)
+	for i := range targets {
+		err := tracking.SetAppInstance(&targets[i], argoSettings.AppLabelKey, instanceName,
+			app.Spec.Destination.Namespace, argoappv1.TrackingMethod(argoSettings.GetTrackingMethod()),
+			argoSettings.GetInstallationID())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pairLiveResources pairs the live resources managed by an Application with its rendered resources.
+// Like `argocd app diff`, Secrets are skipped since their data is not available through the API.
+func pairLiveResources(
+	app argoappv1.Application,
+	liveResources []*argoappv1.ResourceDiff,
+	targets []unstructured.Unstructured,
+) ([]liveItem, error) {
+	byName := map[resourceKey]resourceKey{}
+	for _, res := range liveResources {
+		byName[resourceKey{Group: res.Group, Kind: res.Kind, Name: res.Name}] = resourceKey{
+			Group: res.Group, Kind: res.Kind, Namespace: res.Namespace, Name: res.Name,
+		}
+	}
+
+	targetsByKey := map[resourceKey]*unstructured.Unstructured{}
+	var targetKeys []resourceKey
+	for i := range targets {
+		target := &targets[i]
+		key := newResourceKey(target)
+		// Namespaced resources rendered without a namespace are deployed to the destination namespace
+		if key.Namespace == "" {
+			if liveKey, ok := byName[key]; ok && liveKey.Namespace != "" {
+				key.Namespace = app.Spec.Destination.Namespace
+				target.SetNamespace(key.Namespace)
+			}
+		}
+		if isSecret(key) {
+			continue
+		}
+		targetsByKey[key] = target
+		targetKeys = append(targetKeys, key)
+	}
+
+	var items []liveItem
+	for _, res := range liveResources {
+		key := resourceKey{Group: res.Group, Kind: res.Kind, Namespace: res.Namespace, Name: res.Name}
+		if isSecret(key) {
+			continue
+		}
+		var live *unstructured.Unstructured
+		if res.NormalizedLiveState != "" && res.NormalizedLiveState != "null" {
+			live = &unstructured.Unstructured{}
+			if err := json.Unmarshal([]byte(res.NormalizedLiveState), live); err != nil {
+				return nil, fmt.Errorf("failed to parse the live state of %s: %w", key, err)
+			}
+		}
+		target := targetsByKey[key]
+		delete(targetsByKey, key)
+		if live != nil || target != nil {
+			items = append(items, liveItem{key: key, live: live, target: target})
+		}
+	}
+	for _, key := range targetKeys {
+		if target, ok := targetsByKey[key]; ok {
+			items = append(items, liveItem{key: key, target: target})
+		}
+	}
+	return items, nil
+}
+
+// isSecret returns true for the core Secrets
+func isSecret(key resourceKey) bool {
+	return key.Group == "" && key.Kind == "Secret"
+}
+
+// diffLiveItems returns the resources whose live state differs from the state predicted after a sync,
+// honoring the ignoreDifferences of the Application and the resource overrides of Argo CD
+func diffLiveItems(
+	app argoappv1.Application,
+	argoSettings *settingspkg.Settings,
+	items []liveItem,
+) ([]resourceDiff, error) {
+	overrides := make(map[string]argoappv1.ResourceOverride)
+	for k, v := range argoSettings.ResourceOverrides {
+		overrides[k] = *v
+	}
+	diffConfig, err := argodiff.NewDiffConfigBuilder().
+		WithDiffSettings(app.Spec.IgnoreDifferences, overrides, false, normalizers.IgnoreNormalizerOpts{}).
+		WithTracking(argoSettings.AppLabelKey, argoSettings.TrackingMethod).
+		WithNoCache().
+		WithLogger(logutils.NewLogrusLogger(logutils.NewWithCurrentConfig())).
+		Build()
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []resourceDiff
+	for _, item := range items {
+		if item.target != nil && hook.IsHook(item.target) || item.live != nil && hook.IsHook(item.live) {
+			continue
+		}
+		if item.live == nil || item.target == nil {
+			diffs = append(diffs, resourceDiff{Key: item.key, Old: item.live, New: item.target})
+			continue
+		}
+		result, err := argodiff.StateDiff(item.live, item.target, diffConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to diff %s: %w", item.key, err)
+		}
+		if !result.Modified {
+			continue
+		}
+		predicted := &unstructured.Unstructured{}
+		if err := json.Unmarshal(result.PredictedLive, predicted); err != nil {
+			return nil, err
+		}
+		diffs = append(diffs, resourceDiff{Key: item.key, Old: item.live, New: predicted})
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Key.String() < diffs[j].Key.String()
+	})
+	return diffs, nil
+}
@@ -0,0 +1,75 @@
+package preview
+
+import (
+	"encoding/json"
+	"testing"
+
+	settingspkg "github.com/argoproj/argo-cd/v3/pkg/apiclient/settings"
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newTestLiveResource(t *testing.T, obj unstructured.Unstructured) *argoappv1.ResourceDiff {
+	data, err := json.Marshal(obj.Object)
+	require.NoError(t, err)
+	return &argoappv1.ResourceDiff{
+		Group:               obj.GroupVersionKind().Group,
+		Kind:                obj.GetKind(),
+		Namespace:           obj.GetNamespace(),
+		Name:                obj.GetName(),
+		NormalizedLiveState: string(data),
+	}
+}
+
+// TestDiffLive verifies that the rendered resources are paired with the live ones and diffed like Argo CD does
+func TestDiffLive(t *testing.T) {
+	app := argoappv1.Application{
+		ObjectMeta: metav1.ObjectMeta{Name: "web"},
+		Spec:       argoappv1.ApplicationSpec{Destination: argoappv1.ApplicationDestination{Namespace: "default"}},
+	}
+	argoSettings := &settingspkg.Settings{
+		AppLabelKey:    "app.kubernetes.io/instance",
+		TrackingMethod: string(argoappv1.TrackingMethodLabel),
+	}
+
+	track := func(obj unstructured.Unstructured) unstructured.Unstructured {
+		obj.SetLabels(map[string]string{"app.kubernetes.io/instance": "web"})
+		return obj
+	}
+	live := []*argoappv1.ResourceDiff{
+		newTestLiveResource(t, track(newTestResource("apps/v1", "Deployment", "web",
+			map[string]interface{}{"replicas": int64(2)}))),
+		newTestLiveResource(t, track(newTestResource("v1", "Service", "web",
+			map[string]interface{}{"port": int64(80)}))),
+		newTestLiveResource(t, track(newTestResource("v1", "ConfigMap", "pruned", nil))),
+		newTestLiveResource(t, track(newTestResource("v1", "Secret", "credentials", nil))),
+	}
+
+	service := newTestResource("v1", "Service", "web", map[string]interface{}{"port": int64(80)})
+	// Rendered without a namespace, deployed to the destination namespace
+	service.SetNamespace("")
+	targets := []unstructured.Unstructured{
+		newTestResource("apps/v1", "Deployment", "web", map[string]interface{}{"replicas": int64(3)}),
+		service,
+		newTestResource("v1", "ConfigMap", "added", nil),
+		newTestResource("v1", "Secret", "credentials", map[string]interface{}{"changed": true}),
+	}
+
+	items, err := pairLiveResources(app, live, targets)
+	require.NoError(t, err)
+	require.NoError(t, setTrackingMetadata(app, argoSettings, targets))
+	require.Len(t, items, 4)
+
+	diffs, err := diffLiveItems(app, argoSettings, items)
+	require.NoError(t, err)
+	require.Len(t, diffs, 3)
+	require.Equal(t, "ConfigMap default/added", diffs[0].Key.String())
+	require.Equal(t, diffActionAdded, diffs[0].action())
+	require.Equal(t, "ConfigMap default/pruned", diffs[1].Key.String())
+	require.Equal(t, diffActionRemoved, diffs[1].action())
+	require.Equal(t, "apps/Deployment default/web", diffs[2].Key.String())
+	require.Equal(t, diffActionModified, diffs[2].action())
+	require.Equal(t, int64(3), diffs[2].New.Object["spec"].(map[string]interface{})["replicas"])
+}
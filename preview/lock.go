@@ -0,0 +1,69 @@
+package preview
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// fileLock is an advisory lock on a file, shared by the invocations of the CLI running in parallel on one host.
+// The lock is released when unlocked, or when the process exits.
+type fileLock struct {
+	file *os.File
+}
+
+// tryLock acquires the exclusive lock of a file without waiting, returning false when it is held by another process
+func tryLock(path string) (*fileLock, bool, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o600) // #nosec G304 - path within the cache directory
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to open lock file: %w", err)
+	}
+	acquired, err := lockFile(file)
+	if err != nil || !acquired {
+		_ = file.Close()
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+		return nil, false, nil
+	}
+	return &fileLock{file: file}, true, nil
+}
+
+// unlock releases the lock, a nil lock is valid and does nothing
+func (l *fileLock) unlock() error {
+	if l == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// repoCacheLock is the lock of the repository cache used by the process, repoCacheDir, held until it exits
+var (
+	repoCacheLock *fileLock
+	repoCacheDir  string
+)
+
+// acquireRepoCacheDir returns the directory where the git repositories and Helm charts are cached for the process.
+// The repository service reuses and updates the repositories cloned by earlier invocations in place,
+// so the invocations running in parallel each lock a cache of their own: the first one not in use.
+func acquireRepoCacheDir() (string, error) {
+	if repoCacheLock != nil {
+		return repoCacheDir, nil
+	}
+	base := filepath.Join(getCacheDir(), "repos")
+	if err := os.MkdirAll(base, 0o700); err != nil {
+		return "", fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	for i := 0; ; i++ {
+		dir := filepath.Join(base, strconv.Itoa(i))
+		lock, acquired, err := tryLock(dir + ".lock")
+		if err != nil {
+			return "", err
+		}
+		if acquired {
+			repoCacheLock, repoCacheDir = lock, dir
+			return dir, nil
+		}
+	}
+}
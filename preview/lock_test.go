@@ -0,0 +1,52 @@
+package preview
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestTryLock verifies that a lock is exclusive until it is released
+func TestTryLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.lock")
+
+	lock, acquired, err := tryLock(path)
+	require.NoError(t, err)
+	require.True(t, acquired)
+
+	_, acquired, err = tryLock(path)
+	require.NoError(t, err)
+	require.False(t, acquired)
+
+	require.NoError(t, lock.unlock())
+	other, acquired, err := tryLock(path)
+	require.NoError(t, err)
+	require.True(t, acquired)
+	require.NoError(t, other.unlock())
+}
+
+// TestAcquireRepoCacheDir verifies that the process keeps its cache, and skips the caches locked by others
+func TestAcquireRepoCacheDir(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	t.Cleanup(func() {
+		_ = repoCacheLock.unlock()
+		repoCacheLock, repoCacheDir = nil, ""
+	})
+
+	dir, err := acquireRepoCacheDir()
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(getCacheDir(), "repos", "0"), dir)
+
+	again, err := acquireRepoCacheDir()
+	require.NoError(t, err)
+	require.Equal(t, dir, again)
+
+	// The next invocation gets the next cache
+	lock := repoCacheLock
+	repoCacheLock, repoCacheDir = nil, ""
+	next, err := acquireRepoCacheDir()
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(getCacheDir(), "repos", "1"), next)
+	require.NoError(t, lock.unlock())
+}
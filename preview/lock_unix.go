@@ -0,0 +1,18 @@
+//go:build !windows
+
+package preview
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// lockFile acquires the exclusive flock of an open file without waiting, returning false when it is held
+func lockFile(file *os.File) (bool, error) {
+	err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,347 @@
+package preview
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/argoproj/argo-cd/v3/pkg/apis/application"
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	goyaml "sigs.k8s.io/yaml/goyaml.v3"
+)
+
+// argoCDSchemas are the types of the Argo CD resources whose manifests are checked, by kind. The CRDs of Argo CD are
+// generated from these types.
+var argoCDSchemas = map[string]reflect.Type{
+	applicationKind:                reflect.TypeFor[argoappv1.Application](),
+	application.ApplicationSetKind: reflect.TypeFor[argoappv1.ApplicationSet](),
+	application.AppProjectKind:     reflect.TypeFor[argoappv1.AppProject](),
+}
+
+// jsonUnmarshalerType is the type of the values decoding themselves, e.g. the quantities or the raw JSON
+var jsonUnmarshalerType = reflect.TypeFor[json.Unmarshaler]()
+
+// yamlBooleans are the YAML 1.1 booleans which sigs.k8s.io/yaml decodes as booleans, besides true and false
+var yamlBooleans = []string{"y", "yes", "on", "n", "no", "off"}
+
+// schemaViolation is a field of a manifest not meeting the schema of its Argo CD resource
+type schemaViolation struct {
+	// line is the line of the field in the manifest, from 1
+	line int
+	// resource is the kind and name of the resource
+	resource string
+	message  string
+}
+
+// String formats the violation with its line
+func (v schemaViolation) String() string {
+	return fmt.Sprintf("line %d, %s: %s", v.line, v.resource, v.message)
+}
+
+// schemaError is returned in strict mode when the Argo CD resources of a manifest don't meet their schema
+type schemaError struct {
+	violations []schemaViolation
+}
+
+// Error implements error, listing all the violations of the manifest
+func (e *schemaError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("the Argo CD resources don't meet their schema:")
+	for _, v := range e.violations {
+		sb.WriteString("\n- " + v.String())
+	}
+	return sb.String()
+}
+
+// checkManifestSchemas checks the Applications, ApplicationSets and AppProjects of a manifest against the schema of
+// their type, before they are decoded ignoring the fields which are not known: the unknown fields, e.g. a misplaced
+// or misindented helm block, and the values of the wrong type are reported as warnings with their line, and fail in
+// strict mode. The documents which are not valid YAML are reported by splitManifests.
+func checkManifestSchemas(data []byte, origin string) error {
+	var violations []schemaViolation
+	for _, doc := range readYAMLDocuments(data) {
+		var root goyaml.Node
+		if err := goyaml.Unmarshal(doc.data, &root); err != nil || len(root.Content) == 0 {
+			continue
+		}
+		violations = append(violations, checkDocumentSchema(root.Content[0], doc.line)...)
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	if strictMode {
+		return &schemaError{violations: violations}
+	}
+	for _, v := range violations {
+		log.Warnf("%s:%d: %s: %s", origin, v.line, v.resource, v.message)
+	}
+	return nil
+}
+
+// checkDocumentSchema checks the Argo CD resources of a document: a resource, a List or a JSON array of resources
+func checkDocumentSchema(node *goyaml.Node, line int) []schemaViolation {
+	node = resolveAlias(node)
+	if node.Kind == goyaml.SequenceNode {
+		var violations []schemaViolation
+		for _, item := range node.Content {
+			violations = append(violations, checkDocumentSchema(item, line)...)
+		}
+		return violations
+	}
+	if node.Kind != goyaml.MappingNode {
+		return nil
+	}
+	apiVersion := scalarField(node, "apiVersion")
+	kind := scalarField(node, "kind")
+	if items := mappingField(node, "items"); items != nil && strings.HasSuffix(kind, "List") {
+		return checkDocumentSchema(items, line)
+	}
+	group, _, _ := strings.Cut(apiVersion, "/")
+	schema, ok := argoCDSchemas[kind]
+	if group != application.Group || !ok {
+		return nil
+	}
+
+	resource := kind
+	if metadata := mappingField(node, "metadata"); metadata != nil && scalarField(metadata, "name") != "" {
+		resource += "/" + scalarField(metadata, "name")
+	}
+	var violations []schemaViolation
+	checkNodeSchema(node, schema, "", func(n *goyaml.Node, message string) {
+		violations = append(violations, schemaViolation{line: line + n.Line - 1, resource: resource, message: message})
+	})
+	return violations
+}
+
+// checkNodeSchema checks a YAML node against a type, reporting the unknown fields and the values of the wrong type
+// decoded by encoding/json
+func checkNodeSchema(node *goyaml.Node, t reflect.Type, path string, report func(*goyaml.Node, string)) {
+	node = resolveAlias(node)
+	if node.Kind == goyaml.ScalarNode && node.Tag == "!!null" {
+		return
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Interface || reflect.PointerTo(t).Implements(jsonUnmarshalerType) {
+		return
+	}
+	expected, ok := expectedNodeKind(node, t)
+	if !ok {
+		report(node, fmt.Sprintf("%s must be %s, not %s", fieldName(path), expected, nodeKindName(node)))
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		fields := structFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if key.Value == "<<" {
+				// The merge keys copy the fields of the merged map, or maps
+				merged := []*goyaml.Node{value}
+				if value = resolveAlias(value); value.Kind == goyaml.SequenceNode {
+					merged = value.Content
+				}
+				for _, m := range merged {
+					checkNodeSchema(m, t, path, report)
+				}
+				continue
+			}
+			fieldType, ok := fields[key.Value]
+			if !ok {
+				report(key, unknownFieldMessage(t, path, key.Value))
+				continue
+			}
+			checkNodeSchema(value, fieldType, pathOfKey(path, key.Value), report)
+		}
+	case reflect.Map:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			checkNodeSchema(node.Content[i+1], t.Elem(), pathOfKey(path, node.Content[i].Value), report)
+		}
+	case reflect.Slice, reflect.Array:
+		if node.Kind != goyaml.SequenceNode {
+			// Bytes, encoded in base64
+			return
+		}
+		for i, item := range node.Content {
+			checkNodeSchema(item, t.Elem(), path+"["+strconv.Itoa(i)+"]", report)
+		}
+	}
+}
+
+// expectedNodeKind returns the kind of YAML node a type is decoded from, and whether the node is of that kind
+func expectedNodeKind(node *goyaml.Node, t reflect.Type) (string, bool) {
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map:
+		return "a map", node.Kind == goyaml.MappingNode
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "a string", node.Kind == goyaml.ScalarNode && node.Tag == "!!str"
+		}
+		return "a list", node.Kind == goyaml.SequenceNode
+	case reflect.String:
+		return "a string", node.Kind == goyaml.ScalarNode && (node.Tag == "!!str" || node.Tag == "!!timestamp")
+	case reflect.Bool:
+		return "a boolean", node.Kind == goyaml.ScalarNode && (node.Tag == "!!bool" ||
+			node.Tag == "!!str" && slices.Contains(yamlBooleans, strings.ToLower(node.Value)))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer", node.Kind == goyaml.ScalarNode && node.Tag == "!!int"
+	case reflect.Float32, reflect.Float64:
+		return "a number", node.Kind == goyaml.ScalarNode && (node.Tag == "!!int" || node.Tag == "!!float")
+	}
+	return "", true
+}
+
+// nodeKindName describes the kind of a YAML node in the violations
+func nodeKindName(node *goyaml.Node) string {
+	switch node.Kind {
+	case goyaml.MappingNode:
+		return "a map"
+	case goyaml.SequenceNode:
+		return "a list"
+	}
+	switch node.Tag {
+	case "!!int":
+		return "an integer"
+	case "!!float":
+		return "a number"
+	case "!!bool":
+		return "a boolean"
+	}
+	return "a string"
+}
+
+// unknownFieldMessage reports an unknown field, suggesting the field with a different case, or else the nearest field
+// of a nested type with the same name, such as source.helm for a helm block misplaced in the spec
+func unknownFieldMessage(t reflect.Type, path string, key string) string {
+	message := fmt.Sprintf("unknown field %s", fieldName(pathOfKey(path, key)))
+	for name := range structFields(t) {
+		if strings.EqualFold(name, key) {
+			return fmt.Sprintf("%s, did you mean %s?", message, fieldName(pathOfKey(path, name)))
+		}
+	}
+	if suggestion := nestedFieldPath(t, key, 2); suggestion != "" {
+		if path != "" {
+			suggestion = path + "." + suggestion
+		}
+		return fmt.Sprintf("%s, did you mean %s?", message, fieldName(suggestion))
+	}
+	return message
+}
+
+// nestedFieldPath returns the path of the nearest field with the given name of the struct fields of a type, up to
+// the given depth, in the order of the fields
+func nestedFieldPath(t reflect.Type, key string, depth int) string {
+	type candidate struct {
+		path string
+		t    reflect.Type
+	}
+	var level []candidate
+	for _, name := range sortedStructFields(t) {
+		level = append(level, candidate{path: name, t: structFields(t)[name]})
+	}
+	for ; depth > 0 && len(level) > 0; depth-- {
+		var next []candidate
+		for _, c := range level {
+			fieldType := c.t
+			for fieldType.Kind() == reflect.Pointer {
+				fieldType = fieldType.Elem()
+			}
+			if fieldType.Kind() != reflect.Struct || reflect.PointerTo(fieldType).Implements(jsonUnmarshalerType) {
+				continue
+			}
+			fields := structFields(fieldType)
+			if _, ok := fields[key]; ok {
+				return c.path + "." + key
+			}
+			for _, name := range sortedStructFields(fieldType) {
+				next = append(next, candidate{path: c.path + "." + name, t: fields[name]})
+			}
+		}
+		level = next
+	}
+	return ""
+}
+
+// structFields returns the types of the fields of a struct by JSON name, including the fields of the inlined structs
+func structFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" && (field.Anonymous || strings.Contains(options, "inline")) {
+			inlined := field.Type
+			if inlined.Kind() == reflect.Pointer {
+				inlined = inlined.Elem()
+			}
+			for k, v := range structFields(inlined) {
+				fields[k] = v
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+// sortedStructFields returns the JSON names of the fields of a struct in the order they are declared
+func sortedStructFields(t reflect.Type) []string {
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name != "" && name != "-" && field.IsExported() {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// fieldName quotes the path of a field in the violations
+func fieldName(path string) string {
+	if path == "" {
+		return "the resource"
+	}
+	return strconv.Quote(path)
+}
+
+// resolveAlias returns the node an alias points to, or the node itself
+func resolveAlias(node *goyaml.Node) *goyaml.Node {
+	for node.Kind == goyaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	return node
+}
+
+// mappingField returns the value of a key of a YAML map, nil when not set
+func mappingField(node *goyaml.Node, key string) *goyaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return resolveAlias(node.Content[i+1])
+		}
+	}
+	return nil
+}
+
+// scalarField returns the value of a scalar key of a YAML map, empty when not set
+func scalarField(node *goyaml.Node, key string) string {
+	if value := mappingField(node, key); value != nil && value.Kind == goyaml.ScalarNode {
+		return value.Value
+	}
+	return ""
+}
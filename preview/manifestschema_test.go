@@ -0,0 +1,100 @@
+package preview
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	goyaml "sigs.k8s.io/yaml/goyaml.v3"
+)
+
+const testSchemaManifest = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+data:
+  enabled: true
+---
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: web
+spec:
+  project: default
+  helm:
+    valueFiles: [values-prod.yaml]
+  source:
+    repoURL: https://github.com/example/apps.git
+    path: web
+    Kustomize:
+      namePrefix: web-
+  syncPolicy:
+    automated:
+      prune: yes
+      selfHeal: 1
+  revisionHistoryLimit: ten
+  destination:
+    server: https://kubernetes.default.svc
+    namespace: web
+---
+apiVersion: argoproj.io/v1alpha1
+kind: AppProject
+metadata:
+  name: default
+spec:
+  sourceRepos: "*"
+  roles:
+    - name: ci
+      policies: [p, role:ci, applications, get, "*/*", allow]
+`
+
+// TestCheckManifestSchemas verifies that the unknown fields and the values of the wrong type of the Argo CD
+// resources are reported at their line, the other resources being ignored, and fail in strict mode
+func TestCheckManifestSchemas(t *testing.T) {
+	var violations []schemaViolation
+	for _, doc := range readYAMLDocuments([]byte(testSchemaManifest)) {
+		violations = append(violations, checkDocumentSchema(parseTestNode(t, doc.data), doc.line)...)
+	}
+	require.Equal(t, []schemaViolation{
+		{line: 14, resource: "Application/web", message: `unknown field "spec.helm", did you mean "spec.source.helm"?`},
+		{line: 19, resource: "Application/web",
+			message: `unknown field "spec.source.Kustomize", did you mean "spec.source.kustomize"?`},
+		{line: 24, resource: "Application/web",
+			message: `"spec.syncPolicy.automated.selfHeal" must be a boolean, not an integer`},
+		{line: 25, resource: "Application/web", message: `"spec.revisionHistoryLimit" must be an integer, not a string`},
+		{line: 35, resource: "AppProject/default", message: `"spec.sourceRepos" must be a list, not a string`},
+	}, violations)
+
+	require.NoError(t, checkManifestSchemas([]byte(testSchemaManifest), "apps.yaml"))
+	strictMode = true
+	defer func() { strictMode = false }()
+	err := checkManifestSchemas([]byte(testSchemaManifest), "apps.yaml")
+	require.ErrorContains(t, err, "the Argo CD resources don't meet their schema:\n"+
+		"- line 14, Application/web: unknown field \"spec.helm\", did you mean \"spec.source.helm\"?\n")
+
+	// The merge keys, the JSON arrays and the Lists are checked as well
+	err = checkManifestSchemas([]byte(`[{"apiVersion": "argoproj.io/v1alpha1", "kind": "Application",
+  "metadata": {"name": "web"}, "spec": {"source": {"path": "web"}, "prune": true}}]`),
+		"apps.json")
+	require.EqualError(t, err, "the Argo CD resources don't meet their schema:\n- line 2, Application/web: "+
+		`unknown field "spec.prune", did you mean "spec.syncPolicy.automated.prune"?`)
+	err = checkManifestSchemas([]byte(`apiVersion: v1
+kind: List
+items:
+  - apiVersion: argoproj.io/v1alpha1
+    kind: Application
+    metadata:
+      name: web
+    spec:
+      source:
+        <<: {repoURL: https://github.com/example/apps.git, valueFiles: [values.yaml]}
+`), "list.yaml")
+	require.EqualError(t, err, "the Argo CD resources don't meet their schema:\n- line 10, Application/web: "+
+		`unknown field "spec.source.valueFiles", did you mean "spec.source.helm.valueFiles"?`)
+}
+
+// parseTestNode parses a YAML document into its root node
+func parseTestNode(t *testing.T, data []byte) *goyaml.Node {
+	var root goyaml.Node
+	require.NoError(t, goyaml.Unmarshal(data, &root))
+	return root.Content[0]
+}
@@ -0,0 +1,410 @@
+package preview
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	repoapiclient "github.com/argoproj/argo-cd/v3/reposerver/apiclient"
+	"github.com/argoproj/argo-cd/v3/reposerver/repository"
+	"github.com/argoproj/argo-cd/v3/util/notification/expression"
+	"github.com/argoproj/argo-cd/v3/util/notification/expression/shared"
+	notificationsettings "github.com/argoproj/argo-cd/v3/util/notification/settings"
+	synccommon "github.com/argoproj/gitops-engine/pkg/sync/common"
+	"github.com/argoproj/notifications-engine/pkg/api"
+	"github.com/argoproj/notifications-engine/pkg/services"
+	"github.com/argoproj/notifications-engine/pkg/subscriptions"
+	"github.com/argoproj/notifications-engine/pkg/templates"
+	"github.com/argoproj/notifications-engine/pkg/triggers"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+// Resources holding the notifications settings of Argo CD
+const (
+	notificationsConfigMap = "argocd-notifications-cm"
+	notificationsSecret    = "argocd-notifications-secret"
+)
+
+// NotificationOptions holds the settings of the preview-notifications commands
+type NotificationOptions struct {
+	// AppName restricts the preview to the Application with this name
+	AppName string
+	// Notifications are the files and directories holding the argocd-notifications-cm ConfigMap, and optionally the
+	// argocd-notifications-secret Secret, e.g. an Argo CD namespace export
+	Notifications []string
+	// Triggers restricts the preview to the given triggers, all the triggers of the ConfigMap by default
+	Triggers []string
+	// OperationPhase is the phase of the sync operation the Applications are previewed after, one of:
+	// Succeeded|Running|Failed|Error
+	OperationPhase string
+}
+
+// notificationsConfig holds the triggers, templates and subscriptions of argocd-notifications-cm
+type notificationsConfig struct {
+	cfg       *api.Config
+	context   map[string]string
+	secrets   map[string][]byte
+	triggers  triggers.Service
+	templates templates.Service
+}
+
+// PreviewApplicationNotifications prints the notifications Argo CD would send once the Applications defined in a
+// manifest are synced
+func PreviewApplicationNotifications(filename string, opts NotificationOptions) {
+	previewNotifications(loadApplications(filename), opts)
+}
+
+// PreviewResourceNotifications prints the notifications Argo CD would send once the Applications generated from
+// an ApplicationSet are synced
+func PreviewResourceNotifications(filename string, opts NotificationOptions) {
+	previewNotifications(generateApplications(filename), opts)
+}
+
+// previewNotifications renders the Applications, predicts their status after the sync operation and prints the
+// notifications of the triggers
+func previewNotifications(apps []argoappv1.Application, opts NotificationOptions) {
+	if len(opts.Notifications) == 0 {
+		log.Fatal("--notifications must give the file or directory holding " + notificationsConfigMap)
+	}
+	config, err := loadNotificationsConfig(opts.Notifications)
+	if err != nil {
+		log.Fatal(err)
+	}
+	phase, err := parseOperationPhase(opts.OperationPhase)
+	if err != nil {
+		log.Fatal(err)
+	}
+	repoService, err := newRepoService()
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, app := range apps {
+		if shouldMatch(opts.AppName) && opts.AppName != app.Name {
+			continue
+		}
+		rendered, err := generateAppManifests(repoService, app)
+		if err != nil {
+			log.Fatal(err)
+		}
+		synced, err := syncedApplication(app, rendered, phase, time.Now())
+		if err != nil {
+			log.Fatal(err)
+		}
+		lines, err := config.preview(synced, &offlineNotificationService{repoService: repoService}, opts.Triggers)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, line := range lines {
+			fmt.Println(line)
+		}
+	}
+}
+
+// loadNotificationsConfig reads argocd-notifications-cm and argocd-notifications-secret among the resources of
+// files and directories, the other resources being skipped
+func loadNotificationsConfig(paths []string) (*notificationsConfig, error) {
+	objs, err := loadManifestObjects(paths)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the notifications settings: %w", err)
+	}
+	var configMap *corev1.ConfigMap
+	secret := &corev1.Secret{Data: map[string][]byte{}}
+	for _, obj := range objs {
+		switch {
+		case obj.GroupVersionKind().Group != "":
+		case obj.GetKind() == "ConfigMap" && obj.GetName() == notificationsConfigMap:
+			configMap = &corev1.ConfigMap{}
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, configMap); err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", notificationsConfigMap, err)
+			}
+		case obj.GetKind() == "Secret" && obj.GetName() == notificationsSecret:
+			data, err := secretData(obj)
+			if err != nil {
+				return nil, err
+			}
+			for key, value := range data {
+				secret.Data[key] = []byte(value)
+			}
+		}
+	}
+	if configMap == nil {
+		return nil, fmt.Errorf("no ConfigMap %s found in %s", notificationsConfigMap, strings.Join(paths, ", "))
+	}
+	cfg, err := api.ParseConfig(configMap, secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", notificationsConfigMap, err)
+	}
+	config := &notificationsConfig{cfg: cfg, context: map[string]string{}, secrets: secret.Data}
+	if contextYAML, ok := configMap.Data["context"]; ok {
+		if err := yaml.Unmarshal([]byte(contextYAML), &config.context); err != nil {
+			return nil, fmt.Errorf("failed to parse the context of %s: %w", notificationsConfigMap, err)
+		}
+	}
+	if err := notificationsettings.ApplyLegacyConfig(cfg, config.context, configMap, secret); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", notificationsConfigMap, err)
+	}
+	if config.triggers, err = triggers.NewService(cfg.Triggers); err != nil {
+		return nil, fmt.Errorf("invalid trigger of %s: %w", notificationsConfigMap, err)
+	}
+	if config.templates, err = templates.NewService(cfg.Templates); err != nil {
+		return nil, fmt.Errorf("invalid template of %s: %w", notificationsConfigMap, err)
+	}
+	return config, nil
+}
+
+// parseOperationPhase parses the phase of the sync operation, Succeeded by default
+func parseOperationPhase(phase string) (synccommon.OperationPhase, error) {
+	switch p := synccommon.OperationPhase(phase); p {
+	case "":
+		return synccommon.OperationSucceeded, nil
+	case synccommon.OperationSucceeded, synccommon.OperationRunning, synccommon.OperationFailed,
+		synccommon.OperationError:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown operation phase: %s, must be one of: Succeeded|Running|Failed|Error", phase)
+}
+
+// syncedApplication returns the Application with the status Argo CD would report after a sync operation in the
+// given phase: the predicted status when it succeeded, OutOfSync when it failed
+func syncedApplication(
+	app argoappv1.Application,
+	rendered []renderedSource,
+	phase synccommon.OperationPhase,
+	now time.Time,
+) (argoappv1.Application, error) {
+	predicted, err := predictAppStatus(app, rendered)
+	if err != nil {
+		return app, err
+	}
+	resources, err := parseManifests(allManifests(rendered))
+	if err != nil {
+		return app, err
+	}
+	synced := *app.DeepCopy()
+	syncStatus := argoappv1.SyncStatus{
+		Status:     predicted.Sync.Status,
+		Revision:   predicted.Sync.Revision,
+		Revisions:  predicted.Sync.Revisions,
+		ComparedTo: argoappv1.ComparedTo{Destination: app.Spec.Destination},
+	}
+	if app.Spec.HasMultipleSources() {
+		syncStatus.ComparedTo.Sources = app.Spec.Sources
+	} else if app.Spec.Source != nil {
+		syncStatus.ComparedTo.Source = *app.Spec.Source
+	}
+	if phase != synccommon.OperationSucceeded {
+		syncStatus.Status = argoappv1.SyncStatusCodeOutOfSync
+	}
+	startedAt := metav1.NewTime(now)
+	operationState := &argoappv1.OperationState{
+		Operation: argoappv1.Operation{Sync: &argoappv1.SyncOperation{
+			Revision:  predicted.Sync.Revision,
+			Revisions: predicted.Sync.Revisions,
+		}},
+		Phase:     phase,
+		StartedAt: startedAt,
+		SyncResult: &argoappv1.SyncOperationResult{
+			Revision:  predicted.Sync.Revision,
+			Revisions: predicted.Sync.Revisions,
+			Source:    syncStatus.ComparedTo.Source,
+			Sources:   syncStatus.ComparedTo.Sources,
+		},
+	}
+	switch phase {
+	case synccommon.OperationSucceeded:
+		operationState.Message = "successfully synced (all tasks run)"
+	case synccommon.OperationRunning:
+		operationState.Message = "waiting for completion of hook and resources"
+	default:
+		operationState.Message = "one or more objects failed to apply"
+	}
+	if phase.Completed() {
+		operationState.FinishedAt = &startedAt
+	}
+	synced.Status = argoappv1.ApplicationStatus{
+		Sync:           syncStatus,
+		Health:         predicted.Health,
+		Resources:      predicted.Resources,
+		OperationState: operationState,
+		ReconciledAt:   &startedAt,
+		Summary:        argoappv1.ApplicationSummary{Images: resourceImages(resources)},
+	}
+	return synced, nil
+}
+
+// preview evaluates the triggers on an Application, returning the lines printed for the notifications they send
+// to the subscribed destinations, or once without destination when there is none
+func (c *notificationsConfig) preview(
+	app argoappv1.Application,
+	service *offlineNotificationService,
+	onlyTriggers []string,
+) ([]string, error) {
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&app)
+	if err != nil {
+		return nil, err
+	}
+	obj["apiVersion"], obj["kind"] = applicationAPIVersion, applicationKind
+	destinations := c.cfg.GetGlobalDestinations(app.Labels)
+	destinations.Merge(subscriptions.NewAnnotations(app.Annotations).GetDestinations(
+		c.cfg.DefaultTriggers, c.cfg.ServiceDefaultTriggers))
+	destinations = destinations.Dedup()
+
+	names := onlyTriggers
+	if len(names) == 0 {
+		for name := range c.cfg.Triggers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	var lines []string
+	for _, name := range names {
+		vars := c.vars(obj, service, "")
+		results, err := c.triggers.Run(name, vars)
+		if err != nil {
+			return nil, err
+		}
+		triggered := false
+		for _, result := range results {
+			if !result.Triggered {
+				continue
+			}
+			triggered = true
+			dests := destinations[name]
+			if len(dests) == 0 {
+				dests = []services.Destination{{}}
+			}
+			for _, dest := range dests {
+				notification, err := c.templates.FormatNotification(c.vars(obj, service, dest.Service),
+					result.Templates...)
+				if err != nil {
+					return nil, fmt.Errorf("failed to format notification of trigger '%s' of Application '%s': %w",
+						name, app.Name, err)
+				}
+				data, err := yaml.Marshal(notification)
+				if err != nil {
+					return nil, err
+				}
+				lines = append(lines, fmt.Sprintf("application/%s: %s: %s (%s)",
+					app.Name, name, notificationDestination(dest), strings.Join(result.Templates, ", ")))
+				for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+					lines = append(lines, "  "+line)
+				}
+			}
+		}
+		if !triggered {
+			lines = append(lines, fmt.Sprintf("application/%s: %s: not triggered", app.Name, name))
+		}
+	}
+	return lines, nil
+}
+
+// vars returns the variables of the triggers and templates, as the Argo CD notifications controller sets them
+func (c *notificationsConfig) vars(
+	obj map[string]interface{},
+	service *offlineNotificationService,
+	notificationType string,
+) map[string]interface{} {
+	context := map[string]string{"notificationType": notificationType}
+	for key, value := range c.context {
+		context[key] = value
+	}
+	return expression.Spawn(&unstructured.Unstructured{Object: obj}, service, map[string]interface{}{
+		"app":     obj,
+		"context": context,
+		"secrets": c.secrets,
+	})
+}
+
+// notificationDestination describes the destination of a notification, e.g. slack:team-a
+func notificationDestination(dest services.Destination) string {
+	switch {
+	case dest.Service == "":
+		return "no subscription"
+	case dest.Recipient == "":
+		return dest.Service
+	}
+	return dest.Service + ":" + dest.Recipient
+}
+
+// offlineNotificationService serves the repo functions of the notification templates, e.g.
+// call .repo.GetCommitMetadata, from the repository service instead of the Argo CD API
+type offlineNotificationService struct {
+	repoService *repository.Service
+}
+
+// GetCommitMetadata returns the metadata of a commit of a repository
+func (s *offlineNotificationService) GetCommitMetadata(
+	ctx context.Context,
+	repoURL string,
+	commitSHA string,
+	_ string,
+) (*shared.CommitMetadata, error) {
+	metadata, err := s.repoService.GetRevisionMetadata(ctx, &repoapiclient.RepoServerRevisionMetadataRequest{
+		Repo:     notificationRepository(repoURL),
+		Revision: commitSHA,
+	})
+	if err != nil {
+		return nil, err
+	}
+	commit := &shared.CommitMetadata{Message: metadata.Message, Author: metadata.Author, Tags: metadata.Tags}
+	if metadata.Date != nil {
+		commit.Date = metadata.Date.Time
+	}
+	return commit, nil
+}
+
+// GetAppDetails returns the details of the first source of an Application
+func (s *offlineNotificationService) GetAppDetails(
+	ctx context.Context,
+	app *argoappv1.Application,
+) (*shared.AppDetail, error) {
+	source := app.Spec.GetSourcePtrByIndex(0)
+	if source == nil {
+		return nil, fmt.Errorf("application '%s' has no source", app.Name)
+	}
+	source = source.DeepCopy()
+	if isLocal, localPath, _ := isLocalRepository(source.RepoURL); isLocal {
+		if revision, err := localRevision(localPath); err == nil {
+			source.TargetRevision = revision
+		}
+	}
+	details, err := s.repoService.GetAppDetails(ctx, &repoapiclient.RepoServerAppDetailsQuery{
+		AppName: app.Name,
+		Repo:    notificationRepository(source.RepoURL),
+		Source:  source,
+		NoCache: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	detail := &shared.AppDetail{Type: details.Type, Kustomize: details.Kustomize, Directory: details.Directory}
+	if details.Helm != nil {
+		detail.Helm = &shared.CustomHelmAppSpec{HelmAppSpec: repoapiclient.HelmAppSpec{
+			Name:           details.Helm.Name,
+			ValueFiles:     details.Helm.ValueFiles,
+			Parameters:     details.Helm.Parameters,
+			Values:         details.Helm.Values,
+			FileParameters: details.Helm.FileParameters,
+		}}
+		if source.Helm != nil {
+			detail.Helm.HelmParameterOverrides = source.Helm.Parameters
+		}
+	}
+	return detail, nil
+}
+
+// notificationRepository returns the repository of a URL, the local repository when it is the current one
+func notificationRepository(repoURL string) *argoappv1.Repository {
+	if isLocal, localPath, _ := isLocalRepository(repoURL); isLocal {
+		return &argoappv1.Repository{Repo: fileURL(localPath), Type: "git"}
+	}
+	return remoteRepository(repoURL)
+}
@@ -0,0 +1,100 @@
+package preview
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	synccommon "github.com/argoproj/gitops-engine/pkg/sync/common"
+	"github.com/stretchr/testify/require"
+)
+
+const testNotificationsConfig = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: argocd-notifications-cm
+data:
+  context: |
+    argocdUrl: https://argocd.example.com
+  trigger.on-sync-succeeded: |
+    - send: [app-sync-succeeded]
+      when: app.status.operationState.phase in ['Succeeded']
+  trigger.on-sync-failed: |
+    - send: [app-sync-failed]
+      when: app.status.operationState.phase in ['Error', 'Failed']
+  template.app-sync-succeeded: |
+    message: "{{.context.argocdUrl}}/applications/{{.app.metadata.name}} synced {{.app.status.sync.revision}}"
+  template.app-sync-failed: |
+    message: "{{.app.metadata.name}} failed: {{.secrets.team | toString}}"
+  subscriptions: |
+    - recipients: [slack:deploys]
+      triggers: [on-sync-succeeded]
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: argocd-notifications-secret
+stringData:
+  team: platform
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: other
+`
+
+// TestNotificationsPreview verifies that the triggers of argocd-notifications-cm are evaluated on the synced
+// Application, the notifications being formatted for the subscribed destinations and the secrets
+func TestNotificationsPreview(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notifications.yaml"), []byte(testNotificationsConfig), 0o600))
+	config, err := loadNotificationsConfig([]string{dir})
+	require.NoError(t, err)
+
+	app := argoappv1.Application{}
+	app.Name = "web"
+	app.Annotations = map[string]string{"notifications.argoproj.io/subscribe.on-sync-failed.email": "ops@example.com"}
+	app.Spec.Source = &argoappv1.ApplicationSource{RepoURL: "https://github.com/example/web.git"}
+	app.Spec.Destination.Namespace = "prod"
+	rendered := []renderedSource{{Revision: "abc123", Manifests: []string{
+		`{"apiVersion":"v1","kind":"Service","metadata":{"name":"web"},"spec":{"type":"ClusterIP"}}`,
+	}}}
+
+	synced, err := syncedApplication(app, rendered, synccommon.OperationSucceeded, time.Now())
+	require.NoError(t, err)
+	lines, err := config.preview(synced, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"application/web: on-sync-failed: not triggered",
+		"application/web: on-sync-succeeded: slack:deploys (app-sync-succeeded)",
+		"  message: https://argocd.example.com/applications/web synced abc123",
+	}, lines)
+
+	failed, err := syncedApplication(app, rendered, synccommon.OperationFailed, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, argoappv1.SyncStatusCodeOutOfSync, failed.Status.Sync.Status)
+	lines, err = config.preview(failed, nil, []string{"on-sync-failed"})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"application/web: on-sync-failed: email:ops@example.com (app-sync-failed)",
+		"  message: 'web failed: platform'",
+	}, lines)
+
+	_, err = loadNotificationsConfig([]string{filepath.Join(dir, "missing.yaml")})
+	require.Error(t, err)
+}
+
+// TestParseOperationPhase verifies that the operation phase defaults to Succeeded and that unknown phases are
+// rejected
+func TestParseOperationPhase(t *testing.T) {
+	phase, err := parseOperationPhase("")
+	require.NoError(t, err)
+	require.Equal(t, synccommon.OperationSucceeded, phase)
+	phase, err = parseOperationPhase("Failed")
+	require.NoError(t, err)
+	require.Equal(t, synccommon.OperationFailed, phase)
+	_, err = parseOperationPhase("Terminating")
+	require.Error(t, err)
+}
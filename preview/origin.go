@@ -0,0 +1,81 @@
+package preview
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Annotations recording the origin of a rendered resource
+const (
+	originAnnotationRepo        = "argocd-offline-cli/source-repo"
+	originAnnotationPath        = "argocd-offline-cli/source-path"
+	originAnnotationChart       = "argocd-offline-cli/source-chart"
+	originAnnotationRevision    = "argocd-offline-cli/source-revision"
+	originAnnotationValuesFiles = "argocd-offline-cli/values-files"
+	originAnnotationTemplate    = "argocd-offline-cli/template"
+)
+
+// kustomizeOriginAnnotation is set by Kustomize when the kustomization enables the originAnnotations build metadata
+const kustomizeOriginAnnotation = "config.kubernetes.io/origin"
+
+// annotateOrigins annotates each rendered resource with the source it was generated from: repository, path or
+// chart, resolved revision and Helm values files, along with the template file when known
+func annotateOrigins(rendered []renderedSource) ([]renderedSource, error) {
+	annotated := make([]renderedSource, len(rendered))
+	for i, r := range rendered {
+		origin := map[string]string{
+			originAnnotationRepo:     r.Source.RepoURL,
+			originAnnotationRevision: r.Revision,
+		}
+		if r.Source.Chart != "" {
+			origin[originAnnotationChart] = r.Source.Chart + ":" + r.Source.TargetRevision
+		} else {
+			origin[originAnnotationPath] = r.Source.Path
+		}
+		if r.Source.Helm != nil && len(r.Source.Helm.ValueFiles) > 0 {
+			origin[originAnnotationValuesFiles] = strings.Join(r.Source.Helm.ValueFiles, ",")
+		}
+
+		annotated[i] = r
+		annotated[i].Manifests = make([]string, len(r.Manifests))
+		for j, manifest := range r.Manifests {
+			obj := unstructured.Unstructured{}
+			if err := json.Unmarshal([]byte(manifest), &obj); err != nil {
+				return nil, fmt.Errorf("failed to parse manifest: %w", err)
+			}
+			annotations := obj.GetAnnotations()
+			if annotations == nil {
+				annotations = map[string]string{}
+			}
+			for k, v := range origin {
+				if v != "" {
+					annotations[k] = v
+				}
+			}
+			if template := kustomizeOriginPath(annotations[kustomizeOriginAnnotation]); template != "" {
+				annotations[originAnnotationTemplate] = template
+			}
+			obj.SetAnnotations(annotations)
+			data, err := json.Marshal(obj.Object)
+			if err != nil {
+				return nil, err
+			}
+			annotated[i].Manifests[j] = string(data)
+		}
+	}
+	return annotated, nil
+}
+
+// kustomizeOriginPath returns the path of the file a resource was read from, as recorded by Kustomize
+// in the YAML of its origin annotation
+func kustomizeOriginPath(origin string) string {
+	for _, line := range strings.Split(origin, "\n") {
+		if path, ok := strings.CutPrefix(line, "path: "); ok {
+			return strings.TrimSpace(path)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,49 @@
+package preview
+
+import (
+	"testing"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAnnotateOrigins verifies that the rendered resources are annotated with the source they were generated from
+func TestAnnotateOrigins(t *testing.T) {
+	rendered := []renderedSource{
+		{
+			Source: argoappv1.ApplicationSource{
+				RepoURL:        "https://charts.example.com",
+				Chart:          "web",
+				TargetRevision: "1.2.0",
+				Helm:           &argoappv1.ApplicationSourceHelm{ValueFiles: []string{"values.yaml", "$values/prod.yaml"}},
+			},
+			Revision:  "1.2.0",
+			Manifests: []string{`{"apiVersion":"v1","kind":"Service","metadata":{"name":"web"}}`},
+		},
+		{
+			Source:   argoappv1.ApplicationSource{RepoURL: "https://github.com/example/app.git", Path: "deploy"},
+			Revision: "0123abcd",
+			Manifests: []string{`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"settings",` +
+				`"annotations":{"config.kubernetes.io/origin":"path: base/cm.yaml\n"}}}`},
+		},
+	}
+
+	annotated, err := annotateOrigins(rendered)
+	require.NoError(t, err)
+	resources, err := parseManifests(allManifests(annotated))
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"argocd-offline-cli/source-repo":     "https://charts.example.com",
+		"argocd-offline-cli/source-chart":    "web:1.2.0",
+		"argocd-offline-cli/source-revision": "1.2.0",
+		"argocd-offline-cli/values-files":    "values.yaml,$values/prod.yaml",
+	}, resources[0].GetAnnotations())
+	require.Equal(t, map[string]string{
+		"config.kubernetes.io/origin":        "path: base/cm.yaml\n",
+		"argocd-offline-cli/source-repo":     "https://github.com/example/app.git",
+		"argocd-offline-cli/source-path":     "deploy",
+		"argocd-offline-cli/source-revision": "0123abcd",
+		"argocd-offline-cli/template":        "base/cm.yaml",
+	}, resources[1].GetAnnotations())
+	require.NotContains(t, rendered[0].Manifests[0], "argocd-offline-cli")
+}
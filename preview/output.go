@@ -0,0 +1,278 @@
+package preview
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Files written for each destination cluster
+const (
+	clusterManifestFile = "manifest.yaml"
+	clusterApplyFile    = "apply.yaml"
+	clusterCRDsFile     = "crds.yaml"
+)
+
+// inClusterName is the name given by Argo CD to the cluster it runs in
+const inClusterName = "in-cluster"
+
+// inClusterServer is the server URL of the cluster Argo CD runs in
+const inClusterServer = "https://kubernetes.default.svc"
+
+// Spool files of the streams of a cluster, until all the Applications are rendered
+const (
+	clusterApplyHeadSpool = ".apply.yaml.head"
+	clusterApplyTailSpool = ".apply.yaml.tail"
+	clusterCRDsSpool      = ".crds.yaml"
+)
+
+// clusterOutput writes the rendered resources grouped by destination cluster:
+// - <dir>/<cluster>/<app>/manifest.yaml holds the resources of each Application
+// - <dir>/<cluster>/apply.yaml holds the resources of all the Applications of the cluster, in apply order
+// - <dir>/<cluster>/crds.yaml holds the CustomResourceDefinitions of the cluster instead of apply.yaml, when split
+//
+// The resources are written as each Application is rendered rather than held in memory until the end of the run:
+// the streams of a cluster are spooled to its directory, and assembled when the output is closed. The spool files
+// are only open while an Application is written, so the number of clusters is not bound by the limit of open files.
+type clusterOutput struct {
+	dir       string
+	splitCRDs bool
+	clusters  map[string]*clusterStreams
+	// names are the directory names of the clusters, which must not collide on case-insensitive file systems
+	names *fileNames
+}
+
+// clusterStreams are the streams of a cluster being written
+type clusterStreams struct {
+	// head holds the Namespaces and CustomResourceDefinitions, applied first, and tail the other resources
+	head *spoolFile
+	tail *spoolFile
+	// crds is the stream of the CustomResourceDefinitions when split, nil until the cluster has one
+	crds *spoolFile
+}
+
+// newClusterOutput creates the output directory, which must be empty unless the run is resumed
+func newClusterOutput(dir string, resume bool, splitCRDs bool) (*clusterOutput, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(entries) > 0 && !resume {
+		return nil, fmt.Errorf("output directory %s is not empty", dir)
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+	return &clusterOutput{
+		dir:       outputDirPath(dir),
+		splitCRDs: splitCRDs,
+		clusters:  map[string]*clusterStreams{},
+		names:     newFileNames(),
+	}, nil
+}
+
+// add writes the resources of an Application to the directory of its destination cluster
+func (o *clusterOutput) add(app argoappv1.Application, resources []unstructured.Unstructured) error {
+	if app.Spec.Destination.Server == "" && app.Spec.Destination.Name == "" {
+		return fmt.Errorf("application '%s' has no destination cluster", app.Name)
+	}
+	cluster := o.names.unique(clusterDirName(app.Spec.Destination))
+	dir := filepath.Join(o.dir, cluster, appFileName(app))
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	// The stream is applied outside of Argo CD, the namespaced resources get the destination namespace
+	resources = slices.Clone(resources)
+	for i := range resources {
+		if resources[i].GetNamespace() == "" && isNamespacedResource(&resources[i]) {
+			resources[i] = *resources[i].DeepCopy()
+			resources[i].SetNamespace(app.Spec.Destination.Namespace)
+		}
+	}
+	manifest, err := manifestStream(resources)
+	if err != nil {
+		return err
+	}
+	if err := writeOutputFile(filepath.Join(dir, clusterManifestFile), []byte(manifest)); err != nil {
+		return fmt.Errorf("failed to write manifests of Application '%s': %w", app.Name, err)
+	}
+	if err := o.appendStreams(cluster, resources); err != nil {
+		return fmt.Errorf("failed to write streams of cluster %s: %w", cluster, err)
+	}
+	return nil
+}
+
+// appendStreams appends the resources of an Application to the streams of its cluster
+func (o *clusterOutput) appendStreams(cluster string, resources []unstructured.Unstructured) error {
+	streams, err := o.streamsOf(cluster)
+	if err != nil {
+		return err
+	}
+	if o.splitCRDs {
+		var crds []unstructured.Unstructured
+		crds, resources = splitCRDs(resources)
+		if len(crds) > 0 {
+			if streams.crds == nil {
+				if streams.crds, err = createSpoolFile(filepath.Join(o.dir, cluster, clusterCRDsSpool)); err != nil {
+					return err
+				}
+			}
+			if err := writeManifestStream(streams.crds, crds); err != nil {
+				return err
+			}
+		}
+	}
+	first, rest := splitApplyFirst(resources)
+	if err := writeManifestStream(streams.head, first); err != nil {
+		return err
+	}
+	return writeManifestStream(streams.tail, rest)
+}
+
+// streamsOf returns the streams of a cluster, created for its first Application
+func (o *clusterOutput) streamsOf(cluster string) (*clusterStreams, error) {
+	if streams, ok := o.clusters[cluster]; ok {
+		return streams, nil
+	}
+	head, err := createSpoolFile(filepath.Join(o.dir, cluster, clusterApplyHeadSpool))
+	if err != nil {
+		return nil, err
+	}
+	tail, err := createSpoolFile(filepath.Join(o.dir, cluster, clusterApplyTailSpool))
+	if err != nil {
+		return nil, err
+	}
+	streams := &clusterStreams{head: head, tail: tail}
+	o.clusters[cluster] = streams
+	return streams, nil
+}
+
+// close writes the apply stream of each cluster, returning the clusters
+func (o *clusterOutput) close() ([]string, error) {
+	clusters := make([]string, 0, len(o.clusters))
+	for cluster := range o.clusters {
+		clusters = append(clusters, cluster)
+	}
+	sort.Strings(clusters)
+	for _, cluster := range clusters {
+		streams := o.clusters[cluster]
+		if streams.crds != nil {
+			if err := writeSpooledStream(filepath.Join(o.dir, cluster, clusterCRDsFile), streams.crds); err != nil {
+				return nil, fmt.Errorf("failed to write CRD stream of cluster %s: %w", cluster, err)
+			}
+		}
+		apply := filepath.Join(o.dir, cluster, clusterApplyFile)
+		if err := writeSpooledStream(apply, streams.head, streams.tail); err != nil {
+			return nil, fmt.Errorf("failed to write apply stream of cluster %s: %w", cluster, err)
+		}
+	}
+	return clusters, nil
+}
+
+// writeSpooledStream writes an output file holding the content of the spool files, in order
+func writeSpooledStream(filename string, spools ...*spoolFile) error {
+	file, err := createOutputFile(filename)
+	if err != nil {
+		return err
+	}
+	for _, spool := range spools {
+		if err = spool.copyTo(file); err != nil {
+			break
+		}
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// printClusterOutput closes the output and prints the streams of each cluster, in apply order
+func printClusterOutput(o *clusterOutput) error {
+	clusters, err := o.close()
+	if err != nil {
+		return err
+	}
+	for _, cluster := range clusters {
+		fmt.Printf("cluster/%s: %s\n", cluster, strings.Join(o.streams(cluster), " "))
+	}
+	return nil
+}
+
+// streams returns the files of the streams of a cluster, in apply order
+func (o *clusterOutput) streams(cluster string) []string {
+	var files []string
+	if streams, ok := o.clusters[cluster]; ok && streams.crds != nil {
+		files = append(files, outputFileName(filepath.Join(o.dir, cluster, clusterCRDsFile)))
+	}
+	return append(files, outputFileName(filepath.Join(o.dir, cluster, clusterApplyFile)))
+}
+
+// writeManifestStream writes the YAML stream of the resources, sorted by key
+func writeManifestStream(w io.Writer, resources []unstructured.Unstructured) error {
+	stream, err := manifestStream(resources)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, stream)
+	return err
+}
+
+// splitCRDs separates the CustomResourceDefinitions from the other resources: applied in the same stream, their
+// custom resources fail with "no matches for kind" until the definitions are established
+func splitCRDs(resources []unstructured.Unstructured) ([]unstructured.Unstructured, []unstructured.Unstructured) {
+	var crds, rest []unstructured.Unstructured
+	for _, resource := range resources {
+		if resource.GetKind() == "CustomResourceDefinition" {
+			crds = append(crds, resource)
+		} else {
+			rest = append(rest, resource)
+		}
+	}
+	return crds, rest
+}
+
+// splitApplyFirst separates the Namespaces and CustomResourceDefinitions, applied first so that the apply stream
+// can be applied at once, from the other resources
+func splitApplyFirst(
+	resources []unstructured.Unstructured,
+) ([]unstructured.Unstructured, []unstructured.Unstructured) {
+	var first, rest []unstructured.Unstructured
+	for _, resource := range resources {
+		switch resource.GetKind() {
+		case "Namespace", "CustomResourceDefinition":
+			first = append(first, resource)
+		default:
+			rest = append(rest, resource)
+		}
+	}
+	return first, rest
+}
+
+// clusterDirName returns the directory name of a destination cluster: the name of the known cluster it designates
+// by name, server or alias, else its name when set, in-cluster for the cluster Argo CD runs in, and the host of its
+// server URL otherwise
+func clusterDirName(destination argoappv1.ApplicationDestination) string {
+	if c := lookupCluster(currentClusters, destination); c != nil && c.Name != "" {
+		destination = argoappv1.ApplicationDestination{Name: c.Name}
+	}
+	name := destination.Name
+	switch {
+	case name != "":
+	case isInClusterDestination(destination):
+		name = inClusterName
+	default:
+		name = destination.Server
+		if u, err := url.Parse(destination.Server); err == nil && u.Host != "" {
+			name = u.Host + u.Path
+		}
+	}
+	return safeFileName(name)
+}
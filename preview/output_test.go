@@ -0,0 +1,201 @@
+package preview
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// TestClusterDirName verifies the directory names of the destination clusters
+func TestClusterDirName(t *testing.T) {
+	tests := []struct {
+		destination argoappv1.ApplicationDestination
+		expected    string
+	}{
+		{argoappv1.ApplicationDestination{Name: "prod-eu"}, "prod-eu"},
+		{argoappv1.ApplicationDestination{Server: "https://kubernetes.default.svc"}, "in-cluster"},
+		{argoappv1.ApplicationDestination{Server: "https://10.0.0.1:6443"}, "10.0.0.1_6443"},
+		{argoappv1.ApplicationDestination{Server: "https://rancher.example.com/k8s/clusters/c-1"},
+			"rancher.example.com_k8s_clusters_c-1"},
+		{argoappv1.ApplicationDestination{Name: ".."}, "_"},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.expected, clusterDirName(tt.destination))
+	}
+
+	// The known clusters are grouped under their name, whichever name, server or alias the Applications use
+	defer func(clusters []destinationCluster) { currentClusters = clusters }(currentClusters)
+	currentClusters = []destinationCluster{{Name: "prod", Server: "https://prod.example.com", Aliases: []string{"eu"}}}
+	require.Equal(t, "prod", clusterDirName(argoappv1.ApplicationDestination{Server: "https://prod.example.com/"}))
+	require.Equal(t, "prod", clusterDirName(argoappv1.ApplicationDestination{Name: "eu"}))
+	require.Equal(t, "in-cluster",
+		clusterDirName(argoappv1.ApplicationDestination{Server: "https://kubernetes.default.svc:443"}))
+}
+
+// TestClusterOutput verifies that the resources are written by cluster and Application, with an apply stream
+// per cluster
+func TestClusterOutput(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "out")
+	newApp := func(name string, cluster string) argoappv1.Application {
+		return argoappv1.Application{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: argoappv1.ApplicationSpec{Destination: argoappv1.ApplicationDestination{
+				Name: cluster, Namespace: "apps",
+			}},
+		}
+	}
+	namespace := unstructured.Unstructured{}
+	namespace.SetAPIVersion("v1")
+	namespace.SetKind("Namespace")
+	namespace.SetName("web")
+
+	output, err := newClusterOutput(dir, false, false)
+	require.NoError(t, err)
+	require.NoError(t, output.add(newApp("web", "prod"), []unstructured.Unstructured{
+		newTestResource("apps/v1", "Deployment", "web", nil),
+		namespace,
+	}))
+	configMap := newTestResource("v1", "ConfigMap", "api", nil)
+	configMap.SetNamespace("")
+	require.NoError(t, output.add(newApp("api", "prod"), []unstructured.Unstructured{configMap}))
+	require.NoError(t, output.add(newApp("web", "staging"), []unstructured.Unstructured{
+		newTestResource("apps/v1", "Deployment", "web", nil),
+	}))
+	require.ErrorContains(t, output.add(argoappv1.Application{ObjectMeta: metav1.ObjectMeta{Name: "none"}}, nil),
+		"has no destination cluster")
+	clusters, err := output.close()
+	require.NoError(t, err)
+	require.Equal(t, []string{"prod", "staging"}, clusters)
+
+	for _, file := range []string{"prod/web/manifest.yaml", "prod/api/manifest.yaml", "staging/web/manifest.yaml"} {
+		require.FileExists(t, filepath.Join(dir, file))
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "prod", "apply.yaml"))
+	require.NoError(t, err)
+	var kinds, namespaces []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if kind, ok := strings.CutPrefix(line, "kind: "); ok {
+			kinds = append(kinds, kind)
+		}
+		if namespace, ok := strings.CutPrefix(line, "  namespace: "); ok {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	// The Namespaces come first, the other resources in the order of the Applications
+	require.Equal(t, []string{"Namespace", "Deployment", "ConfigMap"}, kinds)
+	// The namespaced resources without namespace get the destination namespace
+	require.Equal(t, []string{"default", "apps"}, namespaces)
+	// The spool files of the apply stream are removed
+	entries, err := os.ReadDir(filepath.Join(dir, "prod"))
+	require.NoError(t, err)
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	require.ElementsMatch(t, []string{"api", "web", "apply.yaml"}, names)
+
+	// The output directory of another run must be empty
+	_, err = newClusterOutput(dir, false, false)
+	require.ErrorContains(t, err, "is not empty")
+	_, err = newClusterOutput(dir, true, false)
+	require.NoError(t, err)
+}
+
+// TestClusterOutputSplitsCRDs verifies that the CustomResourceDefinitions of a cluster are written to a stream of
+// their own, applied before the stream of the other resources
+func TestClusterOutputSplitsCRDs(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "out")
+	newApp := func(name string, cluster string) argoappv1.Application {
+		return argoappv1.Application{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       argoappv1.ApplicationSpec{Destination: argoappv1.ApplicationDestination{Name: cluster}},
+		}
+	}
+	crd := newTestResource("apiextensions.k8s.io/v1", "CustomResourceDefinition", "certificates.cert-manager.io", nil)
+	crd.SetNamespace("")
+
+	output, err := newClusterOutput(dir, false, true)
+	require.NoError(t, err)
+	require.NoError(t, output.add(newApp("cert-manager", "prod"), []unstructured.Unstructured{
+		crd,
+		newTestResource("apps/v1", "Deployment", "cert-manager", nil),
+	}))
+	require.NoError(t, output.add(newApp("web", "prod"), []unstructured.Unstructured{
+		newTestResource("cert-manager.io/v1", "Certificate", "web", nil),
+	}))
+	require.NoError(t, output.add(newApp("web", "staging"), []unstructured.Unstructured{
+		newTestResource("apps/v1", "Deployment", "web", nil),
+	}))
+	clusters, err := output.close()
+	require.NoError(t, err)
+	require.Equal(t, []string{"prod", "staging"}, clusters)
+
+	require.Equal(t, []string{filepath.Join(dir, "prod", "crds.yaml"), filepath.Join(dir, "prod", "apply.yaml")},
+		output.streams("prod"))
+	crds, err := os.ReadFile(filepath.Join(dir, "prod", "crds.yaml"))
+	require.NoError(t, err)
+	require.Contains(t, string(crds), "name: certificates.cert-manager.io")
+	require.NotContains(t, string(crds), "kind: Deployment")
+	resources, err := os.ReadFile(filepath.Join(dir, "prod", "apply.yaml"))
+	require.NoError(t, err)
+	require.NotContains(t, string(resources), "kind: CustomResourceDefinition")
+	require.Contains(t, string(resources), "kind: Certificate")
+
+	// A cluster without CustomResourceDefinitions only has its apply stream
+	require.Equal(t, []string{filepath.Join(dir, "staging", "apply.yaml")}, output.streams("staging"))
+	require.NoFileExists(t, filepath.Join(dir, "staging", "crds.yaml"))
+}
+
+// TestClusterOutputEncrypted verifies that the streams are encrypted when the output is, the spool files included,
+// each Application appended to the spool files being decrypted in order
+func TestClusterOutputEncrypted(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	outputRecipients = []age.Recipient{identity.Recipient()}
+	t.Cleanup(func() { outputRecipients = nil })
+
+	dir := filepath.Join(t.TempDir(), "out")
+	app := argoappv1.Application{
+		ObjectMeta: metav1.ObjectMeta{Name: "web"},
+		Spec:       argoappv1.ApplicationSpec{Destination: argoappv1.ApplicationDestination{Name: "prod"}},
+	}
+	secret := newTestResource("v1", "Secret", "web", nil)
+	output, err := newClusterOutput(dir, false, true)
+	require.NoError(t, err)
+	require.NoError(t, output.add(app, []unstructured.Unstructured{secret}))
+	spool, err := os.ReadFile(filepath.Join(dir, "prod", clusterApplyTailSpool))
+	require.NoError(t, err)
+	require.NotContains(t, string(spool), "Secret")
+	app.Name = "api"
+	crd := newTestResource("apiextensions.k8s.io/v1", "CustomResourceDefinition", "certificates.cert-manager.io", nil)
+	require.NoError(t, output.add(app, []unstructured.Unstructured{newTestResource("v1", "Secret", "api", nil), crd}))
+
+	_, err = output.close()
+	require.NoError(t, err)
+	require.Equal(t, []string{filepath.Join(dir, "prod", "crds.yaml.age"), filepath.Join(dir, "prod", "apply.yaml.age")},
+		output.streams("prod"))
+	require.NoFileExists(t, filepath.Join(dir, "prod", clusterApplyTailSpool))
+	require.NoFileExists(t, filepath.Join(dir, "prod", clusterCRDsSpool))
+	decrypt := func(file string) string {
+		data, err := os.ReadFile(filepath.Join(dir, "prod", file))
+		require.NoError(t, err)
+		r, err := age.Decrypt(bytes.NewReader(data), identity)
+		require.NoError(t, err)
+		plain, err := io.ReadAll(r)
+		require.NoError(t, err)
+		return string(plain)
+	}
+	plain := decrypt("apply.yaml.age")
+	require.Contains(t, plain, "kind: Secret\nmetadata:\n  name: web")
+	require.Contains(t, plain, "kind: Secret\nmetadata:\n  name: api")
+	require.Contains(t, decrypt("crds.yaml.age"), "name: certificates.cert-manager.io")
+}
@@ -0,0 +1,139 @@
+package preview
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/yaml"
+)
+
+// overridesFile maps Application names to the overrides of their spec applied before rendering
+type overridesFile struct {
+	Applications map[string]appOverride `json:"applications"`
+}
+
+// appOverride overrides the sources of an Application, like `argocd app set` would
+type appOverride struct {
+	// Source is the index of the source to override in a multi-source Application, all the sources by default
+	Source *int `json:"source,omitempty"`
+	// TargetRevision replaces the target revision of the source
+	TargetRevision string `json:"targetRevision,omitempty"`
+	Helm           struct {
+		// Parameters are set on the source, replacing the parameters with the same name
+		Parameters []argoappv1.HelmParameter `json:"parameters,omitempty"`
+	} `json:"helm,omitempty"`
+	Kustomize struct {
+		// Images are set on the source, replacing the images with the same name
+		Images []argoappv1.KustomizeImage `json:"images,omitempty"`
+	} `json:"kustomize,omitempty"`
+	Plugin struct {
+		// Env entries are set on the plugin sources, replacing the entries with the same name, and passed to the
+		// plugin prefixed with ARGOCD_ENV_
+		Env argoappv1.Env `json:"env,omitempty"`
+	} `json:"plugin,omitempty"`
+}
+
+// loadOverrides reads an overrides file, an empty path returns no overrides
+func loadOverrides(filename string) (map[string]appOverride, error) {
+	if !shouldMatch(filename) {
+		return nil, nil
+	}
+	data, err := os.ReadFile(filename) // #nosec G304 - user provided overrides file
+	if err != nil {
+		return nil, fmt.Errorf("failed to read overrides file: %w", err)
+	}
+	var file overridesFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse overrides file %s: %w", filename, err)
+	}
+	return file.Applications, nil
+}
+
+// applyOverrides applies the overrides to the Applications with the same name, warning about the overrides
+// matching no Application
+func applyOverrides(apps []argoappv1.Application, overrides map[string]appOverride) error {
+	used := map[string]bool{}
+	for i := range apps {
+		override, ok := overrides[apps[i].Name]
+		if !ok {
+			continue
+		}
+		used[apps[i].Name] = true
+		if err := override.apply(&apps[i]); err != nil {
+			return err
+		}
+		log.Infof("Overrides applied to Application '%s'", apps[i].Name)
+	}
+
+	var unused []string
+	for name := range overrides {
+		if !used[name] {
+			unused = append(unused, name)
+		}
+	}
+	sort.Strings(unused)
+	for _, name := range unused {
+		log.Warnf("Overrides of Application '%s' match no Application", name)
+	}
+	return nil
+}
+
+// apply applies the override to the selected sources of an Application
+func (o appOverride) apply(app *argoappv1.Application) error {
+	var sources []*argoappv1.ApplicationSource
+	if app.Spec.HasMultipleSources() {
+		for i := range app.Spec.Sources {
+			sources = append(sources, &app.Spec.Sources[i])
+		}
+	} else if app.Spec.Source != nil {
+		sources = append(sources, app.Spec.Source)
+	}
+	if o.Source != nil {
+		if *o.Source < 0 || *o.Source >= len(sources) {
+			return fmt.Errorf("overrides of Application '%s' select source %d, but it has %d source(s)",
+				app.Name, *o.Source, len(sources))
+		}
+		sources = sources[*o.Source : *o.Source+1]
+	}
+
+	if len(o.Plugin.Env) > 0 && !slices.ContainsFunc(sources, func(source *argoappv1.ApplicationSource) bool {
+		return source.Plugin != nil
+	}) {
+		return fmt.Errorf("overrides of Application '%s' set plugin env, but it has no plugin source", app.Name)
+	}
+	for _, source := range sources {
+		if o.TargetRevision != "" {
+			source.TargetRevision = o.TargetRevision
+		}
+		// Sources only referenced for their values files are not rendered
+		if source.Ref != "" && source.Path == "" && source.Chart == "" {
+			continue
+		}
+		if len(o.Helm.Parameters) > 0 {
+			if source.Helm == nil {
+				source.Helm = &argoappv1.ApplicationSourceHelm{}
+			}
+			for _, p := range o.Helm.Parameters {
+				source.Helm.AddParameter(p)
+			}
+		}
+		if len(o.Kustomize.Images) > 0 && source.Chart == "" {
+			if source.Kustomize == nil {
+				source.Kustomize = &argoappv1.ApplicationSourceKustomize{}
+			}
+			for _, image := range o.Kustomize.Images {
+				source.Kustomize.MergeImage(image)
+			}
+		}
+		if source.Plugin != nil {
+			for _, entry := range o.Plugin.Env {
+				source.Plugin.AddEnvEntry(&argoappv1.EnvEntry{Name: entry.Name, Value: entry.Value})
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package preview
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const testOverrides = `applications:
+  web:
+    targetRevision: release-1.25
+    helm:
+      parameters:
+        - name: image.tag
+          value: "1.25"
+        - name: replicas
+          value: "3"
+  api:
+    kustomize:
+      images:
+        - nginx:1.25
+  multi:
+    source: 1
+    targetRevision: v2
+  tanka:
+    plugin:
+      env:
+        - name: TANKA_ENV
+          value: prod-eu
+        - name: REGION
+          value: eu-west-1
+  unknown:
+    targetRevision: v1
+`
+
+// TestApplyOverrides verifies that the overrides are applied to the sources of the matching Applications
+func TestApplyOverrides(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "overrides.yaml")
+	require.NoError(t, os.WriteFile(file, []byte(testOverrides), 0o600))
+	overrides, err := loadOverrides(file)
+	require.NoError(t, err)
+
+	apps := []argoappv1.Application{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "web"},
+			Spec: argoappv1.ApplicationSpec{Source: &argoappv1.ApplicationSource{
+				RepoURL:        "https://charts.example.com",
+				Chart:          "web",
+				TargetRevision: "1.0.0",
+				Helm: &argoappv1.ApplicationSourceHelm{
+					Parameters: []argoappv1.HelmParameter{{Name: "image.tag", Value: "1.24"}, {Name: "debug", Value: "true"}},
+				},
+			}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "api"},
+			Spec: argoappv1.ApplicationSpec{Source: &argoappv1.ApplicationSource{
+				RepoURL: "https://github.com/example/api.git",
+				Path:    "deploy",
+				Kustomize: &argoappv1.ApplicationSourceKustomize{
+					Images: argoappv1.KustomizeImages{"nginx:1.24", "redis:7"},
+				},
+			}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "multi"},
+			Spec: argoappv1.ApplicationSpec{Sources: argoappv1.ApplicationSources{
+				{RepoURL: "https://github.com/example/values.git", TargetRevision: "main", Ref: "values"},
+				{RepoURL: "https://github.com/example/app.git", TargetRevision: "main", Path: "app"},
+			}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "tanka"},
+			Spec: argoappv1.ApplicationSpec{Source: &argoappv1.ApplicationSource{
+				Path: "environments",
+				Plugin: &argoappv1.ApplicationSourcePlugin{
+					Name: "tanka",
+					Env:  argoappv1.Env{{Name: "TANKA_ENV", Value: "default"}, {Name: "DEBUG", Value: "1"}},
+				},
+			}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "untouched"},
+			Spec:       argoappv1.ApplicationSpec{Source: &argoappv1.ApplicationSource{TargetRevision: "main"}},
+		},
+	}
+	require.NoError(t, applyOverrides(apps, overrides))
+
+	require.Equal(t, "release-1.25", apps[0].Spec.Source.TargetRevision)
+	require.Equal(t, []argoappv1.HelmParameter{
+		{Name: "image.tag", Value: "1.25"},
+		{Name: "debug", Value: "true"},
+		{Name: "replicas", Value: "3"},
+	}, apps[0].Spec.Source.Helm.Parameters)
+	require.Equal(t, argoappv1.KustomizeImages{"nginx:1.25", "redis:7"}, apps[1].Spec.Source.Kustomize.Images)
+	require.Equal(t, "main", apps[2].Spec.Sources[0].TargetRevision)
+	require.Equal(t, "v2", apps[2].Spec.Sources[1].TargetRevision)
+	require.Equal(t, argoappv1.Env{
+		{Name: "TANKA_ENV", Value: "prod-eu"},
+		{Name: "DEBUG", Value: "1"},
+		{Name: "REGION", Value: "eu-west-1"},
+	}, apps[3].Spec.Source.Plugin.Env)
+	require.Equal(t, "main", apps[4].Spec.Source.TargetRevision)
+
+	outOfRange := 2
+	err = applyOverrides(apps[2:3], map[string]appOverride{"multi": {Source: &outOfRange}})
+	require.EqualError(t, err, "overrides of Application 'multi' select source 2, but it has 2 source(s)")
+	err = applyOverrides(apps[:1], map[string]appOverride{"web": overrides["tanka"]})
+	require.EqualError(t, err, "overrides of Application 'web' set plugin env, but it has no plugin source")
+}
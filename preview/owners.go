@@ -0,0 +1,163 @@
+package preview
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// unownedTeam is the team the changes matched by no ownership rule are attributed to
+const unownedTeam = "(unowned)"
+
+// ownerRule attributes the matching changes to owners, like a CODEOWNERS line.
+// A rule matches either paths of the repository, or the labels of the changed resources.
+type ownerRule struct {
+	pattern *regexp.Regexp
+	// label and value are set for the "label:key=value" rules
+	label  string
+	value  string
+	owners []string
+}
+
+// loadOwners reads an ownership file in the CODEOWNERS format, the "label:key=value" patterns matching
+// the resources by label, an empty path returns no rules
+func loadOwners(filename string) ([]ownerRule, error) {
+	if !shouldMatch(filename) {
+		return nil, nil
+	}
+	data, err := os.ReadFile(filename) // #nosec G304 - user provided ownership file
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ownership file: %w", err)
+	}
+	var rules []ownerRule
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d of %s has no owner", lineNumber, filename)
+		}
+		rule := ownerRule{owners: fields[1:]}
+		if selector, ok := strings.CutPrefix(fields[0], "label:"); ok {
+			label, value, found := strings.Cut(selector, "=")
+			if !found || label == "" {
+				return nil, fmt.Errorf("line %d of %s has an invalid label pattern '%s', must be label:key=value",
+					lineNumber, filename, fields[0])
+			}
+			rule.label, rule.value = label, value
+		} else {
+			rule.pattern = codeownersPattern(fields[0])
+		}
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+// codeownersPattern converts a CODEOWNERS path pattern to a regular expression matching paths relative to the
+// repository root: a pattern ending with a slash, or whose last segment has no wildcard, matches the files of the
+// directories it matches, and a pattern without a slash matches at any depth. A wildcard of the last segment does
+// not match the nested files, e.g. docs/* does not match docs/api/index.md.
+func codeownersPattern(pattern string) *regexp.Regexp {
+	anchored := strings.Contains(strings.TrimSuffix(pattern, "/"), "/")
+	last := pattern[strings.LastIndex(pattern, "/")+1:]
+	directory := strings.HasSuffix(pattern, "/") || !strings.ContainsAny(last, "*?")
+	pattern = strings.Trim(pattern, "/")
+
+	var expr strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case pattern[i] == '*':
+			expr.WriteString("[^/]*")
+		case pattern[i] == '?':
+			expr.WriteString("[^/]")
+		default:
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	prefix := "^"
+	if !anchored {
+		prefix = "^(.*/)?"
+	}
+	suffix := "$"
+	if directory {
+		suffix = "(/.*)?$"
+	}
+	return regexp.MustCompile(prefix + expr.String() + suffix)
+}
+
+// ownersOf returns the owners of a change, from the last rule matching one of its paths or labels
+func ownersOf(rules []ownerRule, paths []string, labels map[string]string) []string {
+	owners := []string{unownedTeam}
+	for _, rule := range rules {
+		matched := false
+		if rule.pattern == nil {
+			value, ok := labels[rule.label]
+			matched = ok && value == rule.value
+		} else {
+			for _, p := range paths {
+				if rule.pattern.MatchString(p) {
+					matched = true
+					break
+				}
+			}
+		}
+		if matched {
+			owners = rule.owners
+		}
+	}
+	return owners
+}
+
+// ownership counts the changed resources of each Application, by owner
+type ownership map[string]map[string]int
+
+// attribute attributes the diffs of an Application to their owners, given the repository paths of the Application
+func (o ownership) attribute(rules []ownerRule, appName string, paths []string, diffs []resourceDiff) {
+	for _, d := range diffs {
+		obj := d.New
+		if obj == nil {
+			obj = d.Old
+		}
+		for _, owner := range ownersOf(rules, paths, obj.GetLabels()) {
+			if o[owner] == nil {
+				o[owner] = map[string]int{}
+			}
+			o[owner][appName]++
+		}
+	}
+}
+
+// print prints the changed resources of each owner, by Application
+func (o ownership) print(w io.Writer) {
+	if len(o) == 0 {
+		return
+	}
+	owners := make([]string, 0, len(o))
+	for owner := range o {
+		owners = append(owners, owner)
+	}
+	sort.Strings(owners)
+	fmt.Fprintln(w, "Changes by owner:")
+	for _, owner := range owners {
+		var apps []string
+		for app := range o[owner] {
+			apps = append(apps, app)
+		}
+		sort.Strings(apps)
+		counts := make([]string, 0, len(apps))
+		for _, app := range apps {
+			counts = append(counts, fmt.Sprintf("application/%s (%d resource(s))", app, o[owner][app]))
+		}
+		fmt.Fprintf(w, "  %s: %s\n", owner, strings.Join(counts, ", "))
+	}
+}
@@ -0,0 +1,78 @@
+package preview
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const testOwners = `# Default owner
+*                     @platform
+apps/team-a/          @team-a
+/charts/**/values-*.yaml @team-a @release
+label:team=billing    @billing
+`
+
+// TestCodeownersPattern verifies the matching of the CODEOWNERS path patterns
+func TestCodeownersPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		matched bool
+	}{
+		{pattern: "apps/team-a/", path: "apps/team-a/web.yaml", matched: true},
+		{pattern: "apps/team-a", path: "apps/team-a/nested/web.yaml", matched: true},
+		{pattern: "apps/team-a/", path: "other/apps/team-a/web.yaml", matched: false},
+		{pattern: "team-a", path: "other/apps/team-a/web.yaml", matched: true},
+		{pattern: "*.json", path: "apps/web.json", matched: true},
+		{pattern: "apps/*.yaml", path: "apps/team-a/web.yaml", matched: false},
+		{pattern: "/charts/**/values-*.yaml", path: "charts/web/env/values-prod.yaml", matched: true},
+		{pattern: "/charts/**/values-*.yaml", path: "charts/web/values.yaml", matched: false},
+		{pattern: "docs/*", path: "docs/index.md", matched: true},
+		{pattern: "docs/*", path: "docs/api/index.md", matched: false},
+		{pattern: "docs/*/", path: "docs/api/index.md", matched: true},
+		{pattern: "docs/**", path: "docs/api/index.md", matched: true},
+		{pattern: "*", path: "apps/team-a/web.yaml", matched: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.path, func(t *testing.T) {
+			require.Equal(t, tt.matched, codeownersPattern(tt.pattern).MatchString(tt.path))
+		})
+	}
+}
+
+// TestOwnership verifies that the changes are attributed to the owners of the last matching rule
+func TestOwnership(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "OWNERS")
+	require.NoError(t, os.WriteFile(file, []byte(testOwners), 0o600))
+	rules, err := loadOwners(file)
+	require.NoError(t, err)
+	require.Len(t, rules, 4)
+
+	billing := newTestResource("v1", "ConfigMap", "invoices", nil)
+	billing.SetLabels(map[string]string{"team": "billing"})
+	web := newTestResource("v1", "Service", "web", nil)
+	diffs := diffResources(nil, []unstructured.Unstructured{billing, web})
+
+	owners := ownership{}
+	owners.attribute(rules, "web", []string{"apps/team-a/web.yaml", "charts/web"}, diffs)
+	owners.attribute(rules, "api", []string{"apps/api.yaml", "charts/api/values-prod.yaml"}, diffs[1:])
+	owners.attribute(nil, "legacy", []string{"legacy.yaml"}, diffs[1:])
+
+	var out bytes.Buffer
+	owners.print(&out)
+	require.Equal(t, `Changes by owner:
+  (unowned): application/legacy (1 resource(s))
+  @billing: application/web (1 resource(s))
+  @release: application/api (1 resource(s))
+  @team-a: application/api (1 resource(s)), application/web (1 resource(s))
+`, out.String())
+
+	require.NoError(t, os.WriteFile(file, []byte("label:team @team-a\n"), 0o600))
+	_, err = loadOwners(file)
+	require.ErrorContains(t, err, "line 1")
+}
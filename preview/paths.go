@@ -0,0 +1,78 @@
+package preview
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// maxFileNameLength is the length the names of the files written are truncated to, below the 255 bytes most file
+// systems allow for a path element, leaving room for the .yaml, .json and .age suffixes
+const maxFileNameLength = 200
+
+// unsafePathChars matches the characters replaced in the names of the files and directories written
+var unsafePathChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// windowsDrivePath matches the absolute paths of Windows, e.g. C:/Users
+var windowsDrivePath = regexp.MustCompile(`^[A-Za-z]:/`)
+
+// safeFileName returns a name usable as a path element on all the platforms: the unsafe characters are replaced,
+// and a name too long is truncated, a hash of the name keeping it unique
+func safeFileName(name string) string {
+	name = unsafePathChars.ReplaceAllString(name, "_")
+	if name == "." || name == ".." {
+		return "_"
+	}
+	if len(name) <= maxFileNameLength {
+		return name
+	}
+	sum := sha256.Sum256([]byte(name))
+	return name[:maxFileNameLength-17] + "-" + hex.EncodeToString(sum[:8])
+}
+
+// fileNames allocates the names of the files of a directory so that they do not collide on the case-insensitive
+// file systems of Windows and macOS: a name differing from an allocated one by case only gets a numbered suffix.
+type fileNames struct {
+	allocated map[string]string
+	used      map[string]bool
+}
+
+// newFileNames returns the names of the files of a new directory
+func newFileNames() *fileNames {
+	return &fileNames{allocated: map[string]string{}, used: map[string]bool{}}
+}
+
+// unique returns the name allocated to a file, the same for each call with the same name
+func (n *fileNames) unique(name string) string {
+	if allocated, ok := n.allocated[name]; ok {
+		return allocated
+	}
+	allocated := name
+	for i := 2; n.used[strings.ToLower(allocated)]; i++ {
+		allocated = fmt.Sprintf("%s-%d", name, i)
+	}
+	n.allocated[name] = allocated
+	n.used[strings.ToLower(allocated)] = true
+	return allocated
+}
+
+// outputDirPath returns the absolute path of an output directory, the path as is when it cannot be resolved. Go
+// supports the paths longer than MAX_PATH on Windows when they are absolute, not when relative.
+func outputDirPath(dir string) string {
+	if abs, err := filepath.Abs(dir); err == nil {
+		return abs
+	}
+	return dir
+}
+
+// fileURL returns the file URL of a local path, e.g. file:///home/repo or file:///C:/repo on Windows
+func fileURL(path string) string {
+	path = filepath.ToSlash(path)
+	if windowsDrivePath.MatchString(path) {
+		path = "/" + path
+	}
+	return "file://" + path
+}
@@ -0,0 +1,74 @@
+package preview
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestSafeFileName verifies that the names are usable as a path element on all the platforms
+func TestSafeFileName(t *testing.T) {
+	long := strings.Repeat("a", maxFileNameLength+1)
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "safe name", input: "web-prod_1.2", expected: "web-prod_1.2"},
+		{name: "unsafe characters", input: "team/web: prod", expected: "team_web_prod"},
+		{name: "current directory", input: ".", expected: "_"},
+		{name: "parent directory", input: "..", expected: "_"},
+		{name: "maximum length", input: long[1:], expected: long[1:]},
+		{name: "too long", input: long, expected: long[:maxFileNameLength-17] + "-a92efd82109373e5"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual := safeFileName(test.input)
+			require.Equal(t, test.expected, actual)
+			require.LessOrEqual(t, len(actual), maxFileNameLength)
+		})
+	}
+	require.NotEqual(t, safeFileName(long), safeFileName(long+"b"))
+}
+
+// TestFileNamesUnique verifies that the names differing by case only do not collide
+func TestFileNamesUnique(t *testing.T) {
+	tests := []struct {
+		name     string
+		inputs   []string
+		expected []string
+	}{
+		{name: "distinct names", inputs: []string{"web", "api"}, expected: []string{"web", "api"}},
+		{name: "same name", inputs: []string{"web", "web"}, expected: []string{"web", "web"}},
+		{name: "case only", inputs: []string{"web", "Web", "WEB"}, expected: []string{"web", "Web-2", "WEB-3"}},
+		{name: "suffix taken", inputs: []string{"web-2", "web", "Web"}, expected: []string{"web-2", "web", "Web-3"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			names := newFileNames()
+			var actual []string
+			for _, input := range test.inputs {
+				actual = append(actual, names.unique(input))
+			}
+			require.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+// TestFileURL verifies that the file URLs of the Windows paths have an empty host
+func TestFileURL(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{path: "/home/repo", expected: "file:///home/repo"},
+		{path: "C:/repo", expected: "file:///C:/repo"},
+		{path: "d:/work/repo", expected: "file:///d:/work/repo"},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			require.Equal(t, test.expected, fileURL(test.path))
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package preview
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	cmpapiclient "github.com/argoproj/argo-cd/v3/cmpserver/apiclient"
+	"github.com/argoproj/argo-cd/v3/cmpserver/plugin"
+	"github.com/argoproj/argo-cd/v3/common"
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	repoapiclient "github.com/argoproj/argo-cd/v3/reposerver/apiclient"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+)
+
+// pluginsDirName is the directory of the repository cache holding the sockets and work directory of the plugins
+const pluginsDirName = "_plugins"
+
+// currentPlugins are the config management plugins run locally, nil when --plugins is not set
+var currentPlugins []plugin.PluginConfig
+
+// shortenRevision truncates a revision to the given length
+func shortenRevision(revision string, length int) string {
+	if len(revision) > length {
+		return revision[:length]
+	}
+	return revision
+}
+
+// pluginEnv builds the environment passed to a config management plugin for a manifest request,
+// following the same rules as the Argo CD repo server:
+// - the ARGOCD_APP_* build environment, plus KUBE_VERSION and KUBE_API_VERSIONS
+// - the plugin env entries, prefixed with ARGOCD_ENV_ and substituted against the build environment
+// - the plugin parameters, as ARGOCD_APP_PARAMETERS and PARAM_* variables
+func pluginEnv(q *repoapiclient.ManifestRequest) ([]string, error) {
+	revision := q.ApplicationSource.TargetRevision
+	repoURL := q.ApplicationSource.RepoURL
+	if q.Repo != nil {
+		repoURL = q.Repo.Repo
+	}
+	buildEnv := argoappv1.Env{
+		&argoappv1.EnvEntry{Name: "ARGOCD_APP_NAME", Value: q.AppName},
+		&argoappv1.EnvEntry{Name: "ARGOCD_APP_NAMESPACE", Value: q.Namespace},
+		&argoappv1.EnvEntry{Name: "ARGOCD_APP_PROJECT_NAME", Value: q.ProjectName},
+		&argoappv1.EnvEntry{Name: "ARGOCD_APP_REVISION", Value: revision},
+		&argoappv1.EnvEntry{Name: "ARGOCD_APP_REVISION_SHORT", Value: shortenRevision(revision, 7)},
+		&argoappv1.EnvEntry{Name: "ARGOCD_APP_REVISION_SHORT_8", Value: shortenRevision(revision, 8)},
+		&argoappv1.EnvEntry{Name: "ARGOCD_APP_SOURCE_REPO_URL", Value: repoURL},
+		&argoappv1.EnvEntry{Name: "ARGOCD_APP_SOURCE_PATH", Value: q.ApplicationSource.Path},
+		&argoappv1.EnvEntry{Name: "ARGOCD_APP_SOURCE_TARGET_REVISION", Value: q.ApplicationSource.TargetRevision},
+		&argoappv1.EnvEntry{Name: "KUBE_VERSION", Value: q.KubeVersion},
+		&argoappv1.EnvEntry{Name: "KUBE_API_VERSIONS", Value: strings.Join(q.ApiVersions, ",")},
+	}
+	env := buildEnv.Environ()
+
+	plugin := q.ApplicationSource.Plugin
+	if plugin == nil {
+		return env, nil
+	}
+	for _, entry := range plugin.Env {
+		env = append(env, fmt.Sprintf("ARGOCD_ENV_%s=%s", entry.Name, buildEnv.Envsubst(entry.Value)))
+	}
+	paramEnv, err := plugin.Parameters.Environ()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate env vars from plugin parameters: %w", err)
+	}
+	return append(env, paramEnv...), nil
+}
+
+// EnablePlugins loads the ConfigManagementPlugin definitions (the plugin.yaml of the sidecars) found in the given
+// files and directories, so that the plugin sources are rendered locally
+func EnablePlugins(paths []string) {
+	plugins, err := loadPlugins(paths)
+	if err != nil {
+		log.Fatal(err)
+	}
+	currentPlugins = plugins
+}
+
+// loadPlugins loads the ConfigManagementPlugin definitions found in the given files and directories, skipping the
+// other resources
+func loadPlugins(paths []string) ([]plugin.PluginConfig, error) {
+	objs, err := loadManifestObjects(paths)
+	if err != nil {
+		return nil, err
+	}
+	var plugins []plugin.PluginConfig
+	for _, obj := range objs {
+		if obj.GetKind() != plugin.ConfigManagementPluginKind {
+			continue
+		}
+		data, err := json.Marshal(obj.Object)
+		if err != nil {
+			return nil, err
+		}
+		var config plugin.PluginConfig
+		if err := json.Unmarshal(data, &config); err != nil {
+			return nil, fmt.Errorf("invalid ConfigManagementPlugin '%s': %w", obj.GetName(), err)
+		}
+		if err := plugin.ValidatePluginConfig(config); err != nil {
+			return nil, fmt.Errorf("invalid ConfigManagementPlugin '%s': %w", obj.GetName(), err)
+		}
+		plugins = append(plugins, config)
+	}
+	if len(plugins) == 0 {
+		return nil, fmt.Errorf("no ConfigManagementPlugin found in %s", strings.Join(paths, ", "))
+	}
+	return plugins, nil
+}
+
+// startPluginServers serves each plugin with the plugin server of the Argo CD sidecars, on a socket of the
+// directory the repository service discovers the plugins in. The repository service thus passes the build
+// environment, the ARGOCD_ENV_ prefixed env and the parameters to the plugins exactly as in Argo CD.
+// The sockets are created in the repository cache of the invocation, which no other invocation uses.
+func startPluginServers(cacheDir string) error {
+	if len(currentPlugins) == 0 {
+		return nil
+	}
+	dir := filepath.Join(cacheDir, pluginsDirName)
+	// Removes the sockets of the previous invocation
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create plugins directory: %w", err)
+	}
+	for _, env := range []string{common.EnvPluginSockFilePath, common.EnvCMPWorkDir} {
+		if err := os.Setenv(env, dir); err != nil {
+			return err
+		}
+	}
+	for _, config := range currentPlugins {
+		service := plugin.NewService(plugin.CMPServerInitConstants{PluginConfig: config})
+		if err := service.Init(common.GetCMPWorkDir()); err != nil {
+			return fmt.Errorf("failed to initialize plugin '%s': %w", config.Metadata.Name, err)
+		}
+		listener, err := net.Listen("unix", config.Address())
+		if err != nil {
+			return fmt.Errorf("failed to serve plugin '%s': %w", config.Metadata.Name, err)
+		}
+		server := grpc.NewServer(
+			grpc.MaxRecvMsgSize(cmpapiclient.MaxGRPCMessageSize),
+			grpc.MaxSendMsgSize(cmpapiclient.MaxGRPCMessageSize),
+		)
+		cmpapiclient.RegisterConfigManagementPluginServiceServer(server, service)
+		go func() {
+			if err := server.Serve(listener); err != nil {
+				log.Warnf("Plugin '%s' stopped: %v", config.Metadata.Name, err)
+			}
+		}()
+		log.Debugf("Serving plugin '%s' on %s", config.Metadata.Name, config.Address())
+	}
+	return nil
+}
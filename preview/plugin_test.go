@@ -0,0 +1,87 @@
+package preview
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	repoapiclient "github.com/argoproj/argo-cd/v3/reposerver/apiclient"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPluginEnv verifies that the plugin environment follows the Argo CD repo server rules
+func TestPluginEnv(t *testing.T) {
+	value := "bar"
+	env, err := pluginEnv(&repoapiclient.ManifestRequest{
+		AppName:     "my-app",
+		Namespace:   "prod",
+		ProjectName: "applications",
+		Repo:        &argoappv1.Repository{Repo: "https://github.com/example/repo.git"},
+		ApplicationSource: &argoappv1.ApplicationSource{
+			RepoURL:        "https://github.com/example/repo.git",
+			Path:           "deploy",
+			TargetRevision: "0123456789abcdef",
+			Plugin: &argoappv1.ApplicationSourcePlugin{
+				Name: "tanka",
+				Env: argoappv1.Env{
+					&argoappv1.EnvEntry{Name: "TANKA_ENV", Value: "env-$ARGOCD_APP_NAMESPACE"},
+				},
+				Parameters: argoappv1.ApplicationSourcePluginParameters{
+					{Name: "foo", String_: &value},
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+	require.Contains(t, env, "ARGOCD_APP_NAME=my-app")
+	require.Contains(t, env, "ARGOCD_APP_REVISION_SHORT=0123456")
+	require.Contains(t, env, "ARGOCD_APP_REVISION_SHORT_8=01234567")
+	require.Contains(t, env, "ARGOCD_APP_SOURCE_PATH=deploy")
+	require.Contains(t, env, "ARGOCD_ENV_TANKA_ENV=env-prod")
+	require.Contains(t, env, "PARAM_FOO=bar")
+	require.Contains(t, env, `ARGOCD_APP_PARAMETERS=[{"name":"foo","string":"bar"}]`)
+}
+
+// TestLoadPlugins verifies that the ConfigManagementPlugins are loaded, other resources being skipped
+func TestLoadPlugins(t *testing.T) {
+	dir := t.TempDir()
+	writeManifest := func(name string, content string) string {
+		file := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(file, []byte(content), 0o600))
+		return file
+	}
+	valid := writeManifest("plugin.yaml", `apiVersion: argoproj.io/v1alpha1
+kind: ConfigManagementPlugin
+metadata:
+  name: tanka
+spec:
+  version: v1.0
+  generate:
+    command: [tk, show, "environments/${ARGOCD_ENV_TANKA_ENV}", --dangerous-allow-redirect]
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: not-a-plugin
+`)
+	plugins, err := loadPlugins([]string{valid})
+	require.NoError(t, err)
+	require.Len(t, plugins, 1)
+	require.Equal(t, "tanka", plugins[0].Metadata.Name)
+	require.Equal(t, []string{"tk", "show", "environments/${ARGOCD_ENV_TANKA_ENV}", "--dangerous-allow-redirect"},
+		plugins[0].Spec.Generate.Command)
+
+	invalid := writeManifest("invalid.yaml", `apiVersion: argoproj.io/v1alpha1
+kind: ConfigManagementPlugin
+metadata:
+  name: empty
+spec: {}
+`)
+	_, err = loadPlugins([]string{invalid})
+	require.ErrorContains(t, err, "invalid ConfigManagementPlugin 'empty'")
+
+	none := writeManifest("none.yaml", "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n")
+	_, err = loadPlugins([]string{none})
+	require.ErrorContains(t, err, "no ConfigManagementPlugin found")
+}
@@ -0,0 +1,37 @@
+package preview
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Statuses of an Application in the porcelain output
+const (
+	porcelainChanged   = "changed"
+	porcelainUnchanged = "unchanged"
+	porcelainFailed    = "failed"
+)
+
+// printPorcelainLine prints the line of an Application once diffed, made of tab-separated fields: the status, the
+// Application name, the duration in milliseconds and the number of changed resources.
+// The unchanged Applications are skipped when onlyChanged is set.
+func printPorcelainLine(
+	w io.Writer,
+	appName string,
+	start time.Time,
+	diffs []resourceDiff,
+	err error,
+	onlyChanged bool,
+) {
+	status := porcelainUnchanged
+	switch {
+	case err != nil:
+		status = porcelainFailed
+	case len(diffs) > 0:
+		status = porcelainChanged
+	case onlyChanged:
+		return
+	}
+	fmt.Fprintf(w, "%s\t%s\t%d\t%d\n", status, appName, time.Since(start).Milliseconds(), len(diffs))
+}
@@ -0,0 +1,44 @@
+package preview
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestPrintPorcelainLine verifies the fields of the porcelain line of an Application
+func TestPrintPorcelainLine(t *testing.T) {
+	tests := []struct {
+		name     string
+		diffs    []resourceDiff
+		err      error
+		expected []string
+	}{
+		{name: "unchanged", expected: []string{"unchanged", "web", "0"}},
+		{name: "changed", diffs: make([]resourceDiff, 2), expected: []string{"changed", "web", "2"}},
+		{name: "failed", err: errors.New("boom"), expected: []string{"failed", "web", "0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			printPorcelainLine(&out, "web", time.Now(), tt.diffs, tt.err, false)
+			require.True(t, strings.HasSuffix(out.String(), "\n"))
+			fields := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\t")
+			require.Len(t, fields, 4)
+			require.Equal(t, tt.expected, []string{fields[0], fields[1], fields[3]})
+		})
+	}
+}
+
+// TestPrintPorcelainLineOnlyChanged verifies that only the unchanged Applications are left out with onlyChanged
+func TestPrintPorcelainLineOnlyChanged(t *testing.T) {
+	var out bytes.Buffer
+	printPorcelainLine(&out, "web", time.Now(), nil, nil, true)
+	require.Empty(t, out.String())
+	printPorcelainLine(&out, "web", time.Now(), nil, errors.New("boom"), true)
+	require.True(t, strings.HasPrefix(out.String(), "failed\tweb\t"))
+}
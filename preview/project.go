@@ -0,0 +1,287 @@
+package preview
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/argoproj/argo-cd/v3/pkg/apis/application"
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/argoproj/argo-cd/v3/reposerver/repository"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// defaultProjectName is the project name passed to the repository service when no AppProjects are supplied
+const defaultProjectName = "applications"
+
+// defaultControlPlaneNamespace is the namespace of Argo CD, when an AppProject does not set its namespace
+const defaultControlPlaneNamespace = "argocd"
+
+// projectSet holds the supplied AppProjects, by name. A nil projectSet is valid and permits everything.
+type projectSet map[string]*argoappv1.AppProject
+
+// currentProjects are the AppProjects of the ongoing run, nil when --projects is not set
+var currentProjects projectSet
+
+// enableProjects loads the AppProjects the Applications of the run are rendered against
+func enableProjects(paths []string) error {
+	projects, err := loadProjects(paths)
+	if err != nil {
+		return err
+	}
+	currentProjects = projects
+	return nil
+}
+
+// loadProjects loads the AppProjects defined in the given files and directories, skipping the other resources
+func loadProjects(paths []string) (projectSet, error) {
+	objs, err := loadManifestObjects(paths)
+	if err != nil {
+		return nil, err
+	}
+	projects := projectSet{}
+	for _, obj := range objs {
+		gvk := obj.GroupVersionKind()
+		if gvk.Group != application.Group || gvk.Kind != application.AppProjectKind {
+			continue
+		}
+		data, err := json.Marshal(obj.Object)
+		if err != nil {
+			return nil, err
+		}
+		var project argoappv1.AppProject
+		if err := json.Unmarshal(data, &project); err != nil {
+			return nil, fmt.Errorf("invalid AppProject '%s': %w", obj.GetName(), err)
+		}
+		projects[project.Name] = &project
+	}
+	if len(projects) == 0 {
+		return nil, fmt.Errorf("no AppProject found in %v", paths)
+	}
+	return projects, nil
+}
+
+// lookup returns the AppProject of an Application, nil when no AppProjects are supplied
+func (s projectSet) lookup(app argoappv1.Application) (*argoappv1.AppProject, error) {
+	if s == nil {
+		return nil, nil
+	}
+	project, ok := s[app.Spec.GetProject()]
+	if !ok {
+		return nil, fmt.Errorf("application '%s' belongs to AppProject '%s', which was not supplied",
+			app.Name, app.Spec.GetProject())
+	}
+	return project, nil
+}
+
+// requestProject returns the project name and permitted source repositories passed to the repository service,
+// which exposes the name to plugins as ARGOCD_APP_PROJECT_NAME and only lets Helm dependencies be fetched from
+// the permitted repositories
+func (s projectSet) requestProject(app argoappv1.Application) (string, []string) {
+	project, err := s.lookup(app)
+	if project == nil || err != nil {
+		return defaultProjectName, nil
+	}
+	return project.Name, project.Spec.SourceRepos
+}
+
+// checkPermitted returns an error when the AppProject of an Application does not permit its sources,
+// destination or namespace, as the Argo CD controller would refuse to render it
+func (s projectSet) checkPermitted(app argoappv1.Application) error {
+	project, err := s.lookup(app)
+	if project == nil || err != nil {
+		return err
+	}
+	violations := projectViolations(project, app)
+	if len(violations) > 0 {
+		return &projectDenialError{app: app.Name, project: project.Name, violations: violations}
+	}
+	log.Infof("Application '%s' rendered against AppProject '%s'", app.Name, project.Name)
+	return nil
+}
+
+// projectDenialError is returned when the AppProject of an Application does not permit it
+type projectDenialError struct {
+	app        string
+	project    string
+	violations []string
+}
+
+func (e *projectDenialError) Error() string {
+	return fmt.Sprintf("application '%s' is not permitted by AppProject '%s': %s",
+		e.app, e.project, strings.Join(e.violations, ", "))
+}
+
+// projectViolations returns the reasons why an AppProject does not permit an Application
+func projectViolations(project *argoappv1.AppProject, app argoappv1.Application) []string {
+	var violations []string
+	controlPlaneNamespace := project.Namespace
+	if controlPlaneNamespace == "" {
+		controlPlaneNamespace = defaultControlPlaneNamespace
+	}
+	if !project.IsAppNamespacePermitted(&app, controlPlaneNamespace) {
+		violations = append(violations, fmt.Sprintf("Applications are not permitted in namespace '%s'", app.Namespace))
+	}
+	for _, source := range app.Spec.GetSources() {
+		if !project.IsSourcePermitted(source) {
+			violations = append(violations, fmt.Sprintf("repository '%s' is not permitted", source.RepoURL))
+		}
+	}
+	if ok, reason := destinationPermitted(project, app.Spec.Destination, app.Spec.Destination.Namespace); !ok {
+		violations = append(violations, reason)
+	}
+	return violations
+}
+
+// destinationPermitted returns whether an AppProject permits a destination cluster and namespace.
+// Project-scoped clusters can not be listed offline, the destination cluster is assumed to be one of them.
+func destinationPermitted(
+	project *argoappv1.AppProject,
+	destination argoappv1.ApplicationDestination,
+	namespace string,
+) (bool, string) {
+	cluster := &argoappv1.Cluster{Server: destination.Server, Name: destination.Name}
+	permitted, err := project.IsDestinationPermitted(cluster, namespace, func(string) ([]*argoappv1.Cluster, error) {
+		return []*argoappv1.Cluster{cluster}, nil
+	})
+	if err != nil || permitted {
+		return permitted, ""
+	}
+	target := destination.Server
+	if target == "" {
+		target = destination.Name
+	}
+	return false, fmt.Sprintf("destination '%s' namespace '%s' is not permitted", target, namespace)
+}
+
+// newProjectCheck returns a check reporting the Applications and resources not permitted by their AppProject
+func newProjectCheck(projects projectSet) check {
+	return func(app argoappv1.Application, resources []unstructured.Unstructured) []finding {
+		project, err := projects.lookup(app)
+		appKey := resourceKey{Group: application.Group, Kind: applicationKind, Namespace: app.Namespace, Name: app.Name}
+		newFinding := func(resource resourceKey, message string) finding {
+			return finding{
+				RuleID:   "project-permission",
+				Category: categoryProject,
+				App:      app.Name,
+				Resource: resource,
+				Message:  message,
+			}
+		}
+		if err != nil {
+			return []finding{newFinding(appKey, err.Error())}
+		}
+
+		var findings []finding
+		for _, violation := range projectViolations(project, app) {
+			findings = append(findings, newFinding(appKey, violation))
+		}
+		for i := range resources {
+			resource := &resources[i]
+			gvk := resource.GroupVersionKind()
+			namespaced := isNamespacedResource(resource)
+			gk := schema.GroupKind{Group: gvk.Group, Kind: gvk.Kind}
+			if !project.IsGroupKindNamePermitted(gk, resource.GetName(), namespaced) {
+				scope := "cluster-scoped"
+				if namespaced {
+					scope = "namespaced"
+				}
+				findings = append(findings, newFinding(newResourceKey(resource),
+					fmt.Sprintf("%s resource kind %s is not permitted by AppProject '%s'", scope, gk, project.Name)))
+			}
+			namespace := resource.GetNamespace()
+			if namespaced && namespace != "" && namespace != app.Spec.Destination.Namespace {
+				if ok, reason := destinationPermitted(project, app.Spec.Destination, namespace); !ok {
+					findings = append(findings, newFinding(newResourceKey(resource), reason))
+				}
+			}
+		}
+		return findings
+	}
+}
+
+// ProjectImpactOptions holds the settings of the project-impact command
+type ProjectImpactOptions struct {
+	// OldProjects are the files and directories holding the current AppProjects
+	OldProjects []string
+	// NewProjects are the files and directories holding the changed AppProjects
+	NewProjects []string
+	// Render renders the Applications, to also check their resources against the permitted kinds and namespaces
+	Render bool
+}
+
+// ProjectImpact reports the Applications, defined in the given manifest files and directories, which are
+// permitted by the current AppProjects but would no longer be by the changed ones,
+// exiting with status 1 when an Application would become invalid
+func ProjectImpact(paths []string, opts ProjectImpactOptions) {
+	oldProjects, err := loadProjects(opts.OldProjects)
+	if err != nil {
+		log.Fatal(err)
+	}
+	newProjects, err := loadProjects(opts.NewProjects)
+	if err != nil {
+		log.Fatal(err)
+	}
+	manifestFiles, err := expandManifestPaths(paths)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var repoService *repository.Service
+	if opts.Render {
+		if repoService, err = newRepoService(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	checked, invalid := 0, 0
+	oldCheck, newCheck := newProjectCheck(oldProjects), newProjectCheck(newProjects)
+	for _, file := range manifestFiles {
+		for _, app := range loadApplications(file) {
+			project := app.Spec.GetProject()
+			if oldProjects[project] == nil && newProjects[project] == nil {
+				continue
+			}
+			var resources []unstructured.Unstructured
+			if opts.Render {
+				rendered, err := generateAppManifests(repoService, app)
+				if err != nil {
+					log.Fatal(err)
+				}
+				if resources, err = parseManifests(allManifests(rendered)); err != nil {
+					log.Fatal(err)
+				}
+			}
+			checked++
+			denied := newlyDenied(oldCheck(app, resources), newCheck(app, resources))
+			if len(denied) == 0 {
+				continue
+			}
+			invalid++
+			for _, f := range denied {
+				fmt.Printf("application/%s: AppProject %s: %s: %s\n", app.Name, project, f.Resource, f.Message)
+			}
+		}
+	}
+	fmt.Printf("%d of %d Application(s) would become invalid\n", invalid, checked)
+	if invalid > 0 {
+		os.Exit(1)
+	}
+}
+
+// newlyDenied returns the findings of the changed AppProjects which were not reported for the current ones
+func newlyDenied(oldFindings []finding, newFindings []finding) []finding {
+	existing := map[string]bool{}
+	for _, f := range oldFindings {
+		existing[f.Resource.String()+"\n"+f.Message] = true
+	}
+	var denied []finding
+	for _, f := range newFindings {
+		if !existing[f.Resource.String()+"\n"+f.Message] {
+			denied = append(denied, f)
+		}
+	}
+	return denied
+}
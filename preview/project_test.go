@@ -0,0 +1,183 @@
+package preview
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const testProjects = `apiVersion: argoproj.io/v1alpha1
+kind: AppProject
+metadata:
+  name: team-a
+  namespace: argocd
+spec:
+  sourceRepos:
+    - https://github.com/example/team-a-*
+  sourceNamespaces:
+    - team-a
+  destinations:
+    - server: https://kubernetes.default.svc
+      namespace: team-a-*
+  clusterResourceWhitelist:
+    - group: ""
+      kind: Namespace
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: ignored
+`
+
+func newTestProjectApp(name string, namespace string, repoURL string, destination string) argoappv1.Application {
+	return argoappv1.Application{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec: argoappv1.ApplicationSpec{
+			Project: "team-a",
+			Source:  &argoappv1.ApplicationSource{RepoURL: repoURL, Path: "."},
+			Destination: argoappv1.ApplicationDestination{
+				Server:    "https://kubernetes.default.svc",
+				Namespace: destination,
+			},
+		},
+	}
+}
+
+// TestProjectPermissions verifies that Applications are checked against the sources, destinations and
+// source namespaces permitted by their AppProject
+func TestProjectPermissions(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "projects.yaml")
+	require.NoError(t, os.WriteFile(file, []byte(testProjects), 0o600))
+	projects, err := loadProjects([]string{file})
+	require.NoError(t, err)
+	require.Len(t, projects, 1)
+
+	tests := []struct {
+		name     string
+		app      argoappv1.Application
+		expected string
+	}{
+		{
+			name: "permitted",
+			app:  newTestProjectApp("web", "argocd", "https://github.com/example/team-a-web", "team-a-web"),
+		},
+		{
+			name: "permitted source namespace",
+			app:  newTestProjectApp("web", "team-a", "https://github.com/example/team-a-web", "team-a-web"),
+		},
+		{
+			name: "source namespace not permitted",
+			app:  newTestProjectApp("web", "team-b", "https://github.com/example/team-a-web", "team-a-web"),
+			expected: "application 'web' is not permitted by AppProject 'team-a': " +
+				"Applications are not permitted in namespace 'team-b'",
+		},
+		{
+			name: "repository and destination not permitted",
+			app:  newTestProjectApp("web", "argocd", "https://github.com/example/team-b-web", "default"),
+			expected: "application 'web' is not permitted by AppProject 'team-a': " +
+				"repository 'https://github.com/example/team-b-web' is not permitted, " +
+				"destination 'https://kubernetes.default.svc' namespace 'default' is not permitted",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := projects.checkPermitted(tt.app)
+			if tt.expected == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, tt.expected)
+			}
+		})
+	}
+
+	missing := newTestProjectApp("web", "argocd", "https://github.com/example/team-a-web", "team-a-web")
+	missing.Spec.Project = ""
+	require.EqualError(t, projects.checkPermitted(missing),
+		"application 'web' belongs to AppProject 'default', which was not supplied")
+	name, repos := projects.requestProject(missing)
+	require.Equal(t, defaultProjectName, name)
+	require.Nil(t, repos)
+
+	var none projectSet
+	require.NoError(t, none.checkPermitted(missing))
+}
+
+// TestProjectCheck verifies that the resources of kinds and namespaces not permitted are reported
+func TestProjectCheck(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "projects.yaml")
+	require.NoError(t, os.WriteFile(file, []byte(testProjects), 0o600))
+	projects, err := loadProjects([]string{file})
+	require.NoError(t, err)
+
+	app := newTestProjectApp("web", "argocd", "https://github.com/example/team-a-web", "team-a-web")
+	namespace := newTestResource("v1", "Namespace", "team-a-web", nil)
+	namespace.SetNamespace("")
+	clusterRole := newTestResource("rbac.authorization.k8s.io/v1", "ClusterRole", "admin", nil)
+	clusterRole.SetNamespace("")
+	otherNamespace := newTestResource("v1", "ConfigMap", "settings", nil)
+	otherNamespace.SetNamespace("kube-system")
+	resources := []unstructured.Unstructured{namespace, clusterRole, otherNamespace}
+
+	findings := runChecks(app, resources, []check{newProjectCheck(projects)})
+	require.Len(t, findings, 2)
+	require.Equal(t, "ConfigMap kube-system/settings", findings[0].Resource.String())
+	require.Equal(t, "destination 'https://kubernetes.default.svc' namespace 'kube-system' is not permitted",
+		findings[0].Message)
+	require.Equal(t, "rbac.authorization.k8s.io/ClusterRole admin", findings[1].Resource.String())
+	require.Equal(t, "cluster-scoped resource kind ClusterRole.rbac.authorization.k8s.io is not permitted "+
+		"by AppProject 'team-a'", findings[1].Message)
+	require.Equal(t, categoryProject, findings[1].Category)
+}
+
+// TestNewlyDenied verifies that only the violations introduced by the changed AppProjects are reported
+func TestNewlyDenied(t *testing.T) {
+	oldFile := filepath.Join(t.TempDir(), "old.yaml")
+	require.NoError(t, os.WriteFile(oldFile, []byte(testProjects), 0o600))
+	oldProjects, err := loadProjects([]string{oldFile})
+	require.NoError(t, err)
+
+	tightened := oldProjects["team-a"].DeepCopy()
+	tightened.Spec.SourceRepos = []string{"https://github.com/example/team-a-api"}
+	renamed := oldProjects["team-a"].DeepCopy()
+	renamed.Name = "team-b"
+
+	tests := []struct {
+		name        string
+		newProjects projectSet
+		app         argoappv1.Application
+		expected    []string
+	}{
+		{
+			name:        "unchanged",
+			newProjects: oldProjects,
+			app:         newTestProjectApp("web", "argocd", "https://github.com/example/team-a-web", "team-a-web"),
+		},
+		{
+			name:        "already denied",
+			newProjects: projectSet{"team-a": tightened},
+			app:         newTestProjectApp("web", "argocd", "https://github.com/example/team-a-web", "default"),
+			expected:    []string{"repository 'https://github.com/example/team-a-web' is not permitted"},
+		},
+		{
+			name:        "project removed",
+			newProjects: projectSet{"team-b": renamed},
+			app:         newTestProjectApp("web", "argocd", "https://github.com/example/team-a-web", "team-a-web"),
+			expected:    []string{"application 'web' belongs to AppProject 'team-a', which was not supplied"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			denied := newlyDenied(newProjectCheck(oldProjects)(tt.app, nil), newProjectCheck(tt.newProjects)(tt.app, nil))
+			var messages []string
+			for _, f := range denied {
+				messages = append(messages, f.Message)
+			}
+			require.Equal(t, tt.expected, messages)
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package preview
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/argoproj/argo-cd/v3/pkg/apis/application"
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/downloader"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/repo"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// errChartUnsigned is returned when a chart is published without a provenance file
+var errChartUnsigned = errors.New("no provenance file is published")
+
+// notFoundStatus matches the status of the errors of the Helm HTTP getter for a file which is not found, the only
+// ones meaning that the chart is not signed: the getter does not return the status code otherwise
+var notFoundStatus = regexp.MustCompile(` : 404( |$)`)
+
+// Provenance statuses of a Helm chart in a run report
+const (
+	provenanceSigned       = "signed"
+	provenanceUnsigned     = "unsigned"
+	provenanceUnverifiable = "unverifiable"
+)
+
+// chartVerification is the result of the provenance verification of a chart
+type chartVerification struct {
+	// chart is the chart, version and repository URL
+	chart string
+	// signedBy is the identity of the key which signed the chart, when verified
+	signedBy string
+	err      error
+}
+
+// status returns the provenance status of the chart: signed, unsigned or unverifiable
+func (v chartVerification) status() string {
+	switch {
+	case v.err == nil:
+		return provenanceSigned
+	case errors.Is(v.err, errChartUnsigned):
+		return provenanceUnsigned
+	default:
+		return provenanceUnverifiable
+	}
+}
+
+// message describes why the chart is not signed or cannot be verified
+func (v chartVerification) message() string {
+	if v.status() == provenanceUnsigned {
+		return fmt.Sprintf("chart %s is not signed, %v", v.chart, v.err)
+	}
+	return fmt.Sprintf("chart %s cannot be verified: %v", v.chart, v.err)
+}
+
+// chartProvenance is the provenance status of a Helm chart of an Application in a run report
+type chartProvenance struct {
+	// Chart is the chart, version and repository URL
+	Chart string `json:"chart"`
+	// Status is signed, unsigned or unverifiable
+	Status   string `json:"status"`
+	SignedBy string `json:"signedBy,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// provenanceVerifier verifies the provenance of the Helm charts of the Applications against a keyring, each chart
+// once. A nil provenanceVerifier verifies nothing.
+type provenanceVerifier struct {
+	keyring string
+	// enforce fails the Applications whose charts are unsigned or unverifiable, instead of warning
+	enforce       bool
+	verifications map[string]chartVerification
+}
+
+// newProvenanceVerifier returns the verifier of the provenance of the Helm charts, nil when no keyring is given
+func newProvenanceVerifier(keyring string, enforce bool) *provenanceVerifier {
+	if !shouldMatch(keyring) {
+		return nil
+	}
+	return &provenanceVerifier{keyring: keyring, enforce: enforce, verifications: map[string]chartVerification{}}
+}
+
+// verify returns the provenance verification of each Helm chart source of an Application
+func (v *provenanceVerifier) verify(app argoappv1.Application) []chartVerification {
+	if v == nil {
+		return nil
+	}
+	var verifications []chartVerification
+	for _, source := range app.Spec.GetSources() {
+		if source.Chart == "" {
+			continue
+		}
+		chart := chartName(source)
+		verification, ok := v.verifications[chart]
+		if !ok {
+			signedBy, err := verifyChartProvenance(source, v.keyring)
+			verification = chartVerification{chart: chart, signedBy: signedBy, err: err}
+			v.verifications[chart] = verification
+			if err == nil {
+				log.Infof("Chart %s is signed by %s", chart, signedBy)
+			}
+		}
+		verifications = append(verifications, verification)
+	}
+	return verifications
+}
+
+// check verifies the provenance of the Helm charts of an Application before it is rendered. The unsigned and
+// unverifiable charts are logged as warnings, or returned as an error when enforced.
+func (v *provenanceVerifier) check(app argoappv1.Application) error {
+	var messages []string
+	for _, verification := range v.verify(app) {
+		if verification.err != nil {
+			messages = append(messages, verification.message())
+		}
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+	if !v.enforce {
+		for _, message := range messages {
+			log.Warnf("Application '%s': %s", app.Name, message)
+		}
+		return nil
+	}
+	return fmt.Errorf("provenance of Application '%s' not verified: %s", app.Name, strings.Join(messages, "; "))
+}
+
+// report returns the provenance status of the Helm charts of an Application for the run report, leaving out the
+// charts not verified, e.g. of an Application not permitted by its AppProject
+func (v *provenanceVerifier) report(app argoappv1.Application) []chartProvenance {
+	if v == nil {
+		return nil
+	}
+	var provenance []chartProvenance
+	for _, source := range app.Spec.GetSources() {
+		verification, ok := v.verifications[chartName(source)]
+		if source.Chart == "" || !ok {
+			continue
+		}
+		entry := chartProvenance{Chart: verification.chart, Status: verification.status(), SignedBy: verification.signedBy}
+		if verification.err != nil {
+			entry.Error = verification.err.Error()
+		}
+		provenance = append(provenance, entry)
+	}
+	return provenance
+}
+
+// chartName returns the chart, version and repository URL of a Helm chart source
+func chartName(source argoappv1.ApplicationSource) string {
+	return fmt.Sprintf("%s:%s of %s", source.Chart, source.TargetRevision, source.RepoURL)
+}
+
+// newProvenanceCheck returns a check verifying the provenance of the Helm charts of the Applications against a
+// keyring. Unless enforced, the unsigned and unverifiable charts are advisory findings.
+func newProvenanceCheck(keyring string, enforce bool) check {
+	verifier := newProvenanceVerifier(keyring, enforce)
+	return func(app argoappv1.Application, _ []unstructured.Unstructured) []finding {
+		appKey := resourceKey{Group: application.Group, Kind: applicationKind, Namespace: app.Namespace, Name: app.Name}
+		var findings []finding
+		for _, verification := range verifier.verify(app) {
+			if verification.err == nil {
+				continue
+			}
+			findings = append(findings, finding{
+				RuleID:   "chart-" + verification.status(),
+				Category: categoryProvenance,
+				App:      app.Name,
+				Resource: appKey,
+				Message:  verification.message(),
+				Advisory: !enforce,
+			})
+		}
+		return findings
+	}
+}
+
+// verifyChartProvenance downloads a chart of a Helm repository along with its provenance file, and verifies its
+// signature against a keyring, returning the identity of the signing key. The archive verified is downloaded apart
+// from the one the repository service renders, from the same repository index.
+func verifyChartProvenance(source argoappv1.ApplicationSource, keyring string) (string, error) {
+	if u, err := url.Parse(source.RepoURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", errors.New("the provenance of charts of OCI registries is not supported")
+	}
+	settings := cli.New()
+	getters := getter.All(settings)
+	username, password := FindRepoUsername(source.RepoURL), FindRepoPassword(source.RepoURL)
+	chartURL, err := repo.FindChartInAuthAndTLSAndPassRepoURL(source.RepoURL, username, password,
+		source.Chart, source.TargetRevision, "", "", "", false, false, getters)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(chartURL)
+	if err != nil {
+		return "", err
+	}
+	g, err := getters.ByScheme(u.Scheme)
+	if err != nil {
+		return "", err
+	}
+	dir, err := os.MkdirTemp("", "argocd-offline-cli-chart-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+	chartFile := filepath.Join(dir, path.Base(u.Path))
+	options := []getter.Option{getter.WithBasicAuth(username, password)}
+	data, err := g.Get(chartURL, options...)
+	if err != nil {
+		return "", fmt.Errorf("failed to download chart: %w", err)
+	}
+	if err := os.WriteFile(chartFile, data.Bytes(), 0o600); err != nil {
+		return "", err
+	}
+	// Like Helm, the provenance file is expected next to the chart archive
+	data, err = g.Get(chartURL+".prov", options...)
+	if err != nil && notFoundStatus.MatchString(err.Error()) {
+		return "", errChartUnsigned
+	} else if err != nil {
+		return "", fmt.Errorf("failed to download provenance file: %w", err)
+	}
+	if err := os.WriteFile(chartFile+".prov", data.Bytes(), 0o600); err != nil {
+		return "", err
+	}
+
+	verification, err := downloader.VerifyChart(chartFile, keyring)
+	if err != nil {
+		return "", err
+	}
+	var identities []string
+	for name := range verification.SignedBy.Identities {
+		identities = append(identities, name)
+	}
+	return strings.Join(identities, ", "), nil
+}
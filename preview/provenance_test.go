@@ -0,0 +1,126 @@
+package preview
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// testChartIndex is the index of the test chart repository, serving a signed and an unsigned chart
+const testChartIndex = `apiVersion: v1
+entries:
+  signtest:
+  - name: signtest
+    version: 0.1.0
+    urls: [signtest-0.1.0.tgz]
+  local-subchart:
+  - name: local-subchart
+    version: 0.1.0
+    urls: [local-subchart-0.1.0.tgz]
+  protected:
+  - name: protected
+    version: 0.1.0
+    urls: [protected/signtest-0.1.0.tgz]
+`
+
+// TestProvenanceCheck verifies the findings of the signed, unsigned and unverifiable charts, a provenance file which
+// cannot be downloaded making the chart unverifiable rather than unsigned
+func TestProvenanceCheck(t *testing.T) {
+	t.Setenv("HELM_CACHE_HOME", t.TempDir())
+	files := http.FileServer(http.Dir("../testdata/charts"))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/index.yaml" {
+			fmt.Fprint(w, testChartIndex)
+			return
+		}
+		if protected, found := strings.CutPrefix(r.URL.Path, "/protected"); found {
+			if strings.HasSuffix(protected, ".prov") {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			r.URL.Path = protected
+		}
+		files.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	keyring := "../testdata/charts/helm-test-key.pub"
+	chart := func(name string) argoappv1.ApplicationSource {
+		return argoappv1.ApplicationSource{RepoURL: server.URL, Chart: name, TargetRevision: "0.1.0"}
+	}
+
+	tests := []struct {
+		name     string
+		source   argoappv1.ApplicationSource
+		keyring  string
+		expected []string
+		message  string
+	}{
+		{name: "signed", source: chart("signtest"), keyring: keyring},
+		{name: "unsigned", source: chart("local-subchart"), keyring: keyring, expected: []string{"chart-unsigned"}},
+		{name: "forbidden provenance", source: chart("protected"), keyring: keyring,
+			expected: []string{"chart-unverifiable"}, message: "403 Forbidden"},
+		{name: "unknown key", source: chart("signtest"), keyring: "../testdata/repositories.yaml",
+			expected: []string{"chart-unverifiable"}},
+		{name: "oci", source: argoappv1.ApplicationSource{
+			RepoURL: "ghcr.io/example/charts", Chart: "app", TargetRevision: "1.0.0",
+		}, keyring: keyring, expected: []string{"chart-unverifiable"}},
+		{name: "not a chart", source: argoappv1.ApplicationSource{
+			RepoURL: "https://github.com/example/repo.git", Path: "app",
+		}, keyring: keyring},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := argoappv1.Application{
+				ObjectMeta: metav1.ObjectMeta{Name: "app"},
+				Spec:       argoappv1.ApplicationSpec{Source: &tt.source},
+			}
+			findings := newProvenanceCheck(tt.keyring, false)(app, nil)
+			var rules []string
+			for _, f := range findings {
+				require.Equal(t, categoryProvenance, f.Category)
+				require.True(t, f.Advisory)
+				rules = append(rules, f.RuleID)
+				require.Contains(t, f.Message, tt.message)
+			}
+			require.Equal(t, tt.expected, rules)
+		})
+	}
+
+	// Enforced, the findings are not advisory
+	source := chart("local-subchart")
+	app := argoappv1.Application{Spec: argoappv1.ApplicationSpec{Source: &source}}
+	findings := newProvenanceCheck(keyring, true)(app, nil)
+	require.Len(t, findings, 1)
+	require.False(t, findings[0].Advisory)
+
+	// Rendering, the unsigned charts fail the Application when enforced, and their status is reported
+	signed, unsigned := chart("signtest"), chart("local-subchart")
+	app = argoappv1.Application{
+		ObjectMeta: metav1.ObjectMeta{Name: "app"},
+		Spec:       argoappv1.ApplicationSpec{Sources: argoappv1.ApplicationSources{signed, unsigned}},
+	}
+	verifier := newProvenanceVerifier(keyring, false)
+	require.Empty(t, verifier.report(app))
+	require.NoError(t, verifier.check(app))
+	provenance := verifier.report(app)
+	require.Len(t, provenance, 2)
+	require.Equal(t, provenanceSigned, provenance[0].Status)
+	require.NotEmpty(t, provenance[0].SignedBy)
+	require.Equal(t, provenanceUnsigned, provenance[1].Status)
+	require.Equal(t, "local-subchart:0.1.0 of "+server.URL, provenance[1].Chart)
+	require.Contains(t, provenance[1].Error, "no provenance file is published")
+	require.ErrorContains(t, newProvenanceVerifier(keyring, true).check(app),
+		"provenance of Application 'app' not verified: chart local-subchart:0.1.0 of "+server.URL+" is not signed")
+
+	var none *provenanceVerifier
+	require.NoError(t, none.check(app))
+	require.Nil(t, none.report(app))
+	require.Nil(t, newProvenanceVerifier("", true))
+}
@@ -0,0 +1,205 @@
+package preview
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	log "github.com/sirupsen/logrus"
+)
+
+// currentRenderedOutput is the check of the output of Helm and Kustomize of the ongoing run, nil until the
+// repository service is created
+var currentRenderedOutput *renderedOutputCheck
+
+// errMissingKind is returned for a rendered document which is not a Kubernetes resource
+var errMissingKind = errors.New("not a resource: kind is missing")
+
+// enableRenderedOutputOnce installs the check of the rendered output once, for the commands creating several
+// repository services
+var enableRenderedOutputOnce sync.Once
+
+// renderedOutputCheck splits the output of the helm template and kustomize build commands into documents when the
+// repository service fails to generate the manifests of an Application, to report every invalid document along
+// with its source and index instead of the first parsing error of the repository service.
+//
+// The command lines and their output are captured through a logrus hook like the values schema check: the Argo CD
+// exec utilities log the command line at info level, and its output at debug level once it completes.
+type renderedOutputCheck struct {
+	mu sync.Mutex
+	// source is the source of the Application being rendered
+	source string
+	// commands are the rendering commands started and not completed yet, by execID
+	commands map[string]renderedOutput
+	outputs  []renderedOutput
+}
+
+// renderedOutput is the output of a rendering command
+type renderedOutput struct {
+	source  string
+	command string
+	output  string
+}
+
+// renderedDocumentsError is returned when the output of Helm or Kustomize holds invalid documents
+type renderedDocumentsError struct {
+	app     string
+	outputs []renderedOutput
+	errs    [][]*documentError
+}
+
+// Error implements error, listing all the invalid documents with their source and their index in the output
+func (e *renderedDocumentsError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "invalid documents rendered for Application '%s':", e.app)
+	for i, output := range e.outputs {
+		for _, err := range e.errs[i] {
+			fmt.Fprintf(&sb, "\n- %s, %s: %v", output.source, output.command, err)
+		}
+	}
+	return sb.String()
+}
+
+// Unwrap returns the errors of the documents
+func (e *renderedDocumentsError) Unwrap() []error {
+	var errs []error
+	for _, outputErrs := range e.errs {
+		for _, err := range outputErrs {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// enableRenderedOutputCheck starts capturing the output of the commands run by the repository service
+func enableRenderedOutputCheck() {
+	enableRenderedOutputOnce.Do(func() {
+		check := &renderedOutputCheck{commands: map[string]renderedOutput{}}
+		captureCommandLines(check)
+		currentRenderedOutput = check
+	})
+}
+
+// start forgets the output captured so far, before rendering another Application
+func (c *renderedOutputCheck) start() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.source = ""
+	c.commands = map[string]renderedOutput{}
+	c.outputs = nil
+}
+
+// startSource attributes the commands run from now on to a source of the Application
+func (c *renderedOutputCheck) startSource(source *argoappv1.ApplicationSource) {
+	if c == nil || source == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if source.Chart != "" {
+		c.source = fmt.Sprintf("chart %s of %s", source.Chart, source.RepoURL)
+	} else {
+		c.source = fmt.Sprintf("path %s of %s", source.Path, source.RepoURL)
+	}
+}
+
+// stop returns the error listing the invalid documents of the output captured since start, nil when there is none.
+// The duplicate keys are not reported, the repository service resolving them like Argo CD does.
+func (c *renderedOutputCheck) stop(app argoappv1.Application) error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	docErr := &renderedDocumentsError{app: app.Name}
+	for _, output := range c.outputs {
+		if invalid := invalidRenderedDocuments(output.output); len(invalid) > 0 {
+			docErr.outputs = append(docErr.outputs, output)
+			docErr.errs = append(docErr.errs, invalid)
+		}
+	}
+	c.commands = map[string]renderedOutput{}
+	c.outputs = nil
+	if len(docErr.outputs) == 0 {
+		return nil
+	}
+	return docErr
+}
+
+// invalidRenderedDocuments returns the errors of the documents of an output which the repository service fails to
+// parse: the documents which are not valid YAML, and the ones which are not Kubernetes resources
+func invalidRenderedDocuments(output string) []*documentError {
+	var errs []*documentError
+	index := 0
+	for _, doc := range readYAMLDocuments([]byte(output)) {
+		obj, err := parseYAMLDocument(doc)
+		if obj == nil && err == nil {
+			continue
+		}
+		index++
+		if errors.Is(err, errDuplicateKeys) {
+			err = nil
+		}
+		if err == nil && obj.GetKind() == "" {
+			err = errMissingKind
+		}
+		if err != nil {
+			errs = append(errs, &documentError{index: index, line: doc.line, err: err})
+		}
+	}
+	return errs
+}
+
+// Levels implements log.Hook
+func (c *renderedOutputCheck) Levels() []log.Level {
+	return []log.Level{log.InfoLevel, log.DebugLevel}
+}
+
+// Fire implements log.Hook, it records the rendering commands logged by the Argo CD exec utilities, then their output
+func (c *renderedOutputCheck) Fire(entry *log.Entry) error {
+	execID, ok := entry.Data["execID"].(string)
+	if !ok {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry.Level == log.InfoLevel {
+		if command, ok := renderingCommand(entry.Message); ok {
+			c.commands[execID] = renderedOutput{source: c.source, command: command}
+		}
+		return nil
+	}
+	output, ok := c.commands[execID]
+	_, completed := entry.Data["duration"]
+	if !ok || !completed {
+		return nil
+	}
+	delete(c.commands, execID)
+	output.output = entry.Message
+	c.outputs = append(c.outputs, output)
+	return nil
+}
+
+// renderingCommand returns the tool and subcommand of a helm template or kustomize build command line, the
+// arguments being separated by spaces. Returns false for the other commands.
+func renderingCommand(commandLine string) (string, bool) {
+	args := strings.Split(commandLine, " ")
+	if len(args) < 2 {
+		return "", false
+	}
+	tool := filepath.Base(args[0])
+	switch {
+	case tool == "helm" && args[1] == "template":
+	case strings.HasPrefix(tool, "kustomize") && args[1] == "build":
+		tool = "kustomize"
+	default:
+		return "", false
+	}
+	return tool + " " + args[1], true
+}
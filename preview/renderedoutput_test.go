@@ -0,0 +1,82 @@
+package preview
+
+import (
+	"errors"
+	"testing"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fireCommand fires the log entries of a command run by the Argo CD exec utilities, with its output
+func fireCommand(t *testing.T, c *renderedOutputCheck, execID string, commandLine string, output string) {
+	entry := log.NewEntry(log.StandardLogger()).WithFields(log.Fields{"execID": execID, "dir": "/tmp/repo"})
+	entry.Level, entry.Message = log.InfoLevel, commandLine
+	require.NoError(t, c.Fire(entry))
+	entry = log.NewEntry(log.StandardLogger()).WithFields(log.Fields{"execID": execID, "duration": 1})
+	entry.Level, entry.Message = log.DebugLevel, output
+	require.NoError(t, c.Fire(entry))
+}
+
+// TestRenderedOutputCheck verifies that every invalid document of the output of Helm and Kustomize is reported with
+// its source and index, the valid documents and the other commands being ignored
+func TestRenderedOutputCheck(t *testing.T) {
+	app := argoappv1.Application{ObjectMeta: metav1.ObjectMeta{Name: "app"}}
+	c := &renderedOutputCheck{commands: map[string]renderedOutput{}}
+	c.start()
+
+	c.startSource(&argoappv1.ApplicationSource{RepoURL: "https://charts.example.com", Chart: "web"})
+	fireCommand(t, c, "a", "helm template . --name-template app",
+		"kind: ConfigMap\nmetadata:\n  name: ok\n---\nkind: ConfigMap\nmetadata:\n  name: [bad\n---\n- item\n")
+	fireCommand(t, c, "b", "git rev-parse HEAD", "kind: [bad\n")
+	c.startSource(&argoappv1.ApplicationSource{RepoURL: "https://git.example.com/repo", Path: "overlays/prod"})
+	fireCommand(t, c, "c", "/usr/local/bin/kustomize-v5.4.2 build /tmp/repo/overlays/prod",
+		"kind: ConfigMap\nmetadata:\n  name: a\n  name: b\n---\nkind: Secret\ndata: \xff\n---\nmetadata:\n  name: c\n")
+
+	err := c.stop(app)
+	require.Error(t, err)
+	var docErrs *renderedDocumentsError
+	require.True(t, errors.As(err, &docErrs))
+	require.Len(t, docErrs.Unwrap(), 4)
+	require.Contains(t, err.Error(), "invalid documents rendered for Application 'app':\n"+
+		"- chart web of https://charts.example.com, helm template: document 2 (line 5): ")
+	require.Contains(t, err.Error(), "\n- chart web of https://charts.example.com, helm template: document 3 (line 9): "+
+		"not a resource")
+	require.Contains(t, err.Error(), "\n- path overlays/prod of https://git.example.com/repo, kustomize build: "+
+		"document 2 (line 6): ")
+	require.Contains(t, err.Error(), "kustomize build: document 3 (line 9): not a resource: kind is missing")
+	require.NotContains(t, err.Error(), "document 1")
+
+	// The output is forgotten once reported
+	require.NoError(t, c.stop(app))
+
+	var nilCheck *renderedOutputCheck
+	nilCheck.start()
+	nilCheck.startSource(&argoappv1.ApplicationSource{})
+	require.NoError(t, nilCheck.stop(app))
+}
+
+// TestRenderingCommand verifies the recognition of the rendering command lines
+func TestRenderingCommand(t *testing.T) {
+	tests := []struct {
+		commandLine string
+		expected    string
+	}{
+		{commandLine: "helm template . --name-template app", expected: "helm template"},
+		{commandLine: "/usr/bin/helm template .", expected: "helm template"},
+		{commandLine: "kustomize build /tmp/repo", expected: "kustomize build"},
+		{commandLine: "/opt/kustomize-v5.4.2 build /tmp/repo", expected: "kustomize build"},
+		{commandLine: "helm dependency build"},
+		{commandLine: "kustomize edit set nameprefix -- app-"},
+		{commandLine: "git"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.commandLine, func(t *testing.T) {
+			command, ok := renderingCommand(tt.commandLine)
+			require.Equal(t, tt.expected != "", ok)
+			require.Equal(t, tt.expected, command)
+		})
+	}
+}
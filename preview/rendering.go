@@ -0,0 +1,100 @@
+package preview
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	log "github.com/sirupsen/logrus"
+)
+
+// Application annotations altering the rendering
+const (
+	// kustomizeVersionAnnotation pins the Kustomize version of the Kustomize sources of an Application,
+	// unless a source sets its own kustomize.version
+	kustomizeVersionAnnotation = "argocd.argoproj.io/kustomize-version"
+	// refreshAnnotation requests a refresh of an Application, the manifests are always generated without cache
+	refreshAnnotation = "argocd.argoproj.io/refresh"
+)
+
+// supportedHelmVersion is the only Helm version supported by Argo CD v3
+const supportedHelmVersion = "v3"
+
+// kustomizeBinaryPrefix is the prefix of the Kustomize binaries of the pinned versions, e.g. kustomize-v5.4.2,
+// like the binaries registered with kustomize.path.<version> in Argo CD
+const kustomizeBinaryPrefix = "kustomize-"
+
+// lookKustomizeBinary finds the binary of a Kustomize version on the PATH, or downloads it
+var lookKustomizeBinary = func(version string) (string, error) {
+	if path, err := exec.LookPath(kustomizeBinaryPrefix + version); err == nil {
+		return path, nil
+	}
+	toolsDir := filepath.Join(getCacheDir(), "tools")
+	return newKustomizeTool(version).install(toolsDir, runtime.GOOS, runtime.GOARCH)
+}
+
+// kustomizeOptions returns the Kustomize options building a source of an Application with the Kustomize version
+// pinned by the source or by the Application annotation, nil for the default Kustomize.
+// A version neither installed nor downloadable falls back to the default Kustomize, and fails in strict mode.
+// A version which is not a vX.Y.Z version always fails, it would be part of the path of the binary.
+func kustomizeOptions(
+	app argoappv1.Application,
+	source argoappv1.ApplicationSource,
+) (*argoappv1.KustomizeOptions, error) {
+	version, pinnedBy := app.Annotations[kustomizeVersionAnnotation], "annotation "+kustomizeVersionAnnotation
+	if explicitType, err := source.ExplicitType(); source.Chart != "" || err != nil ||
+		(explicitType != nil && *explicitType != argoappv1.ApplicationSourceTypeKustomize) {
+		// Not built by Kustomize
+		return nil, nil
+	}
+	if source.Kustomize != nil && source.Kustomize.Version != "" {
+		version, pinnedBy = source.Kustomize.Version, "kustomize.version"
+	}
+	if version == "" {
+		return nil, nil
+	}
+
+	if !toolVersionPattern.MatchString(version) {
+		return nil, fmt.Errorf("invalid kustomize version %q pinned by the %s of Application '%s', expected vX.Y.Z",
+			version, pinnedBy, app.Name)
+	}
+
+	path, err := lookKustomizeBinary(version)
+	if err != nil {
+		err = fmt.Errorf("kustomize version %s pinned by the %s of Application '%s' is not installed, "+
+			"expected a %s%s binary on the PATH: %w", version, pinnedBy, app.Name, kustomizeBinaryPrefix, version, err)
+		if strictMode {
+			return nil, err
+		}
+		log.Warnf("%v, using the default kustomize", err)
+		return nil, nil
+	}
+	log.Debugf("Using %s for Application '%s'", path, app.Name)
+	if source.Kustomize != nil && source.Kustomize.Version != "" {
+		return &argoappv1.KustomizeOptions{Versions: []argoappv1.KustomizeVersion{{Name: version, Path: path}}}, nil
+	}
+	// The binary path only applies to the sources built by Kustomize, unlike a kustomize.version set on the source
+	// which would make it a Kustomize source
+	return &argoappv1.KustomizeOptions{BinaryPath: path}, nil //nolint:staticcheck // the repo service still uses it
+}
+
+// checkRenderingPins warns about the rendering pins of an Application which cannot be honored, failing in strict mode
+func checkRenderingPins(app argoappv1.Application) error {
+	for i, source := range app.Spec.GetSources() {
+		if source.Helm != nil && source.Helm.Version != "" && source.Helm.Version != supportedHelmVersion {
+			err := fmt.Errorf("helm version %s of source %d of Application '%s' is not supported, only %s is",
+				source.Helm.Version, i, app.Name, supportedHelmVersion)
+			if strictMode {
+				return err
+			}
+			log.Warnf("%v, rendering with Helm %s", err, supportedHelmVersion)
+		}
+	}
+	if refresh, ok := app.Annotations[refreshAnnotation]; ok {
+		log.Debugf("Application '%s' requests a %s refresh, the manifests are always generated without cache",
+			app.Name, refresh)
+	}
+	return nil
+}
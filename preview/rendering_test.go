@@ -0,0 +1,96 @@
+package preview
+
+import (
+	"errors"
+	"testing"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TestKustomizeOptions verifies the Kustomize binary of the version pinned by a source or an Application annotation
+func TestKustomizeOptions(t *testing.T) {
+	original := lookKustomizeBinary
+	t.Cleanup(func() { lookKustomizeBinary = original })
+	lookKustomizeBinary = func(version string) (string, error) {
+		if version == "v5.4.2" {
+			return "/usr/local/bin/kustomize-v5.4.2", nil
+		}
+		return "", errors.New("not found")
+	}
+	t.Cleanup(func() {
+		original := lookKustomizeBinary
+		t.Cleanup(func() { lookKustomizeBinary = original })
+		lookKustomizeBinary = func(version string) (string, error) { return "", errors.New("not found") }
+	})
+
+	pinned := argoappv1.ApplicationSource{Kustomize: &argoappv1.ApplicationSourceKustomize{Version: "v5.4.2"}}
+	annotated := map[string]string{kustomizeVersionAnnotation: "v5.4.2"}
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		source      argoappv1.ApplicationSource
+		expected    *argoappv1.KustomizeOptions
+	}{
+		{name: "not pinned", source: argoappv1.ApplicationSource{}},
+		{name: "pinned by the source", source: pinned, expected: &argoappv1.KustomizeOptions{
+			Versions: []argoappv1.KustomizeVersion{{Name: "v5.4.2", Path: "/usr/local/bin/kustomize-v5.4.2"}},
+		}},
+		{name: "pinned by the annotation", annotations: annotated, source: argoappv1.ApplicationSource{},
+			expected: &argoappv1.KustomizeOptions{BinaryPath: "/usr/local/bin/kustomize-v5.4.2"}},
+		{name: "the source takes precedence", annotations: map[string]string{kustomizeVersionAnnotation: "v4.0.0"},
+			source: pinned, expected: &argoappv1.KustomizeOptions{
+				Versions: []argoappv1.KustomizeVersion{{Name: "v5.4.2", Path: "/usr/local/bin/kustomize-v5.4.2"}},
+			}},
+		{name: "not a Kustomize source", annotations: annotated,
+			source: argoappv1.ApplicationSource{Helm: &argoappv1.ApplicationSourceHelm{}}},
+		{name: "chart", annotations: annotated, source: argoappv1.ApplicationSource{Chart: "app"}},
+		{name: "not installed", annotations: map[string]string{kustomizeVersionAnnotation: "v4.0.0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := argoappv1.Application{ObjectMeta: metav1.ObjectMeta{Name: "app", Annotations: tt.annotations}}
+			options, err := kustomizeOptions(app, tt.source)
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, options)
+		})
+	}
+
+	// A version which is not vX.Y.Z is rejected before looking for its binary
+	for _, version := range []string{"../../x", "v5.4.2/../../x", "5.4.2"} {
+		app := argoappv1.Application{ObjectMeta: metav1.ObjectMeta{Name: "app", Annotations: map[string]string{
+			kustomizeVersionAnnotation: version,
+		}}}
+		_, err := kustomizeOptions(app, argoappv1.ApplicationSource{})
+		require.ErrorContains(t, err, "invalid kustomize version")
+	}
+
+	// A version which is not installed fails in strict mode
+	strictMode = true
+	defer func() { strictMode = false }()
+	app := argoappv1.Application{ObjectMeta: metav1.ObjectMeta{Name: "app", Annotations: map[string]string{
+		kustomizeVersionAnnotation: "v4.0.0",
+	}}}
+	_, err := kustomizeOptions(app, argoappv1.ApplicationSource{})
+	require.ErrorContains(t, err, "expected a kustomize-v4.0.0 binary on the PATH")
+}
+
+// TestCheckRenderingPins verifies that the Helm versions not supported fail in strict mode only
+func TestCheckRenderingPins(t *testing.T) {
+	app := argoappv1.Application{
+		ObjectMeta: metav1.ObjectMeta{Name: "app"},
+		Spec: argoappv1.ApplicationSpec{Source: &argoappv1.ApplicationSource{
+			Helm: &argoappv1.ApplicationSourceHelm{Version: "v2"},
+		}},
+	}
+	require.NoError(t, checkRenderingPins(app))
+
+	strictMode = true
+	defer func() { strictMode = false }()
+	require.ErrorContains(t, checkRenderingPins(app),
+		"helm version v2 of source 0 of Application 'app' is not supported")
+
+	app.Spec.Source.Helm.Version = "v3"
+	require.NoError(t, checkRenderingPins(app))
+}
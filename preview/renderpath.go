@@ -0,0 +1,180 @@
+package preview
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	log "github.com/sirupsen/logrus"
+)
+
+// Defaults of the Application generated by the render-path command, as for argocd app create
+const (
+	defaultRenderPathRevision  = "HEAD"
+	defaultRenderPathNamespace = "default"
+	defaultRenderPathServer    = "https://kubernetes.default.svc"
+)
+
+// invalidNameChars are the characters replaced in the name generated for an Application
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// PathOptions describes the source rendered by the render-path command, with the flags of argocd app create
+type PathOptions struct {
+	// Repo is the URL of the repository, or the path of a local git repository
+	Repo string
+	// Path is the path of the source in the repository
+	Path string
+	// Chart is the name of the chart of a Helm repository, instead of a path
+	Chart string
+	// Revision is the revision of the repository, or the version of the chart
+	Revision string
+	// Type is the type of the source, one of: helm|kustomize|directory|plugin, detected by default
+	Type string
+	// Values are the Helm values files, relative to the path of the source
+	Values []string
+	// HelmSet are the Helm parameters, as name=value
+	HelmSet []string
+	// Name is the name of the Application, derived from the path or chart by default
+	Name string
+	// Project is the AppProject of the Application
+	Project string
+	// DestServer and DestName select the destination cluster, DestNamespace the destination namespace
+	DestServer    string
+	DestName      string
+	DestNamespace string
+}
+
+// RenderPath renders a source without Application manifest, generating an Application with the given source
+func RenderPath(pathOpts PathOptions, opts RenderOptions) {
+	app, err := pathApplication(pathOpts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Debugf("Rendering Application '%s' of %s", app.Name, app.Spec.Source.RepoURL)
+	generateAndOutputManifests([]argoappv1.Application{app}, opts)
+}
+
+// pathApplication generates the Application rendering a source
+func pathApplication(opts PathOptions) (argoappv1.Application, error) {
+	var app argoappv1.Application
+	if opts.Path == "" && opts.Chart == "" {
+		return app, fmt.Errorf("either --path or --helm-chart must be given")
+	}
+	repoURL, err := pathRepoURL(opts.Repo)
+	if err != nil {
+		return app, err
+	}
+	source := &argoappv1.ApplicationSource{
+		RepoURL:        repoURL,
+		Path:           opts.Path,
+		Chart:          opts.Chart,
+		TargetRevision: opts.Revision,
+	}
+	if source.TargetRevision == "" {
+		source.TargetRevision = defaultRenderPathRevision
+	}
+
+	sourceType := opts.Type
+	if sourceType == "" && (len(opts.Values) > 0 || len(opts.HelmSet) > 0) {
+		sourceType = "helm"
+	}
+	switch sourceType {
+	case "":
+		// Detected by the repository service, as in Argo CD
+	case "helm":
+		source.Helm = &argoappv1.ApplicationSourceHelm{ValueFiles: opts.Values}
+		for _, set := range opts.HelmSet {
+			name, value, ok := strings.Cut(set, "=")
+			if !ok {
+				return app, fmt.Errorf("invalid Helm parameter '%s', expected name=value", set)
+			}
+			source.Helm.Parameters = append(source.Helm.Parameters, argoappv1.HelmParameter{Name: name, Value: value})
+		}
+	case "kustomize":
+		source.Kustomize = &argoappv1.ApplicationSourceKustomize{}
+	case "directory":
+		source.Directory = &argoappv1.ApplicationSourceDirectory{}
+	case "plugin":
+		source.Plugin = &argoappv1.ApplicationSourcePlugin{}
+	default:
+		return app, fmt.Errorf("unknown source type: %s", sourceType)
+	}
+	if sourceType != "helm" && (len(opts.Values) > 0 || len(opts.HelmSet) > 0) {
+		return app, fmt.Errorf("--values and --helm-set only apply to the helm sources")
+	}
+
+	app.APIVersion = applicationAPIVersion
+	app.Kind = applicationKind
+	app.Name = opts.Name
+	if app.Name == "" {
+		app.Name = pathApplicationName(opts)
+	}
+	app.Spec = argoappv1.ApplicationSpec{
+		Project: opts.Project,
+		Source:  source,
+		Destination: argoappv1.ApplicationDestination{
+			Server:    opts.DestServer,
+			Name:      opts.DestName,
+			Namespace: opts.DestNamespace,
+		},
+	}
+	if app.Spec.Project == "" {
+		app.Spec.Project = argoappv1.DefaultAppProjectName
+	}
+	if app.Spec.Destination.Namespace == "" {
+		app.Spec.Destination.Namespace = defaultRenderPathNamespace
+	}
+	if app.Spec.Destination.Server == "" && app.Spec.Destination.Name == "" {
+		app.Spec.Destination.Server = defaultRenderPathServer
+	}
+	return app, nil
+}
+
+// pathRepoURL returns the URL of the repository of a source. A local git repository is the current repository
+// when it is, so that it is rendered like the Applications of the current repository, or else cloned from its path.
+func pathRepoURL(repo string) (string, error) {
+	if repo == "" {
+		repo = "."
+	}
+	info, err := os.Stat(repo)
+	if err != nil || !info.IsDir() {
+		// Not a local directory, the URL of a remote repository
+		return repo, nil
+	}
+	root, err := runGit(repo, nil, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", fmt.Errorf("%s is not a git repository: %w", repo, err)
+	}
+	if origin, err := runGit(repo, nil, "config", "--get", "remote.origin.url"); err == nil {
+		if isLocal, localPath, _ := isLocalRepository(origin); isLocal && sameDirectory(localPath, root) {
+			return origin, nil
+		}
+	}
+	return fileURL(root), nil
+}
+
+// sameDirectory returns whether two paths are the same directory, following the symbolic links and ignoring the
+// case of the paths on the case-insensitive file systems
+func sameDirectory(a string, b string) bool {
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	return errA == nil && errB == nil && os.SameFile(infoA, infoB)
+}
+
+// pathApplicationName returns the name of the Application generated for a source: the name of its chart or last
+// path element, as a DNS label
+func pathApplicationName(opts PathOptions) string {
+	name := opts.Chart
+	if name == "" {
+		name = path.Base(filepath.ToSlash(opts.Path))
+	}
+	name = strings.Trim(invalidNameChars.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if name == "" {
+		return "render-path"
+	}
+	return name
+}
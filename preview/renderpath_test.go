@@ -0,0 +1,78 @@
+package preview
+
+import (
+	"path/filepath"
+	"testing"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPathApplication verifies that the generated Application has the given source, and the defaults of
+// argocd app create
+func TestPathApplication(t *testing.T) {
+	app, err := pathApplication(PathOptions{
+		Repo:    "https://github.com/example/charts.git",
+		Path:    "charts/My_App",
+		Values:  []string{"env/prod.yaml"},
+		HelmSet: []string{"image.tag=1.2=beta"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "my-app", app.Name)
+	require.Equal(t, "default", app.Spec.Project)
+	require.Equal(t, argoappv1.ApplicationDestination{Server: "https://kubernetes.default.svc", Namespace: "default"},
+		app.Spec.Destination)
+	require.Equal(t, &argoappv1.ApplicationSource{
+		RepoURL:        "https://github.com/example/charts.git",
+		Path:           "charts/My_App",
+		TargetRevision: "HEAD",
+		Helm: &argoappv1.ApplicationSourceHelm{
+			ValueFiles: []string{"env/prod.yaml"},
+			Parameters: []argoappv1.HelmParameter{{Name: "image.tag", Value: "1.2=beta"}},
+		},
+	}, app.Spec.Source)
+
+	app, err = pathApplication(PathOptions{
+		Repo: "https://charts.example.com", Chart: "redis", Revision: "18.1.0", Type: "helm", DestName: "prod",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "redis", app.Name)
+	require.Equal(t, argoappv1.ApplicationDestination{Name: "prod", Namespace: "default"}, app.Spec.Destination)
+	require.Equal(t, "18.1.0", app.Spec.Source.TargetRevision)
+
+	app, err = pathApplication(PathOptions{Repo: "https://github.com/example/apps.git", Path: ".", Type: "kustomize"})
+	require.NoError(t, err)
+	require.Equal(t, "render-path", app.Name)
+	require.NotNil(t, app.Spec.Source.Kustomize)
+
+	_, err = pathApplication(PathOptions{Repo: "https://github.com/example/apps.git"})
+	require.ErrorContains(t, err, "either --path or --helm-chart")
+	_, err = pathApplication(PathOptions{Repo: "https://github.com/example/apps.git", Path: "a", Type: "jsonnet"})
+	require.ErrorContains(t, err, "unknown source type")
+	_, err = pathApplication(PathOptions{
+		Repo: "https://github.com/example/apps.git", Path: "a", Type: "kustomize", Values: []string{"v.yaml"},
+	})
+	require.ErrorContains(t, err, "only apply to the helm sources")
+	_, err = pathApplication(PathOptions{Repo: "https://github.com/example/apps.git", Path: "a", HelmSet: []string{"a"}})
+	require.ErrorContains(t, err, "expected name=value")
+}
+
+// TestPathRepoURL verifies that a local repository which is not the current one is cloned from its path
+func TestPathRepoURL(t *testing.T) {
+	dir := initTestRepo(t)
+	root, err := filepath.EvalSymlinks(dir)
+	require.NoError(t, err)
+
+	repoURL, err := pathRepoURL(filepath.Join(dir, "."))
+	require.NoError(t, err)
+	resolved, err := filepath.EvalSymlinks(repoURL[len("file://"):])
+	require.NoError(t, err)
+	require.Equal(t, root, resolved)
+
+	repoURL, err = pathRepoURL("https://github.com/example/apps.git")
+	require.NoError(t, err)
+	require.Equal(t, "https://github.com/example/apps.git", repoURL)
+
+	_, err = pathRepoURL(t.TempDir())
+	require.ErrorContains(t, err, "is not a git repository")
+}
@@ -0,0 +1,462 @@
+package preview
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Statuses of an Application in a run report
+const (
+	appStatusSucceeded = "succeeded"
+	appStatusFailed    = "failed"
+	// appStatusSkipped is the status of the Applications intentionally not rendered, with a reason
+	appStatusSkipped = "skipped"
+	// appStatusResumed is the status of the Applications already rendered by the resumed run, restored from its state
+	appStatusResumed = "resumed"
+)
+
+// Thresholds above which the duration change of an Application is reported by the comparison
+const (
+	durationChangeRatio = 0.2
+	durationChangeMin   = time.Second
+)
+
+// runReport is the report of a run, written as JSON to compare runs over time.
+// A nil runReport is valid and reports nothing.
+type runReport struct {
+	file string
+	// Shard is the shard of the run the report covers, index/count, empty for a whole run
+	Shard     string         `json:"shard,omitempty"`
+	StartedAt time.Time      `json:"startedAt"`
+	Duration  reportDuration `json:"duration"`
+	Apps      []appReport    `json:"apps"`
+	// Cache counts the reuse of the repository clones, charts and manifests cached
+	Cache *cacheStats `json:"cache,omitempty"`
+	// Summary counts the Applications rendered, failed by category of failure, and skipped
+	Summary *runSummary `json:"summary,omitempty"`
+	// provenance is the verifier of the provenance of the Helm charts, nil when no keyring is given
+	provenance *provenanceVerifier
+}
+
+// appReport is the report of the rendering of an Application
+type appReport struct {
+	Name string `json:"name"`
+	// Namespace is the namespace of the Application, empty for the Applications without one
+	Namespace string         `json:"namespace,omitempty"`
+	Status    string         `json:"status"`
+	Duration  reportDuration `json:"duration"`
+	Resources int            `json:"resources"`
+	Images    []string       `json:"images,omitempty"`
+	Error     string         `json:"error,omitempty"`
+	// Category is the category of the failure of a failed Application, e.g. auth or template
+	Category string `json:"category,omitempty"`
+	// Reason is why the Application was intentionally not rendered
+	Reason string `json:"reason,omitempty"`
+	// Provenance is the provenance status of the Helm charts of the Application, with --chart-keyring
+	Provenance []chartProvenance `json:"provenance,omitempty"`
+}
+
+// key identifies the Application in the reports: namespace/name, or its name when it has no namespace
+func (a appReport) key() string {
+	if a.Namespace == "" {
+		return a.Name
+	}
+	return a.Namespace + "/" + a.Name
+}
+
+// reportDuration is a duration marshaled as a Go duration string, e.g. 1.5s
+type reportDuration time.Duration
+
+func (d reportDuration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *reportDuration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = reportDuration(parsed)
+	return nil
+}
+
+// newRunReport starts the report of a run written to a file, nil when no file is given
+func newRunReport(file string) *runReport {
+	if !shouldMatch(file) {
+		return nil
+	}
+	return &runReport{file: file, StartedAt: time.Now().UTC(), Apps: []appReport{}}
+}
+
+// setShard records the shard of the run the report covers
+func (r *runReport) setShard(shard *appShard) {
+	if r != nil && shard != nil {
+		r.Shard = shard.String()
+	}
+}
+
+// add records the rendering of an Application which started at the given time, err being its error if it failed
+func (r *runReport) add(
+	app argoappv1.Application,
+	start time.Time,
+	rendered []renderedSource,
+	status string,
+	err error,
+) {
+	if r == nil {
+		return
+	}
+	duration := reportDuration(time.Since(start).Round(time.Millisecond))
+	entry := appReport{Name: app.Name, Namespace: app.Namespace, Status: status, Duration: duration}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	if status == appStatusFailed {
+		entry.Category = failureCategory(err)
+	}
+	resources, _ := parseManifests(allManifests(rendered))
+	entry.Resources = len(resources)
+	entry.Images = resourceImages(resources)
+	entry.Provenance = r.provenance.report(app)
+	r.Apps = append(r.Apps, entry)
+}
+
+// setSummary records the summary of the run, updated as the Applications are rendered
+func (r *runReport) setSummary(summary *runSummary) {
+	if r != nil {
+		r.Summary = summary
+	}
+}
+
+// setProvenance records the provenance status of the Helm charts of the Applications, as verified
+func (r *runReport) setProvenance(verifier *provenanceVerifier) {
+	if r != nil {
+		r.provenance = verifier
+	}
+}
+
+// skip records an Application intentionally not rendered, for the given reason
+func (r *runReport) skip(app argoappv1.Application, reason string) {
+	if r == nil {
+		return
+	}
+	r.Apps = append(r.Apps, appReport{
+		Name:      app.Name,
+		Namespace: app.Namespace,
+		Status:    appStatusSkipped,
+		Reason:    reason,
+	})
+}
+
+// write writes the report to its file
+func (r *runReport) write() error {
+	if r == nil {
+		return nil
+	}
+	r.Duration = reportDuration(time.Since(r.StartedAt).Round(time.Millisecond))
+	r.Cache = currentCacheStats
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeOutputFile(r.file, append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write run report: %w", err)
+	}
+	return nil
+}
+
+// resourceImages returns the sorted images of the containers of the resources
+func resourceImages(resources []unstructured.Unstructured) []string {
+	var images []string
+	for i := range resources {
+		for _, image := range containerImages(&resources[i]) {
+			if !slices.Contains(images, image.Image) {
+				images = append(images, image.Image)
+			}
+		}
+	}
+	sort.Strings(images)
+	return images
+}
+
+// loadRunReport reads a run report
+func loadRunReport(file string) (*runReport, error) {
+	data, err := os.ReadFile(file) // #nosec G304 - user provided report
+	if err != nil {
+		return nil, err
+	}
+	var report runReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("failed to parse run report %s: %w", file, err)
+	}
+	return &report, nil
+}
+
+// CompareRunReports prints the differences between two run reports: the totals, the Applications added, removed,
+// whose status changed or whose duration changed significantly, and the images added and removed
+func CompareRunReports(oldFile string, newFile string) {
+	oldReport, err := loadRunReport(oldFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	newReport, err := loadRunReport(newFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	compareRunReports(os.Stdout, oldReport, newReport)
+}
+
+// compareRunReports prints the differences between two run reports
+func compareRunReports(w io.Writer, oldReport *runReport, newReport *runReport) {
+	fmt.Fprintf(w, "apps: %d -> %d\n", len(oldReport.Apps), len(newReport.Apps))
+	fmt.Fprintf(w, "failed: %d -> %d\n", oldReport.countStatus(appStatusFailed), newReport.countStatus(appStatusFailed))
+	fmt.Fprintf(w, "duration: %s\n", durationChange(oldReport.Duration, newReport.Duration))
+
+	oldApps := map[string]appReport{}
+	for _, app := range oldReport.Apps {
+		oldApps[app.key()] = app
+	}
+	newApps := map[string]appReport{}
+	for _, app := range newReport.Apps {
+		newApps[app.key()] = app
+	}
+	names := make([]string, 0, len(oldApps)+len(newApps))
+	for name := range oldApps {
+		names = append(names, name)
+	}
+	for name := range newApps {
+		if _, ok := oldApps[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		oldApp, inOld := oldApps[name]
+		newApp, inNew := newApps[name]
+		switch {
+		case !inOld:
+			fmt.Fprintf(w, "application/%s: added, %s\n", name, newApp.Status)
+		case !inNew:
+			fmt.Fprintf(w, "application/%s: removed\n", name)
+		case oldApp.Status != newApp.Status:
+			fmt.Fprintf(w, "application/%s: %s -> %s\n", name, oldApp.Status, newApp.Status)
+		case significantDurationChange(oldApp.Duration, newApp.Duration):
+			fmt.Fprintf(w, "application/%s: duration %s\n", name, durationChange(oldApp.Duration, newApp.Duration))
+		}
+		if inNew && newApp.Status == appStatusFailed && newApp.Error != oldApp.Error {
+			fmt.Fprintf(w, "  %s\n", newApp.Error)
+		}
+		if inNew && newApp.Reason != "" && newApp.Reason != oldApp.Reason {
+			fmt.Fprintf(w, "  %s\n", newApp.Reason)
+		}
+	}
+
+	oldImages, newImages := oldReport.images(), newReport.images()
+	for _, image := range newImages {
+		if !slices.Contains(oldImages, image) {
+			fmt.Fprintf(w, "image %s: added\n", image)
+		}
+	}
+	for _, image := range oldImages {
+		if !slices.Contains(newImages, image) {
+			fmt.Fprintf(w, "image %s: removed\n", image)
+		}
+	}
+}
+
+// countStatus returns the number of Applications with the given status
+func (r *runReport) countStatus(status string) int {
+	count := 0
+	for _, app := range r.Apps {
+		if app.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+// images returns the sorted images of all the Applications
+func (r *runReport) images() []string {
+	var images []string
+	for _, app := range r.Apps {
+		for _, image := range app.Images {
+			if !slices.Contains(images, image) {
+				images = append(images, image)
+			}
+		}
+	}
+	sort.Strings(images)
+	return images
+}
+
+// significantDurationChange returns whether a duration changed by more than the reporting thresholds
+func significantDurationChange(oldDuration reportDuration, newDuration reportDuration) bool {
+	delta := time.Duration(newDuration - oldDuration).Abs()
+	return delta >= durationChangeMin && float64(delta) >= durationChangeRatio*float64(oldDuration)
+}
+
+// durationChange formats the change of a duration, e.g. 1s -> 1.5s (+50%)
+func durationChange(oldDuration reportDuration, newDuration reportDuration) string {
+	change := fmt.Sprintf("%s -> %s", time.Duration(oldDuration), time.Duration(newDuration))
+	if oldDuration > 0 {
+		change += fmt.Sprintf(" (%+.0f%%)", 100*float64(newDuration-oldDuration)/float64(oldDuration))
+	}
+	return change
+}
+
+// MergeReports merges the run reports, or the JSON drift reports, of the shards of a run into one report, written
+// to the output file, or printed when empty
+func MergeReports(files []string, output string) {
+	data, err := mergeReports(files)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if shouldMatch(output) {
+		if err := writeOutputFile(output, data); err != nil {
+			log.Fatalf("failed to write merged report: %v", err)
+		}
+		return
+	}
+	_, _ = os.Stdout.Write(data)
+}
+
+// mergeReports merges reports of the same type: run reports, which are JSON objects, or drift reports, which are
+// JSON arrays of the drifted resources
+func mergeReports(files []string) ([]byte, error) {
+	var reports []*runReport
+	entries := []driftEntry{}
+	drift := false
+	for i, file := range files {
+		data, err := os.ReadFile(file) // #nosec G304 - user provided report
+		if err != nil {
+			return nil, err
+		}
+		isDrift := bytes.HasPrefix(bytes.TrimSpace(data), []byte("["))
+		if i > 0 && isDrift != drift {
+			return nil, fmt.Errorf("%s and %s are not both run reports or drift reports", files[0], file)
+		}
+		drift = isDrift
+		if drift {
+			var fileEntries []driftEntry
+			if err := json.Unmarshal(data, &fileEntries); err != nil {
+				return nil, fmt.Errorf("failed to parse drift report %s: %w", file, err)
+			}
+			entries = append(entries, fileEntries...)
+			continue
+		}
+		var report runReport
+		if err := json.Unmarshal(data, &report); err != nil {
+			return nil, fmt.Errorf("failed to parse run report %s: %w", file, err)
+		}
+		reports = append(reports, &report)
+	}
+
+	var merged interface{}
+	if drift {
+		sort.SliceStable(entries, func(i, j int) bool {
+			if entries[i].Application != entries[j].Application {
+				return entries[i].Application < entries[j].Application
+			}
+			return entries[i].Resource < entries[j].Resource
+		})
+		merged = entries
+	} else {
+		report, err := mergeRunReports(files, reports)
+		if err != nil {
+			return nil, err
+		}
+		merged = report
+	}
+	data, err := json.MarshalIndent(merged, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// mergeRunReports merges the run reports of the shards of a run, read from the given files: the Applications are
+// sorted by namespace and name, whatever the order of the reports, the run spans from the earliest start to the
+// latest end of the shards, and the cache hits are summed. The shards must not overlap, the missing ones are
+// reported.
+func mergeRunReports(files []string, reports []*runReport) (*runReport, error) {
+	merged := &runReport{Apps: []appReport{}}
+	var end time.Time
+	shardFiles := map[string]string{}
+	appFiles := map[string]string{}
+	count := 0
+	for i, report := range reports {
+		if report.Shard != "" {
+			shard, err := parseShard(report.Shard)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", files[i], err)
+			}
+			if count != 0 && shard.count != count {
+				return nil, fmt.Errorf("%s covers shard %s of a run with %d shards", files[i], report.Shard, count)
+			}
+			count = shard.count
+			if other, ok := shardFiles[report.Shard]; ok {
+				return nil, fmt.Errorf("%s and %s both cover shard %s", other, files[i], report.Shard)
+			}
+			shardFiles[report.Shard] = files[i]
+		}
+		for _, app := range report.Apps {
+			if other, ok := appFiles[app.key()]; ok && other != files[i] {
+				return nil, fmt.Errorf("application '%s' is in both %s and %s", app.key(), other, files[i])
+			}
+			appFiles[app.key()] = files[i]
+		}
+		merged.Apps = append(merged.Apps, report.Apps...)
+		if merged.StartedAt.IsZero() || report.StartedAt.Before(merged.StartedAt) {
+			merged.StartedAt = report.StartedAt
+		}
+		if reportEnd := report.StartedAt.Add(time.Duration(report.Duration)); reportEnd.After(end) {
+			end = reportEnd
+		}
+		if report.Cache != nil {
+			if merged.Cache == nil {
+				merged.Cache = newCacheStats(nil)
+			}
+			merged.Cache.Repositories.add(report.Cache.Repositories)
+			merged.Cache.Charts.add(report.Cache.Charts)
+			merged.Cache.Manifests.add(report.Cache.Manifests)
+		}
+		if report.Summary != nil {
+			if merged.Summary == nil {
+				merged.Summary = newRunSummary()
+			}
+			merged.Summary.add(report.Summary)
+		}
+	}
+	var missing []string
+	for index := 1; index <= count; index++ {
+		if shard := fmt.Sprintf("%d/%d", index, count); shardFiles[shard] == "" {
+			missing = append(missing, shard)
+		}
+	}
+	if len(missing) > 0 {
+		log.Warnf("The reports of shards %s are missing", strings.Join(missing, ", "))
+	}
+	sort.SliceStable(merged.Apps, func(i, j int) bool {
+		if merged.Apps[i].Namespace != merged.Apps[j].Namespace {
+			return merged.Apps[i].Namespace < merged.Apps[j].Namespace
+		}
+		return merged.Apps[i].Name < merged.Apps[j].Name
+	})
+	merged.Duration = reportDuration(end.Sub(merged.StartedAt))
+	return merged, nil
+}
@@ -0,0 +1,166 @@
+package preview
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRunReportRoundTrip verifies that a written report is read back
+func TestRunReportRoundTrip(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "report.json")
+	report := newRunReport(file)
+	app := argoappv1.Application{}
+	app.Name = "web"
+	rendered := []renderedSource{{Manifests: []string{
+		`{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"web"},"spec":{"template":{"spec":` +
+			`{"containers":[{"name":"web","image":"nginx:1.27"},{"name":"proxy","image":"envoy:1.30"}]}}}}`,
+		`{"apiVersion":"v1","kind":"Service","metadata":{"name":"web"}}`,
+	}}}
+	report.add(app, time.Now(), rendered, appStatusSucceeded, nil)
+	require.NoError(t, report.write())
+
+	loaded, err := loadRunReport(file)
+	require.NoError(t, err)
+	require.Len(t, loaded.Apps, 1)
+	require.Equal(t, "web", loaded.Apps[0].Name)
+	require.Equal(t, appStatusSucceeded, loaded.Apps[0].Status)
+	require.Equal(t, 2, loaded.Apps[0].Resources)
+	require.Equal(t, []string{"envoy:1.30", "nginx:1.27"}, loaded.Apps[0].Images)
+
+	// A nil report reports nothing
+	var none *runReport
+	none.add(app, time.Now(), rendered, appStatusSucceeded, nil)
+	require.NoError(t, none.write())
+}
+
+// TestCompareRunReports verifies the differences printed between two runs
+func TestCompareRunReports(t *testing.T) {
+	oldReport := &runReport{Duration: reportDuration(10 * time.Second), Apps: []appReport{
+		{Name: "api", Status: appStatusSucceeded, Duration: reportDuration(2 * time.Second), Images: []string{"api:1"}},
+		{Name: "legacy", Status: appStatusSucceeded, Duration: reportDuration(time.Second)},
+		{Name: "old", Status: appStatusSucceeded, Duration: reportDuration(time.Second)},
+		{Name: "steady", Status: appStatusSucceeded, Duration: reportDuration(4 * time.Second)},
+		{Name: "web", Status: appStatusSucceeded, Duration: reportDuration(time.Second), Images: []string{"nginx:1.25"}},
+	}}
+	newReport := &runReport{Duration: reportDuration(15 * time.Second), Apps: []appReport{
+		{Name: "api", Status: appStatusSucceeded, Duration: reportDuration(5 * time.Second), Images: []string{"api:1"}},
+		{Name: "legacy", Status: appStatusSkipped, Reason: "rendered by the legacy pipeline"},
+		{Name: "new", Status: appStatusSucceeded, Duration: reportDuration(time.Second)},
+		{Name: "steady", Status: appStatusSucceeded, Duration: reportDuration(4500 * time.Millisecond)},
+		{Name: "web", Status: appStatusFailed, Error: "chart not found", Images: []string{"nginx:1.27"}},
+	}}
+	var out bytes.Buffer
+	compareRunReports(&out, oldReport, newReport)
+	require.Equal(t, `apps: 5 -> 5
+failed: 0 -> 1
+duration: 10s -> 15s (+50%)
+application/api: duration 2s -> 5s (+150%)
+application/legacy: succeeded -> skipped
+  rendered by the legacy pipeline
+application/new: added, succeeded
+application/old: removed
+application/web: succeeded -> failed
+  chart not found
+image nginx:1.27: added
+image nginx:1.25: removed
+`, out.String())
+}
+
+// TestRunReportSkip verifies that the skipped Applications are reported with their reason
+func TestRunReportSkip(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "report.json")
+	report := newRunReport(file)
+	app := argoappv1.Application{}
+	app.Name = "legacy"
+	report.skip(app, "rendered by the legacy pipeline")
+	require.NoError(t, report.write())
+
+	loaded, err := loadRunReport(file)
+	require.NoError(t, err)
+	require.Equal(t, []appReport{{Name: "legacy", Status: appStatusSkipped, Reason: "rendered by the legacy pipeline"}},
+		loaded.Apps)
+
+	var none *runReport
+	none.skip(app, "rendered by the legacy pipeline")
+}
+
+// TestMergeRunReports verifies that the reports of the shards are merged in name order whatever their order, that
+// the run spans all the shards and that overlapping shards fail
+func TestMergeRunReports(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	writeReport := func(name string, report string) string {
+		file := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(file, []byte(report), 0o600))
+		return file
+	}
+	shard1 := writeReport("shard1.json", `{"shard":"1/3","startedAt":"`+start.Format(time.RFC3339)+`",
+		"duration":"1m0s","apps":[{"name":"web","status":"succeeded","duration":"30s","resources":2}],
+		"cache":{"repositories":{"hits":1,"misses":1},"charts":{"hits":0,"misses":0},"manifests":{"hits":0,"misses":1}},
+		"summary":{"rendered":1,"skipped":0,"resumed":2}}`)
+	shard2 := writeReport("shard2.json", `{"shard":"2/3","startedAt":"`+start.Add(time.Minute).Format(time.RFC3339)+`",
+		"duration":"2m0s","apps":[{"name":"api","status":"failed","duration":"1m0s","resources":0,"error":"boom"}],
+		"cache":{"repositories":{"hits":2,"misses":0},"charts":{"hits":1,"misses":1},"manifests":{"hits":0,"misses":1}},
+		"summary":{"rendered":0,"failed":{"auth":1},"skipped":0,"notRendered":3}}`)
+
+	data, err := mergeReports([]string{shard1, shard2})
+	require.NoError(t, err)
+	var merged runReport
+	require.NoError(t, json.Unmarshal(data, &merged))
+	require.Empty(t, merged.Shard)
+	require.Equal(t, start, merged.StartedAt)
+	require.Equal(t, reportDuration(3*time.Minute), merged.Duration)
+	require.Equal(t, []string{"api", "web"}, []string{merged.Apps[0].Name, merged.Apps[1].Name})
+	require.Equal(t, cacheCounter{Hits: 3, Misses: 1}, merged.Cache.Repositories)
+	require.Equal(t, cacheCounter{Hits: 1, Misses: 1}, merged.Cache.Charts)
+	require.Equal(t, "1 rendered, 1 failed auth, 2 resumed, 3 not rendered", merged.Summary.String())
+	reversed, err := mergeReports([]string{shard2, shard1})
+	require.NoError(t, err)
+	require.Equal(t, string(data), string(reversed))
+
+	_, err = mergeReports([]string{shard1, writeReport("again.json", `{"shard":"1/3","apps":[]}`)})
+	require.ErrorContains(t, err, "both cover shard 1/3")
+	_, err = mergeReports([]string{shard1, writeReport("other.json", `{"shard":"2/4","apps":[]}`)})
+	require.ErrorContains(t, err, "covers shard 2/4 of a run with 3 shards")
+	_, err = mergeReports([]string{shard1, writeReport("web.json", `{"apps":[{"name":"web"}]}`)})
+	require.ErrorContains(t, err, "application 'web' is in both")
+	_, err = mergeReports([]string{shard1, writeReport("drift.json", `[]`)})
+	require.ErrorContains(t, err, "are not both run reports or drift reports")
+
+	// The Applications of the same name in two namespaces are distinct, sorted by namespace
+	prod := writeReport("prod.json", `{"shard":"1/2","apps":[{"name":"web","namespace":"prod","status":"succeeded"}]}`)
+	dev := writeReport("dev.json", `{"shard":"2/2","apps":[{"name":"web","namespace":"dev","status":"failed"}]}`)
+	data, err = mergeReports([]string{prod, dev})
+	require.NoError(t, err)
+	merged = runReport{}
+	require.NoError(t, json.Unmarshal(data, &merged))
+	require.Equal(t, []string{"dev/web", "prod/web"}, []string{merged.Apps[0].key(), merged.Apps[1].key()})
+	_, err = mergeReports([]string{prod, writeReport("prod-again.json", `{"apps":[{"name":"web","namespace":"prod"}]}`)})
+	require.ErrorContains(t, err, "application 'prod/web' is in both")
+}
+
+// TestMergeDriftReports verifies that the drift reports are merged sorted by Application and resource
+func TestMergeDriftReports(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.json")
+	second := filepath.Join(dir, "second.json")
+	require.NoError(t, os.WriteFile(first, []byte(`[{"application":"web","resource":"v1/Service default/web",
+		"status":"modified","diff":"-a\n+b\n"}]`), 0o600))
+	require.NoError(t, os.WriteFile(second, []byte(`[{"application":"api","resource":"v1/ConfigMap default/api",
+		"status":"added"}]`), 0o600))
+	data, err := mergeReports([]string{first, second})
+	require.NoError(t, err)
+	var entries []driftEntry
+	require.NoError(t, json.Unmarshal(data, &entries))
+	require.Equal(t, []driftEntry{
+		{Application: "api", Resource: "v1/ConfigMap default/api", Status: "added"},
+		{Application: "web", Resource: "v1/Service default/web", Status: "modified", Diff: "-a\n+b\n"},
+	}, entries)
+}
@@ -0,0 +1,149 @@
+package preview
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	log "github.com/sirupsen/logrus"
+)
+
+var runIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// runState persists the manifests of the Applications rendered during a run,
+// so that a crashed or cancelled run can be resumed without re-rendering them.
+// A nil runState is valid and persists nothing.
+type runState struct {
+	id  string
+	dir string
+	// lock prevents another invocation from using the state of the run at the same time
+	lock *fileLock
+}
+
+// getRunStateDir returns the directory holding the state of the run with the given ID
+func getRunStateDir(runID string) string {
+	return filepath.Join(getCacheDir(), "runs", runID)
+}
+
+// openRunState opens the state of a run
+// - runID starts a new run, failing if a state already exists for that ID
+// - resume continues an existing run, failing if no state exists for that ID
+// Returns nil when neither is set, and an error while another invocation uses the same run.
+// A run cannot be persisted when the output is encrypted, its state holding the rendered manifests in plain text.
+func openRunState(runID string, resume string) (*runState, error) {
+	if shouldMatch(runID) && shouldMatch(resume) && runID != resume {
+		return nil, fmt.Errorf("conflicting run IDs: --run-id '%s' and --resume '%s'", runID, resume)
+	}
+	id := runID
+	if shouldMatch(resume) {
+		id = resume
+	}
+	if !shouldMatch(id) {
+		return nil, nil
+	}
+	if outputRecipients != nil {
+		return nil, fmt.Errorf("--run-id and --resume cannot be used with --encrypt-output, the state of run '%s' "+
+			"would hold the rendered manifests in plain text", id)
+	}
+	if !runIDPattern.MatchString(id) {
+		return nil, fmt.Errorf("invalid run ID '%s': only alphanumerics, '.', '_' and '-' are allowed", id)
+	}
+
+	dir := getRunStateDir(id)
+	if err := os.MkdirAll(filepath.Dir(dir), 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create state directory for run '%s': %w", id, err)
+	}
+	lock, acquired, err := tryLock(dir + ".lock")
+	if err != nil {
+		return nil, err
+	}
+	if !acquired {
+		return nil, fmt.Errorf("run '%s' is in use by another invocation", id)
+	}
+
+	_, err = os.Stat(dir)
+	switch {
+	case shouldMatch(resume) && os.IsNotExist(err):
+		err = fmt.Errorf("no state found for run '%s'", id)
+	case !shouldMatch(resume) && err == nil:
+		err = fmt.Errorf("a state already exists for run '%s', use --resume to continue it", id)
+	case err != nil && !os.IsNotExist(err):
+	default:
+		err = os.MkdirAll(dir, 0o750)
+	}
+	if err != nil {
+		_ = lock.unlock()
+		return nil, err
+	}
+	return &runState{id: id, dir: dir, lock: lock}, nil
+}
+
+// appStateFile returns the file holding the rendered manifests of an Application
+func (s *runState) appStateFile(app argoappv1.Application) string {
+	return filepath.Join(s.dir, appFileName(app)+".json")
+}
+
+// load returns the manifests of an Application rendered earlier in the run, if any
+func (s *runState) load(app argoappv1.Application) ([]renderedSource, bool) {
+	if s == nil {
+		return nil, false
+	}
+	data, err := os.ReadFile(s.appStateFile(app))
+	if err != nil {
+		return nil, false
+	}
+	var rendered []renderedSource
+	if err := json.Unmarshal(data, &rendered); err != nil {
+		log.Warnf("Ignoring corrupted state of Application '%s' in run '%s': %v", app.Name, s.id, err)
+		return nil, false
+	}
+	return rendered, true
+}
+
+// save records the manifests of a successfully rendered Application
+// The file is written atomically so that an interrupted save is never mistaken for a completed app.
+func (s *runState) save(app argoappv1.Application, rendered []renderedSource) error {
+	if s == nil {
+		return nil
+	}
+	data, err := json.Marshal(rendered)
+	if err != nil {
+		return err
+	}
+	filename := s.appStateFile(app)
+	tmp := filename + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to save state of Application '%s': %w", app.Name, err)
+	}
+	return os.Rename(tmp, filename)
+}
+
+// remove deletes the state once the run has completed successfully
+func (s *runState) remove() error {
+	if s == nil {
+		return nil
+	}
+	if err := os.RemoveAll(s.dir); err != nil {
+		return err
+	}
+	return s.close()
+}
+
+// close releases the state for other invocations, keeping it for a later resume
+func (s *runState) close() error {
+	if s == nil {
+		return nil
+	}
+	return s.lock.unlock()
+}
+
+// logResumeHint tells the user how to resume the run after a failure
+func (s *runState) logResumeHint() {
+	if s == nil {
+		return
+	}
+	log.Errorf("Run '%s' failed, use --resume %s to continue it", s.id, s.id)
+}
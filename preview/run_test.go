@@ -0,0 +1,115 @@
+package preview
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TestOpenRunStateDisabled verifies that no state is persisted without a run ID
+func TestOpenRunStateDisabled(t *testing.T) {
+	state, err := openRunState("", "")
+	require.NoError(t, err)
+	require.Nil(t, state)
+
+	// A nil state is safe to use
+	app := argoappv1.Application{ObjectMeta: metav1.ObjectMeta{Name: "app"}}
+	_, completed := state.load(app)
+	require.False(t, completed)
+	require.NoError(t, state.save(app, []renderedSource{{Manifests: []string{"{}"}}}))
+	require.NoError(t, state.remove())
+}
+
+// TestRunStateResume verifies that the manifests saved during a run are reused when resuming it
+func TestRunStateResume(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	done := argoappv1.Application{ObjectMeta: metav1.ObjectMeta{Name: "done", Namespace: "argocd"}}
+	pending := argoappv1.Application{ObjectMeta: metav1.ObjectMeta{Name: "pending"}}
+
+	state, err := openRunState("run-1", "")
+	require.NoError(t, err)
+	rendered := []renderedSource{{
+		Source:    argoappv1.ApplicationSource{RepoURL: "https://github.com/example/repo.git", Path: "app"},
+		Revision:  "0123456789abcdef",
+		Manifests: []string{`{"kind":"ConfigMap"}`},
+	}}
+	require.NoError(t, state.save(done, rendered))
+
+	// The run cannot be used by another invocation while in progress
+	_, err = openRunState("", "run-1")
+	require.ErrorContains(t, err, "in use by another invocation")
+	require.NoError(t, state.close())
+
+	// Starting the same run again is rejected
+	_, err = openRunState("run-1", "")
+	require.ErrorContains(t, err, "use --resume")
+
+	resumed, err := openRunState("", "run-1")
+	require.NoError(t, err)
+	loaded, completed := resumed.load(done)
+	require.True(t, completed)
+	require.Equal(t, rendered, loaded)
+	_, completed = resumed.load(pending)
+	require.False(t, completed)
+
+	require.NoError(t, resumed.remove())
+	_, err = os.Stat(getRunStateDir("run-1"))
+	require.True(t, os.IsNotExist(err))
+}
+
+// TestRunStateResumeOverBudget verifies that an Application exceeding the per-app budget is not saved as completed,
+// so that resuming the run renders it again
+func TestRunStateResumeOverBudget(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	fast := argoappv1.Application{ObjectMeta: metav1.ObjectMeta{Name: "fast"}}
+	slow := argoappv1.Application{ObjectMeta: metav1.ObjectMeta{Name: "slow"}}
+	rendered := []renderedSource{{Manifests: []string{`{"kind":"ConfigMap"}`}}}
+
+	state, err := openRunState("run-1", "")
+	require.NoError(t, err)
+	budget, err := newDurationBudget(0, time.Second)
+	require.NoError(t, err)
+	budgetErr, err := completeApp(state, budget, fast, 10*time.Millisecond, rendered)
+	require.NoError(t, err)
+	require.NoError(t, budgetErr)
+	budgetErr, err = completeApp(state, budget, slow, 2*time.Second, rendered)
+	require.NoError(t, err)
+	require.EqualError(t, budgetErr, "application 'slow' rendered in 2s, exceeding the 1s budget")
+	require.NoError(t, state.close())
+
+	resumed, err := openRunState("", "run-1")
+	require.NoError(t, err)
+	_, completed := resumed.load(fast)
+	require.True(t, completed)
+	_, completed = resumed.load(slow)
+	require.False(t, completed)
+	require.NoError(t, resumed.remove())
+}
+
+// TestOpenRunStateErrors verifies the validation of run IDs
+func TestOpenRunStateErrors(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	_, err := openRunState("", "unknown")
+	require.ErrorContains(t, err, "no state found for run 'unknown'")
+
+	_, err = openRunState("../escape", "")
+	require.ErrorContains(t, err, "invalid run ID")
+
+	_, err = openRunState("a", "b")
+	require.ErrorContains(t, err, "conflicting run IDs")
+
+	// The state is not persisted in plain text when the output is encrypted
+	identity, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	outputRecipients = []age.Recipient{identity.Recipient()}
+	t.Cleanup(func() { outputRecipients = nil })
+	_, err = openRunState("nightly", "")
+	require.ErrorContains(t, err, "cannot be used with --encrypt-output")
+	require.NoDirExists(t, getRunStateDir("nightly"))
+}
@@ -0,0 +1,161 @@
+package preview
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Categories of the rendering failures counted by the exit summary of a run
+const (
+	// failureAuth is a repository or registry refusing the credentials, or asking for some
+	failureAuth = "auth"
+	// failureTemplate is helm template, kustomize build or the values schema of a chart failing
+	failureTemplate = "template"
+	// failureProject is the AppProject of the Application not permitting it
+	failureProject = "project"
+	// failureBudget is the rendering of the Application exceeding the per-app duration budget
+	failureBudget = "budget"
+	failureOther  = "other"
+)
+
+// failureCategories are the categories of failures, in the order they are summarized
+var failureCategories = []string{failureAuth, failureTemplate, failureProject, failureBudget, failureOther}
+
+// authErrorPatterns are the lowercase messages of the git, Helm and OCI clients refusing the credentials
+var authErrorPatterns = []string{
+	"authentication required", "authentication failed", "could not read username", "invalid username or password",
+	"permission denied (publickey)", "unauthorized", "403 forbidden",
+}
+
+// templateErrorPatterns are the lowercase messages of the repository service when a rendering tool fails
+var templateErrorPatterns = []string{"helm template", "kustomize build"}
+
+// runSummary counts the Applications of a run by outcome, printed on stderr when the run exits and recorded in the
+// report, so that what went wrong is found without reading through the logs of all the Applications.
+type runSummary struct {
+	Rendered int `json:"rendered"`
+	// Failed counts the failed Applications by category of failure
+	Failed  map[string]int `json:"failed,omitempty"`
+	Skipped int            `json:"skipped"`
+	// Resumed counts the Applications already rendered by the resumed run, restored from its state
+	Resumed int `json:"resumed,omitempty"`
+	// NotRendered counts the Applications not reached, the run stopping early, e.g. at the first one failing to
+	// render without --keep-going
+	NotRendered int `json:"notRendered,omitempty"`
+
+	// selected is the number of Applications of the run, finish the function printing the summary once
+	selected int
+	finish   func()
+}
+
+// newRunSummary starts the summary of a run
+func newRunSummary() *runSummary {
+	return &runSummary{Failed: map[string]int{}}
+}
+
+// startRunSummary starts the summary of a run of the given number of Applications, printed on stderr by finish, or
+// when the run exits early through log.Exit or log.Fatal, the Applications not reached counted as not rendered
+func startRunSummary(selected int) *runSummary {
+	s := newRunSummary()
+	s.selected = selected
+	s.finish = onExit(func() {
+		s.stop()
+		s.print(os.Stderr)
+	})
+	return s
+}
+
+// stop counts the Applications of the run not recorded yet as not rendered
+func (s *runSummary) stop() {
+	s.NotRendered = s.selected - s.Rendered - s.Skipped - s.Resumed
+	for _, count := range s.Failed {
+		s.NotRendered -= count
+	}
+}
+
+// record counts an Application with the given status of the report, err being the error of a failed one
+func (s *runSummary) record(status string, err error) {
+	switch status {
+	case appStatusSucceeded:
+		s.Rendered++
+	case appStatusSkipped:
+		s.Skipped++
+	case appStatusResumed:
+		s.Resumed++
+	case appStatusFailed:
+		s.Failed[failureCategory(err)]++
+	}
+}
+
+// add adds the counts of another summary, e.g. of another shard of the run
+func (s *runSummary) add(other *runSummary) {
+	s.Rendered += other.Rendered
+	s.Skipped += other.Skipped
+	s.Resumed += other.Resumed
+	s.NotRendered += other.NotRendered
+	for category, count := range other.Failed {
+		s.Failed[category] += count
+	}
+}
+
+// String formats the non-zero counts, e.g. 12 rendered, 1 failed template, 1 project denial(s), 2 skipped
+func (s *runSummary) String() string {
+	parts := []string{fmt.Sprintf("%d rendered", s.Rendered)}
+	for _, category := range failureCategories {
+		count := s.Failed[category]
+		if count == 0 {
+			continue
+		}
+		if category == failureProject {
+			parts = append(parts, fmt.Sprintf("%d project denial(s)", count))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d failed %s", count, category))
+		}
+	}
+	if s.Skipped > 0 {
+		parts = append(parts, fmt.Sprintf("%d skipped", s.Skipped))
+	}
+	if s.Resumed > 0 {
+		parts = append(parts, fmt.Sprintf("%d resumed", s.Resumed))
+	}
+	if s.NotRendered > 0 {
+		parts = append(parts, fmt.Sprintf("%d not rendered", s.NotRendered))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// print prints the summary on one line, e.g. summary: 12 rendered, 1 failed auth, 5 not rendered
+func (s *runSummary) print(w io.Writer) {
+	fmt.Fprintf(w, "summary: %s\n", s)
+}
+
+// failureCategory returns the category of the error of a failed Application
+func failureCategory(err error) string {
+	var denialErr *projectDenialError
+	var budgetErr *appBudgetError
+	var templateErr *templateError
+	var schemaErr *valuesSchemaError
+	switch {
+	case err == nil:
+		return failureOther
+	case errors.As(err, &denialErr):
+		return failureProject
+	case errors.As(err, &budgetErr):
+		return failureBudget
+	case errors.As(err, &templateErr), errors.As(err, &schemaErr):
+		return failureTemplate
+	}
+	message := strings.ToLower(err.Error())
+	contains := func(pattern string) bool { return strings.Contains(message, pattern) }
+	if slices.ContainsFunc(authErrorPatterns, contains) {
+		return failureAuth
+	}
+	if slices.ContainsFunc(templateErrorPatterns, contains) {
+		return failureTemplate
+	}
+	return failureOther
+}
@@ -0,0 +1,50 @@
+package preview
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestFailureCategory verifies that the failures are categorized from their type, or else their message
+func TestFailureCategory(t *testing.T) {
+	denial := &projectDenialError{app: "web", project: "default", violations: []string{"destination not permitted"}}
+	for _, c := range []struct {
+		err      error
+		category string
+	}{
+		{fmt.Errorf("failed to render app 'web': %w", denial), failureProject},
+		{&appBudgetError{app: "web"}, failureBudget},
+		{&valuesSchemaError{app: "web"}, failureTemplate},
+		{fmt.Errorf("wrapped: %w", &templateError{}), failureTemplate},
+		{errors.New("`kustomize build /tmp/web` failed"), failureTemplate},
+		{errors.New("failed to fetch chart: 401 Unauthorized"), failureAuth},
+		{errors.New("fatal: could not read Username for 'https://github.com': terminal prompts disabled"), failureAuth},
+		{errors.New("dial tcp: lookup github.com: no such host"), failureOther},
+	} {
+		require.Equal(t, c.category, failureCategory(c.err), c.err.Error())
+	}
+}
+
+// TestRunSummary verifies that the Applications are counted by outcome and the failures by category, the ones not
+// reached when the run stops being counted as not rendered
+func TestRunSummary(t *testing.T) {
+	summary := newRunSummary()
+	require.Equal(t, "0 rendered", summary.String())
+	summary.selected = 9
+	summary.record(appStatusSucceeded, nil)
+	summary.record(appStatusSucceeded, nil)
+	summary.record(appStatusSkipped, nil)
+	summary.record(appStatusResumed, nil)
+	summary.record(appStatusFailed, &appBudgetError{app: "api"})
+	summary.record(appStatusFailed, &projectDenialError{app: "web"})
+	summary.stop()
+
+	var out bytes.Buffer
+	summary.print(&out)
+	require.Equal(t, "summary: 2 rendered, 1 project denial(s), 1 failed budget, 1 skipped, 1 resumed, 3 not rendered\n",
+		out.String())
+}
@@ -0,0 +1,54 @@
+package preview
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+)
+
+// appShard is the shard of the Applications rendered by one of the CI jobs of a sharded run, given as index/count.
+// A nil appShard holds all the Applications.
+type appShard struct {
+	// index is the 1-based index of the shard
+	index int
+	count int
+}
+
+// parseShard parses a shard given as index/count, e.g. 2/5, nil when empty
+func parseShard(spec string) (*appShard, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	index, count, found := strings.Cut(spec, "/")
+	s := &appShard{}
+	var err error
+	if found {
+		if s.index, err = strconv.Atoi(index); err == nil {
+			s.count, err = strconv.Atoi(count)
+		}
+	}
+	if !found || err != nil || s.count < 1 || s.index < 1 || s.index > s.count {
+		return nil, fmt.Errorf("invalid shard '%s', expected index/count with 1 <= index <= count, e.g. 2/5", spec)
+	}
+	return s, nil
+}
+
+// includes returns whether an Application belongs to the shard. The Applications are assigned by a hash of their
+// namespace and name, so that each one is assigned to the same shard by all the jobs, whatever the order of the
+// manifests, and keeps its shard when other Applications are added or removed.
+func (s *appShard) includes(app argoappv1.Application) bool {
+	if s == nil {
+		return true
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(app.Namespace + "/" + app.Name))
+	return int(h.Sum32()%uint32(s.count)) == s.index-1 // #nosec G115 - count is positive
+}
+
+// String formats the shard as index/count
+func (s *appShard) String() string {
+	return fmt.Sprintf("%d/%d", s.index, s.count)
+}
@@ -0,0 +1,44 @@
+package preview
+
+import (
+	"fmt"
+	"testing"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TestAppShard verifies that each Application belongs to exactly one shard, and that invalid shards fail
+func TestAppShard(t *testing.T) {
+	for _, spec := range []string{"2", "0/5", "6/5", "a/5", "1/0", "-1/2"} {
+		_, err := parseShard(spec)
+		require.Error(t, err, spec)
+	}
+	none, err := parseShard("")
+	require.NoError(t, err)
+	require.True(t, none.includes(argoappv1.Application{}))
+
+	var shards []*appShard
+	for index := 1; index <= 3; index++ {
+		shard, err := parseShard(fmt.Sprintf("%d/3", index))
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprintf("%d/3", index), shard.String())
+		shards = append(shards, shard)
+	}
+	sizes := make([]int, len(shards))
+	for i := 0; i < 30; i++ {
+		app := argoappv1.Application{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("app-%d", i), Namespace: "argocd"}}
+		count := 0
+		for j, shard := range shards {
+			if shard.includes(app) {
+				count++
+				sizes[j]++
+			}
+		}
+		require.Equal(t, 1, count, app.Name)
+	}
+	for _, size := range sizes {
+		require.NotZero(t, size)
+	}
+}
@@ -9,6 +9,8 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	argocmd "github.com/argoproj/argo-cd/v3/cmd/argocd/commands"
 	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
@@ -98,17 +100,144 @@ func shouldMatch(v string) bool {
 	return len(v) > 0
 }
 
-// getCacheDir returns the cache directory for repositories and helm charts.
+// onExit registers a cleanup function to run when the process exits through log.Exit or log.Fatal, e.g. in
+// errors.CheckError, which do not run the deferred calls. The returned function runs it, once whatever the path.
+func onExit(cleanup func()) func() {
+	var once sync.Once
+	run := func() { once.Do(cleanup) }
+	log.RegisterExitHandler(run)
+	return run
+}
+
+// appFileName returns a file name identifying an Application, qualified by its namespace when set
+func appFileName(app argoappv1.Application) string {
+	if app.Namespace != "" {
+		return safeFileName(app.Namespace + "_" + app.Name)
+	}
+	return safeFileName(app.Name)
+}
+
+// getCacheDir returns the cache directory for repositories, helm charts and run states.
 // Uses the system temp directory to avoid cross-device link errors when
 // ArgoCD needs to move files between directories.
 func getCacheDir() string {
 	return filepath.Join(os.TempDir(), "_argocd-offline-cli")
 }
 
-// generateAndOutputManifests generates manifests for Applications and outputs them
-func generateAndOutputManifests(apps []argoappv1.Application, appName string, resKind string, output string) {
+// RenderOptions holds the settings shared by the commands generating resource manifests
+type RenderOptions struct {
+	// AppName restricts the rendering to the Application with the given name
+	AppName string
+	// Shard restricts the rendering to the Applications of a shard of the run, given as index/count, e.g. 2/5
+	Shard string
+	// Destination restricts the rendering to the Applications going to the given cluster, a name, server or alias,
+	// in-cluster being the cluster Argo CD runs in
+	Destination string
+	// Kind restricts the output to the resources of the given kind
+	Kind string
+	// Output is the output format, one of: name|json|yaml
+	Output string
+	// RunID persists the per-app completion state of the run under the given ID
+	RunID string
+	// Resume resumes the run with the given ID, skipping the apps that already succeeded
+	Resume string
+	// DebugArtifacts is the directory where the intermediate artifacts of each app are dumped
+	DebugArtifacts string
+	// Projects are the files and directories holding the AppProjects the Applications are rendered against
+	Projects []string
+	// Overrides is the file mapping Application names to the overrides of their spec applied before rendering
+	Overrides string
+	// SourceOverrides substitute a single source of an Application with a local directory or another revision,
+	// given as app=index=path:dir or app=index=revision:rev
+	SourceOverrides []string
+	// SkipList is the file mapping the names of the Applications intentionally not rendered to the reason
+	SkipList string
+	// OutputDir is the directory where the resources are written, grouped by destination cluster, instead of printed
+	OutputDir string
+	// Report is the file where the JSON report of the run is written: status, duration, resources and images
+	// of each app
+	Report string
+	// SplitCRDs writes the CustomResourceDefinitions of each cluster to a crds.yaml stream applied before apply.yaml,
+	// with OutputDir
+	SplitCRDs bool
+	// OutputArchive is the zstd-compressed tar archive the resources are written to instead of printed, each
+	// distinct resource being stored once
+	OutputArchive string
+	// OriginAnnotations annotates each resource with the source, revision and values files it was generated from
+	OriginAnnotations bool
+	// AddLabels and AddAnnotations are the key=value labels and annotations added to every resource, like the
+	// commonLabels and commonAnnotations of Kustomize
+	AddLabels      []string
+	AddAnnotations []string
+	// LabelSelectors also adds AddLabels to the selectors, as commonLabels does
+	LabelSelectors bool
+	// Hooks are the commands run around the pipeline: before loading, after rendering each app and after the run
+	Hooks ExecHooks
+	// MaxDuration and MaxDurationPerApp fail the run when it, or the rendering of an Application, takes longer,
+	// zero being no budget
+	MaxDuration       time.Duration
+	MaxDurationPerApp time.Duration
+	// KeepGoing renders the remaining Applications after one fails to render, the run failing once done
+	KeepGoing bool
+	// Strip are the profiles of the preview-only metadata stripped from the rendered resources, to apply them with
+	// kubectl: test-hooks, argocd-metadata, null-fields or all
+	Strip []string
+	// MergePreview is the base..head range whose merge the local repositories are rendered at, instead of HEAD
+	MergePreview string
+	// ChartKeyring is the keyring the provenance of the Helm charts is verified against, when set
+	ChartKeyring string
+	// EnforceProvenance fails the Applications whose Helm charts are unsigned or unverifiable, instead of warning
+	EnforceProvenance bool
+}
+
+// renderedSource holds the manifests generated from one source of an Application
+type renderedSource struct {
+	// Source is the source as defined in the Application
+	Source argoappv1.ApplicationSource `json:"source"`
+	// Revision is the revision the manifests were generated from, as resolved by the repository service
+	Revision string `json:"revision"`
+	// Manifests are the generated manifests, in JSON
+	Manifests []string `json:"manifests"`
+}
+
+// allManifests returns the manifests generated from all the sources of an Application
+func allManifests(rendered []renderedSource) []string {
+	var manifests []string
+	for _, r := range rendered {
+		manifests = append(manifests, r.Manifests...)
+	}
+	return manifests
+}
+
+// enableMergePreview renders the local repositories at the merge of the base..head range, created in the
+// repository of the current directory. The returned cleanup function deletes the merge commit ref.
+func enableMergePreview(spec string) (func(), error) {
+	base, head, err := parseMergePreview(spec)
+	if err != nil {
+		return nil, err
+	}
+	repoRoot, err := runGit(".", nil, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, fmt.Errorf("--merge-preview must run from within a git repository")
+	}
+	commit, removeRef, err := createMergePreviewCommit(repoRoot, base, head)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Rendering the merge of %s into %s: %s", head, base, commit)
+	localRevisionOverride = commit
+	return func() {
+		localRevisionOverride = ""
+		removeRef()
+	}, nil
+}
+
+// newRepoService creates and initializes the repository service used to generate manifests
+func newRepoService() (*repository.Service, error) {
 	max, err := resource.ParseQuantity("100G")
-	errors.CheckError(err)
+	if err != nil {
+		return nil, err
+	}
 	maxValue := max.ToDec().Value()
 	initConstants := repository.RepoServerInitConstants{
 		HelmManifestMaxExtractedSize:      maxValue,
@@ -117,56 +246,314 @@ func generateAndOutputManifests(apps []argoappv1.Application, appName string, re
 		StreamedManifestMaxExtractedSize:  maxValue,
 		StreamedManifestMaxTarSize:        maxValue,
 	}
+	currentArgoCDExport.applyParams(&initConstants)
 
+	removeStaleTempFiles(os.TempDir(), staleTempAge)
+	ensureRenderingTools()
+	cacheDir, err := acquireRepoCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	if err := startPluginServers(cacheDir); err != nil {
+		return nil, err
+	}
+	enableValuesSchemaCheck()
+	enableRenderedOutputCheck()
+	currentCacheStats = newCacheStats(clonedRepositories(cacheDir))
 	repoService := repository.NewService(
 		metrics.NewMetricsServer(),
 		NewNoopCache(),
 		initConstants,
 		git.NoopCredsStore{},
-		getCacheDir(),
+		cacheDir,
 	)
 	if err := repoService.Init(); err != nil {
-		log.Fatal("failed to initialize the repo service: ", err)
+		return nil, fmt.Errorf("failed to initialize the repo service: %w", err)
+	}
+	return repoService, nil
+}
+
+// generateAndOutputManifests generates manifests for Applications and outputs them
+func generateAndOutputManifests(apps []argoappv1.Application, opts RenderOptions) {
+	state, err := openRunState(opts.RunID, opts.Resume)
+	errors.CheckError(err)
+	if shouldMatch(opts.MergePreview) {
+		cleanup, err := enableMergePreview(opts.MergePreview)
+		errors.CheckError(err)
+		defer cleanup()
 	}
 
+	repoService, err := newRepoService()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if shouldMatch(opts.DebugArtifacts) {
+		errors.CheckError(enableDebugArtifacts(opts.DebugArtifacts))
+	}
+	if len(opts.Projects) > 0 {
+		errors.CheckError(enableProjects(opts.Projects))
+	}
+	overrides, err := loadOverrides(opts.Overrides)
+	errors.CheckError(err)
+	errors.CheckError(applyOverrides(apps, overrides))
+	sourceOverrides, err := newSourceOverrides(opts.SourceOverrides)
+	errors.CheckError(err)
+	defer sourceOverrides.cleanup()
+	errors.CheckError(sourceOverrides.apply(apps))
+	skipList, err := loadSkipList(opts.SkipList)
+	errors.CheckError(err)
+	commonMeta, err := newCommonMetadata(opts.AddLabels, opts.AddAnnotations, opts.LabelSelectors)
+	errors.CheckError(err)
+	strip, err := newStripProfiles(opts.Strip)
+	errors.CheckError(err)
+	shard, err := parseShard(opts.Shard)
+	errors.CheckError(err)
+	report := newRunReport(opts.Report)
+	report.setShard(shard)
+	provenance := newProvenanceVerifier(opts.ChartKeyring, opts.EnforceProvenance)
+	report.setProvenance(provenance)
+	budget, err := newDurationBudget(opts.MaxDuration, opts.MaxDurationPerApp)
+	errors.CheckError(err)
+	var output *clusterOutput
+	if shouldMatch(opts.OutputDir) {
+		output, err = newClusterOutput(opts.OutputDir, shouldMatch(opts.Resume), opts.SplitCRDs)
+		errors.CheckError(err)
+	} else if opts.SplitCRDs {
+		log.Fatal("--split-crds requires --output-dir")
+	}
+	var archive *resourceArchive
+	if shouldMatch(opts.OutputArchive) {
+		if output != nil {
+			log.Fatal("--output-archive and --output-dir can not be combined")
+		}
+		archive, err = newResourceArchive(opts.OutputArchive)
+		errors.CheckError(err)
+	}
+
+	// Skip apps that don't match the filter
+	selected := func(app argoappv1.Application) bool {
+		return (!shouldMatch(opts.AppName) || opts.AppName == app.Name) && shard.includes(app) &&
+			(!shouldMatch(opts.Destination) ||
+				sameDestination(currentClusters, parseDestination(opts.Destination), app.Spec.Destination))
+	}
+	summary := startRunSummary(countSelected(apps, selected))
+	report.setSummary(summary)
+	var ran []execHookApp
+	var failed []string
+	// fail records an Application failing to render, and stops the run unless --keep-going is set
+	fail := func(app argoappv1.Application, start time.Time, err error) {
+		summary.record(appStatusFailed, err)
+		report.add(app, start, nil, appStatusFailed, err)
+		ran = append(ran, execHookApp{Name: app.Name, Namespace: app.Namespace, Status: appStatusFailed})
+		if opts.KeepGoing {
+			log.Error(err)
+			failed = append(failed, app.Name)
+			return
+		}
+		summary.stop()
+		errors.CheckError(report.write())
+		if hookErr := opts.Hooks.runPostRunHook(ran, opts, err); hookErr != nil {
+			log.Error(hookErr)
+		}
+		state.logResumeHint()
+		log.Error(err)
+		log.Exit(1)
+	}
 	for _, app := range apps {
-		// Skip apps that don't match the filter
-		if shouldMatch(appName) && appName != app.Name {
+		if !selected(app) {
+			continue
+		}
+		if reason, skipped := skipList.reason(app); skipped {
+			log.Infof("Skipping Application '%s': %s", app.Name, reason)
+			report.skip(app, reason)
+			summary.record(appStatusSkipped, nil)
+			ran = append(ran, execHookApp{Name: app.Name, Namespace: app.Namespace, Status: appStatusSkipped})
+			continue
+		}
+
+		start := time.Now()
+		if err := currentProjects.checkPermitted(app); err != nil {
+			fail(app, start, err)
 			continue
 		}
+		if err := provenance.check(app); err != nil {
+			fail(app, start, err)
+			continue
+		}
+		rendered, completed := state.load(app)
+		currentCacheStats.recordManifests(completed)
+		if completed {
+			log.Infof("Resuming Application '%s', already rendered in run '%s'", app.Name, state.id)
+			report.add(app, start, rendered, appStatusResumed, nil)
+			summary.record(appStatusResumed, nil)
+			ran = append(ran, execHookApp{Name: app.Name, Namespace: app.Namespace, Status: appStatusResumed})
+		} else {
+			errors.CheckError(currentDebugArtifacts.startApp(app))
+			rendered, err = generateAppManifests(repoService, app)
+			if err != nil {
+				fail(app, start, err)
+				continue
+			}
+			budgetErr, err := completeApp(state, budget, app, time.Since(start), rendered)
+			errors.CheckError(err)
+			status := appStatusSucceeded
+			if budgetErr != nil {
+				log.Error(budgetErr)
+				status = appStatusFailed
+			}
+			report.add(app, start, rendered, status, budgetErr)
+			summary.record(status, budgetErr)
+			ran = append(ran, execHookApp{Name: app.Name, Namespace: app.Namespace, Status: status})
+		}
+		if opts.OriginAnnotations {
+			rendered, err = annotateOrigins(rendered)
+			errors.CheckError(err)
+		}
+		rendered, err = commonMeta.apply(rendered)
+		errors.CheckError(err)
+		manifests, err := opts.Hooks.runPostRenderHook(app, allManifests(rendered))
+		errors.CheckError(err)
+		manifests, err = strip.apply(app, manifests)
+		errors.CheckError(err)
+		resources := filterResources(manifests, opts.Kind)
+		if output != nil || archive != nil {
+			var appResources []unstructured.Unstructured
+			for _, kindResources := range resources {
+				appResources = append(appResources, kindResources...)
+			}
+			if output != nil {
+				errors.CheckError(output.add(app, appResources))
+			} else {
+				errors.CheckError(archive.add(app, appResources))
+			}
+			continue
+		}
+		printResources(resources, opts.Output)
+	}
+
+	if output != nil {
+		errors.CheckError(printClusterOutput(output))
+	}
+	if archive != nil {
+		errors.CheckError(archive.close())
+	}
+	skipList.warnUnused()
+	currentCacheStats.print(os.Stderr)
+	summary.finish()
+	runErr := budget.check()
+	if len(failed) > 0 {
+		renderErr := fmt.Errorf("%d Applications failed to render: %s", len(failed), strings.Join(failed, ", "))
+		if runErr != nil {
+			renderErr = fmt.Errorf("%w; %w", renderErr, runErr)
+		}
+		runErr = renderErr
+	}
+	errors.CheckError(report.write())
+	if runErr == nil {
+		errors.CheckError(state.remove())
+	} else {
+		// The failed Applications and the ones over budget are not saved, resuming the run renders them again
+		state.logResumeHint()
+	}
+	errors.CheckError(opts.Hooks.runPostRunHook(ran, opts, runErr))
+	if runErr != nil {
+		log.Fatal(runErr)
+	}
+}
+
+// countSelected returns the number of Applications selected by the filters of a run
+func countSelected(apps []argoappv1.Application, selected func(argoappv1.Application) bool) int {
+	count := 0
+	for _, app := range apps {
+		if selected(app) {
+			count++
+		}
+	}
+	return count
+}
 
-		manifests := generateAppManifests(repoService, app)
-		resources := filterResources(manifests, resKind)
-		printResources(resources, output)
+// completeApp checks the rendering of an Application against the per-app budget, then saves its manifests in the
+// state of the run. An Application over budget is not saved, so that resuming the run renders it again.
+func completeApp(
+	state *runState,
+	budget *durationBudget,
+	app argoappv1.Application,
+	elapsed time.Duration,
+	rendered []renderedSource,
+) (budgetErr error, err error) {
+	if budgetErr := budget.checkApp(app, elapsed); budgetErr != nil {
+		return budgetErr, nil
 	}
+	return nil, state.save(app, rendered)
+}
+
+// generateManifest sends a manifest request to the repository service
+func generateManifest(
+	repoService *repository.Service,
+	q *repoapiclient.ManifestRequest,
+) (*repoapiclient.ManifestResponse, error) {
+	currentArgoCDExport.applySettings(q)
+	currentDebugArtifacts.recordRequest(q)
+	currentCacheStats.recordRequest(q)
+	currentRenderedOutput.startSource(q.ApplicationSource)
+	return repoService.GenerateManifest(context.Background(), q)
 }
 
 // generateAppManifests generates manifests for a single application
-func generateAppManifests(repoService *repository.Service, app argoappv1.Application) []string {
+func generateAppManifests(repoService *repository.Service, app argoappv1.Application) ([]renderedSource, error) {
 	// Normalize source handling using ArgoCD v3 helper methods
 	sources := app.Spec.GetSources() // Normalize to array
 	if len(sources) == 0 {
-		log.Fatalf("Application '%s' has no source configured (.spec.source or .spec.sources)", app.Name)
+		return nil, fmt.Errorf("application '%s' has no source configured (.spec.source or .spec.sources)", app.Name)
 	}
 
-	var manifests []string
-	var err error
+	if strictMode {
+		if err := checkSupportedApplication(app); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkRenderingPins(app); err != nil {
+		return nil, err
+	}
 
+	var rendered []renderedSource
+	var err error
+	currentValuesSchema.start()
+	currentRenderedOutput.start()
 	if app.Spec.HasMultipleSources() {
 		// Multi-source path
-		manifests, err = generateMultiSourceManifests(repoService, app)
+		rendered, err = generateMultiSourceManifests(repoService, app)
 		if err != nil {
-			log.Fatalf("Failed to generate manifests for multi-source app '%s': %v", app.Name, err)
+			err = fmt.Errorf("failed to generate manifests for multi-source app '%s': %w", app.Name, err)
 		}
 	} else {
 		// Single-source path (existing logic)
-		manifests, err = generateSingleSourceManifest(repoService, app)
+		rendered, err = generateSingleSourceManifest(repoService, app)
 		if err != nil {
-			log.Fatalf("Failed to generate manifests for app '%s': %v", app.Name, err)
+			err = fmt.Errorf("failed to generate manifests for app '%s': %w", app.Name, err)
 		}
 	}
+	// The violations of the values schemas are reported at once, rather than the first one failing helm template
+	if violations := currentValuesSchema.stop(); len(violations) > 0 {
+		return nil, &valuesSchemaError{app: app.Name, namespace: app.Namespace, violations: violations}
+	}
+	// The invalid documents of the output of Helm or Kustomize are reported at once, rather than the first one
+	// failing the parsing of the repository service
+	if documentsErr := currentRenderedOutput.stop(app); err != nil && documentsErr != nil {
+		return nil, documentsErr
+	}
+	if err != nil {
+		return nil, err
+	}
 
-	return manifests
+	if !keepLists {
+		for i := range rendered {
+			if rendered[i].Manifests, err = unwrapListManifests(rendered[i].Manifests); err != nil {
+				return nil, fmt.Errorf("failed to unwrap the Lists of app '%s': %w", app.Name, err)
+			}
+		}
+	}
+	return rendered, nil
 }
 
 // filterResources parses manifests and filters by resource kind
@@ -228,7 +615,10 @@ func printResourceNames(kinds []string, resources map[string][]unstructured.Unst
 }
 
 // generateSingleSourceManifest handles manifest generation for traditional single-source applications
-func generateSingleSourceManifest(repoService *repository.Service, app argoappv1.Application) ([]string, error) {
+func generateSingleSourceManifest(
+	repoService *repository.Service,
+	app argoappv1.Application,
+) ([]renderedSource, error) {
 	if app.Spec.Source == nil || app.Spec.Source.RepoURL == "" {
 		return nil, fmt.Errorf("application has no valid source configuration")
 	}
@@ -243,7 +633,7 @@ func generateSingleSourceManifest(repoService *repository.Service, app argoappv1
 		log.Infof("Detected local repository for %s, using path: %s", app.Name, localPath)
 
 		// Resolve to HEAD for local repositories
-		resolvedRevision, err := resolveLocalRevision(localPath)
+		resolvedRevision, err := localRevision(localPath)
 		if err != nil {
 			// Intentionally use original value when resolution fails to allow
 			// graceful fallback for edge cases
@@ -258,32 +648,42 @@ func generateSingleSourceManifest(repoService *repository.Service, app argoappv1
 
 		// localPath is from git rev-parse --show-toplevel and is therefore trusted
 		repoOverride = &argoappv1.Repository{
-			Repo: "file://" + filepath.ToSlash(localPath),
+			Repo: fileURL(localPath),
 			Type: "git",
 		}
 	} else {
 		// Use existing credential resolution
 		log.Debugf("Using remote repository for %s: %s", app.Name, app.Spec.Source.RepoURL)
-		repoOverride = &argoappv1.Repository{
-			Repo:     app.Spec.Source.RepoURL,
-			Username: FindRepoUsername(app.Spec.Source.RepoURL),
-			Password: FindRepoPassword(app.Spec.Source.RepoURL),
-		}
+		repoOverride = remoteRepository(app.Spec.Source.RepoURL)
 	}
 
-	response, err := repoService.GenerateManifest(context.Background(), &repoapiclient.ManifestRequest{
-		ApplicationSource: applicationSource,
-		AppName:           app.Name,
-		Namespace:         app.Spec.Destination.Namespace,
-		NoCache:           true,
-		Repo:              repoOverride,
-		ProjectName:       "applications",
+	projectName, projectSourceRepos := currentProjects.requestProject(app)
+	kubeVersion, apiVersions := destinationCapabilities(app)
+	kustomize, err := kustomizeOptions(app, *app.Spec.Source)
+	if err != nil {
+		return nil, err
+	}
+	response, err := generateManifest(repoService, &repoapiclient.ManifestRequest{
+		ApplicationSource:  applicationSource,
+		AppName:            app.Name,
+		Namespace:          app.Spec.Destination.Namespace,
+		NoCache:            true,
+		Repo:               repoOverride,
+		KustomizeOptions:   kustomize,
+		ProjectName:        projectName,
+		ProjectSourceRepos: projectSourceRepos,
+		KubeVersion:        kubeVersion,
+		ApiVersions:        apiVersions,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate manifests: %w", err)
+		return nil, fmt.Errorf("failed to generate manifests: %w", mapTemplateError(err, *applicationSource, localPath))
 	}
 
-	return response.Manifests, nil
+	return []renderedSource{{
+		Source:    *app.Spec.Source,
+		Revision:  response.Revision,
+		Manifests: response.Manifests,
+	}}, nil
 }
 
 // generateMultiSourceManifests handles manifest generation for multi-source applications
@@ -298,8 +698,8 @@ func validateGitSourcesConstraint(sources []argoappv1.ApplicationSource) error {
 			return fmt.Errorf("source at index %d has empty repoURL", i)
 		}
 
-		// Skip Helm chart sources - they're allowed to be from different repos
-		if source.Chart != "" {
+		// Skip Helm chart sources and local directories - they're allowed to be from different repos
+		if source.Chart != "" || strings.HasPrefix(source.RepoURL, "file://") {
 			continue
 		}
 
@@ -338,7 +738,7 @@ func resolveLocalRevisions(
 		log.Infof("Detected local repository for source %d in %s, using path: %s", i, appName, localPath)
 		localPaths[i] = localPath
 
-		resolvedRevision, err := resolveLocalRevision(localPath)
+		resolvedRevision, err := localRevision(localPath)
 		if err != nil {
 			// Intentionally use original value when resolution fails to allow graceful fallback
 			log.Warnf("Failed to resolve local revision: %v, using original", err)
@@ -362,23 +762,22 @@ func createRepoOverride(
 	if localPath != "" {
 		// localPath is from git rev-parse --show-toplevel and is therefore trusted
 		return &argoappv1.Repository{
-			Repo: "file://" + filepath.ToSlash(localPath),
+			Repo: fileURL(localPath),
 			Type: "git",
 		}
 	}
 
 	// Repository credentials are resolved per-source using the source's repoURL
 	log.Debugf("Using remote repository for source %d in %s: %s", sourceIndex, appName, sourceCopy.RepoURL)
-	return &argoappv1.Repository{
-		Repo:     sourceCopy.RepoURL,
-		Username: FindRepoUsername(sourceCopy.RepoURL),
-		Password: FindRepoPassword(sourceCopy.RepoURL),
-	}
+	return remoteRepository(sourceCopy.RepoURL)
 }
 
 // Constraint: all Git repository sources must use the same repository URL
 // Helm chart sources (with Chart field set) are allowed to use different repositories
-func generateMultiSourceManifests(repoService *repository.Service, app argoappv1.Application) ([]string, error) {
+func generateMultiSourceManifests(
+	repoService *repository.Service,
+	app argoappv1.Application,
+) ([]renderedSource, error) {
 	sources := app.Spec.GetSources()
 	if len(sources) == 0 {
 		return nil, fmt.Errorf("no sources found in multi-source application")
@@ -391,14 +790,27 @@ func generateMultiSourceManifests(repoService *repository.Service, app argoappv1
 	// Resolve local revisions and build refSources with resolved values
 	resolvedSources, localPaths := resolveLocalRevisions(sources, app.Name)
 	refSources := buildRefSources(resolvedSources)
+	// The ref sources of local repositories are read from the local repository as well, rather than fetched from
+	// their remote when the source referencing them is in another repository, e.g. a local chart directory
+	for i, source := range resolvedSources {
+		if source.Ref != "" && localPaths[i] != "" {
+			refSources["$"+source.Ref].Repo.Repo = fileURL(localPaths[i])
+		}
+	}
 
 	// Generate manifests for each source
-	var allManifests []string
+	projectName, projectSourceRepos := currentProjects.requestProject(app)
+	kubeVersion, apiVersions := destinationCapabilities(app)
+	var rendered []renderedSource
 	for i := range sources {
 		sourceCopy := resolvedSources[i]
 		repoOverride := createRepoOverride(sourceCopy, localPaths[i], i, app.Name)
+		kustomize, err := kustomizeOptions(app, sourceCopy)
+		if err != nil {
+			return nil, err
+		}
 
-		response, err := repoService.GenerateManifest(context.Background(), &repoapiclient.ManifestRequest{
+		response, err := generateManifest(repoService, &repoapiclient.ManifestRequest{
 			ApplicationSource:  &sourceCopy,
 			AppName:            app.Name,
 			Namespace:          app.Spec.Destination.Namespace,
@@ -406,16 +818,25 @@ func generateMultiSourceManifests(repoService *repository.Service, app argoappv1
 			HasMultipleSources: true,
 			RefSources:         refSources,
 			Repo:               repoOverride,
-			ProjectName:        "applications",
+			KustomizeOptions:   kustomize,
+			ProjectName:        projectName,
+			ProjectSourceRepos: projectSourceRepos,
+			KubeVersion:        kubeVersion,
+			ApiVersions:        apiVersions,
 		})
 		if err != nil {
-			return nil, fmt.Errorf("failed to generate manifests for source %d: %w", i, err)
+			return nil, fmt.Errorf("failed to generate manifests for source %d: %w", i,
+				mapTemplateError(err, sourceCopy, localPaths[i]))
 		}
 
-		allManifests = append(allManifests, response.Manifests...)
+		rendered = append(rendered, renderedSource{
+			Source:    sources[i],
+			Revision:  response.Revision,
+			Manifests: response.Manifests,
+		})
 	}
 
-	return allManifests, nil
+	return rendered, nil
 }
 
 // buildRefSources creates a map of named source references for cross-source value file resolution
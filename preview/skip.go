@@ -0,0 +1,80 @@
+package preview
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/yaml"
+)
+
+// skipAnnotation marks an Application as intentionally not rendered, its value being the reason
+const skipAnnotation = "preview.argocd-offline/skip"
+
+// skipListFile maps the names of the Applications intentionally not rendered to the reason
+type skipListFile struct {
+	Applications map[string]string `json:"applications"`
+}
+
+// appSkipList holds the Applications intentionally not rendered, and the ones which were matched.
+// A nil appSkipList only skips the Applications with the skip annotation.
+type appSkipList struct {
+	reasons map[string]string
+	used    map[string]bool
+}
+
+// loadSkipList reads a skip-list file, an empty path returns no skip list
+func loadSkipList(filename string) (*appSkipList, error) {
+	if !shouldMatch(filename) {
+		return nil, nil
+	}
+	data, err := os.ReadFile(filename) // #nosec G304 - user provided skip-list file
+	if err != nil {
+		return nil, fmt.Errorf("failed to read skip-list file: %w", err)
+	}
+	var file skipListFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse skip-list file %s: %w", filename, err)
+	}
+	for name, reason := range file.Applications {
+		if reason == "" {
+			return nil, fmt.Errorf("application '%s' of skip-list file %s has no reason", name, filename)
+		}
+	}
+	return &appSkipList{reasons: file.Applications, used: map[string]bool{}}, nil
+}
+
+// reason returns why an Application is skipped: the reason of the skip list, which takes precedence over the skip
+// annotation of the Application. ok is false when the Application is rendered.
+func (s *appSkipList) reason(app argoappv1.Application) (string, bool) {
+	if s != nil {
+		if reason, ok := s.reasons[app.Name]; ok {
+			s.used[app.Name] = true
+			return reason, true
+		}
+	}
+	reason, ok := app.Annotations[skipAnnotation]
+	if ok && reason == "" {
+		reason = "annotated with " + skipAnnotation
+	}
+	return reason, ok
+}
+
+// warnUnused warns about the entries of the skip list matching no Application
+func (s *appSkipList) warnUnused() {
+	if s == nil {
+		return
+	}
+	var unused []string
+	for name := range s.reasons {
+		if !s.used[name] {
+			unused = append(unused, name)
+		}
+	}
+	sort.Strings(unused)
+	for _, name := range unused {
+		log.Warnf("Skip-list entry of Application '%s' matches no Application", name)
+	}
+}
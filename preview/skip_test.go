@@ -0,0 +1,51 @@
+package preview
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TestSkipListReason verifies that the Applications of the skip list or with the skip annotation are skipped, the
+// reason of the skip list taking precedence
+func TestSkipListReason(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "skip.yaml")
+	require.NoError(t, os.WriteFile(filename, []byte(`applications:
+  legacy: rendered by the legacy pipeline
+  annotated: listed
+  removed: decommissioned
+`), 0o600))
+	skipList, err := loadSkipList(filename)
+	require.NoError(t, err)
+
+	newApp := func(name string, annotations map[string]string) argoappv1.Application {
+		return argoappv1.Application{ObjectMeta: metav1.ObjectMeta{Name: name, Annotations: annotations}}
+	}
+	reason, skipped := skipList.reason(newApp("legacy", nil))
+	require.True(t, skipped)
+	require.Equal(t, "rendered by the legacy pipeline", reason)
+	reason, skipped = skipList.reason(newApp("annotated", map[string]string{skipAnnotation: "annotated"}))
+	require.True(t, skipped)
+	require.Equal(t, "listed", reason)
+	reason, skipped = skipList.reason(newApp("web", map[string]string{skipAnnotation: "needs the vault plugin"}))
+	require.True(t, skipped)
+	require.Equal(t, "needs the vault plugin", reason)
+	_, skipped = skipList.reason(newApp("api", nil))
+	require.False(t, skipped)
+	require.Equal(t, map[string]bool{"legacy": true, "annotated": true}, skipList.used)
+
+	// Without skip list, only the annotation skips
+	var noSkipList *appSkipList
+	reason, skipped = noSkipList.reason(newApp("web", map[string]string{skipAnnotation: ""}))
+	require.True(t, skipped)
+	require.Equal(t, "annotated with "+skipAnnotation, reason)
+	noSkipList.warnUnused()
+
+	require.NoError(t, os.WriteFile(filename, []byte("applications:\n  legacy: \"\"\n"), 0o600))
+	_, err = loadSkipList(filename)
+	require.ErrorContains(t, err, "has no reason")
+}
@@ -0,0 +1,201 @@
+package preview
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	log "github.com/sirupsen/logrus"
+)
+
+// sourceOverride substitutes a single source of an Application, given with --override-source as
+// app=index=path:dir or app=index=revision:rev
+type sourceOverride struct {
+	app   string
+	index int
+	// path is the local directory the source is rendered from instead of its repository or chart
+	path string
+	// revision replaces the target revision of the source
+	revision string
+}
+
+// parseSourceOverride parses a source override given as app=index=path:dir or app=index=revision:rev
+func parseSourceOverride(spec string) (sourceOverride, error) {
+	o := sourceOverride{}
+	invalid := fmt.Errorf("invalid source override '%s', expected app=index=path:dir or app=index=revision:rev", spec)
+	app, rest, found := strings.Cut(spec, "=")
+	if !found || app == "" {
+		return o, invalid
+	}
+	index, value, found := strings.Cut(rest, "=")
+	if !found {
+		return o, invalid
+	}
+	var err error
+	if o.index, err = strconv.Atoi(index); err != nil || o.index < 0 {
+		return o, invalid
+	}
+	o.app = app
+	kind, target, _ := strings.Cut(value, ":")
+	switch {
+	case kind == "path" && target != "":
+		o.path = target
+	case kind == "revision" && target != "":
+		o.revision = target
+	default:
+		return o, invalid
+	}
+	return o, nil
+}
+
+// sourceOverrides holds the source overrides of a run, and the working tree commits of the local directories
+// they render
+type sourceOverrides struct {
+	overrides []sourceOverride
+	// snapshots are the commits of the working trees of the repositories holding the local directories, by root
+	snapshots map[string]string
+	cleanups  []func()
+}
+
+// newSourceOverrides parses the source overrides given with --override-source, nil when none
+func newSourceOverrides(specs []string) (*sourceOverrides, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	s := &sourceOverrides{snapshots: map[string]string{}}
+	for _, spec := range specs {
+		o, err := parseSourceOverride(spec)
+		if err != nil {
+			return nil, err
+		}
+		s.overrides = append(s.overrides, o)
+	}
+	return s, nil
+}
+
+// apply applies the source overrides to the Applications with the same name, in the order they were given, warning
+// about the overrides matching no Application
+func (s *sourceOverrides) apply(apps []argoappv1.Application) error {
+	if s == nil {
+		return nil
+	}
+	used := map[string]bool{}
+	for _, o := range s.overrides {
+		for i := range apps {
+			if apps[i].Name != o.app {
+				continue
+			}
+			used[o.app] = true
+			if err := s.applyOne(&apps[i], o); err != nil {
+				return err
+			}
+		}
+	}
+
+	var unused []string
+	for _, o := range s.overrides {
+		if !used[o.app] && !slices.Contains(unused, o.app) {
+			unused = append(unused, o.app)
+		}
+	}
+	sort.Strings(unused)
+	for _, name := range unused {
+		log.Warnf("Source override of Application '%s' matches no Application", name)
+	}
+	return nil
+}
+
+// applyOne applies a source override to the selected source of an Application
+func (s *sourceOverrides) applyOne(app *argoappv1.Application, o sourceOverride) error {
+	var source *argoappv1.ApplicationSource
+	count := len(app.Spec.GetSources())
+	if o.index < count {
+		if app.Spec.HasMultipleSources() {
+			source = &app.Spec.Sources[o.index]
+		} else {
+			source = app.Spec.Source
+		}
+	}
+	if source == nil {
+		return fmt.Errorf("source override of Application '%s' selects source %d, but it has %d source(s)",
+			app.Name, o.index, count)
+	}
+
+	if o.revision != "" {
+		source.TargetRevision = o.revision
+		log.Infof("Source %d of Application '%s' rendered at revision %s", o.index, app.Name, o.revision)
+		return nil
+	}
+	repoURL, sourcePath, revision, err := s.localSource(o.path)
+	if err != nil {
+		return fmt.Errorf("source override of Application '%s': %w", app.Name, err)
+	}
+	source.RepoURL = repoURL
+	source.Path = sourcePath
+	source.Chart = ""
+	source.TargetRevision = revision
+	log.Infof("Source %d of Application '%s' rendered from %s", o.index, app.Name, o.path)
+	return nil
+}
+
+// localSource returns the repository URL, path and revision rendering a local directory. The directory of the
+// current repository is rendered like the Applications of the current repository, the directory of another
+// repository from a snapshot of its working tree, so that the uncommitted changes of an unreleased chart are
+// rendered as well.
+func (s *sourceOverrides) localSource(dir string) (string, string, string, error) {
+	repoURL, err := pathRepoURL(dir)
+	if err != nil {
+		return "", "", "", err
+	}
+	prefix, err := runGit(dir, nil, "rev-parse", "--show-prefix")
+	if err != nil {
+		return "", "", "", err
+	}
+	sourcePath := strings.TrimSuffix(prefix, "/")
+	if sourcePath == "" {
+		sourcePath = "."
+	}
+	if !strings.HasPrefix(repoURL, "file://") {
+		return repoURL, sourcePath, "HEAD", nil
+	}
+
+	root, err := runGit(dir, nil, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", "", "", err
+	}
+	if commit, ok := s.snapshots[root]; ok {
+		return repoURL, sourcePath, commit, nil
+	}
+	changed, err := changedFiles(root)
+	if err != nil {
+		return "", "", "", err
+	}
+	var commit string
+	if len(changed) == 0 {
+		commit, err = resolveLocalRevision(root)
+	} else {
+		var cleanup func()
+		commit, cleanup, err = createWorktreeCommit(root)
+		if cleanup != nil {
+			s.cleanups = append(s.cleanups, cleanup)
+		}
+	}
+	if err != nil {
+		return "", "", "", err
+	}
+	s.snapshots[root] = commit
+	return repoURL, sourcePath, commit, nil
+}
+
+// cleanup deletes the refs of the working tree commits
+func (s *sourceOverrides) cleanup() {
+	if s == nil {
+		return
+	}
+	for _, cleanup := range s.cleanups {
+		cleanup()
+	}
+}
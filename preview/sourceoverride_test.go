@@ -0,0 +1,83 @@
+package preview
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TestParseSourceOverride verifies that the app, index and path or revision are required
+func TestParseSourceOverride(t *testing.T) {
+	o, err := parseSourceOverride("web=1=path:./charts/web")
+	require.NoError(t, err)
+	require.Equal(t, sourceOverride{app: "web", index: 1, path: "./charts/web"}, o)
+	o, err = parseSourceOverride("web=0=revision:feature/values")
+	require.NoError(t, err)
+	require.Equal(t, sourceOverride{app: "web", index: 0, revision: "feature/values"}, o)
+
+	for _, spec := range []string{"web", "web=1", "=1=path:.", "web=-1=path:.", "web=x=path:.", "web=1=path:",
+		"web=1=chart:web"} {
+		_, err := parseSourceOverride(spec)
+		require.EqualError(t, err, "invalid source override '"+spec+
+			"', expected app=index=path:dir or app=index=revision:rev", spec)
+	}
+}
+
+// TestApplySourceOverrides verifies that only the selected source is substituted, that a local directory is
+// rendered from a snapshot of the working tree of its repository, and that an unknown source index fails
+func TestApplySourceOverrides(t *testing.T) {
+	repo := initTestRepo(t)
+	chartDir := filepath.Join(repo, "charts", "web")
+	require.NoError(t, os.MkdirAll(chartDir, 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(chartDir, "Chart.yaml"), []byte("name: web\n"), 0o600))
+	head, err := resolveLocalRevision(repo)
+	require.NoError(t, err)
+	root, err := runGit(repo, nil, "rev-parse", "--show-toplevel")
+	require.NoError(t, err)
+
+	newApp := func() argoappv1.Application {
+		return argoappv1.Application{
+			ObjectMeta: metav1.ObjectMeta{Name: "web"},
+			Spec: argoappv1.ApplicationSpec{Sources: argoappv1.ApplicationSources{
+				{RepoURL: "https://github.com/example/values.git", TargetRevision: "main", Ref: "values"},
+				{
+					RepoURL:        "https://charts.example.com",
+					Chart:          "web",
+					TargetRevision: "1.0.0",
+					Helm:           &argoappv1.ApplicationSourceHelm{ValueFiles: []string{"$values/web/values.yaml"}},
+				},
+			}},
+		}
+	}
+	overrides, err := newSourceOverrides([]string{"web=1=path:" + chartDir, "web=0=revision:feature", "api=0=path:."})
+	require.NoError(t, err)
+	defer overrides.cleanup()
+	apps := []argoappv1.Application{newApp()}
+	require.NoError(t, overrides.apply(apps))
+
+	sources := apps[0].Spec.Sources
+	require.Equal(t, argoappv1.ApplicationSource{
+		RepoURL: "https://github.com/example/values.git", TargetRevision: "feature", Ref: "values",
+	}, sources[0])
+	require.Equal(t, fileURL(root), sources[1].RepoURL)
+	require.Equal(t, "charts/web", sources[1].Path)
+	require.Empty(t, sources[1].Chart)
+	require.Equal(t, []string{"$values/web/values.yaml"}, sources[1].Helm.ValueFiles)
+	require.NotEqual(t, head, sources[1].TargetRevision)
+	content, err := runGit(repo, nil, "show", sources[1].TargetRevision+":charts/web/Chart.yaml")
+	require.NoError(t, err)
+	require.Equal(t, "name: web", content)
+
+	overrides.cleanup()
+	_, err = runGit(repo, nil, "rev-parse", "--verify", "-q", processRef(worktreeRef))
+	require.Error(t, err)
+
+	overrides, err = newSourceOverrides([]string{"web=2=revision:v2"})
+	require.NoError(t, err)
+	require.EqualError(t, overrides.apply([]argoappv1.Application{newApp()}),
+		"source override of Application 'web' selects source 2, but it has 2 source(s)")
+}
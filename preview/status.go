@@ -0,0 +1,156 @@
+package preview
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/argoproj/argo-cd/v3/common"
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/argoproj/argo-cd/v3/util/lua"
+	"github.com/argoproj/gitops-engine/pkg/health"
+	"github.com/argoproj/gitops-engine/pkg/sync/hook"
+	"github.com/argoproj/gitops-engine/pkg/sync/syncwaves"
+	log "github.com/sirupsen/logrus"
+)
+
+// StatusOptions holds the settings of the predict-status commands
+type StatusOptions struct {
+	// AppName restricts the prediction to the Application with this name
+	AppName string
+}
+
+// predictedApp is the predicted status of an Application
+type predictedApp struct {
+	Name      string          `json:"name"`
+	Namespace string          `json:"namespace,omitempty"`
+	Status    predictedStatus `json:"status"`
+}
+
+// predictedStatus is the status Argo CD would report for an Application, in the format of its status field
+type predictedStatus struct {
+	Sync      predictedSyncStatus        `json:"sync"`
+	Health    argoappv1.AppHealthStatus  `json:"health"`
+	Resources []argoappv1.ResourceStatus `json:"resources"`
+}
+
+// predictedSyncStatus is the sync status of an Application, along with the revisions its sources resolved to
+type predictedSyncStatus struct {
+	Status    argoappv1.SyncStatusCode `json:"status"`
+	Revision  string                   `json:"revision,omitempty"`
+	Revisions []string                 `json:"revisions,omitempty"`
+}
+
+// PredictApplicationStatus prints, as JSON, the status Argo CD would report for the Applications defined in a
+// manifest
+func PredictApplicationStatus(filename string, opts StatusOptions) {
+	predictStatus(loadApplications(filename), opts)
+}
+
+// PredictResourcesStatus prints, as JSON, the status Argo CD would report for the Applications generated from an
+// ApplicationSet
+func PredictResourcesStatus(filename string, opts StatusOptions) {
+	predictStatus(generateApplications(filename), opts)
+}
+
+// predictStatus renders the Applications and prints their predicted status
+func predictStatus(apps []argoappv1.Application, opts StatusOptions) {
+	repoService, err := newRepoService()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	predicted := []predictedApp{}
+	for _, app := range apps {
+		if shouldMatch(opts.AppName) && opts.AppName != app.Name {
+			continue
+		}
+		rendered, err := generateAppManifests(repoService, app)
+		if err != nil {
+			log.Fatal(err)
+		}
+		status, err := predictAppStatus(app, rendered)
+		if err != nil {
+			log.Fatal(err)
+		}
+		predicted = append(predicted, predictedApp{Name: app.Name, Namespace: app.Namespace, Status: status})
+	}
+	data, err := json.MarshalIndent(predicted, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(string(data))
+}
+
+// predictAppStatus predicts the status of an Application once its resources are synced, before their controllers
+// report their state: the resources are Synced, and their health is assessed from the rendered manifests with the
+// health checks of Argo CD, e.g. a Deployment is Progressing until rolled out. As in Argo CD, the hooks are left
+// out, the resources without health check have no health, and the health of the Application is the worst health
+// of its resources, bar the ones annotated with argocd.argoproj.io/ignore-healthcheck.
+func predictAppStatus(app argoappv1.Application, rendered []renderedSource) (predictedStatus, error) {
+	status := predictedStatus{
+		Sync:      predictedSyncStatus{Status: argoappv1.SyncStatusCodeSynced},
+		Health:    argoappv1.AppHealthStatus{Status: health.HealthStatusHealthy},
+		Resources: []argoappv1.ResourceStatus{},
+	}
+	if app.Spec.HasMultipleSources() {
+		for _, r := range rendered {
+			status.Sync.Revisions = append(status.Sync.Revisions, r.Revision)
+		}
+	} else if len(rendered) > 0 {
+		status.Sync.Revision = rendered[0].Revision
+	}
+
+	resources, err := parseManifests(allManifests(rendered))
+	if err != nil {
+		return status, err
+	}
+	healthOverrides := lua.ResourceHealthOverrides{}
+	for i := range resources {
+		resource := &resources[i]
+		if hook.IsHook(resource) || hook.Skip(resource) {
+			continue
+		}
+		gvk := resource.GroupVersionKind()
+		namespace := resource.GetNamespace()
+		if namespace == "" && isNamespacedResource(resource) {
+			namespace = app.Spec.Destination.Namespace
+		}
+		resourceStatus := argoappv1.ResourceStatus{
+			Group:     gvk.Group,
+			Version:   gvk.Version,
+			Kind:      gvk.Kind,
+			Namespace: namespace,
+			Name:      resource.GetName(),
+			Status:    argoappv1.SyncStatusCodeSynced,
+			SyncWave:  int64(syncwaves.Wave(resource)),
+		}
+		resourceHealth, err := health.GetResourceHealth(resource, healthOverrides)
+		if err != nil {
+			log.Warnf("Failed to predict the health of %s of Application '%s': %v", newResourceKey(resource), app.Name, err)
+		}
+		if resourceHealth != nil {
+			resourceStatus.Health = &argoappv1.HealthStatus{Status: resourceHealth.Status, Message: resourceHealth.Message}
+			if resource.GetAnnotations()[common.AnnotationIgnoreHealthCheck] != "true" &&
+				health.IsWorse(status.Health.Status, resourceHealth.Status) {
+				status.Health.Status = resourceHealth.Status
+			}
+		}
+		status.Resources = append(status.Resources, resourceStatus)
+	}
+	// Sorted like the resources of the Application status
+	sort.SliceStable(status.Resources, func(i, j int) bool {
+		a, b := status.Resources[i], status.Resources[j]
+		if a.Group != b.Group {
+			return a.Group < b.Group
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	return status, nil
+}
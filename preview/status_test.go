@@ -0,0 +1,71 @@
+package preview
+
+import (
+	"testing"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/argoproj/gitops-engine/pkg/health"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPredictAppStatus verifies that the resources are predicted Synced with the health assessed from their
+// manifests, the hooks being left out and the Application getting the worst health of its resources
+func TestPredictAppStatus(t *testing.T) {
+	app := argoappv1.Application{}
+	app.Name = "web"
+	app.Spec.Source = &argoappv1.ApplicationSource{RepoURL: "https://github.com/example/web.git"}
+	app.Spec.Destination.Namespace = "prod"
+	rendered := []renderedSource{{Revision: "abc123", Manifests: []string{
+		`{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"web","annotations":` +
+			`{"argocd.argoproj.io/sync-wave":"1"}},"spec":{"replicas":2}}`,
+		`{"apiVersion":"v1","kind":"Service","metadata":{"name":"web"},"spec":{"type":"ClusterIP"}}`,
+		`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"web","namespace":"shared"}}`,
+		`{"apiVersion":"rbac.authorization.k8s.io/v1","kind":"ClusterRole","metadata":{"name":"web"}}`,
+		`{"apiVersion":"batch/v1","kind":"Job","metadata":{"name":"migrate","annotations":` +
+			`{"argocd.argoproj.io/hook":"PreSync"}}}`,
+	}}}
+
+	status, err := predictAppStatus(app, rendered)
+	require.NoError(t, err)
+	require.Equal(t, predictedSyncStatus{Status: argoappv1.SyncStatusCodeSynced, Revision: "abc123"}, status.Sync)
+	require.Equal(t, health.HealthStatusProgressing, status.Health.Status)
+	require.Len(t, status.Resources, 4)
+
+	// Sorted by group, kind, namespace and name
+	configMap, service, deployment, clusterRole := status.Resources[0], status.Resources[1], status.Resources[2],
+		status.Resources[3]
+	require.Equal(t, "apps", deployment.Group)
+	require.Equal(t, "Deployment", deployment.Kind)
+	require.Equal(t, "prod", deployment.Namespace)
+	require.Equal(t, int64(1), deployment.SyncWave)
+	require.Equal(t, health.HealthStatusProgressing, deployment.Health.Status)
+
+	require.Equal(t, "shared", configMap.Namespace)
+	require.Nil(t, configMap.Health)
+	require.Equal(t, "Service", service.Kind)
+	require.Equal(t, health.HealthStatusHealthy, service.Health.Status)
+	require.Equal(t, "ClusterRole", clusterRole.Kind)
+	require.Empty(t, clusterRole.Namespace)
+	require.Equal(t, argoappv1.SyncStatusCodeSynced, clusterRole.Status)
+}
+
+// TestPredictAppStatusIgnoresHealthCheck verifies that the resources annotated with
+// argocd.argoproj.io/ignore-healthcheck don't affect the health of the Application, and that the revisions of all
+// the sources of a multi-source Application are reported
+func TestPredictAppStatusIgnoresHealthCheck(t *testing.T) {
+	app := argoappv1.Application{}
+	app.Name = "web"
+	app.Spec.Sources = argoappv1.ApplicationSources{{RepoURL: "https://a"}, {RepoURL: "https://b"}}
+	rendered := []renderedSource{
+		{Revision: "abc123", Manifests: []string{`{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"web",` +
+			`"annotations":{"argocd.argoproj.io/ignore-healthcheck":"true"}},"spec":{"replicas":1}}`}},
+		{Revision: "1.2.0"},
+	}
+
+	status, err := predictAppStatus(app, rendered)
+	require.NoError(t, err)
+	require.Equal(t, []string{"abc123", "1.2.0"}, status.Sync.Revisions)
+	require.Empty(t, status.Sync.Revision)
+	require.Equal(t, health.HealthStatusHealthy, status.Health.Status)
+	require.Equal(t, health.HealthStatusProgressing, status.Resources[0].Health.Status)
+}
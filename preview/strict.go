@@ -0,0 +1,126 @@
+package preview
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// strictMode fails on the Application features which are not implemented, instead of rendering without them
+var strictMode bool
+
+// EnableStrictMode makes the Applications and ApplicationSets using a feature which is not implemented,
+// or fields which are not known, fail instead of being rendered without them
+func EnableStrictMode() {
+	strictMode = true
+}
+
+// supportedGenerators are the ApplicationSet generators implemented, see getAppSetGenerators
+var supportedGenerators = map[string]bool{"list": true, "matrix": true, "merge": true}
+
+// decodeResource decodes a resource into its typed form, failing on the fields which are not known in strict mode
+func decodeResource(obj *unstructured.Unstructured, into interface{}) error {
+	data, err := json.Marshal(obj.Object)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if strictMode {
+		decoder.DisallowUnknownFields()
+	}
+	return decoder.Decode(into)
+}
+
+// checkSupportedApplication returns an error when an Application uses a feature which is not implemented
+func checkSupportedApplication(app argoappv1.Application) error {
+	var unsupported []string
+	if app.Spec.SourceHydrator != nil {
+		unsupported = append(unsupported, "the source hydrator (only rendered by the hydrate command)")
+	}
+	for i, source := range app.Spec.GetSources() {
+		if source.Plugin != nil && currentPlugins == nil {
+			unsupported = append(unsupported, fmt.Sprintf("the config management plugin of source %d", i))
+		}
+	}
+	if len(unsupported) > 0 {
+		return fmt.Errorf("application '%s' uses features which are not supported: %s",
+			app.Name, strings.Join(unsupported, ", "))
+	}
+	return nil
+}
+
+// checkSupportedGenerators returns an error when an ApplicationSet uses generators which are not implemented,
+// which would otherwise generate no Application
+func checkSupportedGenerators(appSet *argoappv1.ApplicationSet) error {
+	data, err := json.Marshal(appSet.Spec.Generators)
+	if err != nil {
+		return err
+	}
+	var generators []map[string]interface{}
+	if err := json.Unmarshal(data, &generators); err != nil {
+		return err
+	}
+	found := map[string]bool{}
+	collectUnsupportedGenerators(generators, found)
+	if len(found) == 0 {
+		return nil
+	}
+	var names []string
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("ApplicationSet '%s' uses generators which are not supported: %s",
+		appSet.Name, strings.Join(names, ", "))
+}
+
+// collectUnsupportedGenerators collects the generators which are not implemented, including the nested ones
+func collectUnsupportedGenerators(generators []map[string]interface{}, found map[string]bool) {
+	for _, generator := range generators {
+		for name, spec := range generator {
+			if name == "selector" {
+				continue
+			}
+			if !supportedGenerators[name] {
+				found[name] = true
+				continue
+			}
+			nested, _, _ := unstructured.NestedSlice(map[string]interface{}{"spec": spec}, "spec", "generators")
+			var children []map[string]interface{}
+			for _, n := range nested {
+				if child, ok := n.(map[string]interface{}); ok {
+					children = append(children, child)
+				}
+			}
+			collectUnsupportedGenerators(children, found)
+		}
+	}
+}
+
+// checkStrictApplicationSet returns an error when the first ApplicationSet of a manifest has fields which are not known
+func checkStrictApplicationSet(filename string) error {
+	data, err := readManifestFile(filename)
+	if err != nil {
+		return err
+	}
+	objs, err := splitManifests(data, filename)
+	if err != nil {
+		return err
+	}
+	for _, obj := range objs {
+		if obj.GetKind() != "ApplicationSet" {
+			continue
+		}
+		var appSet argoappv1.ApplicationSet
+		if err := decodeResource(obj, &appSet); err != nil {
+			return fmt.Errorf("failed to construct ApplicationSet '%s': %w", obj.GetName(), err)
+		}
+		return nil
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package preview
+
+import (
+	"testing"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// TestDecodeResourceStrict verifies that the fields which are not known only fail in strict mode
+func TestDecodeResourceStrict(t *testing.T) {
+	obj := &unstructured.Unstructured{}
+	require.NoError(t, yaml.Unmarshal([]byte(`apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: web
+spec:
+  source:
+    repoURL: https://github.com/example/web.git
+    helm:
+      valueFile: values-prod.yaml
+`), &obj.Object))
+
+	var app argoappv1.Application
+	require.NoError(t, decodeResource(obj, &app))
+
+	strictMode = true
+	defer func() { strictMode = false }()
+	require.ErrorContains(t, decodeResource(obj, &app), `unknown field "valueFile"`)
+}
+
+// TestCheckSupportedApplication verifies that the features which are not implemented are reported
+func TestCheckSupportedApplication(t *testing.T) {
+	app := argoappv1.Application{
+		ObjectMeta: metav1.ObjectMeta{Name: "web"},
+		Spec: argoappv1.ApplicationSpec{Source: &argoappv1.ApplicationSource{
+			RepoURL: "https://github.com/example/web.git",
+			Path:    "deploy",
+		}},
+	}
+	require.NoError(t, checkSupportedApplication(app))
+
+	app.Spec.Source.Plugin = &argoappv1.ApplicationSourcePlugin{Name: "envsubst"}
+	require.EqualError(t, checkSupportedApplication(app),
+		"application 'web' uses features which are not supported: the config management plugin of source 0")
+}
+
+// TestCheckSupportedGenerators verifies that the generators which are not implemented are reported,
+// including the nested ones
+func TestCheckSupportedGenerators(t *testing.T) {
+	var appSet argoappv1.ApplicationSet
+	require.NoError(t, yaml.Unmarshal([]byte(`metadata:
+  name: apps
+spec:
+  generators:
+    - list:
+        elements: [{name: a}]
+    - matrix:
+        generators:
+          - git:
+              repoURL: https://github.com/example/apps.git
+              revision: HEAD
+              directories: [{path: apps/*}]
+          - list:
+              elements: [{env: prod}]
+`), &appSet))
+	require.EqualError(t, checkSupportedGenerators(&appSet),
+		"ApplicationSet 'apps' uses generators which are not supported: git")
+
+	appSet.Spec.Generators = appSet.Spec.Generators[:1]
+	require.NoError(t, checkSupportedGenerators(&appSet))
+}
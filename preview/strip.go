@@ -0,0 +1,167 @@
+package preview
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	resourceutil "github.com/argoproj/gitops-engine/pkg/sync/resource"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Profiles of the metadata stripped from the rendered resources with --strip
+const (
+	// stripTestHooks removes the Helm test hooks, run by helm test only
+	stripTestHooks = "test-hooks"
+	// stripArgoCDMetadata removes the annotations and labels only read by Argo CD and argocd-offline-cli: the sync
+	// waves, hooks and options, the tracking annotation, the tracking label when the resources are tracked by label,
+	// and the origin annotations
+	stripArgoCDMetadata = "argocd-metadata"
+	// stripNullFields removes the fields set to null, e.g. the creationTimestamp of the resources generated by
+	// client-go based tools, and the empty status
+	stripNullFields = "null-fields"
+	// stripAll is all the profiles
+	stripAll = "all"
+)
+
+// stripProfileNames are the profiles, in the order they are documented
+var stripProfileNames = []string{stripTestHooks, stripArgoCDMetadata, stripNullFields}
+
+// helmTestHookTypes are the values of the helm.sh/hook annotation of the Helm test hooks
+var helmTestHookTypes = []string{"test", "test-success", "test-failure"}
+
+// argoCDMetadataAnnotations are the annotations stripped by the argocd-metadata profile. The other argocd.argoproj.io
+// keys are kept, e.g. the secret-type label of the Argo CD Secrets is needed to re-apply them.
+var argoCDMetadataAnnotations = []string{
+	"argocd.argoproj.io/sync-wave",
+	"argocd.argoproj.io/hook",
+	"argocd.argoproj.io/hook-delete-policy",
+	"argocd.argoproj.io/sync-options",
+	"argocd.argoproj.io/compare-options",
+	"argocd.argoproj.io/tracking-id",
+	originAnnotationRepo,
+	originAnnotationPath,
+	originAnnotationChart,
+	originAnnotationRevision,
+	originAnnotationValuesFiles,
+	originAnnotationTemplate,
+}
+
+// stripProfiles holds the profiles of the metadata stripped from the rendered resources, so that the output can be
+// applied with kubectl without carrying the preview-only metadata into the cluster.
+// A nil stripProfiles strips nothing.
+type stripProfiles struct {
+	testHooks      bool
+	argoCDMetadata bool
+	nullFields     bool
+}
+
+// newStripProfiles parses the profiles given with --strip, nil when none
+func newStripProfiles(profiles []string) (*stripProfiles, error) {
+	if len(profiles) == 0 {
+		return nil, nil
+	}
+	s := &stripProfiles{}
+	for _, profile := range profiles {
+		switch profile {
+		case stripTestHooks:
+			s.testHooks = true
+		case stripArgoCDMetadata:
+			s.argoCDMetadata = true
+		case stripNullFields:
+			s.nullFields = true
+		case stripAll:
+			s.testHooks, s.argoCDMetadata, s.nullFields = true, true, true
+		default:
+			return nil, fmt.Errorf("unknown strip profile '%s', expected one of: %s", profile,
+				strings.Join(append(slices.Clone(stripProfileNames), stripAll), "|"))
+		}
+	}
+	return s, nil
+}
+
+// apply strips the rendered manifests of an Application, in JSON
+func (s *stripProfiles) apply(app argoappv1.Application, manifests []string) ([]string, error) {
+	if s == nil {
+		return manifests, nil
+	}
+	stripped := make([]string, 0, len(manifests))
+	for _, manifest := range manifests {
+		obj := unstructured.Unstructured{}
+		if err := json.Unmarshal([]byte(manifest), &obj); err != nil {
+			return nil, fmt.Errorf("failed to parse manifest: %w", err)
+		}
+		if s.testHooks && isHelmTestHook(&obj) {
+			log.Debugf("Stripping the Helm test hook %s of Application '%s'", newResourceKey(&obj), app.Name)
+			continue
+		}
+		s.stripResource(&obj)
+		data, err := json.Marshal(obj.Object)
+		if err != nil {
+			return nil, err
+		}
+		stripped = append(stripped, string(data))
+	}
+	return stripped, nil
+}
+
+// stripResource strips the metadata and fields of a resource
+func (s *stripProfiles) stripResource(obj *unstructured.Unstructured) {
+	if s.argoCDMetadata {
+		obj.SetAnnotations(withoutKeys(obj.GetAnnotations(), argoCDMetadataAnnotations))
+		if key := currentArgoCDExport.trackingLabelKey(); key != "" {
+			obj.SetLabels(withoutKeys(obj.GetLabels(), []string{key}))
+		}
+	}
+	if s.nullFields {
+		removeNullFields(obj.Object)
+		if status, ok := obj.Object["status"].(map[string]interface{}); ok && len(status) == 0 {
+			delete(obj.Object, "status")
+		}
+	}
+}
+
+// isHelmTestHook returns whether a resource is a Helm test hook
+func isHelmTestHook(obj *unstructured.Unstructured) bool {
+	for _, hookType := range resourceutil.GetAnnotationCSVs(obj, "helm.sh/hook") {
+		if slices.Contains(helmTestHookTypes, hookType) {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutKeys returns the annotations or labels without the given keys, nil when none is left
+func withoutKeys(values map[string]string, keys []string) map[string]string {
+	kept := map[string]string{}
+	for key, value := range values {
+		if !slices.Contains(keys, key) {
+			kept[key] = value
+		}
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+	return kept
+}
+
+// removeNullFields removes the fields set to null from a map and the maps it holds, in lists included
+func removeNullFields(obj map[string]interface{}) {
+	for key, value := range obj {
+		switch v := value.(type) {
+		case nil:
+			delete(obj, key)
+		case map[string]interface{}:
+			removeNullFields(v)
+		case []interface{}:
+			for _, item := range v {
+				if m, ok := item.(map[string]interface{}); ok {
+					removeNullFields(m)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package preview
+
+import (
+	"encoding/json"
+	"testing"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// TestStripProfiles verifies that each profile strips its metadata only, and that the unknown profiles fail
+func TestStripProfiles(t *testing.T) {
+	strip, err := newStripProfiles(nil)
+	require.NoError(t, err)
+	require.Nil(t, strip)
+	_, err = newStripProfiles([]string{"status"})
+	require.EqualError(t, err,
+		"unknown strip profile 'status', expected one of: test-hooks|argocd-metadata|null-fields|all")
+
+	deployment := newTestResource("apps/v1", "Deployment", "web", map[string]interface{}{
+		"template": map[string]interface{}{
+			"metadata": map[string]interface{}{"creationTimestamp": nil},
+			"spec": map[string]interface{}{
+				"containers": []interface{}{map[string]interface{}{"name": "web", "resources": nil}},
+			},
+		},
+	})
+	deployment.SetAnnotations(map[string]string{
+		"argocd.argoproj.io/sync-wave":    "1",
+		"argocd-offline-cli/source-repo":  "https://github.com/example/apps",
+		"deployment.kubernetes.io/ignore": "true",
+	})
+	deployment.SetLabels(map[string]string{"app.kubernetes.io/instance": "web"})
+	deployment.Object["status"] = map[string]interface{}{}
+	require.NoError(t, unstructured.SetNestedField(deployment.Object, nil, "metadata", "creationTimestamp"))
+	testHook := newTestResource("v1", "Pod", "web-test", nil)
+	testHook.SetAnnotations(map[string]string{"helm.sh/hook": "test,post-install"})
+	installHook := newTestResource("batch/v1", "Job", "web-migrate", nil)
+	installHook.SetAnnotations(map[string]string{"helm.sh/hook": "post-install"})
+	var manifests []string
+	for _, obj := range []unstructured.Unstructured{deployment, testHook, installHook} {
+		data, err := json.Marshal(obj.Object)
+		require.NoError(t, err)
+		manifests = append(manifests, string(data))
+	}
+
+	strip, err = newStripProfiles([]string{stripTestHooks})
+	require.NoError(t, err)
+	stripped, err := strip.apply(argoappv1.Application{}, manifests)
+	require.NoError(t, err)
+	require.Equal(t, []string{manifests[0], manifests[2]}, stripped)
+
+	// The tracking label is only stripped when the resources are tracked by label
+	currentArgoCDExport = &argoCDExport{appLabelKey: "app.kubernetes.io/instance", trackingMethod: "label"}
+	t.Cleanup(func() { currentArgoCDExport = nil })
+	strip, err = newStripProfiles([]string{stripArgoCDMetadata, stripNullFields})
+	require.NoError(t, err)
+	stripped, err = strip.apply(argoappv1.Application{}, manifests[:1])
+	require.NoError(t, err)
+	resources, err := parseManifests(stripped)
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]interface{}{
+			"name":        "web",
+			"namespace":   "default",
+			"annotations": map[string]interface{}{"deployment.kubernetes.io/ignore": "true"},
+		},
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{},
+				"spec": map[string]interface{}{
+					"containers": []interface{}{map[string]interface{}{"name": "web"}},
+				},
+			},
+		},
+	}, resources[0].Object)
+
+	strip, err = newStripProfiles([]string{stripAll})
+	require.NoError(t, err)
+	stripped, err = strip.apply(argoappv1.Application{}, manifests)
+	require.NoError(t, err)
+	require.Len(t, stripped, 2)
+}
+
+// TestStripArgoCDMetadataKeepsSecretType verifies that the argocd-metadata profile only strips the Argo CD keys of
+// the preview, keeping the label the Argo CD Secrets need to be re-applied, and the tracking label without label
+// tracking
+func TestStripArgoCDMetadataKeepsSecretType(t *testing.T) {
+	secret := newTestResource("v1", "Secret", "repo", nil)
+	secret.SetLabels(map[string]string{
+		"argocd.argoproj.io/secret-type": "repository",
+		"app.kubernetes.io/instance":     "argocd",
+	})
+	secret.SetAnnotations(map[string]string{
+		"argocd.argoproj.io/tracking-id": "argocd:/Secret:argocd/repo",
+		"argocd.argoproj.io/sync-wave":   "-1",
+	})
+	data, err := json.Marshal(secret.Object)
+	require.NoError(t, err)
+
+	strip, err := newStripProfiles([]string{stripArgoCDMetadata})
+	require.NoError(t, err)
+	stripped, err := strip.apply(argoappv1.Application{}, []string{string(data)})
+	require.NoError(t, err)
+	resources, err := parseManifests(stripped)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"argocd.argoproj.io/secret-type": "repository",
+		"app.kubernetes.io/instance":     "argocd",
+	}, resources[0].GetLabels())
+	require.Empty(t, resources[0].GetAnnotations())
+}
@@ -0,0 +1,247 @@
+package preview
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"sigs.k8s.io/yaml"
+)
+
+// plainPathKey matches the map keys written as is in a YAML path, the others being quoted, e.g.
+// metadata.annotations["argocd.argoproj.io/sync-wave"]
+var plainPathKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// structuralChange is a change of the value at a YAML path of a resource.
+// Old is nil for an added path, New is nil for a removed one.
+type structuralChange struct {
+	path    string
+	old     interface{}
+	new     interface{}
+	added   bool
+	removed bool
+}
+
+// structuralChanges returns the changes between the old and new values at a YAML path, by path: the maps are
+// compared by key, the lists of named items (containers, env, ports...) by name, and the other lists by index
+func structuralChanges(path string, old interface{}, new interface{}) []structuralChange {
+	if reflect.DeepEqual(old, new) {
+		return nil
+	}
+	oldMap, oldIsMap := old.(map[string]interface{})
+	newMap, newIsMap := new.(map[string]interface{})
+	if oldIsMap && newIsMap {
+		keys := make([]string, 0, len(oldMap)+len(newMap))
+		for key := range oldMap {
+			keys = append(keys, key)
+		}
+		for key := range newMap {
+			if _, ok := oldMap[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		var changes []structuralChange
+		for _, key := range keys {
+			changes = append(changes, childChanges(pathOfKey(path, key), oldMap, newMap, key)...)
+		}
+		return changes
+	}
+	oldList, oldIsList := old.([]interface{})
+	newList, newIsList := new.([]interface{})
+	if oldIsList && newIsList {
+		if oldNamed, newNamed := namedItems(oldList), namedItems(newList); oldNamed != nil && newNamed != nil {
+			var names []string
+			for _, list := range [][]interface{}{newList, oldList} {
+				for _, item := range list {
+					if name := item.(map[string]interface{})["name"].(string); !slices.Contains(names, name) {
+						names = append(names, name)
+					}
+				}
+			}
+			var changes []structuralChange
+			for _, name := range names {
+				changes = append(changes, childChanges(fmt.Sprintf("%s[name=%s]", path, name), oldNamed, newNamed,
+					name)...)
+			}
+			return changes
+		}
+		var changes []structuralChange
+		for i := 0; i < len(oldList) || i < len(newList); i++ {
+			itemPath := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(oldList):
+				changes = append(changes, structuralChange{path: itemPath, new: newList[i], added: true})
+			case i >= len(newList):
+				changes = append(changes, structuralChange{path: itemPath, old: oldList[i], removed: true})
+			default:
+				changes = append(changes, structuralChanges(itemPath, oldList[i], newList[i])...)
+			}
+		}
+		return changes
+	}
+	return []structuralChange{{path: path, old: old, new: new}}
+}
+
+// childChanges returns the changes of the child with the given key of the old and new maps
+func childChanges(
+	path string,
+	old map[string]interface{},
+	new map[string]interface{},
+	key string,
+) []structuralChange {
+	oldValue, inOld := old[key]
+	newValue, inNew := new[key]
+	switch {
+	case !inOld:
+		return []structuralChange{{path: path, new: newValue, added: true}}
+	case !inNew:
+		return []structuralChange{{path: path, old: oldValue, removed: true}}
+	}
+	return structuralChanges(path, oldValue, newValue)
+}
+
+// namedItems returns the items of a list by name, nil when the items are not all maps with a distinct name
+func namedItems(list []interface{}) map[string]interface{} {
+	items := make(map[string]interface{}, len(list))
+	for _, item := range list {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		name, ok := m["name"].(string)
+		if !ok {
+			return nil
+		}
+		if _, duplicate := items[name]; duplicate {
+			return nil
+		}
+		items[name] = item
+	}
+	return items
+}
+
+// pathOfKey returns the YAML path of the child with the given key of the map at a path
+func pathOfKey(path string, key string) string {
+	if !plainPathKey.MatchString(key) {
+		return path + "[" + strconv.Quote(key) + "]"
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// printStructuralDiff prints the changed YAML paths of each modified resource with their old and new values, and
+// the added and removed resource keys
+func printStructuralDiff(w io.Writer, diffs []resourceDiff) error {
+	for _, d := range diffs {
+		switch d.action() {
+		case diffActionAdded:
+			fmt.Fprintf(w, "  + %s\n", d.Key)
+		case diffActionRemoved:
+			fmt.Fprintf(w, "  - %s\n", d.Key)
+		default:
+			fmt.Fprintf(w, "  ~ %s\n", d.Key)
+			for _, change := range structuralChanges("", d.Old.Object, d.New.Object) {
+				if err := printStructuralChange(w, change, "      "); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// printStructuralChange prints a change: "path: old → new" for the scalar values, the YAML of the added and removed
+// values, and the changed lines of the multi-line strings
+func printStructuralChange(w io.Writer, change structuralChange, indent string) error {
+	switch {
+	case change.added:
+		return printStructuralValue(w, indent+"+ "+change.path, change.new, indent+"    ")
+	case change.removed:
+		return printStructuralValue(w, indent+"- "+change.path, change.old, indent+"    ")
+	}
+	oldText, oldOK := change.old.(string)
+	newText, newOK := change.new.(string)
+	if oldOK && newOK && (strings.Contains(oldText, "\n") || strings.Contains(newText, "\n")) {
+		fmt.Fprintf(w, "%s%s:\n", indent, change.path)
+		diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:       difflib.SplitLines(oldText),
+			B:       difflib.SplitLines(newText),
+			Context: 0,
+		})
+		if err != nil {
+			return err
+		}
+		for _, line := range strings.Split(diff, "\n") {
+			if line != "" && !strings.HasPrefix(line, "@@") {
+				fmt.Fprintf(w, "%s    %s\n", indent, line)
+			}
+		}
+		return nil
+	}
+	oldValue, oldScalar, err := scalarYAML(change.old)
+	if err != nil {
+		return err
+	}
+	newValue, newScalar, err := scalarYAML(change.new)
+	if err != nil {
+		return err
+	}
+	if oldScalar && newScalar {
+		_, err := fmt.Fprintf(w, "%s%s: %s → %s\n", indent, change.path, oldValue, newValue)
+		return err
+	}
+	// A scalar replaced by a map or a list, or the other way around
+	if err := printStructuralValue(w, indent+"- "+change.path, change.old, indent+"    "); err != nil {
+		return err
+	}
+	return printStructuralValue(w, indent+"+ "+change.path, change.new, indent+"    ")
+}
+
+// printStructuralValue prints a value after its label, on the same line when it is a scalar, as an indented YAML
+// block otherwise
+func printStructuralValue(w io.Writer, label string, value interface{}, indent string) error {
+	text, scalar, err := scalarYAML(value)
+	if err != nil {
+		return err
+	}
+	if scalar {
+		_, err := fmt.Fprintf(w, "%s: %s\n", label, text)
+		return err
+	}
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%s:\n", label)
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		fmt.Fprintf(w, "%s%s\n", indent, line)
+	}
+	return nil
+}
+
+// scalarYAML returns the YAML of a value on one line, and whether it is a scalar: the strings are quoted when they
+// would be read as another type, e.g. "3"
+func scalarYAML(value interface{}) (string, bool, error) {
+	switch v := value.(type) {
+	case map[string]interface{}, []interface{}:
+		return "", false, nil
+	case string:
+		if strings.Contains(v, "\n") {
+			return "", false, nil
+		}
+	}
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		return "", false, err
+	}
+	return strings.TrimSuffix(string(data), "\n"), true, nil
+}
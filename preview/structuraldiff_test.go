@@ -0,0 +1,58 @@
+package preview
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// TestPrintStructuralDiff verifies that the changed YAML paths are printed with their old and new values, the
+// named list items being matched by name and the other ones by index
+func TestPrintStructuralDiff(t *testing.T) {
+	oldWeb := newTestResource("apps/v1", "Deployment", "web", map[string]interface{}{
+		"replicas": int64(2),
+		"containers": []interface{}{
+			map[string]interface{}{"name": "sidecar", "image": "envoy:1.28"},
+			map[string]interface{}{"name": "web", "image": "web:1.0", "args": []interface{}{"--port", "80"}},
+		},
+	})
+	oldWeb.SetAnnotations(map[string]string{"argocd.argoproj.io/sync-wave": "1"})
+	newWeb := newTestResource("apps/v1", "Deployment", "web", map[string]interface{}{
+		"replicas": int64(3),
+		"containers": []interface{}{
+			map[string]interface{}{"name": "web", "image": "web:1.1", "args": []interface{}{"--port", "8080", "-v"}},
+		},
+		"strategy": map[string]interface{}{"type": "Recreate"},
+	})
+	newWeb.SetAnnotations(map[string]string{"argocd.argoproj.io/sync-wave": "2"})
+	oldConfig := newTestResource("v1", "ConfigMap", "config", nil)
+	oldConfig.Object["data"] = map[string]interface{}{"app.conf": "a=1\nb=2\n"}
+	newConfig := newTestResource("v1", "ConfigMap", "config", nil)
+	newConfig.Object["data"] = map[string]interface{}{"app.conf": "a=1\nb=3\n"}
+	diffs := diffResources(
+		[]unstructured.Unstructured{oldWeb, oldConfig, newTestResource("v1", "Service", "old", nil)},
+		[]unstructured.Unstructured{newWeb, newConfig},
+	)
+
+	var out bytes.Buffer
+	require.NoError(t, printStructuralDiff(&out, diffs))
+	require.Equal(t, `  ~ ConfigMap default/config
+      data["app.conf"]:
+          -b=2
+          +b=3
+  - Service default/old
+  ~ apps/Deployment default/web
+      metadata.annotations["argocd.argoproj.io/sync-wave"]: "1" → "2"
+      spec.containers[name=web].args[1]: "80" → "8080"
+      + spec.containers[name=web].args[2]: -v
+      spec.containers[name=web].image: web:1.0 → web:1.1
+      - spec.containers[name=sidecar]:
+          image: envoy:1.28
+          name: sidecar
+      spec.replicas: 2 → 3
+      + spec.strategy:
+          type: Recreate
+`, out.String())
+}
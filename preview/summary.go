@@ -0,0 +1,111 @@
+package preview
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// summarizeDiffs returns a short human-readable summary of the diffs, e.g.
+// "image nginx 1.24→1.25, replicas 2→3 (Deployment web), new NetworkPolicy deny-all added"
+func summarizeDiffs(diffs []resourceDiff) string {
+	var changes []string
+	seen := map[string]bool{}
+	add := func(change string) {
+		if !seen[change] {
+			seen[change] = true
+			changes = append(changes, change)
+		}
+	}
+	for _, d := range diffs {
+		name := d.Key.Kind + " " + d.Key.Name
+		switch d.action() {
+		case diffActionAdded:
+			add("new " + name + " added")
+		case diffActionRemoved:
+			add(name + " removed")
+		default:
+			summary, others := summarizeModification(d.Old, d.New)
+			for _, change := range summary {
+				add(change)
+			}
+			if others {
+				add(name + " changed")
+			}
+		}
+	}
+	if len(changes) == 0 {
+		return "no changes"
+	}
+	return strings.Join(changes, ", ")
+}
+
+// summarizeModification returns the image and replicas changes of a modified resource,
+// and whether other fields changed
+func summarizeModification(oldObj *unstructured.Unstructured, newObj *unstructured.Unstructured) ([]string, bool) {
+	var changes []string
+	// The summarized changes are reverted on a copy, to find out whether other fields changed
+	reverted := newObj.DeepCopy()
+
+	oldImages := map[string]string{}
+	for _, c := range containerImages(oldObj) {
+		oldImages[c.Container] = c.Image
+	}
+	for _, c := range containerImages(newObj) {
+		oldImage, ok := oldImages[c.Container]
+		if !ok || oldImage == c.Image {
+			continue
+		}
+		changes = append(changes, summarizeImageChange(oldImage, c.Image))
+		setContainerImage(reverted, c.Container, oldImage)
+	}
+
+	oldReplicas, oldFound, _ := unstructured.NestedInt64(oldObj.Object, "spec", "replicas")
+	newReplicas, newFound, _ := unstructured.NestedInt64(newObj.Object, "spec", "replicas")
+	if oldFound && newFound && oldReplicas != newReplicas {
+		changes = append(changes, fmt.Sprintf("replicas %d→%d (%s %s)",
+			oldReplicas, newReplicas, newObj.GetKind(), newObj.GetName()))
+		_ = unstructured.SetNestedField(reverted.Object, oldReplicas, "spec", "replicas")
+	}
+	return changes, !reflect.DeepEqual(oldObj.Object, reverted.Object)
+}
+
+// summarizeImageChange describes an image change as "image <repository> <old tag>→<new tag>"
+// when the repository is the same, as "image <old>→<new>" otherwise
+func summarizeImageChange(oldImage string, newImage string) string {
+	oldTag, newTag := imageTag(oldImage), imageTag(newImage)
+	oldRepo := strings.TrimSuffix(strings.SplitN(oldImage, "@", 2)[0], ":"+oldTag)
+	newRepo := strings.TrimSuffix(strings.SplitN(newImage, "@", 2)[0], ":"+newTag)
+	if oldRepo == newRepo && oldTag != newTag {
+		return fmt.Sprintf("image %s %s→%s", newRepo, orNone(oldTag), orNone(newTag))
+	}
+	return fmt.Sprintf("image %s→%s", oldImage, newImage)
+}
+
+// orNone returns the value, or "none" when empty
+func orNone(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return value
+}
+
+// setContainerImage sets the image of a container of a workload resource
+func setContainerImage(obj *unstructured.Unstructured, container string, image string) {
+	path := podSpecPaths[obj.GetKind()]
+	for _, field := range []string{"initContainers", "containers", "ephemeralContainers"} {
+		fieldPath := append(append([]string{}, path...), field)
+		containers, found, _ := unstructured.NestedSlice(obj.Object, fieldPath...)
+		if !found {
+			continue
+		}
+		for _, c := range containers {
+			if m, ok := c.(map[string]interface{}); ok && m["name"] == container {
+				m["image"] = image
+			}
+		}
+		_ = unstructured.SetNestedSlice(obj.Object, containers, fieldPath...)
+	}
+}
@@ -0,0 +1,64 @@
+package preview
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newTestDeployment(replicas int64, image string, env string) unstructured.Unstructured {
+	return newTestResource("apps/v1", "Deployment", "web", map[string]interface{}{
+		"replicas": replicas,
+		"template": map[string]interface{}{
+			"spec": map[string]interface{}{
+				"containers": []interface{}{
+					map[string]interface{}{"name": "web", "image": image, "env": env},
+				},
+			},
+		},
+	})
+}
+
+// TestSummarizeDiffs verifies the human-readable summary of the diffs
+func TestSummarizeDiffs(t *testing.T) {
+	tests := []struct {
+		name     string
+		old      []unstructured.Unstructured
+		new      []unstructured.Unstructured
+		expected string
+	}{
+		{
+			name:     "no changes",
+			old:      []unstructured.Unstructured{newTestDeployment(2, "nginx:1.24", "prod")},
+			new:      []unstructured.Unstructured{newTestDeployment(2, "nginx:1.24", "prod")},
+			expected: "no changes",
+		},
+		{
+			name:     "image and replicas",
+			old:      []unstructured.Unstructured{newTestDeployment(2, "nginx:1.24", "prod")},
+			new:      []unstructured.Unstructured{newTestDeployment(3, "nginx:1.25", "prod")},
+			expected: "image nginx 1.24→1.25, replicas 2→3 (Deployment web)",
+		},
+		{
+			name:     "image repository and other fields",
+			old:      []unstructured.Unstructured{newTestDeployment(2, "nginx:1.24", "prod")},
+			new:      []unstructured.Unstructured{newTestDeployment(2, "registry.example.com:5000/nginx", "staging")},
+			expected: "image nginx:1.24→registry.example.com:5000/nginx, Deployment web changed",
+		},
+		{
+			name: "added and removed",
+			old:  []unstructured.Unstructured{newTestResource("v1", "ConfigMap", "old", nil)},
+			new: []unstructured.Unstructured{
+				newTestResource("networking.k8s.io/v1", "NetworkPolicy", "deny-all", nil),
+				newTestResource("v1", "Service", "web", map[string]interface{}{"port": int64(80)}),
+			},
+			expected: "ConfigMap old removed, new Service web added, new NetworkPolicy deny-all added",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, summarizeDiffs(diffResources(tt.old, tt.new)))
+		})
+	}
+}
@@ -0,0 +1,394 @@
+package preview
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/argoproj/argo-cd/v3/reposerver/repository"
+	synccommon "github.com/argoproj/gitops-engine/pkg/sync/common"
+	"github.com/argoproj/gitops-engine/pkg/sync/hook"
+	helmhook "github.com/argoproj/gitops-engine/pkg/sync/hook/helm"
+	resourceutil "github.com/argoproj/gitops-engine/pkg/sync/resource"
+	"github.com/argoproj/gitops-engine/pkg/sync/syncwaves"
+	"github.com/argoproj/gitops-engine/pkg/utils/kube"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// SyncPlanOptions holds the settings of the sync-plan command
+type SyncPlanOptions struct {
+	// AppName restricts the plan to the Application with this name
+	AppName string
+	// Recursive also renders the child Applications, to plan the Applications they manage in turn
+	Recursive bool
+	// Resources also plans the other resources of the Applications, with the way Argo CD would sync each of them
+	Resources bool
+	// SyncOptions overrides the sync options of the planned Applications, as argocd app sync --sync-option does
+	SyncOptions []string
+	// Force simulates a forced sync of the planned Applications, as argocd app sync --force does
+	Force bool
+}
+
+// syncWave is a wave of child Applications and resources, synced together once the previous waves are healthy
+type syncWave struct {
+	wave      int
+	apps      []plannedApp
+	resources []plannedResource
+}
+
+// plannedApp is an Application of a sync plan, along with the waves of its own child Applications and its hooks
+// when rendered
+type plannedApp struct {
+	app      argoappv1.Application
+	method   syncMethod
+	hooks    []plannedHook
+	children []syncWave
+}
+
+// plannedHook is a hook of an Application, run by the sync rather than applied, and deleted by its delete policies
+type plannedHook struct {
+	key            resourceKey
+	types          []synccommon.HookType
+	deletePolicies []synccommon.HookDeletePolicy
+	// defaultPolicy is set when the hook has no delete policy annotation, the default policy applying
+	defaultPolicy bool
+}
+
+// plannedResource is a resource of a sync plan other than an Application
+type plannedResource struct {
+	key    resourceKey
+	method syncMethod
+}
+
+// appSync holds the settings of the sync of an Application its resources are planned with
+type appSync struct {
+	// namespace is the destination namespace, the namespace of the namespaced resources without one
+	namespace string
+	// options are the sync options of the sync operation, the ones of the sync policy by default
+	options argoappv1.SyncOptions
+	// force is set for a forced sync, the resources being deleted and recreated when they can't be patched
+	force bool
+}
+
+// syncMethod is the way Argo CD syncs a resource, e.g. kubectl apply or kubectl replace
+type syncMethod struct {
+	// command is the kubectl command the resource is synced with, e.g. "apply" or "replace --force"
+	command string
+	// warning describes the side effect of the command, e.g. that the resource is deleted and recreated
+	warning string
+	// recreates is set when the resource is deleted and recreated when it can't be patched
+	recreates bool
+}
+
+// String returns the method as "command", or "command (warning)" when it has a side effect
+func (m syncMethod) String() string {
+	if m.warning == "" {
+		return m.command
+	}
+	return m.command + " (" + m.warning + ")"
+}
+
+// PlanApplicationSync prints the order in which Argo CD would sync the child Applications of the Applications
+// defined in a manifest, by sync wave
+func PlanApplicationSync(filename string, opts SyncPlanOptions) {
+	repoService, err := newRepoService()
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, app := range loadApplications(filename) {
+		if shouldMatch(opts.AppName) && opts.AppName != app.Name {
+			continue
+		}
+		planned := plannedApp{app: app}
+		err := planApplication(repoService, &planned, opts.appSync(app), opts.Recursive, map[string]bool{app.Name: true})
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("application/%s\n", app.Name)
+		printPlannedApp(os.Stdout, planned, 1)
+		printSyncPlan(os.Stdout, planned.children, 1)
+	}
+}
+
+// appSync returns the settings of the sync of a planned Application, nil when the resources are not planned, which
+// overriding the sync options or forcing the sync implies. The sync options default to the ones of its sync policy.
+func (opts SyncPlanOptions) appSync(app argoappv1.Application) *appSync {
+	if !opts.Resources && opts.SyncOptions == nil && !opts.Force {
+		return nil
+	}
+	sync := newAppSync(app)
+	if opts.SyncOptions != nil {
+		sync.options = opts.SyncOptions
+	}
+	sync.force = opts.Force
+	return sync
+}
+
+// newAppSync returns the settings of an automated sync of an Application, with the options of its sync policy
+func newAppSync(app argoappv1.Application) *appSync {
+	sync := &appSync{namespace: app.Spec.Destination.Namespace}
+	if app.Spec.SyncPolicy != nil {
+		sync.options = app.Spec.SyncPolicy.SyncOptions
+	}
+	return sync
+}
+
+// planApplication renders a planned Application, to plan its hooks and group the Applications it manages by sync
+// wave, rendering them in turn when recursive, along with the other resources when sync is set. visited holds the
+// Applications being planned, to stop on cycles.
+func planApplication(
+	repoService *repository.Service,
+	planned *plannedApp,
+	sync *appSync,
+	recursive bool,
+	visited map[string]bool,
+) error {
+	app := planned.app
+	rendered, err := generateAppManifests(repoService, app)
+	if err != nil {
+		return err
+	}
+	resources, err := parseManifests(allManifests(rendered))
+	if err != nil {
+		return err
+	}
+	planned.hooks = syncHooks(resources, app.Spec.Destination.Namespace)
+	planned.children, err = syncWaves(resources, sync)
+	if err != nil {
+		return fmt.Errorf("invalid child Application of '%s': %w", app.Name, err)
+	}
+	if !recursive {
+		return nil
+	}
+	for _, wave := range planned.children {
+		for i := range wave.apps {
+			child := wave.apps[i].app
+			if visited[child.Name] {
+				log.Warnf("Application '%s' manages its ancestor '%s', not planning it again", app.Name, child.Name)
+				continue
+			}
+			visited[child.Name] = true
+			var childSync *appSync
+			if sync != nil {
+				childSync = newAppSync(child)
+			}
+			if err := planApplication(repoService, &wave.apps[i], childSync, true, visited); err != nil {
+				return err
+			}
+			delete(visited, child.Name)
+		}
+	}
+	return nil
+}
+
+// syncHooks returns the hooks among the rendered resources, Argo CD and Helm ones, with the policies they are
+// deleted by, BeforeHookCreation by default as in Argo CD
+func syncHooks(resources []unstructured.Unstructured, namespace string) []plannedHook {
+	var hooks []plannedHook
+	for i := range resources {
+		resource := &resources[i]
+		if !hook.IsHook(resource) {
+			continue
+		}
+		key := newResourceKey(resource)
+		if key.Namespace == "" && isNamespacedResource(resource) {
+			key.Namespace = namespace
+		}
+		hooks = append(hooks, plannedHook{
+			key:            key,
+			types:          hook.Types(resource),
+			deletePolicies: hook.DeletePolicies(resource),
+			defaultPolicy: len(resourceutil.GetAnnotationCSVs(resource, synccommon.AnnotationKeyHookDeletePolicy)) == 0 &&
+				len(helmhook.DeletePolicies(resource)) == 0,
+		})
+	}
+	sort.Slice(hooks, func(i, j int) bool { return hooks[i].key.String() < hooks[j].key.String() })
+	return hooks
+}
+
+// retryStrategy describes the retry strategy of the syncs of an Application: the number of attempts, and the
+// backoff between them with the defaults of Argo CD
+func retryStrategy(app argoappv1.Application) string {
+	if app.Spec.SyncPolicy == nil || app.Spec.SyncPolicy.Retry == nil || app.Spec.SyncPolicy.Retry.Limit == 0 {
+		return "none"
+	}
+	retry := app.Spec.SyncPolicy.Retry
+	limit := fmt.Sprintf("%d attempts", retry.Limit)
+	if retry.Limit < 0 {
+		limit = "unlimited attempts"
+	}
+	duration, factor, maxDuration := argoappv1.DefaultSyncRetryDuration.String(), argoappv1.DefaultSyncRetryFactor,
+		argoappv1.DefaultSyncRetryMaxDuration.String()
+	if retry.Backoff != nil {
+		if retry.Backoff.Duration != "" {
+			duration = backoffDuration(retry.Backoff.Duration)
+		}
+		if retry.Backoff.Factor != nil {
+			factor = *retry.Backoff.Factor
+		}
+		if retry.Backoff.MaxDuration != "" {
+			maxDuration = backoffDuration(retry.Backoff.MaxDuration)
+		}
+	}
+	description := fmt.Sprintf("%s, backoff %s x%d up to %s", limit, duration, factor, maxDuration)
+	if retry.Refresh {
+		description += ", retried with the latest revision"
+	}
+	return description
+}
+
+// backoffDuration returns a backoff duration with its unit, the durations without unit being seconds
+func backoffDuration(duration string) string {
+	if _, err := strconv.Atoi(duration); err == nil {
+		return duration + "s"
+	}
+	return duration
+}
+
+// syncWaves groups the Applications among the rendered resources by sync wave, in the order Argo CD syncs them:
+// by increasing wave, then by name within a wave. The Applications wrapped in Lists, e.g. by a Helm chart, are
+// unwrapped: the repository service only unwraps the top-level Lists. When sync is set, the other resources are
+// grouped too, bar the hooks, and the way each resource is synced with is planned.
+func syncWaves(resources []unstructured.Unstructured, sync *appSync) ([]syncWave, error) {
+	objs := make([]*unstructured.Unstructured, 0, len(resources))
+	for i := range resources {
+		objs = append(objs, &resources[i])
+	}
+	objs, err := unwrapLists(objs)
+	if err != nil {
+		return nil, err
+	}
+	byWave := map[int]*syncWave{}
+	waveOf := func(resource *unstructured.Unstructured) *syncWave {
+		wave := syncwaves.Wave(resource)
+		if byWave[wave] == nil {
+			byWave[wave] = &syncWave{wave: wave}
+		}
+		return byWave[wave]
+	}
+	for _, resource := range objs {
+		if resource.GroupVersionKind().Group != "argoproj.io" || resource.GetKind() != applicationKind {
+			if sync != nil && !hook.IsHook(resource) && !hook.Skip(resource) {
+				key := newResourceKey(resource)
+				if key.Namespace == "" && isNamespacedResource(resource) {
+					key.Namespace = sync.namespace
+				}
+				wave := waveOf(resource)
+				wave.resources = append(wave.resources, plannedResource{key: key, method: sync.method(resource)})
+			}
+			continue
+		}
+		var child argoappv1.Application
+		if err := decodeResource(resource, &child); err != nil {
+			return nil, fmt.Errorf("failed to construct Application '%s': %w", resource.GetName(), err)
+		}
+		planned := plannedApp{app: child}
+		if sync != nil {
+			planned.method = sync.method(resource)
+		}
+		wave := waveOf(resource)
+		wave.apps = append(wave.apps, planned)
+	}
+
+	waves := make([]syncWave, 0, len(byWave))
+	for _, wave := range byWave {
+		sort.Slice(wave.apps, func(i, j int) bool { return wave.apps[i].app.Name < wave.apps[j].app.Name })
+		sort.Slice(wave.resources, func(i, j int) bool {
+			return wave.resources[i].key.String() < wave.resources[j].key.String()
+		})
+		waves = append(waves, *wave)
+	}
+	sort.Slice(waves, func(i, j int) bool { return waves[i].wave < waves[j].wave })
+	return waves, nil
+}
+
+// method returns the way Argo CD syncs a resource, as gitops-engine decides it from the sync options of the
+// operation and the argocd.argoproj.io/sync-options annotation of the resource
+func (s *appSync) method(resource *unstructured.Unstructured) syncMethod {
+	replace := s.options.HasOption(synccommon.SyncOptionReplace) ||
+		resourceutil.HasAnnotationOption(resource, synccommon.AnnotationSyncOptions, synccommon.SyncOptionReplace)
+	force := s.force ||
+		resourceutil.HasAnnotationOption(resource, synccommon.AnnotationSyncOptions, synccommon.SyncOptionForce)
+	serverSideApply := !resourceutil.HasAnnotationOption(resource, synccommon.AnnotationSyncOptions,
+		synccommon.SyncOptionDisableServerSideApply) &&
+		(s.options.HasOption(synccommon.SyncOptionServerSideApply) || resourceutil.HasAnnotationOption(resource,
+			synccommon.AnnotationSyncOptions, synccommon.SyncOptionServerSideApply))
+	switch {
+	case replace && (kube.IsCRD(resource) || resource.GetKind() == kube.NamespaceKind):
+		// Replacing a CRD or a Namespace would delete what it holds, they are updated instead
+		return syncMethod{command: "update"}
+	case replace && force:
+		return syncMethod{command: "replace --force", warning: "deleted and recreated", recreates: true}
+	case replace:
+		return syncMethod{command: "replace", warning: "replaced as a whole rather than patched"}
+	case serverSideApply && force:
+		return syncMethod{command: "apply --server-side --force", warning: "fails, --force is rejected with --server-side"}
+	case serverSideApply:
+		return syncMethod{command: "apply --server-side"}
+	case force:
+		return syncMethod{command: "apply --force", warning: "deleted and recreated when the patch fails", recreates: true}
+	}
+	return syncMethod{command: "apply"}
+}
+
+// printPlannedApp prints the retry strategy of a planned Application, and its hooks when rendered
+func printPlannedApp(w io.Writer, planned plannedApp, depth int) {
+	indent := strings.Repeat("  ", depth)
+	fmt.Fprintf(w, "%sretry: %s\n", indent, retryStrategy(planned.app))
+	for _, h := range planned.hooks {
+		// The Helm hooks map to the same Argo CD hooks for installs and upgrades, e.g. post-install,post-upgrade
+		var types []string
+		for _, t := range h.types {
+			if !slices.Contains(types, string(t)) {
+				types = append(types, string(t))
+			}
+		}
+		var policies []string
+		for _, p := range h.deletePolicies {
+			if !slices.Contains(policies, string(p)) {
+				policies = append(policies, string(p))
+			}
+		}
+		sort.Strings(policies)
+		if len(types) == 0 {
+			// E.g. the Helm test hooks, which Argo CD does not run
+			fmt.Fprintf(w, "%shook %s: never run, its hook type is not supported by Argo CD\n", indent, h.key)
+			continue
+		}
+		if h.defaultPolicy {
+			policies[0] += " (default)"
+		}
+		fmt.Fprintf(w, "%shook %s %s: delete policy %s\n", indent, strings.Join(types, ","), h.key,
+			strings.Join(policies, ","))
+	}
+}
+
+// printSyncPlan prints the waves of a sync plan, the child Applications indented under their parent along with
+// their retry strategy and hooks. The way each resource is synced with is printed when planned.
+func printSyncPlan(w io.Writer, waves []syncWave, depth int) {
+	indent := strings.Repeat("  ", depth)
+	if len(waves) == 0 && depth == 1 {
+		fmt.Fprintf(w, "%sno child Application\n", indent)
+	}
+	for _, wave := range waves {
+		fmt.Fprintf(w, "%swave %d:\n", indent, wave.wave)
+		for _, planned := range wave.resources {
+			fmt.Fprintf(w, "%s  %s: %s\n", indent, planned.key, planned.method)
+		}
+		for _, planned := range wave.apps {
+			if planned.method.command == "" {
+				fmt.Fprintf(w, "%s  application/%s\n", indent, planned.app.Name)
+			} else {
+				fmt.Fprintf(w, "%s  application/%s: %s\n", indent, planned.app.Name, planned.method)
+			}
+			printPlannedApp(w, planned, depth+2)
+			printSyncPlan(w, planned.children, depth+2)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package preview
+
+import (
+	"bytes"
+	"testing"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// newTestChildApp returns a rendered child Application, in the given sync wave when set
+func newTestChildApp(name string, wave string) unstructured.Unstructured {
+	obj := newTestResource("argoproj.io/v1alpha1", "Application", name, map[string]interface{}{
+		"project": "default",
+	})
+	if wave != "" {
+		obj.SetAnnotations(map[string]string{"argocd.argoproj.io/sync-wave": wave})
+	}
+	return obj
+}
+
+// TestSyncWaves verifies that the child Applications are grouped by wave, in sync order
+func TestSyncWaves(t *testing.T) {
+	waves, err := syncWaves([]unstructured.Unstructured{
+		newTestChildApp("web", ""),
+		newTestChildApp("ingress", "-1"),
+		newTestChildApp("cert-manager", "-1"),
+		newTestChildApp("monitoring", "5"),
+		newTestResource("v1", "ConfigMap", "not-an-app", nil),
+		newTestChildApp("api", "0"),
+	}, nil)
+	require.NoError(t, err)
+
+	plan := map[int][]string{}
+	var order []int
+	for _, wave := range waves {
+		order = append(order, wave.wave)
+		for _, planned := range wave.apps {
+			plan[wave.wave] = append(plan[wave.wave], planned.app.Name)
+		}
+	}
+	require.Equal(t, []int{-1, 0, 5}, order)
+	require.Equal(t, map[int][]string{-1: {"cert-manager", "ingress"}, 0: {"api", "web"}, 5: {"monitoring"}}, plan)
+}
+
+// TestSyncWavesOfWrappedApplications verifies that the child Applications wrapped in nested Lists are planned
+func TestSyncWavesOfWrappedApplications(t *testing.T) {
+	app := newTestChildApp("web", "2")
+	list := unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "List",
+		"items": []interface{}{map[string]interface{}{
+			"apiVersion": "argoproj.io/v1alpha1",
+			"kind":       "ApplicationList",
+			"items":      []interface{}{app.Object},
+		}},
+	}}
+	waves, err := syncWaves([]unstructured.Unstructured{list}, nil)
+	require.NoError(t, err)
+	require.Len(t, waves, 1)
+	require.Equal(t, 2, waves[0].wave)
+	require.Equal(t, "web", waves[0].apps[0].app.Name)
+}
+
+// TestPrintSyncPlan verifies the indentation of the nested waves
+func TestPrintSyncPlan(t *testing.T) {
+	newApp := func(name string) argoappv1.Application {
+		app := argoappv1.Application{}
+		app.Name = name
+		return app
+	}
+	waves := []syncWave{
+		{wave: -1, apps: []plannedApp{{app: newApp("infra"), children: []syncWave{
+			{wave: 0, apps: []plannedApp{{app: newApp("cert-manager")}}},
+		}}}},
+		{wave: 0, apps: []plannedApp{{app: newApp("web")}}},
+	}
+	var out bytes.Buffer
+	printSyncPlan(&out, waves, 1)
+	require.Equal(t, `  wave -1:
+    application/infra
+      retry: none
+      wave 0:
+        application/cert-manager
+          retry: none
+  wave 0:
+    application/web
+      retry: none
+`, out.String())
+
+	out.Reset()
+	printSyncPlan(&out, []syncWave{{
+		wave: 0,
+		apps: []plannedApp{{app: newApp("web"), method: syncMethod{command: "apply"}}},
+		resources: []plannedResource{{
+			key:    resourceKey{Group: "apps", Kind: "StatefulSet", Namespace: "prod", Name: "db"},
+			method: syncMethod{command: "replace --force", warning: "deleted and recreated"},
+		}},
+	}}, 1)
+	require.Equal(t, `  wave 0:
+    apps/StatefulSet prod/db: replace --force (deleted and recreated)
+    application/web: apply
+      retry: none
+`, out.String())
+
+	out.Reset()
+	printSyncPlan(&out, nil, 1)
+	require.Equal(t, "  no child Application\n", out.String())
+}
+
+// TestPrintPlannedApp verifies that the retry strategy of an Application is printed with the defaults of Argo CD,
+// along with its hooks and the policies they are deleted by
+func TestPrintPlannedApp(t *testing.T) {
+	migrate := newTestResource("batch/v1", "Job", "migrate", nil)
+	migrate.SetAnnotations(map[string]string{"argocd.argoproj.io/hook": "PreSync"})
+	smoke := newTestResource("batch/v1", "Job", "smoke", nil)
+	smoke.SetNamespace("")
+	smoke.SetAnnotations(map[string]string{
+		"helm.sh/hook":               "post-install,post-upgrade",
+		"helm.sh/hook-delete-policy": "hook-succeeded,hook-failed",
+	})
+	cleanup := newTestResource("batch/v1", "Job", "cleanup", nil)
+	cleanup.SetAnnotations(map[string]string{
+		"argocd.argoproj.io/hook":               "SyncFail",
+		"argocd.argoproj.io/hook-delete-policy": "HookSucceeded",
+	})
+	test := newTestResource("v1", "Pod", "test", nil)
+	test.SetAnnotations(map[string]string{"helm.sh/hook": "test"})
+	resources := []unstructured.Unstructured{
+		migrate, smoke, cleanup, test, newTestResource("v1", "ConfigMap", "web", nil),
+	}
+
+	factor := int64(3)
+	app := argoappv1.Application{Spec: argoappv1.ApplicationSpec{SyncPolicy: &argoappv1.SyncPolicy{
+		Retry: &argoappv1.RetryStrategy{Limit: 5, Backoff: &argoappv1.Backoff{Duration: "10", Factor: &factor}},
+	}}}
+	var out bytes.Buffer
+	printPlannedApp(&out, plannedApp{app: app, hooks: syncHooks(resources, "prod")}, 1)
+	require.Equal(t, `  retry: 5 attempts, backoff 10s x3 up to 3m0s
+  hook Pod default/test: never run, its hook type is not supported by Argo CD
+  hook SyncFail batch/Job default/cleanup: delete policy HookSucceeded
+  hook PreSync batch/Job default/migrate: delete policy BeforeHookCreation (default)
+  hook PostSync batch/Job prod/smoke: delete policy HookFailed,HookSucceeded
+`, out.String())
+
+	app.Spec.SyncPolicy.Retry = &argoappv1.RetryStrategy{Limit: -1, Refresh: true}
+	require.Equal(t, "unlimited attempts, backoff 5s x2 up to 3m0s, retried with the latest revision",
+		retryStrategy(app))
+	app.Spec.SyncPolicy.Retry.Limit = 0
+	require.Equal(t, "none", retryStrategy(app))
+}
+
+// TestSyncWavesOfResources verifies that the resources are planned with the way Argo CD syncs them: replaced or
+// recreated as their sync-options annotation or the sync options of the operation ask
+func TestSyncWavesOfResources(t *testing.T) {
+	withOptions := func(obj unstructured.Unstructured, options string) unstructured.Unstructured {
+		obj.SetAnnotations(map[string]string{"argocd.argoproj.io/sync-options": options})
+		return obj
+	}
+	resources := []unstructured.Unstructured{
+		newTestResource("v1", "Namespace", "prod", nil),
+		withOptions(newTestResource("apps/v1", "StatefulSet", "db", nil), "Replace=true,Force=true"),
+		withOptions(newTestResource("apps/v1", "Deployment", "web", nil), "Replace=true"),
+		withOptions(newTestResource("v1", "ConfigMap", "web", nil), "ServerSideApply=true"),
+		withOptions(newTestResource("batch/v1", "Job", "migrate", nil), "Force=true"),
+		withOptions(newTestResource("batch/v1", "Job", "smoke", nil), "Force=true"),
+		newTestChildApp("child", ""),
+	}
+	resources[5].SetAnnotations(map[string]string{"argocd.argoproj.io/hook": "PostSync"})
+	for i := range resources {
+		// The namespaced resources without namespace are in the destination namespace
+		resources[i].SetNamespace("")
+	}
+
+	methods := func(sync *appSync) map[string]string {
+		waves, err := syncWaves(resources, sync)
+		require.NoError(t, err)
+		require.Len(t, waves, 1)
+		planned := map[string]string{}
+		for _, resource := range waves[0].resources {
+			planned[resource.key.String()] = resource.method.String()
+		}
+		for _, app := range waves[0].apps {
+			planned["application/"+app.app.Name] = app.method.String()
+		}
+		return planned
+	}
+	require.Equal(t, map[string]string{
+		"Namespace prod":           "apply",
+		"apps/StatefulSet prod/db": "replace --force (deleted and recreated)",
+		"apps/Deployment prod/web": "replace (replaced as a whole rather than patched)",
+		"ConfigMap prod/web":       "apply --server-side",
+		"batch/Job prod/migrate":   "apply --force (deleted and recreated when the patch fails)",
+		"application/child":        "apply",
+	}, methods(&appSync{namespace: "prod"}))
+
+	replaced := methods(&appSync{namespace: "prod", options: argoappv1.SyncOptions{"Replace=true"}})
+	require.Equal(t, "update", replaced["Namespace prod"])
+	require.Equal(t, "replace (replaced as a whole rather than patched)", replaced["ConfigMap prod/web"])
+	require.Equal(t, "replace --force (deleted and recreated)", replaced["batch/Job prod/migrate"])
+}
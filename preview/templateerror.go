@@ -0,0 +1,160 @@
+package preview
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+)
+
+// Locations of the errors printed by helm template, the file being prefixed with the name of the chart, e.g.
+// mychart/templates/deployment.yaml. Nested templates, e.g. included ones, print several locations: the last one
+// is where the error is.
+var (
+	// executingErrorPattern matches the errors of the template functions and of nil values,
+	// e.g. template: mychart/templates/deployment.yaml:9:22: executing "..." at <.Values.image.tag>: ...
+	executingErrorPattern = regexp.MustCompile(`template: (\S+?):(\d+):(\d+): executing "[^"]*" at <([^>]*)>: `)
+	// executionErrorPattern matches the errors of fail and required,
+	// e.g. execution error at (mychart/templates/deployment.yaml:9:15): ...
+	executionErrorPattern = regexp.MustCompile(`execution error at \((\S+?):(\d+):(\d+)\): `)
+	// parseErrorPattern matches the syntax errors of the templates,
+	// e.g. parse error at (mychart/templates/deployment.yaml:9): ...
+	parseErrorPattern = regexp.MustCompile(`parse error at \((\S+?):(\d+)\): `)
+	// yamlErrorPattern matches the templates rendering invalid YAML, the line being the one of the rendered template,
+	// e.g. YAML parse error on mychart/templates/deployment.yaml: error converting YAML to JSON: yaml: line 13: ...
+	yamlErrorPattern = regexp.MustCompile(`YAML parse error on (\S+): error converting YAML to JSON: yaml: line (\d+): `)
+	// valuesReferencePattern matches the values referenced by a template action, e.g. .Values.image.tag
+	valuesReferencePattern = regexp.MustCompile(`^\$?\.Values\.([\w.]+)`)
+	// actionValuesPattern matches the first values referenced in the failing action of a template line
+	actionValuesPattern = regexp.MustCompile(`^[^}]*?\$?\.Values\.([\w.]+)`)
+)
+
+// templateError is a helm template error mapped back to the file of the chart and the line where it occurred
+type templateError struct {
+	// file is the template as printed by helm, prefixed with the name of the chart
+	file string
+	// source is the file of the template in the source of the Application: a path in the repository, or in the
+	// chart for the sources of a Helm repository
+	source string
+	line   int
+	column int
+	// rendered is set when line is a line of the rendered template, not of the template itself
+	rendered bool
+	// valuesKey is the key of the values involved, when the failing action references one
+	valuesKey string
+	message   string
+	// snippet is the failing line of the template, when the source is read from a local repository
+	snippet string
+	err     error
+}
+
+// Error implements error, locating the error in the chart
+func (e *templateError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("helm template error in " + e.source)
+	switch {
+	case e.rendered:
+		fmt.Fprintf(&sb, " (line %d of the rendered template)", e.line)
+	case e.column > 0:
+		fmt.Fprintf(&sb, ":%d:%d", e.line, e.column)
+	default:
+		fmt.Fprintf(&sb, ":%d", e.line)
+	}
+	if e.valuesKey != "" {
+		fmt.Fprintf(&sb, " (values key %s)", e.valuesKey)
+	}
+	sb.WriteString(": " + e.message)
+	if e.snippet != "" {
+		fmt.Fprintf(&sb, "\n  %d | %s", e.line, e.snippet)
+	}
+	return sb.String()
+}
+
+// Unwrap returns the error of the repository service
+func (e *templateError) Unwrap() error {
+	return e.err
+}
+
+// mapTemplateError maps a helm template error of a source back to the chart file and line where it occurred,
+// reading the failing line from the local repository when localPath is set. Other errors are returned as is.
+func mapTemplateError(err error, source argoappv1.ApplicationSource, localPath string) error {
+	e := parseTemplateError(err)
+	if e == nil {
+		return err
+	}
+	// The name of the chart is replaced with its path in the source
+	relative := e.file
+	if i := strings.Index(relative, "/"); i >= 0 {
+		relative = relative[i+1:]
+	}
+	if source.Chart != "" {
+		e.source = fmt.Sprintf("chart %s %s: %s", source.Chart, source.TargetRevision, relative)
+		return e
+	}
+	e.source = path.Join(source.Path, relative)
+	if localPath != "" && !e.rendered {
+		e.snippet = templateLine(localPath, source.TargetRevision, e.source, e.line)
+		// The values given to fail or required are found in the failing action
+		if e.valuesKey == "" && e.column > 0 && e.column <= len(e.snippet) {
+			if values := actionValuesPattern.FindStringSubmatch(e.snippet[e.column-1:]); values != nil {
+				e.valuesKey = values[1]
+			}
+		}
+	}
+	return e
+}
+
+// parseTemplateError parses the innermost location of a helm template error, nil when the error has none
+func parseTemplateError(err error) *templateError {
+	msg := err.Error()
+	var e *templateError
+	start, end := -1, -1
+	for _, pattern := range []*regexp.Regexp{
+		executingErrorPattern, executionErrorPattern, parseErrorPattern, yamlErrorPattern,
+	} {
+		for _, m := range pattern.FindAllStringSubmatchIndex(msg, -1) {
+			if m[0] < start {
+				continue
+			}
+			start, end = m[0], m[1]
+			e = &templateError{file: msg[m[2]:m[3]], err: err}
+			e.line, _ = strconv.Atoi(msg[m[4]:m[5]])
+			switch pattern {
+			case executingErrorPattern:
+				e.column, _ = strconv.Atoi(msg[m[6]:m[7]])
+				if values := valuesReferencePattern.FindStringSubmatch(msg[m[8]:m[9]]); values != nil {
+					e.valuesKey = values[1]
+				}
+			case executionErrorPattern:
+				e.column, _ = strconv.Atoi(msg[m[6]:m[7]])
+			case yamlErrorPattern:
+				e.rendered = true
+			}
+		}
+	}
+	if e == nil {
+		return nil
+	}
+	message := msg[end:]
+	if i := strings.Index(message, "\n"); i >= 0 {
+		message = message[:i]
+	}
+	e.message = strings.TrimSpace(message)
+	return e
+}
+
+// templateLine returns a line of a file of a local repository at the rendered revision, empty when not readable
+func templateLine(localPath string, revision string, file string, line int) string {
+	content, err := runGit(localPath, nil, "show", revision+":"+file)
+	if err != nil {
+		return ""
+	}
+	lines := strings.Split(content, "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	return strings.TrimRight(lines[line-1], " \t")
+}
@@ -0,0 +1,86 @@
+package preview
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseTemplateError verifies that the innermost location of the helm template errors is parsed, along with
+// the values key of the failing action
+func TestParseTemplateError(t *testing.T) {
+	e := parseTemplateError(errors.New("failed to execute helm template command: `helm template .` failed exit " +
+		"status 1: Error: template: web/templates/deployment.yaml:9:22: executing \"web/templates/deployment.yaml\" " +
+		"at <.Values.scaling.min.count>: nil pointer evaluating interface {}.min\n\nUse --debug flag"))
+	require.NotNil(t, e)
+	require.Equal(t, "web/templates/deployment.yaml", e.file)
+	require.Equal(t, 9, e.line)
+	require.Equal(t, 22, e.column)
+	require.Equal(t, "scaling.min.count", e.valuesKey)
+	require.Equal(t, "nil pointer evaluating interface {}.min", e.message)
+
+	// The error is located in the included template
+	e = parseTemplateError(errors.New("Error: template: web/templates/service.yaml:4:8: executing " +
+		"\"web/templates/service.yaml\" at <include \"web.labels\" .>: error calling include: template: " +
+		"web/templates/_helpers.tpl:12:3: executing \"web.labels\" at <$.Values.team.name>: nil pointer"))
+	require.Equal(t, "web/templates/_helpers.tpl", e.file)
+	require.Equal(t, 12, e.line)
+	require.Equal(t, "team.name", e.valuesKey)
+	require.Equal(t, "nil pointer", e.message)
+
+	e = parseTemplateError(errors.New("Error: execution error at (web/templates/deployment.yaml:9:15): " +
+		"replicaCount is required"))
+	require.Equal(t, 15, e.column)
+	require.Equal(t, "replicaCount is required", e.message)
+	e = parseTemplateError(errors.New("Error: parse error at (web/templates/deployment.yaml:9): " +
+		"function \"foo\" not defined"))
+	require.Equal(t, 9, e.line)
+	require.Zero(t, e.column)
+	e = parseTemplateError(errors.New("Error: YAML parse error on web/templates/deployment.yaml: error converting " +
+		"YAML to JSON: yaml: line 13: mapping values are not allowed in this context"))
+	require.True(t, e.rendered)
+	e.source = e.file
+	require.Equal(t, "helm template error in web/templates/deployment.yaml (line 13 of the rendered template): "+
+		"mapping values are not allowed in this context", e.Error())
+
+	require.Nil(t, parseTemplateError(errors.New("repository not found")))
+}
+
+// TestMapTemplateError verifies that a helm template error is located in the source of the Application, with the
+// failing line of the local repository
+func TestMapTemplateError(t *testing.T) {
+	dir := initTestRepo(t)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "charts", "web", "templates"), 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "charts", "web", "templates", "deployment.yaml"),
+		[]byte("kind: Deployment\nspec:\n  replicas: {{ required \"replicas are required\" .Values.replicas }}\n"),
+		0o600))
+	_, err := runGit(dir, nil, "add", "--all")
+	require.NoError(t, err)
+	_, err = runGit(dir, []string{
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@localhost",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@localhost",
+	}, "commit", "-q", "-m", "chart")
+	require.NoError(t, err)
+	head, err := resolveLocalRevision(dir)
+	require.NoError(t, err)
+
+	renderErr := errors.New("Error: execution error at (web/templates/deployment.yaml:3:15): replicas are required")
+	source := argoappv1.ApplicationSource{Path: "charts/web", TargetRevision: head}
+	err = mapTemplateError(renderErr, source, dir)
+	require.ErrorIs(t, err, renderErr)
+	require.Equal(t, "helm template error in charts/web/templates/deployment.yaml:3:15 (values key replicas): "+
+		"replicas are required\n"+
+		"  3 |   replicas: {{ required \"replicas are required\" .Values.replicas }}", err.Error())
+
+	// The templates of the charts of a Helm repository are located in the chart
+	source = argoappv1.ApplicationSource{Chart: "web", TargetRevision: "1.2.0"}
+	require.Equal(t, "helm template error in chart web 1.2.0: templates/deployment.yaml:3:15: replicas are required",
+		mapTemplateError(renderErr, source, "").Error())
+
+	other := errors.New("repository not found")
+	require.Equal(t, other, mapTemplateError(other, source, ""))
+}
@@ -0,0 +1,246 @@
+package preview
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Versions of the tools downloaded when not found on the PATH: the Helm version of the Helm Go packages,
+// and the Kustomize version of the Argo CD release
+const (
+	helmToolVersion      = "v3.20.2"
+	kustomizeToolVersion = "v5.7.1"
+)
+
+// toolVersionPattern matches the tool versions which can be downloaded, a version being part of the release URL and
+// of the path of the installed binary
+var toolVersionPattern = regexp.MustCompile(`^v\d+\.\d+\.\d+$`)
+
+// pinnedToolChecksums are the SHA-256 checksums of the release archives by archive name, as the checksums published
+// next to an archive come from the same origin. The Kustomize ones are vendored by Argo CD in hack/installers.
+var pinnedToolChecksums = map[string]string{
+	"kustomize_v5.7.1_darwin_amd64.tar.gz":  "4a0dff80c5644df6bc8f51b342842969004cb6ba5f94dddaabbea7483493273d",
+	"kustomize_v5.7.1_darwin_arm64.tar.gz":  "073e9d16d5a235e2ff83e62d6b76edb5d962adbc33be1e4860c4b3f1f39b33b9",
+	"kustomize_v5.7.1_linux_amd64.tar.gz":   "ea375e7372f9aa029129d4b2d16c66b7750b7f1213c4f66f910d981c895818d8",
+	"kustomize_v5.7.1_linux_arm64.tar.gz":   "4261a040217df3bd6896597c3986d1465925726e4f22a945304b5233a4dcdbda",
+	"kustomize_v5.7.1_linux_ppc64le.tar.gz": "56b6fbf549080b14ddc738f10a05f78cbc5511cd7ab2014d9eb85f52bb4b7263",
+	"kustomize_v5.7.1_linux_s390x.tar.gz":   "b1eee427af74f3bb53d96e3ba94d5cc7484a35bb1af1495488bc684d60df4488",
+}
+
+// allowUnpinnedTools downloads the archives without a pinned checksum, verified against their published checksum
+var allowUnpinnedTools bool
+
+// AllowUnpinnedTools downloads the tool versions without a pinned checksum, trusting the checksum published
+// with their release
+func AllowUnpinnedTools() {
+	allowUnpinnedTools = true
+}
+
+// maxToolArchiveSize bounds the size of a downloaded release archive
+const maxToolArchiveSize = 256 << 20
+
+// tool is a binary used to render manifests, downloaded from its official releases when not found on the PATH
+type tool struct {
+	name    string
+	version string
+	// archiveURL returns the URL of the release archive for an OS and architecture
+	archiveURL func(version string, goos string, goarch string) string
+	// checksumsURL returns the URL of the published SHA-256 checksums of the release archive
+	checksumsURL func(version string, goos string, goarch string) string
+	// member returns the path of the binary in the release archive
+	member func(goos string, goarch string) string
+}
+
+// toolHTTPClient downloads the release archives
+var toolHTTPClient = &http.Client{Timeout: 5 * time.Minute}
+
+// helmTool downloads Helm from get.helm.sh
+var helmTool = tool{
+	name:    "helm",
+	version: helmToolVersion,
+	archiveURL: func(version string, goos string, goarch string) string {
+		return fmt.Sprintf("https://get.helm.sh/helm-%s-%s-%s.tar.gz", version, goos, goarch)
+	},
+	checksumsURL: func(version string, goos string, goarch string) string {
+		return fmt.Sprintf("https://get.helm.sh/helm-%s-%s-%s.tar.gz.sha256sum", version, goos, goarch)
+	},
+	member: func(goos string, goarch string) string {
+		return goos + "-" + goarch + "/helm"
+	},
+}
+
+// newKustomizeTool returns the tool downloading a Kustomize version from its GitHub releases
+func newKustomizeTool(version string) tool {
+	const releases = "https://github.com/kubernetes-sigs/kustomize/releases/download/kustomize%2F"
+	return tool{
+		name:    "kustomize",
+		version: version,
+		archiveURL: func(version string, goos string, goarch string) string {
+			return fmt.Sprintf("%s%s/kustomize_%s_%s_%s.tar.gz", releases, version, version, goos, goarch)
+		},
+		checksumsURL: func(version string, goos string, goarch string) string {
+			return fmt.Sprintf("%s%s/checksums.txt", releases, version)
+		},
+		member: func(goos string, goarch string) string {
+			return "kustomize"
+		},
+	}
+}
+
+// ensureRenderingTools downloads Helm and Kustomize when they are not found on the PATH, and adds them to the PATH
+// used by the repository service. A tool which cannot be downloaded is only reported, the rendering of the sources
+// using it fails later on.
+func ensureRenderingTools() {
+	for _, t := range []tool{helmTool, newKustomizeTool(kustomizeToolVersion)} {
+		if _, err := exec.LookPath(t.name); err == nil {
+			continue
+		}
+		binary, err := t.install(filepath.Join(getCacheDir(), "tools"), runtime.GOOS, runtime.GOARCH)
+		if err != nil {
+			log.Warnf("%s not found on the PATH, and failed to download it: %v", t.name, err)
+			continue
+		}
+		log.Infof("%s not found on the PATH, using %s %s", t.name, binary, t.version)
+		if err := os.Setenv("PATH", filepath.Dir(binary)+string(os.PathListSeparator)+os.Getenv("PATH")); err != nil {
+			log.Warnf("Failed to add %s to the PATH: %v", filepath.Dir(binary), err)
+		}
+	}
+}
+
+// install downloads the release archive of the tool for an OS and architecture, verifies its pinned checksum and
+// extracts the binary, unless already installed. An archive without a pinned checksum is only downloaded when
+// allowed, and verified against its published checksum. Returns the path of the binary.
+func (t tool) install(toolsDir string, goos string, goarch string) (string, error) {
+	if !toolVersionPattern.MatchString(t.version) {
+		return "", fmt.Errorf("invalid %s version %q, expected vX.Y.Z", t.name, t.version)
+	}
+	if goos == "windows" {
+		return "", fmt.Errorf("downloading %s is not supported on %s", t.name, goos)
+	}
+	binary := filepath.Join(toolsDir, fmt.Sprintf("%s-%s-%s-%s", t.name, t.version, goos, goarch), t.name)
+	if _, err := os.Stat(binary); err == nil {
+		return binary, nil
+	}
+
+	archiveURL := t.archiveURL(t.version, goos, goarch)
+	filename := path.Base(archiveURL)
+	pinned, ok := pinnedToolChecksums[filename]
+	if !ok && !allowUnpinnedTools {
+		return "", fmt.Errorf("no pinned checksum of %s, use --allow-unpinned-tools to verify it against "+
+			"its published checksum", filename)
+	}
+	log.Infof("Downloading %s", archiveURL)
+	archive, err := downloadTool(archiveURL)
+	if err != nil {
+		return "", err
+	}
+	checksums := []byte(pinned + "  " + filename)
+	if !ok {
+		if checksums, err = downloadTool(t.checksumsURL(t.version, goos, goarch)); err != nil {
+			return "", err
+		}
+	}
+	if err := verifyChecksum(archive, checksums, filename); err != nil {
+		return "", err
+	}
+	content, err := extractTarGzMember(archive, t.member(goos, goarch))
+	if err != nil {
+		return "", fmt.Errorf("failed to extract %s: %w", t.name, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(binary), 0o750); err != nil {
+		return "", err
+	}
+	// Written to a temporary file then renamed, for the invocations installing the same tool in parallel
+	tmp, err := os.CreateTemp(filepath.Dir(binary), t.name+"-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		_ = tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), 0o755); err != nil { // #nosec G302 - the binary must be executable
+		return "", err
+	}
+	return binary, os.Rename(tmp.Name(), binary)
+}
+
+// downloadTool downloads a release file
+func downloadTool(url string) ([]byte, error) {
+	resp, err := toolHTTPClient.Get(url) // #nosec G107 - URL of the official releases
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxToolArchiveSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	return data, nil
+}
+
+// verifyChecksum verifies the SHA-256 checksum of a file against the checksums published in the sha256sum format,
+// a line without file name being the checksum of the only file
+func verifyChecksum(data []byte, checksums []byte, filename string) error {
+	sum := sha256.Sum256(data)
+	actual := hex.EncodeToString(sum[:])
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || (len(fields) > 1 && strings.TrimPrefix(fields[1], "*") != filename) {
+			continue
+		}
+		if !strings.EqualFold(fields[0], actual) {
+			return fmt.Errorf("checksum mismatch of %s: expected %s, got %s", filename, fields[0], actual)
+		}
+		return nil
+	}
+	return fmt.Errorf("no checksum published for %s", filename)
+}
+
+// extractTarGzMember returns the content of a file of a gzipped tar archive
+func extractTarGzMember(archive []byte, member string) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	reader := tar.NewReader(gz)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s not found in the archive", member)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if path.Clean(header.Name) == member && header.Typeflag == tar.TypeReg {
+			return io.ReadAll(io.LimitReader(reader, maxToolArchiveSize))
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package preview
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newTestToolArchive returns a gzipped tar archive holding a file
+func newTestToolArchive(t *testing.T, name string, content string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	writer := tar.NewWriter(gz)
+	require.NoError(t, writer.WriteHeader(&tar.Header{Name: name, Mode: 0o755, Size: int64(len(content))}))
+	_, err := writer.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+// TestToolInstall verifies the download, checksum verification and extraction of a tool
+func TestToolInstall(t *testing.T) {
+	archive := newTestToolArchive(t, "linux-amd64/helm", "#!/bin/sh\n")
+	sum := sha256.Sum256(archive)
+	checksum := hex.EncodeToString(sum[:])
+	downloads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/helm-v3.0.0-linux-amd64.tar.gz":
+			downloads++
+			_, _ = w.Write(archive)
+		case "/good.sha256sum":
+			fmt.Fprintf(w, "%s  helm-v3.0.0-linux-amd64.tar.gz\n", checksum)
+		case "/bad.sha256sum":
+			fmt.Fprintf(w, "%064d  helm-v3.0.0-linux-amd64.tar.gz\n", 0)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	newTool := func(checksums string) tool {
+		return tool{
+			name:    "helm",
+			version: "v3.0.0",
+			archiveURL: func(version string, goos string, goarch string) string {
+				return fmt.Sprintf("%s/helm-%s-%s-%s.tar.gz", server.URL, version, goos, goarch)
+			},
+			checksumsURL: func(version string, goos string, goarch string) string {
+				return server.URL + "/" + checksums
+			},
+			member: helmTool.member,
+		}
+	}
+	toolsDir := t.TempDir()
+
+	// A version without a pinned checksum is only downloaded when allowed
+	_, err := newTool("good.sha256sum").install(toolsDir, "linux", "amd64")
+	require.ErrorContains(t, err, "no pinned checksum of helm-v3.0.0-linux-amd64.tar.gz")
+	require.Zero(t, downloads)
+
+	// A pinned checksum takes precedence over the published one
+	pinnedToolChecksums["helm-v3.0.0-linux-amd64.tar.gz"] = fmt.Sprintf("%064d", 0)
+	_, err = newTool("good.sha256sum").install(toolsDir, "linux", "amd64")
+	require.ErrorContains(t, err, "checksum mismatch of helm-v3.0.0-linux-amd64.tar.gz")
+	pinnedToolChecksums["helm-v3.0.0-linux-amd64.tar.gz"] = checksum
+	binary, err := newTool("missing.sha256sum").install(t.TempDir(), "linux", "amd64")
+	require.NoError(t, err)
+	require.FileExists(t, binary)
+	delete(pinnedToolChecksums, "helm-v3.0.0-linux-amd64.tar.gz")
+	downloads = 0
+
+	allowUnpinnedTools = true
+	defer func() { allowUnpinnedTools = false }()
+	_, err = newTool("bad.sha256sum").install(toolsDir, "linux", "amd64")
+	require.ErrorContains(t, err, "checksum mismatch of helm-v3.0.0-linux-amd64.tar.gz")
+	_, err = newTool("missing.sha256sum").install(toolsDir, "linux", "amd64")
+	require.ErrorContains(t, err, "404 Not Found")
+
+	binary, err = newTool("good.sha256sum").install(toolsDir, "linux", "amd64")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(toolsDir, "helm-v3.0.0-linux-amd64", "helm"), binary)
+	content, err := os.ReadFile(binary)
+	require.NoError(t, err)
+	require.Equal(t, "#!/bin/sh\n", string(content))
+	info, err := os.Stat(binary)
+	require.NoError(t, err)
+	require.NotZero(t, info.Mode()&0o100)
+
+	// An installed tool is not downloaded again
+	_, err = newTool("good.sha256sum").install(toolsDir, "linux", "amd64")
+	require.NoError(t, err)
+	require.Equal(t, 3, downloads)
+
+	_, err = newTool("good.sha256sum").install(toolsDir, "windows", "amd64")
+	require.ErrorContains(t, err, "not supported on windows")
+
+	// A version which is not vX.Y.Z is not downloaded, nor joined to the tools directory
+	traversal := newTool("good.sha256sum")
+	traversal.version = "../../x"
+	_, err = traversal.install(toolsDir, "linux", "amd64")
+	require.ErrorContains(t, err, `invalid helm version "../../x"`)
+	require.Equal(t, 3, downloads)
+}
+
+// TestVerifyChecksum verifies the lookup of the checksum of a file in the sha256sum format
+func TestVerifyChecksum(t *testing.T) {
+	data := []byte("archive")
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:])
+
+	require.NoError(t, verifyChecksum(data, []byte(checksum+"  other.tar.gz\n"+checksum+"  app.tar.gz\n"), "app.tar.gz"))
+	require.NoError(t, verifyChecksum(data, []byte(checksum+" *app.tar.gz\n"), "app.tar.gz"))
+	require.NoError(t, verifyChecksum(data, []byte(checksum+"\n"), "app.tar.gz"))
+	require.ErrorContains(t, verifyChecksum(data, []byte(checksum+"  other.tar.gz\n"), "app.tar.gz"),
+		"no checksum published for app.tar.gz")
+}
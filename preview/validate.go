@@ -0,0 +1,308 @@
+package preview
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"time"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ValidateOptions holds the settings of the validate commands
+type ValidateOptions struct {
+	// AppName restricts the validation to the Application with this name
+	AppName string
+	// Suppressions is the file listing the known and accepted findings
+	Suppressions string
+	// Policies are the files and directories holding the Kyverno policies and Gatekeeper Constraints to evaluate
+	Policies []string
+	// Projects are the files and directories holding the AppProjects the Applications are validated against
+	Projects []string
+	// ChartKeyring is the keyring the provenance of the Helm charts is verified against, when set
+	ChartKeyring string
+	// EnforceProvenance reports the unsigned and unverifiable Helm charts as errors instead of warnings
+	EnforceProvenance bool
+	// Config is the validation config file, setting the severity of each check category
+	Config string
+	// WarnOnly reports all the findings as warnings, never failing the validation
+	WarnOnly bool
+	// WriteBaseline is the file where a suppression file accepting all the current findings is written
+	WriteBaseline string
+	// SkipList is the file mapping the names of the Applications intentionally not validated to the reason
+	SkipList string
+}
+
+// check inspects the rendered resources of an Application and returns its findings
+type check func(app argoappv1.Application, resources []unstructured.Unstructured) []finding
+
+// checks are the built-in checks run on every rendered Application
+var checks = []check{
+	checkRemovedAPIs,
+	checkImageTags,
+}
+
+// ValidateApplications validates the resources generated from the Applications defined in a manifest
+func ValidateApplications(filename string, opts ValidateOptions) {
+	validate(loadApplications(filename), opts)
+}
+
+// ValidateResources validates the resources generated from the Applications of an ApplicationSet
+func ValidateResources(filename string, opts ValidateOptions) {
+	validate(generateApplications(filename), opts)
+}
+
+// validate renders the Applications, runs the checks on their resources and prints the findings,
+// exiting with status 1 when an error is not accepted by the suppression file
+func validate(apps []argoappv1.Application, opts ValidateOptions) {
+	config, err := loadValidationConfig(opts.Config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	suppressions, err := loadSuppressions(opts.Suppressions)
+	if err != nil {
+		log.Fatal(err)
+	}
+	skipList, err := loadSkipList(opts.SkipList)
+	if err != nil {
+		log.Fatal(err)
+	}
+	appChecks := slices.Clone(checks)
+	if len(opts.Policies) > 0 {
+		policyChecks, err := newPolicyChecks(opts.Policies)
+		if err != nil {
+			log.Fatal(err)
+		}
+		appChecks = append(appChecks, policyChecks...)
+	}
+	if len(opts.Projects) > 0 {
+		if err := enableProjects(opts.Projects); err != nil {
+			log.Fatal(err)
+		}
+		appChecks = append(appChecks, newProjectCheck(currentProjects))
+	}
+	if currentClusters != nil {
+		appChecks = append(appChecks, newAPIAvailabilityCheck(currentClusters))
+	}
+	if shouldMatch(opts.ChartKeyring) {
+		appChecks = append(appChecks, newProvenanceCheck(opts.ChartKeyring, opts.EnforceProvenance))
+	}
+	repoService, err := newRepoService()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// The definitions of all the Applications are checked at once, the ones missing required fields not rendered
+	appFindings := checkApplications(apps, currentClusters)
+
+	selected := func(app argoappv1.Application) bool {
+		return !shouldMatch(opts.AppName) || opts.AppName == app.Name
+	}
+	summary := startRunSummary(countSelected(apps, selected))
+	var findings []finding
+	for i, app := range apps {
+		if !selected(app) {
+			continue
+		}
+		if reason, skipped := skipList.reason(app); skipped {
+			fmt.Printf("application/%s: skipped: %s\n", app.Name, reason)
+			summary.record(appStatusSkipped, nil)
+			continue
+		}
+		findings = append(findings, appFindings[i]...)
+		if !renderable(appFindings[i]) {
+			summary.record(appStatusFailed, nil)
+			continue
+		}
+		if project, err := currentProjects.lookup(app); project != nil && err == nil {
+			fmt.Printf("application/%s: validated against AppProject %s\n", app.Name, project.Name)
+		}
+		rendered, err := generateAppManifests(repoService, app)
+		var schemaErr *valuesSchemaError
+		if errors.As(err, &schemaErr) {
+			findings = append(findings, schemaErr.findings()...)
+			summary.record(appStatusFailed, err)
+			continue
+		}
+		if err != nil {
+			summary.record(appStatusFailed, err)
+			log.Fatal(err)
+		}
+		resources, err := parseManifests(allManifests(rendered))
+		if err != nil {
+			summary.record(appStatusFailed, err)
+			log.Fatal(err)
+		}
+		summary.record(appStatusSucceeded, nil)
+		findings = append(findings, runChecks(app, resources, appChecks)...)
+	}
+	skipList.warnUnused()
+	summary.finish()
+	findings = applySeverities(findings, config, opts.WarnOnly)
+
+	if shouldMatch(opts.WriteBaseline) {
+		file, err := os.Create(opts.WriteBaseline)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		if err := writeBaseline(file, findings); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Baseline of %d finding(s) written to %s\n", len(findings), opts.WriteBaseline)
+		return
+	}
+
+	applySuppressions(findings, suppressions, time.Now())
+	errorCount, warningCount := 0, 0
+	for _, f := range findings {
+		if f.Suppression != nil {
+			continue
+		}
+		if f.Severity == severityError {
+			errorCount++
+		} else {
+			warningCount++
+		}
+		fmt.Printf("application/%s: %s: %s [%s] %s\n", f.App, f.Severity, f.Resource, f.RuleID, f.Message)
+	}
+	for _, s := range unusedSuppressions(suppressions) {
+		log.Infof("Suppression of rule '%s' (app '%s', resource '%s') matched no finding", s.Rule, s.App, s.Resource)
+	}
+	fmt.Printf("%d error(s), %d warning(s), %d suppressed\n",
+		errorCount, warningCount, len(findings)-errorCount-warningCount)
+	if errorCount > 0 {
+		os.Exit(1)
+	}
+}
+
+// runChecks runs the checks on the resources of an Application, returning the findings sorted by resource
+func runChecks(app argoappv1.Application, resources []unstructured.Unstructured, checks []check) []finding {
+	var findings []finding
+	for _, c := range checks {
+		findings = append(findings, c(app, resources)...)
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Resource.String() < findings[j].Resource.String()
+	})
+	return findings
+}
+
+// newPolicyChecks returns the checks evaluating the Kyverno policies and Gatekeeper Constraints
+// defined in the given files and directories
+func newPolicyChecks(paths []string) ([]check, error) {
+	objs, err := loadManifestObjects(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	kyvernoPolicies, err := loadKyvernoPolicies(objs)
+	if err != nil {
+		return nil, err
+	}
+	templates, constraints, err := loadGatekeeperPolicies(objs)
+	if err != nil {
+		return nil, err
+	}
+	var policyChecks []check
+	if len(kyvernoPolicies) > 0 {
+		policyChecks = append(policyChecks, newKyvernoCheck(kyvernoPolicies))
+	}
+	if len(constraints) > 0 {
+		policyChecks = append(policyChecks, newGatekeeperCheck(templates, constraints))
+	}
+	return policyChecks, nil
+}
+
+// removedAPI is an API version which is no longer served by Kubernetes
+type removedAPI struct {
+	replacement string
+	removedIn   string
+}
+
+// removedAPIs are the API versions removed from Kubernetes, by "apiVersion Kind"
+var removedAPIs = map[string]removedAPI{
+	// Removed in Kubernetes 1.16
+	"extensions/v1beta1 Deployment":        {"apps/v1", "1.16"},
+	"extensions/v1beta1 DaemonSet":         {"apps/v1", "1.16"},
+	"extensions/v1beta1 ReplicaSet":        {"apps/v1", "1.16"},
+	"extensions/v1beta1 NetworkPolicy":     {"networking.k8s.io/v1", "1.16"},
+	"extensions/v1beta1 PodSecurityPolicy": {"policy/v1beta1", "1.16"},
+	"apps/v1beta1 Deployment":              {"apps/v1", "1.16"},
+	"apps/v1beta1 StatefulSet":             {"apps/v1", "1.16"},
+	"apps/v1beta2 Deployment":              {"apps/v1", "1.16"},
+	"apps/v1beta2 DaemonSet":               {"apps/v1", "1.16"},
+	"apps/v1beta2 ReplicaSet":              {"apps/v1", "1.16"},
+	"apps/v1beta2 StatefulSet":             {"apps/v1", "1.16"},
+
+	// Removed in Kubernetes 1.22
+	"extensions/v1beta1 Ingress":                                          {"networking.k8s.io/v1", "1.22"},
+	"networking.k8s.io/v1beta1 Ingress":                                   {"networking.k8s.io/v1", "1.22"},
+	"networking.k8s.io/v1beta1 IngressClass":                              {"networking.k8s.io/v1", "1.22"},
+	"apiextensions.k8s.io/v1beta1 CustomResourceDefinition":               {"apiextensions.k8s.io/v1", "1.22"},
+	"admissionregistration.k8s.io/v1beta1 MutatingWebhookConfiguration":   {"admissionregistration.k8s.io/v1", "1.22"},
+	"admissionregistration.k8s.io/v1beta1 ValidatingWebhookConfiguration": {"admissionregistration.k8s.io/v1", "1.22"},
+	"rbac.authorization.k8s.io/v1beta1 ClusterRole":                       {"rbac.authorization.k8s.io/v1", "1.22"},
+	"rbac.authorization.k8s.io/v1beta1 ClusterRoleBinding":                {"rbac.authorization.k8s.io/v1", "1.22"},
+	"rbac.authorization.k8s.io/v1beta1 Role":                              {"rbac.authorization.k8s.io/v1", "1.22"},
+	"rbac.authorization.k8s.io/v1beta1 RoleBinding":                       {"rbac.authorization.k8s.io/v1", "1.22"},
+	"scheduling.k8s.io/v1beta1 PriorityClass":                             {"scheduling.k8s.io/v1", "1.22"},
+	"storage.k8s.io/v1beta1 StorageClass":                                 {"storage.k8s.io/v1", "1.22"},
+	"storage.k8s.io/v1beta1 CSIDriver":                                    {"storage.k8s.io/v1", "1.22"},
+	"certificates.k8s.io/v1beta1 CertificateSigningRequest":               {"certificates.k8s.io/v1", "1.22"},
+	"coordination.k8s.io/v1beta1 Lease":                                   {"coordination.k8s.io/v1", "1.22"},
+
+	// Removed in Kubernetes 1.25
+	"batch/v1beta1 CronJob":                       {"batch/v1", "1.25"},
+	"discovery.k8s.io/v1beta1 EndpointSlice":      {"discovery.k8s.io/v1", "1.25"},
+	"events.k8s.io/v1beta1 Event":                 {"events.k8s.io/v1", "1.25"},
+	"autoscaling/v2beta1 HorizontalPodAutoscaler": {"autoscaling/v2", "1.25"},
+	"policy/v1beta1 PodDisruptionBudget":          {"policy/v1", "1.25"},
+	"policy/v1beta1 PodSecurityPolicy":            {"", "1.25"},
+	"node.k8s.io/v1beta1 RuntimeClass":            {"node.k8s.io/v1", "1.25"},
+
+	// Removed in Kubernetes 1.26
+	"autoscaling/v2beta2 HorizontalPodAutoscaler":                     {"autoscaling/v2", "1.26"},
+	"flowcontrol.apiserver.k8s.io/v1beta1 FlowSchema":                 {"flowcontrol.apiserver.k8s.io/v1", "1.26"},
+	"flowcontrol.apiserver.k8s.io/v1beta1 PriorityLevelConfiguration": {"flowcontrol.apiserver.k8s.io/v1", "1.26"},
+
+	// Removed in Kubernetes 1.27
+	"storage.k8s.io/v1beta1 CSIStorageCapacity": {"storage.k8s.io/v1", "1.27"},
+
+	// Removed in Kubernetes 1.29
+	"flowcontrol.apiserver.k8s.io/v1beta2 FlowSchema":                 {"flowcontrol.apiserver.k8s.io/v1", "1.29"},
+	"flowcontrol.apiserver.k8s.io/v1beta2 PriorityLevelConfiguration": {"flowcontrol.apiserver.k8s.io/v1", "1.29"},
+
+	// Removed in Kubernetes 1.32
+	"flowcontrol.apiserver.k8s.io/v1beta3 FlowSchema":                 {"flowcontrol.apiserver.k8s.io/v1", "1.32"},
+	"flowcontrol.apiserver.k8s.io/v1beta3 PriorityLevelConfiguration": {"flowcontrol.apiserver.k8s.io/v1", "1.32"},
+}
+
+// checkRemovedAPIs reports the resources using an API version which is no longer served by Kubernetes
+func checkRemovedAPIs(app argoappv1.Application, resources []unstructured.Unstructured) []finding {
+	var findings []finding
+	for i := range resources {
+		resource := &resources[i]
+		removed, ok := removedAPIs[resource.GetAPIVersion()+" "+resource.GetKind()]
+		if !ok {
+			continue
+		}
+		message := fmt.Sprintf("%s %s was removed in Kubernetes %s",
+			resource.GetAPIVersion(), resource.GetKind(), removed.removedIn)
+		if removed.replacement != "" {
+			message += ", use " + removed.replacement
+		}
+		findings = append(findings, finding{
+			RuleID:   "removed-api",
+			Category: categoryDeprecatedAPI,
+			App:      app.Name,
+			Resource: newResourceKey(resource),
+			Message:  message,
+		})
+	}
+	return findings
+}
@@ -0,0 +1,55 @@
+package preview
+
+import (
+	"testing"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// TestCheckRemovedAPIs verifies that resources using removed API versions are reported
+func TestCheckRemovedAPIs(t *testing.T) {
+	app := argoappv1.Application{ObjectMeta: metav1.ObjectMeta{Name: "web"}}
+	resources := []unstructured.Unstructured{
+		newTestResource("networking.k8s.io/v1", "Ingress", "current", nil),
+		newTestResource("extensions/v1beta1", "Ingress", "legacy", nil),
+		newTestResource("policy/v1beta1", "PodSecurityPolicy", "restricted", nil),
+	}
+
+	findings := runChecks(app, resources, checks)
+	require.Len(t, findings, 2)
+	require.Equal(t, "extensions/Ingress default/legacy", findings[0].Resource.String())
+	require.Equal(t, "extensions/v1beta1 Ingress was removed in Kubernetes 1.22, use networking.k8s.io/v1",
+		findings[0].Message)
+	require.Equal(t, "policy/PodSecurityPolicy default/restricted", findings[1].Resource.String())
+	require.Equal(t, "policy/v1beta1 PodSecurityPolicy was removed in Kubernetes 1.25", findings[1].Message)
+	require.Equal(t, "removed-api", findings[1].RuleID)
+	require.Equal(t, "web", findings[1].App)
+}
+
+// TestCheckImageTags verifies that the containers using unpinned images are reported
+func TestCheckImageTags(t *testing.T) {
+	app := argoappv1.Application{ObjectMeta: metav1.ObjectMeta{Name: "web"}}
+	deployment := newTestResource("apps/v1", "Deployment", "web", map[string]interface{}{
+		"template": map[string]interface{}{
+			"spec": map[string]interface{}{
+				"initContainers": []interface{}{
+					map[string]interface{}{"name": "init", "image": "registry:5000/busybox"},
+				},
+				"containers": []interface{}{
+					map[string]interface{}{"name": "web", "image": "nginx:1.25"},
+					map[string]interface{}{"name": "sidecar", "image": "envoy:latest"},
+					map[string]interface{}{"name": "digest", "image": "envoy@sha256:0123"},
+				},
+			},
+		},
+	})
+
+	findings := checkImageTags(app, []unstructured.Unstructured{deployment})
+	require.Len(t, findings, 2)
+	require.Equal(t, "image 'registry:5000/busybox' of container 'init' has no tag", findings[0].Message)
+	require.Equal(t, "image 'envoy:latest' of container 'sidecar' uses the latest tag", findings[1].Message)
+	require.Equal(t, categoryImage, findings[1].Category)
+}
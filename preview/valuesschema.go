@@ -0,0 +1,390 @@
+package preview
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/argoproj/argo-cd/v3/pkg/apis/application"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/cli/values"
+	"helm.sh/helm/v3/pkg/getter"
+)
+
+// currentValuesSchema is the check of the Helm values of the ongoing run, nil until the repository service is created
+var currentValuesSchema *valuesSchemaCheck
+
+// enableValuesSchemaOnce installs the check of the Helm values once, for the commands creating several repository
+// services
+var enableValuesSchemaOnce sync.Once
+
+// schemaHTTPClient downloads the schemas referenced by the values schemas, like Helm
+var schemaHTTPClient = &http.Client{Timeout: 15 * time.Second}
+
+// valuesSchemaCheck validates the values of the Helm charts against their values.schema.json right before they are
+// templated, to report every violation along with the path of the offending value instead of the first error of
+// helm template.
+//
+// The helm template command lines are captured through a logrus hook like the debug artifacts: the chart and the
+// values files it uses only exist while the repository service generates the manifests.
+type valuesSchemaCheck struct {
+	mu         sync.Mutex
+	violations []valuesViolation
+}
+
+// valuesViolation is a value of an Application which does not meet the schema of its chart
+type valuesViolation struct {
+	// Chart is the chart whose schema is violated, a dependency of the templated chart for the values of a subchart
+	Chart string
+	// Path is the path of the value, as set with helm --set
+	Path    string
+	Message string
+}
+
+// String returns the violation as reported to the user
+func (v valuesViolation) String() string {
+	return fmt.Sprintf("chart %s: %s: %s", v.Chart, v.Path, v.Message)
+}
+
+// valuesSchemaError is returned when the values of an Application violate the schemas of its charts
+type valuesSchemaError struct {
+	app        string
+	namespace  string
+	violations []valuesViolation
+}
+
+// Error implements error, listing all the violations of the Application
+func (e *valuesSchemaError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "values of Application '%s' don't meet the schema of their chart:", e.app)
+	for _, v := range e.violations {
+		sb.WriteString("\n- " + v.String())
+	}
+	return sb.String()
+}
+
+// findings returns the violations as findings of the validate command
+func (e *valuesSchemaError) findings() []finding {
+	appKey := resourceKey{Group: application.Group, Kind: applicationKind, Namespace: e.namespace, Name: e.app}
+	findings := make([]finding, 0, len(e.violations))
+	for _, v := range e.violations {
+		findings = append(findings, finding{
+			RuleID:   "helm-values-schema",
+			Category: categorySchema,
+			App:      e.app,
+			Resource: appKey,
+			Message:  v.String(),
+		})
+	}
+	return findings
+}
+
+// enableValuesSchemaCheck starts validating the values of the Helm charts templated by the repository service
+func enableValuesSchemaCheck() {
+	enableValuesSchemaOnce.Do(func() {
+		check := &valuesSchemaCheck{}
+		captureCommandLines(check)
+		currentValuesSchema = check
+	})
+}
+
+// start forgets the violations reported so far, before rendering another Application
+func (c *valuesSchemaCheck) start() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.violations = nil
+}
+
+// stop returns the violations reported since start
+func (c *valuesSchemaCheck) stop() []valuesViolation {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	violations := c.violations
+	c.violations = nil
+	return violations
+}
+
+// Levels implements log.Hook
+func (c *valuesSchemaCheck) Levels() []log.Level {
+	return []log.Level{log.InfoLevel}
+}
+
+// Fire implements log.Hook, it validates the values of the helm template commands logged by the Argo CD exec
+// utilities. The failures other than violations are left to helm template, which reports them in turn.
+func (c *valuesSchemaCheck) Fire(entry *log.Entry) error {
+	if _, ok := entry.Data["execID"]; !ok {
+		return nil
+	}
+	chartPath, opts, ok := parseHelmTemplateCommand(entry.Message)
+	if !ok {
+		return nil
+	}
+	dir, _ := entry.Data["dir"].(string)
+	violations, err := validateHelmValues(dir, chartPath, opts)
+	if err != nil {
+		log.Debugf("Not validating the values of chart %s: %v", filepath.Join(dir, chartPath), err)
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.violations = append(c.violations, violations...)
+	return nil
+}
+
+// parseHelmTemplateCommand returns the chart path and the values options of a helm template command line, the
+// arguments being separated by spaces. Returns false for the other commands, and when the schema validation is
+// skipped.
+func parseHelmTemplateCommand(commandLine string) (string, values.Options, bool) {
+	args := strings.Split(commandLine, " ")
+	if len(args) < 3 || filepath.Base(args[0]) != "helm" || args[1] != "template" {
+		return "", values.Options{}, false
+	}
+	var opts values.Options
+	// flagValues are the values of the flag being parsed, nil for the flags not setting values
+	var flagValues *[]string
+	continued := false
+	for _, arg := range args[3:] {
+		if strings.HasPrefix(arg, "--") {
+			flagValues, continued = nil, false
+			switch arg {
+			case "--values":
+				flagValues = &opts.ValueFiles
+			case "--set":
+				flagValues = &opts.Values
+			case "--set-string":
+				flagValues = &opts.StringValues
+			case "--set-file":
+				flagValues = &opts.FileValues
+			case "--skip-schema-validation":
+				return "", values.Options{}, false
+			}
+			continue
+		}
+		if flagValues == nil {
+			continue
+		}
+		// The values holding spaces are split across arguments
+		if continued {
+			(*flagValues)[len(*flagValues)-1] += " " + arg
+			continue
+		}
+		*flagValues = append(*flagValues, arg)
+		continued = true
+	}
+	return args[2], opts, true
+}
+
+// validateHelmValues merges the values of a helm template command like Helm does, and validates them against the
+// schemas of the chart and of its dependencies. The relative paths are relative to the directory of the command.
+func validateHelmValues(dir string, chartPath string, opts values.Options) ([]valuesViolation, error) {
+	chrt, err := loader.Load(absPath(dir, chartPath))
+	if err != nil {
+		return nil, err
+	}
+	if !hasValuesSchema(chrt) {
+		return nil, nil
+	}
+	for i, file := range opts.ValueFiles {
+		if !strings.Contains(file, "://") {
+			opts.ValueFiles[i] = absPath(dir, file)
+		}
+	}
+	for i, fileValue := range opts.FileValues {
+		if key, file, ok := strings.Cut(fileValue, "="); ok {
+			opts.FileValues[i] = key + "=" + absPath(dir, file)
+		}
+	}
+	vals, err := opts.MergeValues(getter.All(cli.New()))
+	if err != nil {
+		return nil, err
+	}
+	if err := chartutil.ProcessDependenciesWithMerge(chrt, vals); err != nil {
+		return nil, err
+	}
+	coalesced, err := chartutil.CoalesceValues(chrt, vals)
+	if err != nil {
+		return nil, err
+	}
+	return validateChartValues(chrt, coalesced, nil)
+}
+
+// absPath returns a path made absolute against a directory
+func absPath(dir string, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// hasValuesSchema tells whether a chart or one of its dependencies ships a values.schema.json
+func hasValuesSchema(chrt *chart.Chart) bool {
+	if chrt.Schema != nil {
+		return true
+	}
+	for _, dependency := range chrt.Dependencies() {
+		if hasValuesSchema(dependency) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateChartValues validates the values of a chart against its schema, then the values of its enabled
+// dependencies against theirs, like chartutil.ValidateAgainstSchema. prefix is the path of the values of the chart
+// in the values of the templated chart.
+func validateChartValues(chrt *chart.Chart, vals map[string]any, prefix []string) ([]valuesViolation, error) {
+	var violations []valuesViolation
+	if chrt.Schema != nil {
+		schema, err := compileValuesSchema(chrt.Schema)
+		if err != nil {
+			return nil, fmt.Errorf("invalid values schema of chart %s: %w", chrt.Name(), err)
+		}
+		err = schema.Validate(vals)
+		if validationErr, ok := err.(*jsonschema.ValidationError); ok {
+			violations = schemaViolations(chrt.Name(), vals, prefix, validationErr)
+			sort.SliceStable(violations, func(i, j int) bool { return violations[i].Path < violations[j].Path })
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	for _, dependency := range chrt.Dependencies() {
+		raw, ok := vals[dependency.Name()]
+		if !ok || raw == nil {
+			continue
+		}
+		path := append(append([]string{}, prefix...), dependency.Name())
+		dependencyVals, ok := raw.(map[string]any)
+		if !ok {
+			violations = append(violations, valuesViolation{
+				Chart:   dependency.Name(),
+				Path:    valuePath(vals, path[len(prefix):], prefix),
+				Message: fmt.Sprintf("invalid type for values: expected object (map), got %T", raw),
+			})
+			continue
+		}
+		dependencyViolations, err := validateChartValues(dependency, dependencyVals, path)
+		if err != nil {
+			return nil, err
+		}
+		violations = append(violations, dependencyViolations...)
+	}
+	return violations, nil
+}
+
+// compileValuesSchema compiles a values.schema.json, with the loaders Helm uses to resolve its references
+func compileValuesSchema(data []byte) (*jsonschema.Schema, error) {
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	compiler := jsonschema.NewCompiler()
+	compiler.UseLoader(jsonschema.SchemeURLLoader{
+		"file":  jsonschema.FileLoader{},
+		"http":  httpSchemaLoader{},
+		"https": httpSchemaLoader{},
+		// Like Helm, the URN references are not resolved and accept any value
+		"urn": urnSchemaLoader{},
+	})
+	if err := compiler.AddResource("file:///values.schema.json", doc); err != nil {
+		return nil, err
+	}
+	return compiler.Compile("file:///values.schema.json")
+}
+
+// httpSchemaLoader downloads the schemas referenced by URL
+type httpSchemaLoader struct{}
+
+// Load implements jsonschema.URLLoader
+func (httpSchemaLoader) Load(url string) (any, error) {
+	resp, err := schemaHTTPClient.Get(url) // #nosec G107 - URL referenced by the chart schema
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: %s", url, resp.Status)
+	}
+	return jsonschema.UnmarshalJSON(resp.Body)
+}
+
+// urnSchemaLoader resolves the URN references to a schema accepting any value
+type urnSchemaLoader struct{}
+
+// Load implements jsonschema.URLLoader
+func (urnSchemaLoader) Load(string) (any, error) {
+	return true, nil
+}
+
+// schemaMessages prints the messages of the violations
+var schemaMessages = message.NewPrinter(language.English)
+
+// schemaViolations returns a violation for each leaf error of a schema validation
+func schemaViolations(
+	chartName string,
+	vals map[string]any,
+	prefix []string,
+	err *jsonschema.ValidationError,
+) []valuesViolation {
+	if len(err.Causes) == 0 {
+		return []valuesViolation{{
+			Chart:   chartName,
+			Path:    valuePath(vals, err.InstanceLocation, prefix),
+			Message: err.ErrorKind.LocalizedString(schemaMessages),
+		}}
+	}
+	var violations []valuesViolation
+	for _, cause := range err.Causes {
+		violations = append(violations, schemaViolations(chartName, vals, prefix, cause)...)
+	}
+	return violations
+}
+
+// valuePath returns the path of a value in the --set syntax of Helm, e.g. ports[0].name, prefixed with the path of
+// the values of the chart. The values tell the array indexes apart from the keys.
+func valuePath(vals map[string]any, location []string, prefix []string) string {
+	path := strings.Join(prefix, ".")
+	var current any = vals
+	for _, token := range location {
+		if items, ok := current.([]any); ok {
+			path += "[" + token + "]"
+			if index, err := strconv.Atoi(token); err == nil && index >= 0 && index < len(items) {
+				current = items[index]
+			} else {
+				current = nil
+			}
+			continue
+		}
+		if path != "" {
+			path += "."
+		}
+		path += token
+		if m, ok := current.(map[string]any); ok {
+			current = m[token]
+		} else {
+			current = nil
+		}
+	}
+	if path == "" {
+		return "(root)"
+	}
+	return path
+}
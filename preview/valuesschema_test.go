@@ -0,0 +1,112 @@
+package preview
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/cli/values"
+)
+
+// writeSchemaChart writes a chart with a values schema, and a subchart with its own schema
+func writeSchemaChart(t *testing.T) string {
+	dir := t.TempDir()
+	files := map[string]string{
+		"Chart.yaml":  "apiVersion: v2\nname: web\nversion: 1.0.0\ndependencies:\n- name: db\n  version: 1.0.0\n",
+		"values.yaml": "replicas: 1\nports:\n- name: http\n  port: 80\n",
+		"values.schema.json": `{"type": "object", "properties": {
+			"replicas": {"type": "integer"},
+			"ports": {"type": "array", "items": {"type": "object", "properties": {"port": {"type": "integer"}}}}}}`,
+		"charts/db/Chart.yaml":         "apiVersion: v2\nname: db\nversion: 1.0.0\n",
+		"charts/db/values.yaml":        "storage: 1Gi\n",
+		"charts/db/values.schema.json": `{"type": "object", "properties": {"storage": {"type": "string", "pattern": "^[0-9]+Gi$"}}}`,
+		"values-prod.yaml":             "replicas: two\ndb:\n  storage: 2Gi\n",
+	}
+	for name, content := range files {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o750))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+	}
+	return dir
+}
+
+// TestValidateHelmValues verifies that the merged values are validated against the schemas of the chart and of its
+// subcharts, each violation reported with the path of its value
+func TestValidateHelmValues(t *testing.T) {
+	dir := writeSchemaChart(t)
+
+	violations, err := validateHelmValues(dir, ".", values.Options{
+		ValueFiles: []string{"values-prod.yaml"},
+		Values:     []string{"ports[0].port=http"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []valuesViolation{
+		{Chart: "web", Path: "ports[0].port", Message: "got string, want integer"},
+		{Chart: "web", Path: "replicas", Message: "got string, want integer"},
+	}, violations)
+
+	// The subchart schema applies to the values of the subchart
+	violations, err = validateHelmValues(dir, ".", values.Options{Values: []string{"db.storage=big"}})
+	require.NoError(t, err)
+	require.Equal(t, []valuesViolation{
+		{Chart: "db", Path: "db.storage", Message: "'big' does not match pattern '^[0-9]+Gi$'"},
+	}, violations)
+}
+
+// TestParseHelmTemplateCommand verifies that the values options are read from a helm template command line
+func TestParseHelmTemplateCommand(t *testing.T) {
+	chartPath, opts, ok := parseHelmTemplateCommand("/usr/bin/helm template . --name-template app " +
+		"--set image.tag=1.0 --set-string note=hello world --values /tmp/v.yaml --api-versions v1 --include-crds")
+	require.True(t, ok)
+	require.Equal(t, ".", chartPath)
+	require.Equal(t, values.Options{
+		ValueFiles:   []string{"/tmp/v.yaml"},
+		Values:       []string{"image.tag=1.0"},
+		StringValues: []string{"note=hello world"},
+	}, opts)
+
+	_, _, ok = parseHelmTemplateCommand("helm template . --name-template app --skip-schema-validation")
+	require.False(t, ok)
+	_, _, ok = parseHelmTemplateCommand("helm dependency build")
+	require.False(t, ok)
+}
+
+// TestValuesSchemaCheckCollectsViolations verifies that the violations of the logged helm template commands are
+// collected until the rendering of the Application is done
+func TestValuesSchemaCheckCollectsViolations(t *testing.T) {
+	dir := writeSchemaChart(t)
+	c := &valuesSchemaCheck{}
+	c.start()
+
+	entry := log.NewEntry(log.StandardLogger()).WithFields(log.Fields{"execID": "abc", "dir": dir})
+	entry.Message = "helm template . --name-template app --values values-prod.yaml"
+	require.NoError(t, c.Fire(entry))
+
+	violations := c.stop()
+	require.Len(t, violations, 1)
+	require.Equal(t, "chart web: replicas: got string, want integer", violations[0].String())
+	require.Empty(t, c.stop())
+
+	var nilCheck *valuesSchemaCheck
+	nilCheck.start()
+	require.Empty(t, nilCheck.stop())
+}
+
+// TestValuesSchemaErrorFindings verifies that each violation is a finding of the schema category
+func TestValuesSchemaErrorFindings(t *testing.T) {
+	err := &valuesSchemaError{app: "web", violations: []valuesViolation{
+		{Chart: "web", Path: "replicas", Message: "got string, want integer"},
+		{Chart: "db", Path: "db.storage", Message: "'big' does not match pattern '^[0-9]+Gi$'"},
+	}}
+	require.Equal(t, "values of Application 'web' don't meet the schema of their chart:\n"+
+		"- chart web: replicas: got string, want integer\n"+
+		"- chart db: db.storage: 'big' does not match pattern '^[0-9]+Gi$'", err.Error())
+
+	findings := err.findings()
+	require.Len(t, findings, 2)
+	require.Equal(t, "helm-values-schema", findings[1].RuleID)
+	require.Equal(t, categorySchema, findings[1].Category)
+	require.Equal(t, "argoproj.io/Application web", findings[1].Resource.String())
+	require.Equal(t, "chart db: db.storage: 'big' does not match pattern '^[0-9]+Gi$'", findings[1].Message)
+}
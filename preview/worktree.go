@@ -0,0 +1,216 @@
+package preview
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// worktreeRef is the ref pointing to the commit snapshotting the working tree.
+// It is a branch so that the commit is part of the default refspec fetched by the repository service
+// from the local repository, it is deleted once the rendering is done. Each process suffixes it with its PID.
+const worktreeRef = "refs/heads/argocd-offline-cli/worktree"
+
+// mergePreviewRef is the ref pointing to the merge commit rendered with --merge-preview, as worktreeRef
+const mergePreviewRef = "refs/heads/argocd-offline-cli/merge-preview"
+
+// processRef returns the ref of the current process for the given ref, e.g. refs/heads/argocd-offline-cli/worktree-42
+// for worktreeRef, so that the invocations running in parallel in a repository do not move each other's refs
+func processRef(ref string) string {
+	return fmt.Sprintf("%s-%d", ref, os.Getpid())
+}
+
+// removeStaleRefs deletes the refs of the processes which exited without deleting them, e.g. killed, the refs of the
+// processes still running being kept. The ref itself, without suffix, was used by the earlier versions.
+func removeStaleRefs(repoPath string, ref string) {
+	refs, err := runGit(repoPath, nil, "for-each-ref", "--format=%(refname)", path.Dir(ref))
+	if err != nil {
+		return
+	}
+	for _, name := range strings.Fields(refs) {
+		if name != ref {
+			suffix, found := strings.CutPrefix(name, ref+"-")
+			pid, err := strconv.Atoi(suffix)
+			if !found || err != nil || processRunning(pid) {
+				continue
+			}
+		}
+		log.Debugf("Deleting the stale ref %s", name)
+		_, _ = runGit(repoPath, nil, "update-ref", "-d", name)
+	}
+}
+
+// processRunning returns true when a process with the given PID is running
+func processRunning(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	// Signal 0 only checks the process exists, it is not supported on Windows where FindProcess fails instead
+	return !errors.Is(process.Signal(syscall.Signal(0)), os.ErrProcessDone)
+}
+
+// commitEnv is the identity of the commits created by argocd-offline-cli
+var commitEnv = []string{
+	"GIT_AUTHOR_NAME=argocd-offline-cli", "GIT_AUTHOR_EMAIL=argocd-offline-cli@localhost",
+	"GIT_COMMITTER_NAME=argocd-offline-cli", "GIT_COMMITTER_EMAIL=argocd-offline-cli@localhost",
+}
+
+// localRevisionOverride, when set, is the revision rendered for local repositories instead of HEAD
+var localRevisionOverride string
+
+// localRevision returns the revision to render for a local repository
+func localRevision(repoPath string) (string, error) {
+	if localRevisionOverride != "" {
+		return localRevisionOverride, nil
+	}
+	return resolveLocalRevision(repoPath)
+}
+
+// runGit runs a git command in the given repository and returns its trimmed output
+func runGit(repoPath string, env []string, args ...string) (string, error) {
+	return runGitWithInput(repoPath, env, nil, args...)
+}
+
+// runGitWithInput runs a git command reading the given input, and returns its trimmed output
+func runGitWithInput(repoPath string, env []string, input []byte, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", repoPath}, args...)...) // #nosec G204 - fixed git subcommands
+	cmd.Env = append(os.Environ(), env...)
+	if input != nil {
+		cmd.Stdin = bytes.NewReader(input)
+	}
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return "", fmt.Errorf("git %s failed: %s", strings.Join(args, " "), strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("git %s failed: %w", strings.Join(args, " "), err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// changedFiles returns the absolute paths of the files changed in the working tree since HEAD,
+// including the untracked files which are not ignored
+func changedFiles(repoPath string) ([]string, error) {
+	modified, err := runGit(repoPath, nil, "diff", "--name-only", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := runGit(repoPath, nil, "ls-files", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, name := range strings.Split(modified+"\n"+untracked, "\n") {
+		if name != "" {
+			files = append(files, filepath.Join(repoPath, name))
+		}
+	}
+	return files, nil
+}
+
+// createWorktreeCommit snapshots the working tree, including untracked files, into a commit
+// without touching the index, the working tree or any branch.
+// The returned cleanup function deletes the ref pointing to the commit, it also runs on log.Fatal.
+func createWorktreeCommit(repoPath string) (string, func(), error) {
+	index, err := os.CreateTemp("", "argocd-offline-cli-index-")
+	if err != nil {
+		return "", nil, err
+	}
+	indexPath := index.Name()
+	_ = index.Close()
+	defer os.Remove(indexPath)
+
+	// Start from the current index so that unchanged files are not hashed again
+	gitDir, err := runGit(repoPath, nil, "rev-parse", "--absolute-git-dir")
+	if err != nil {
+		return "", nil, err
+	}
+	if err := copyFile(filepath.Join(gitDir, "index"), indexPath); err != nil && !os.IsNotExist(err) {
+		return "", nil, err
+	}
+
+	env := []string{"GIT_INDEX_FILE=" + indexPath}
+	if _, err := runGit(repoPath, env, "add", "--all"); err != nil {
+		return "", nil, err
+	}
+	tree, err := runGit(repoPath, env, "write-tree")
+	if err != nil {
+		return "", nil, err
+	}
+	commit, err := runGit(repoPath, commitEnv, "commit-tree", tree, "-p", "HEAD", "-m", "argocd-offline-cli working tree")
+	if err != nil {
+		return "", nil, err
+	}
+	removeStaleRefs(repoPath, worktreeRef)
+	ref := processRef(worktreeRef)
+	if _, err := runGit(repoPath, nil, "update-ref", ref, commit); err != nil {
+		return "", nil, err
+	}
+
+	cleanup := onExit(func() {
+		_, _ = runGit(repoPath, nil, "update-ref", "-d", ref)
+	})
+	return commit, cleanup, nil
+}
+
+// parseMergePreview splits a base..head range into the revision merged into and the merged one
+func parseMergePreview(spec string) (string, string, error) {
+	base, head, found := strings.Cut(spec, "..")
+	if !found || base == "" || head == "" || strings.HasPrefix(head, ".") {
+		return "", "", fmt.Errorf("invalid merge preview '%s', expected base..head", spec)
+	}
+	return base, head, nil
+}
+
+// createMergePreviewCommit creates the commit merging head into base, as the merge of a pull request would,
+// without touching the index, the working tree or any branch.
+// It fails when the merge conflicts. The returned cleanup function deletes the ref pointing to the commit, it also
+// runs on log.Fatal.
+func createMergePreviewCommit(repoPath string, base string, head string) (string, func(), error) {
+	baseCommit, err := runGit(repoPath, nil, "rev-parse", "--verify", "-q", base+"^{commit}")
+	if err != nil {
+		return "", nil, fmt.Errorf("unknown revision '%s'", base)
+	}
+	headCommit, err := runGit(repoPath, nil, "rev-parse", "--verify", "-q", head+"^{commit}")
+	if err != nil {
+		return "", nil, fmt.Errorf("unknown revision '%s'", head)
+	}
+
+	// merge-tree exits with status 1 and lists the conflicting files after the tree when the merge conflicts
+	cmd := exec.Command("git", "-C", repoPath, "merge-tree", "--write-tree", "--name-only", "--no-messages",
+		baseCommit, headCommit) // #nosec G204 - revisions resolved to commits by rev-parse
+	output, err := cmd.Output()
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 && len(lines) > 1 {
+		return "", nil, fmt.Errorf("merging %s into %s conflicts in: %s", head, base, strings.Join(lines[1:], ", "))
+	} else if err != nil {
+		return "", nil, fmt.Errorf("git merge-tree failed (git 2.38 or later is required): %w", err)
+	}
+
+	commit, err := runGit(repoPath, commitEnv, "commit-tree", lines[0], "-p", baseCommit, "-p", headCommit,
+		"-m", fmt.Sprintf("argocd-offline-cli merge preview of %s into %s", head, base))
+	if err != nil {
+		return "", nil, err
+	}
+	removeStaleRefs(repoPath, mergePreviewRef)
+	ref := processRef(mergePreviewRef)
+	if _, err := runGit(repoPath, nil, "update-ref", ref, commit); err != nil {
+		return "", nil, err
+	}
+
+	cleanup := onExit(func() {
+		_, _ = runGit(repoPath, nil, "update-ref", "-d", ref)
+	})
+	return commit, cleanup, nil
+}
@@ -0,0 +1,168 @@
+package preview
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// initTestRepo creates a git repository with a single committed file
+func initTestRepo(t *testing.T) string {
+	dir := t.TempDir()
+	_, err := runGit(dir, nil, "init", "-q")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "committed.yaml"), []byte("a: 1\n"), 0o600))
+	_, err = runGit(dir, nil, "add", "--all")
+	require.NoError(t, err)
+	_, err = runGit(dir, []string{
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@localhost",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@localhost",
+	}, "commit", "-q", "-m", "initial")
+	require.NoError(t, err)
+	return dir
+}
+
+// TestChangedFiles verifies that modified and untracked files are reported
+func TestChangedFiles(t *testing.T) {
+	dir := initTestRepo(t)
+	files, err := changedFiles(dir)
+	require.NoError(t, err)
+	require.Empty(t, files)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "committed.yaml"), []byte("a: 2\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "untracked.yaml"), []byte("b: 1\n"), 0o600))
+	files, err = changedFiles(dir)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{
+		filepath.Join(dir, "committed.yaml"),
+		filepath.Join(dir, "untracked.yaml"),
+	}, files)
+}
+
+// TestCreateWorktreeCommit verifies that the working tree is snapshotted without touching the index or branches
+func TestCreateWorktreeCommit(t *testing.T) {
+	dir := initTestRepo(t)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "committed.yaml"), []byte("a: 2\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "untracked.yaml"), []byte("b: 1\n"), 0o600))
+	head, err := resolveLocalRevision(dir)
+	require.NoError(t, err)
+
+	commit, cleanup, err := createWorktreeCommit(dir)
+	require.NoError(t, err)
+
+	content, err := runGit(dir, nil, "show", commit+":committed.yaml")
+	require.NoError(t, err)
+	require.Equal(t, "a: 2", content)
+	content, err = runGit(dir, nil, "show", commit+":untracked.yaml")
+	require.NoError(t, err)
+	require.Equal(t, "b: 1", content)
+	ref, err := runGit(dir, nil, "rev-parse", processRef(worktreeRef))
+	require.NoError(t, err)
+	require.Equal(t, commit, ref)
+
+	// HEAD and the index are left untouched
+	current, err := resolveLocalRevision(dir)
+	require.NoError(t, err)
+	require.Equal(t, head, current)
+	staged, err := runGit(dir, nil, "diff", "--cached", "--name-only")
+	require.NoError(t, err)
+	require.Empty(t, staged)
+
+	cleanup()
+	_, err = runGit(dir, nil, "rev-parse", "--verify", "-q", processRef(worktreeRef))
+	require.Error(t, err)
+}
+
+// TestParseMergePreview verifies that a base..head range is required
+func TestParseMergePreview(t *testing.T) {
+	base, head, err := parseMergePreview("origin/main..feature")
+	require.NoError(t, err)
+	require.Equal(t, "origin/main", base)
+	require.Equal(t, "feature", head)
+	for _, spec := range []string{"main", "..feature", "main..", "main...feature"} {
+		_, _, err := parseMergePreview(spec)
+		require.Error(t, err, spec)
+	}
+}
+
+// TestCreateMergePreviewCommit verifies that the merge of head into base holds the changes of both, leaving the
+// branches untouched, and that a conflicting merge fails with the conflicting files
+func TestCreateMergePreviewCommit(t *testing.T) {
+	dir := initTestRepo(t)
+	env := []string{
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@localhost",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@localhost",
+	}
+	commitFile := func(name string, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+		_, err := runGit(dir, nil, "add", "--all")
+		require.NoError(t, err)
+		_, err = runGit(dir, env, "commit", "-q", "-m", name)
+		require.NoError(t, err)
+	}
+	_, err := runGit(dir, nil, "branch", "base")
+	require.NoError(t, err)
+	_, err = runGit(dir, nil, "checkout", "-q", "-b", "feature")
+	require.NoError(t, err)
+	commitFile("feature.yaml", "b: 1\n")
+	_, err = runGit(dir, nil, "checkout", "-q", "base")
+	require.NoError(t, err)
+	commitFile("base.yaml", "c: 1\n")
+	baseHead, err := resolveLocalRevision(dir)
+	require.NoError(t, err)
+
+	commit, cleanup, err := createMergePreviewCommit(dir, "base", "feature")
+	require.NoError(t, err)
+	for file, content := range map[string]string{"base.yaml": "c: 1", "feature.yaml": "b: 1", "committed.yaml": "a: 1"} {
+		shown, err := runGit(dir, nil, "show", commit+":"+file)
+		require.NoError(t, err)
+		require.Equal(t, content, shown)
+	}
+	ref, err := runGit(dir, nil, "rev-parse", processRef(mergePreviewRef))
+	require.NoError(t, err)
+	require.Equal(t, commit, ref)
+	current, err := runGit(dir, nil, "rev-parse", "base")
+	require.NoError(t, err)
+	require.Equal(t, baseHead, current)
+	cleanup()
+	_, err = runGit(dir, nil, "rev-parse", "--verify", "-q", processRef(mergePreviewRef))
+	require.Error(t, err)
+
+	commitFile("committed.yaml", "a: 2\n")
+	_, err = runGit(dir, nil, "checkout", "-q", "feature")
+	require.NoError(t, err)
+	commitFile("committed.yaml", "a: 3\n")
+	_, _, err = createMergePreviewCommit(dir, "base", "feature")
+	require.EqualError(t, err, "merging feature into base conflicts in: committed.yaml")
+	_, _, err = createMergePreviewCommit(dir, "base", "missing")
+	require.EqualError(t, err, "unknown revision 'missing'")
+}
+
+// TestRemoveStaleRefs verifies that the refs of the processes which exited are deleted, the refs of the processes
+// still running and the other refs being kept
+func TestRemoveStaleRefs(t *testing.T) {
+	dir := initTestRepo(t)
+	exited := exec.Command("true")
+	require.NoError(t, exited.Run())
+	refs := []string{
+		mergePreviewRef,
+		fmt.Sprintf("%s-%d", mergePreviewRef, exited.Process.Pid),
+		processRef(mergePreviewRef),
+		worktreeRef + "-1",
+		mergePreviewRef + "-main",
+	}
+	for _, ref := range refs {
+		_, err := runGit(dir, nil, "update-ref", ref, "HEAD")
+		require.NoError(t, err)
+	}
+
+	removeStaleRefs(dir, mergePreviewRef)
+	remaining, err := runGit(dir, nil, "for-each-ref", "--format=%(refname)", "refs/heads/argocd-offline-cli/")
+	require.NoError(t, err)
+	require.ElementsMatch(t, refs[2:], strings.Fields(remaining))
+}